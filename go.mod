@@ -30,6 +30,7 @@ require (
 	github.com/rubenv/sql-migrate v0.0.0-20190618074426-f4d34eae5a5c
 	github.com/satori/go.uuid v1.2.0
 	github.com/sergi/go-diff v1.0.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/cobra v0.0.5
 	github.com/stripe/stripe-go v61.7.1+incompatible
 	github.com/ziutek/mymysql v1.5.4 // indirect
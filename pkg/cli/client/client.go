@@ -26,6 +26,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -38,11 +40,25 @@ import (
 // ErrInvalidLogin is an error for invalid credentials for login
 var ErrInvalidLogin = errors.New("wrong credentials")
 
+// ErrInvalidTwoFactorCode is an error for a wrong two-factor code, or a sign in that has expired
+var ErrInvalidTwoFactorCode = errors.New("wrong two-factor code, or the sign in has expired")
+
 // requestOptions contians options for requests
 type requestOptions struct {
 	HTTPClient *http.Client
 }
 
+// getUserAgent returns the user agent of the CLI, including the hostname so that
+// the sessions of different machines can be told apart in the server.
+func getUserAgent(ctx context.NadCtx) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return fmt.Sprintf("nad-cli/%s (%s)", ctx.Version, runtime.GOOS)
+	}
+
+	return fmt.Sprintf("nad-cli/%s (%s; %s)", ctx.Version, runtime.GOOS, hostname)
+}
+
 func getReq(ctx context.NadCtx, path, method, body string) (*http.Request, error) {
 	endpoint := fmt.Sprintf("%s%s", ctx.APIEndpoint, path)
 	req, err := http.NewRequest(method, endpoint, strings.NewReader(body))
@@ -52,6 +68,7 @@ func getReq(ctx context.NadCtx, path, method, body string) (*http.Request, error
 
 	req.Header.Set("CLI-Version", ctx.Version)
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", getUserAgent(ctx))
 
 	if ctx.SessionKey != "" {
 		credential := fmt.Sprintf("Bearer %s", ctx.SessionKey)
@@ -155,19 +172,23 @@ type SyncFragNote struct {
 	EditedOn  int64     `json:"edited_on"`
 	Body      string    `json:"content"`
 	Public    bool      `json:"public"`
+	Encrypted bool      `json:"encrypted"`
 	Deleted   bool      `json:"deleted"`
+	Tags      []string  `json:"tags"`
 }
 
 // SyncFragBook represents a book in a sync fragment and contains only the necessary information
 // for the client to sync the note locally
 type SyncFragBook struct {
-	UUID      string    `json:"uuid"`
-	USN       int       `json:"usn"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	AddedOn   int64     `json:"added_on"`
-	Name      string    `json:"name"`
-	Deleted   bool      `json:"deleted"`
+	UUID       string    `json:"uuid"`
+	USN        int       `json:"usn"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	AddedOn    int64     `json:"added_on"`
+	Name       string    `json:"name"`
+	ParentUUID string    `json:"parent_uuid"`
+	Encrypted  bool      `json:"encrypted"`
+	Deleted    bool      `json:"deleted"`
 }
 
 // SyncFragment contains a piece of information about the server's state.
@@ -210,23 +231,29 @@ func GetSyncFragment(ctx context.NadCtx, afterUSN int) (GetSyncFragmentResp, err
 
 // RespBook is the book in the response from the create book api
 type RespBook struct {
-	ID        int       `json:"id"`
-	UUID      string    `json:"uuid"`
-	USN       int       `json:"usn"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Name      string    `json:"name"`
+	ID         int       `json:"id"`
+	UUID       string    `json:"uuid"`
+	USN        int       `json:"usn"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Name       string    `json:"name"`
+	ParentUUID string    `json:"parent_uuid"`
 }
 
 // CreateBookPayload is a payload for creating a book
 type CreateBookPayload struct {
-	Name string `json:"name"`
+	Name       string `json:"name"`
+	ParentUUID string `json:"parent_uuid"`
+	Encrypted  bool   `json:"encrypted"`
 }
 
-// CreateBook creates a new book in the server
-func CreateBook(ctx context.NadCtx, name string) (RespBook, error) {
+// CreateBook creates a new book in the server under the book with the given
+// parent uuid. An empty parent uuid creates a top-level book.
+func CreateBook(ctx context.NadCtx, name, parentUUID string, encrypted bool) (RespBook, error) {
 	payload := CreateBookPayload{
-		Name: name,
+		Name:       name,
+		ParentUUID: parentUUID,
+		Encrypted:  encrypted,
 	}
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -247,7 +274,9 @@ func CreateBook(ctx context.NadCtx, name string) (RespBook, error) {
 }
 
 type updateBookPayload struct {
-	Name *string `json:"name"`
+	Name       *string `json:"name"`
+	ParentUUID *string `json:"parent_uuid"`
+	Encrypted  *bool   `json:"encrypted"`
 }
 
 // UpdateBookResp is the response from create book api
@@ -256,9 +285,11 @@ type UpdateBookResp struct {
 }
 
 // UpdateBook updates a book in the server
-func UpdateBook(ctx context.NadCtx, name, uuid string) (UpdateBookResp, error) {
+func UpdateBook(ctx context.NadCtx, name, parentUUID, uuid string, encrypted bool) (UpdateBookResp, error) {
 	payload := updateBookPayload{
-		Name: &name,
+		Name:       &name,
+		ParentUUID: &parentUUID,
+		Encrypted:  &encrypted,
 	}
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -303,8 +334,10 @@ func DeleteBook(ctx context.NadCtx, uuid string) (DeleteBookResp, error) {
 
 // CreateNotePayload is a payload for creating a note
 type CreateNotePayload struct {
-	BookUUID string `json:"book_uuid"`
-	Body     string `json:"content"`
+	BookUUID  string   `json:"book_uuid"`
+	Body      string   `json:"content"`
+	Tags      []string `json:"tags"`
+	Encrypted bool     `json:"encrypted"`
 }
 
 // CreateNoteResp is the response from create note endpoint
@@ -329,16 +362,20 @@ type RespNote struct {
 	Body      string       `json:"content"`
 	AddedOn   int64        `json:"added_on"`
 	Public    bool         `json:"public"`
+	Encrypted bool         `json:"encrypted"`
 	USN       int          `json:"usn"`
+	Tags      []string     `json:"tags"`
 	Book      respNoteBook `json:"book"`
 	User      respNoteUser `json:"user"`
 }
 
 // CreateNote creates a note in the server
-func CreateNote(ctx context.NadCtx, bookUUID, content string) (CreateNoteResp, error) {
+func CreateNote(ctx context.NadCtx, bookUUID, content string, tags []string, encrypted bool) (CreateNoteResp, error) {
 	payload := CreateNotePayload{
-		BookUUID: bookUUID,
-		Body:     content,
+		BookUUID:  bookUUID,
+		Body:      content,
+		Tags:      tags,
+		Encrypted: encrypted,
 	}
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -359,9 +396,11 @@ func CreateNote(ctx context.NadCtx, bookUUID, content string) (CreateNoteResp, e
 }
 
 type updateNotePayload struct {
-	BookUUID *string `json:"book_uuid"`
-	Body     *string `json:"content"`
-	Public   *bool   `json:"public"`
+	BookUUID  *string   `json:"book_uuid"`
+	Body      *string   `json:"content"`
+	Public    *bool     `json:"public"`
+	Encrypted *bool     `json:"encrypted"`
+	Tags      *[]string `json:"tags"`
 }
 
 // UpdateNoteResp is the response from create book api
@@ -371,11 +410,13 @@ type UpdateNoteResp struct {
 }
 
 // UpdateNote updates a note in the server
-func UpdateNote(ctx context.NadCtx, uuid, bookUUID, content string, public bool) (UpdateNoteResp, error) {
+func UpdateNote(ctx context.NadCtx, uuid, bookUUID, content string, public bool, tags []string, encrypted bool) (UpdateNoteResp, error) {
 	payload := updateNotePayload{
-		BookUUID: &bookUUID,
-		Body:     &content,
-		Public:   &public,
+		BookUUID:  &bookUUID,
+		Body:      &content,
+		Public:    &public,
+		Encrypted: &encrypted,
+		Tags:      &tags,
 	}
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -418,6 +459,218 @@ func DeleteNote(ctx context.NadCtx, uuid string) (DeleteNoteResp, error) {
 	return resp, nil
 }
 
+// RespNoteRevision is a note revision in the response from the server
+type RespNoteRevision struct {
+	UUID      string    `json:"uuid"`
+	CreatedAt time.Time `json:"created_at"`
+	BookUUID  string    `json:"book_uuid"`
+	Body      string    `json:"content"`
+	EditedOn  int64     `json:"edited_on"`
+	USN       int       `json:"usn"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// GetNoteRevisionsResp is a response from the note revisions endpoint
+type GetNoteRevisionsResp []RespNoteRevision
+
+// GetNoteRevisions gets the revisions of a note from the server, the most recent first
+func GetNoteRevisions(ctx context.NadCtx, uuid string) (GetNoteRevisionsResp, error) {
+	endpoint := fmt.Sprintf("/v1/notes/%s/revisions", uuid)
+	res, err := doAuthorizedReq(ctx, "GET", endpoint, "", nil)
+	if err != nil {
+		return GetNoteRevisionsResp{}, errors.Wrap(err, "making http request")
+	}
+
+	var resp GetNoteRevisionsResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return GetNoteRevisionsResp{}, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
+// EncryptionResp is the response from the encryption endpoint. Both fields
+// are empty if the encryption has not been set up.
+type EncryptionResp struct {
+	Salt     string `json:"salt"`
+	KeyCheck string `json:"key_check"`
+}
+
+// GetEncryption gets the encryption settings of the user from the server
+func GetEncryption(ctx context.NadCtx) (EncryptionResp, error) {
+	res, err := doAuthorizedReq(ctx, "GET", "/v1/encryption", "", nil)
+	if err != nil {
+		return EncryptionResp{}, errors.Wrap(err, "making http request")
+	}
+
+	var resp EncryptionResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return EncryptionResp{}, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
+type setEncryptionPayload struct {
+	Salt     string `json:"salt"`
+	KeyCheck string `json:"key_check"`
+}
+
+// SetEncryption sets up the encryption for the user in the server with the given
+// salt and key check, both encoded in base64
+func SetEncryption(ctx context.NadCtx, salt, keyCheck string) (EncryptionResp, error) {
+	payload := setEncryptionPayload{
+		Salt:     salt,
+		KeyCheck: keyCheck,
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return EncryptionResp{}, errors.Wrap(err, "marshaling payload")
+	}
+
+	res, err := doAuthorizedReq(ctx, "PUT", "/v1/encryption", string(b), nil)
+	if err != nil {
+		return EncryptionResp{}, errors.Wrap(err, "making http request")
+	}
+
+	var resp EncryptionResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return EncryptionResp{}, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
+// AccessTokenResp is an access token in the responses from the access token endpoints
+type AccessTokenResp struct {
+	ID         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// GetAccessTokens gets the access tokens of the user from the server
+func GetAccessTokens(ctx context.NadCtx) ([]AccessTokenResp, error) {
+	res, err := doAuthorizedReq(ctx, "GET", "/v1/tokens", "", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "making http request")
+	}
+
+	var resp []AccessTokenResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
+type createAccessTokenPayload struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+// CreateAccessTokenResp is the response from creating an access token
+type CreateAccessTokenResp struct {
+	Token AccessTokenResp `json:"token"`
+	Key   string          `json:"key"`
+}
+
+// CreateAccessToken creates an access token in the server. expiresIn is the number of
+// days until the token expires, and zero means no expiry.
+func CreateAccessToken(ctx context.NadCtx, name string, scopes []string, expiresIn int) (CreateAccessTokenResp, error) {
+	payload := createAccessTokenPayload{
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresIn: expiresIn,
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return CreateAccessTokenResp{}, errors.Wrap(err, "marshaling payload")
+	}
+
+	res, err := doAuthorizedReq(ctx, "POST", "/v1/tokens", string(b), nil)
+	if err != nil {
+		return CreateAccessTokenResp{}, errors.Wrap(err, "making http request")
+	}
+
+	var resp CreateAccessTokenResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return CreateAccessTokenResp{}, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
+// DeleteAccessToken revokes the access token with the given id in the server
+func DeleteAccessToken(ctx context.NadCtx, id uint) error {
+	endpoint := fmt.Sprintf("/v1/tokens/%d", id)
+	if _, err := doAuthorizedReq(ctx, "DELETE", endpoint, "", nil); err != nil {
+		return errors.Wrap(err, "making http request")
+	}
+
+	return nil
+}
+
+// SessionResp is a session in the responses from the session endpoints
+type SessionResp struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+}
+
+// GetSessions gets the sessions of the user from the server
+func GetSessions(ctx context.NadCtx) ([]SessionResp, error) {
+	res, err := doAuthorizedReq(ctx, "GET", "/v1/sessions", "", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "making http request")
+	}
+
+	var resp []SessionResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
+// DeleteSession revokes the session with the given id in the server
+func DeleteSession(ctx context.NadCtx, id uint) error {
+	endpoint := fmt.Sprintf("/v1/sessions/%d", id)
+	if _, err := doAuthorizedReq(ctx, "DELETE", endpoint, "", nil); err != nil {
+		return errors.Wrap(err, "making http request")
+	}
+
+	return nil
+}
+
+// deleteSessionsResp is the response from revoking sessions
+type deleteSessionsResp struct {
+	Count int64 `json:"count"`
+}
+
+// DeleteOtherSessions revokes all sessions of the user except the current one in
+// the server, and returns the number of the revoked sessions
+func DeleteOtherSessions(ctx context.NadCtx) (int64, error) {
+	res, err := doAuthorizedReq(ctx, "DELETE", "/v1/sessions", "", nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "making http request")
+	}
+
+	var resp deleteSessionsResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return 0, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp.Count, nil
+}
+
 // GetBooksResp is a response from get books endpoint
 type GetBooksResp []struct {
 	UUID string `json:"uuid"`
@@ -445,10 +698,14 @@ type SigninPayload struct {
 	Passowrd string `json:"password"`
 }
 
-// SigninResponse is a response from /v1/login endpoint
+// SigninResponse is a response from /v1/login endpoint. If the user has
+// enabled two-factor authentication, TwoFactorRequired is set instead of a
+// session, and the sign in is completed by SigninTwoFactor.
 type SigninResponse struct {
-	Key       string `json:"key"`
-	ExpiresAt int64  `json:"expires_at"`
+	Key               string `json:"key"`
+	ExpiresAt         int64  `json:"expires_at"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	TwoFactorToken    string `json:"two_factor_token"`
 }
 
 // Signin requests a session token
@@ -478,6 +735,69 @@ func Signin(ctx context.NadCtx, email, password string) (SigninResponse, error)
 	return resp, nil
 }
 
+// SigninTwoFactorPayload is a payload for /v1/login/2fa
+type SigninTwoFactorPayload struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
+// SigninTwoFactor completes a sign in with a code from an authenticator app
+// or a recovery code, and requests a session token
+func SigninTwoFactor(ctx context.NadCtx, token, code string) (SigninResponse, error) {
+	payload := SigninTwoFactorPayload{
+		Token: token,
+		Code:  code,
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return SigninResponse{}, errors.Wrap(err, "marshaling payload")
+	}
+	res, err := doReq(ctx, "POST", "/v1/login/2fa", string(b), nil)
+	if err != nil {
+		if res != nil && res.StatusCode == http.StatusBadRequest {
+			return SigninResponse{}, ErrInvalidTwoFactorCode
+		}
+
+		return SigninResponse{}, errors.Wrap(err, "making http request")
+	}
+
+	var resp SigninResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return SigninResponse{}, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
+// SigninOIDCPayload is a payload for /v1/login/oidc
+type SigninOIDCPayload struct {
+	Code string `json:"code"`
+}
+
+// SigninOIDC exchanges the code that the server sent to the CLI after a
+// single sign-on for a session token. As with Signin, TwoFactorRequired is set
+// instead if the user has enabled two-factor authentication.
+func SigninOIDC(ctx context.NadCtx, code string) (SigninResponse, error) {
+	payload := SigninOIDCPayload{
+		Code: code,
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return SigninResponse{}, errors.Wrap(err, "marshaling payload")
+	}
+	res, err := doReq(ctx, "POST", "/v1/login/oidc", string(b), nil)
+	if err != nil {
+		return SigninResponse{}, errors.Wrap(err, "making http request")
+	}
+
+	var resp SigninResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return SigninResponse{}, errors.Wrap(err, "decoding payload")
+	}
+
+	return resp, nil
+}
+
 // Signout deletes a user session on the server side
 func Signout(ctx context.NadCtx, sessionKey string) error {
 	hc := http.Client{
@@ -19,7 +19,6 @@
 package add
 
 import (
-	"database/sql"
 	"time"
 
 	"github.com/nadproject/nad/pkg/cli/context"
@@ -36,13 +35,20 @@ import (
 )
 
 var contentFlag string
+var tagFlag []string
 
 var example = `
  * Open an editor to write content
  nad add git
 
  * Skip the editor by providing content directly
- nad add git -c "time is a part of the commit hash"`
+ nad add git -c "time is a part of the commit hash"
+
+ * Tag the note
+ nad add git -c "time is a part of the commit hash" --tag internals --tag hash
+
+ * Add to a nested book, creating the books in the path as needed
+ nad add work/infra/k8s -c "kubectl rollout undo rolls back a deployment"`
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) != 1 {
@@ -65,6 +71,7 @@ func NewCmd(ctx context.NadCtx) *cobra.Command {
 
 	f := cmd.Flags()
 	f.StringVarP(&contentFlag, "content", "c", "", "The new content for the note")
+	f.StringSliceVarP(&tagFlag, "tag", "t", nil, "A tag for the note. Can be repeated or given as a comma-separated list")
 
 	return cmd
 }
@@ -90,9 +97,12 @@ func getContent(ctx context.NadCtx) (string, error) {
 func newRun(ctx context.NadCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
 		bookName := args[0]
-		if err := validate.BookName(bookName); err != nil {
+		if err := validate.BookPath(bookName); err != nil {
 			return errors.Wrap(err, "invalid book name")
 		}
+		if err := validate.TagNames(tagFlag); err != nil {
+			return err
+		}
 
 		content, err := getContent(ctx)
 		if err != nil {
@@ -103,7 +113,7 @@ func newRun(ctx context.NadCtx) infra.RunEFunc {
 		}
 
 		ts := time.Now().UnixNano()
-		noteRowID, err := writeNote(ctx, bookName, content, ts)
+		noteRowID, err := writeNote(ctx, bookName, content, ts, tagFlag)
 		if err != nil {
 			return errors.Wrap(err, "Failed to write note")
 		}
@@ -126,24 +136,15 @@ func newRun(ctx context.NadCtx) infra.RunEFunc {
 	}
 }
 
-func writeNote(ctx context.NadCtx, bookLabel string, content string, ts int64) (int, error) {
+func writeNote(ctx context.NadCtx, bookLabel string, content string, ts int64, tags []string) (int, error) {
 	tx, err := ctx.DB.Begin()
 	if err != nil {
 		return 0, errors.Wrap(err, "beginning a transaction")
 	}
 
-	var bookUUID string
-	err = tx.QueryRow("SELECT uuid FROM books WHERE name = ?", bookLabel).Scan(&bookUUID)
-	if err == sql.ErrNoRows {
-		bookUUID = utils.GenerateUUID()
-
-		b := database.NewBook(bookUUID, bookLabel, 0, false, true)
-		err = b.Insert(tx)
-		if err != nil {
-			tx.Rollback()
-			return 0, errors.Wrap(err, "creating the book")
-		}
-	} else if err != nil {
+	bookUUID, err := database.FindOrCreateBook(tx, bookLabel)
+	if err != nil {
+		tx.Rollback()
 		return 0, errors.Wrap(err, "finding the book")
 	}
 
@@ -156,6 +157,11 @@ func writeNote(ctx context.NadCtx, bookLabel string, content string, ts int64) (
 		return 0, errors.Wrap(err, "creating the note")
 	}
 
+	if err := database.SetNoteTags(tx, noteUUID, tags); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "tagging the note")
+	}
+
 	var noteRowID int
 	err = tx.QueryRow(`SELECT notes.rowid
 			FROM notes
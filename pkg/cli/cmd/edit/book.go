@@ -21,6 +21,7 @@ package edit
 import (
 	"strings"
 
+	"github.com/nadproject/nad/pkg/cli/consts"
 	"github.com/nadproject/nad/pkg/cli/context"
 	"github.com/nadproject/nad/pkg/cli/database"
 	"github.com/nadproject/nad/pkg/cli/log"
@@ -34,9 +35,6 @@ func validateRunBookFlags() error {
 	if contentFlag != "" {
 		return errors.New("--content is invalid for editing a book")
 	}
-	if bookFlag != "" {
-		return errors.New("--book is invalid for editing a book")
-	}
 
 	return nil
 }
@@ -72,6 +70,89 @@ func getName(ctx context.NadCtx) (string, error) {
 	return c, nil
 }
 
+// getParentUUID returns the uuid of the book to move a book to. A slash
+// denotes the top level.
+func getParentUUID(db *database.DB, path string) (string, error) {
+	if strings.Trim(path, consts.BookPathSeparator) == "" {
+		return "", nil
+	}
+
+	uuid, err := database.GetBookUUID(db, path)
+	if err != nil {
+		return "", errors.Wrap(err, "finding the destination book")
+	}
+
+	return uuid, nil
+}
+
+func moveBookTo(tx *database.DB, book database.BookInfo, path string) error {
+	var parentUUID string
+	if err := tx.QueryRow("SELECT parent_uuid FROM books WHERE uuid = ?", book.UUID).Scan(&parentUUID); err != nil {
+		return errors.Wrap(err, "getting the current parent")
+	}
+
+	targetUUID, err := getParentUUID(tx, path)
+	if err != nil {
+		return err
+	}
+	if targetUUID == parentUUID {
+		return errors.New("Nothing changed")
+	}
+
+	isAncestor, err := database.IsBookAncestor(tx, book.UUID, targetUUID)
+	if err != nil {
+		return errors.Wrap(err, "checking the destination book")
+	}
+	if isAncestor {
+		return errors.New("cannot move a book into itself or its descendant")
+	}
+
+	if err := ensureNameAvailable(tx, book.UUID, targetUUID, book.Name); err != nil {
+		return err
+	}
+
+	if err := database.UpdateBookParent(tx, book.UUID, targetUUID); err != nil {
+		return errors.Wrap(err, "moving the book")
+	}
+
+	return nil
+}
+
+func renameBook(tx *database.DB, book database.BookInfo, name string) error {
+	if err := validate.BookName(name); err != nil {
+		return errors.Wrap(err, "validating book name")
+	}
+
+	var parentUUID string
+	if err := tx.QueryRow("SELECT parent_uuid FROM books WHERE uuid = ?", book.UUID).Scan(&parentUUID); err != nil {
+		return errors.Wrap(err, "getting the current parent")
+	}
+
+	if err := ensureNameAvailable(tx, book.UUID, parentUUID, name); err != nil {
+		return err
+	}
+
+	if err := database.UpdateBookName(tx, book.UUID, name); err != nil {
+		return errors.Wrap(err, "updating the book name")
+	}
+
+	return nil
+}
+
+// ensureNameAvailable returns an error if the book with the given parent
+// already has a child, other than the given book, with the given name
+func ensureNameAvailable(tx *database.DB, uuid, parentUUID, name string) error {
+	var count int
+	if err := tx.QueryRow("SELECT count(*) FROM books WHERE parent_uuid = ? AND name = ? AND uuid != ?", parentUUID, name, uuid).Scan(&count); err != nil {
+		return errors.Wrap(err, "checking the book name")
+	}
+	if count > 0 {
+		return errors.Errorf("book '%s' already exists in the destination", name)
+	}
+
+	return nil
+}
+
 func runBook(ctx context.NadCtx, bookName string) error {
 	err := validateRunBookFlags()
 	if err != nil {
@@ -84,14 +165,13 @@ func runBook(ctx context.NadCtx, bookName string) error {
 		return errors.Wrap(err, "getting book uuid")
 	}
 
-	name, err := getName(ctx)
-	if err != nil {
-		return errors.Wrap(err, "getting name")
-	}
-
-	err = validate.BookName(name)
-	if err != nil {
-		return errors.Wrap(err, "validating book name")
+	// Moving a book does not require a new name.
+	var name string
+	if bookFlag == "" || nameFlag != "" {
+		name, err = getName(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting name")
+		}
 	}
 
 	tx, err := ctx.DB.Begin()
@@ -99,13 +179,29 @@ func runBook(ctx context.NadCtx, bookName string) error {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	err = database.UpdateBookName(tx, uuid, name)
+	bookInfo, err := database.GetBookInfo(tx, uuid)
 	if err != nil {
 		tx.Rollback()
-		return errors.Wrap(err, "updating the book name")
+		return errors.Wrap(err, "getting book info")
 	}
 
-	bookInfo, err := database.GetBookInfo(tx, uuid)
+	if name != "" || bookFlag == "" {
+		if err := renameBook(tx, bookInfo, name); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		bookInfo.Name = name
+	}
+
+	if bookFlag != "" {
+		if err := moveBookTo(tx, bookInfo, bookFlag); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	bookInfo, err = database.GetBookInfo(tx, uuid)
 	if err != nil {
 		tx.Rollback()
 		return errors.Wrap(err, "getting book info")
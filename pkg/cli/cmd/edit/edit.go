@@ -30,6 +30,8 @@ import (
 var contentFlag string
 var bookFlag string
 var nameFlag string
+var publicFlag bool
+var tagFlag []string
 
 var example = `
   * Edit a note by id
@@ -41,17 +43,38 @@ var example = `
   * Move a note to another book
   nad edit 3 -b javascript
 
+  * Share a note publicly
+  nad edit 3 --public
+
+  * Stop sharing a note
+  nad edit 3 --public=false
+
+  * Replace the tags of a note
+  nad edit 3 --tag closure --tag scope
+
+  * Remove all tags from a note
+  nad edit 3 --tag ""
+
   * Rename a book
   nad edit javascript
 
   * Rename a book without launching an editor
   nad edit javascript -n js
+
+  * Rename a nested book
+  nad edit work/infra/k8s -n kubernetes
+
+  * Move a book and its descendants under another book
+  nad edit k8s -b work/infra
+
+  * Move a book to the top level
+  nad edit work/infra/k8s -b /
 `
 
 // NewCmd returns a new edit command
 func NewCmd(ctx context.NadCtx) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "edit <note id|book name>",
+		Use:     "edit <note id|book path>",
 		Short:   "Edit a note or a book",
 		Aliases: []string{"e"},
 		Example: example,
@@ -61,8 +84,10 @@ func NewCmd(ctx context.NadCtx) *cobra.Command {
 
 	f := cmd.Flags()
 	f.StringVarP(&contentFlag, "content", "c", "", "a new content for the note")
-	f.StringVarP(&bookFlag, "book", "b", "", "the name of the book to move the note to")
+	f.StringVarP(&bookFlag, "book", "b", "", "the book to move the note or the book to. '/' is the top level for a book")
 	f.StringVarP(&nameFlag, "name", "n", "", "a new name for a book")
+	f.BoolVar(&publicFlag, "public", false, "whether to share the note publicly")
+	f.StringSliceVarP(&tagFlag, "tag", "t", nil, "the tags to replace the tags of the note with")
 
 	return cmd
 }
@@ -77,13 +102,20 @@ func preRun(cmd *cobra.Command, args []string) error {
 
 func newRun(ctx context.NadCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
+		publicSet := cmd.Flags().Changed("public")
+		tagSet := cmd.Flags().Changed("tag")
+
+		if publicSet && publicFlag && ctx.CipherKey != nil {
+			return errors.New("notes cannot be shared publicly when encryption is set up")
+		}
+
 		// DEPRECATED: Remove in 1.0.0
 		if len(args) == 2 {
 			log.Plain(log.ColorYellow.Sprintf("DEPRECATED: you no longer need to pass book name to the view command. e.g. `nad view 123`.\n\n"))
 
 			target := args[1]
 
-			if err := runNote(ctx, target); err != nil {
+			if err := runNote(ctx, target, publicSet, tagSet); err != nil {
 				return errors.Wrap(err, "editing note")
 			}
 
@@ -93,10 +125,17 @@ func newRun(ctx context.NadCtx) infra.RunEFunc {
 		target := args[0]
 
 		if utils.IsNumber(target) {
-			if err := runNote(ctx, target); err != nil {
+			if err := runNote(ctx, target, publicSet, tagSet); err != nil {
 				return errors.Wrap(err, "editing note")
 			}
 		} else {
+			if publicSet {
+				return errors.New("--public is invalid for editing a book")
+			}
+			if tagSet {
+				return errors.New("--tag is invalid for editing a book")
+			}
+
 			if err := runBook(ctx, target); err != nil {
 				return errors.Wrap(err, "editing book")
 			}
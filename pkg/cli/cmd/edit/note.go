@@ -21,13 +21,16 @@ package edit
 import (
 	"database/sql"
 	"io/ioutil"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/nadproject/nad/pkg/cli/context"
 	"github.com/nadproject/nad/pkg/cli/database"
 	"github.com/nadproject/nad/pkg/cli/log"
 	"github.com/nadproject/nad/pkg/cli/output"
 	"github.com/nadproject/nad/pkg/cli/ui"
+	"github.com/nadproject/nad/pkg/cli/validate"
 	"github.com/pkg/errors"
 )
 
@@ -99,7 +102,56 @@ func moveBook(ctx context.NadCtx, tx *database.DB, note database.Note, bookName
 	return nil
 }
 
-func updateNote(ctx context.NadCtx, tx *database.DB, note database.Note, bookName, content string) error {
+func changePublic(ctx context.NadCtx, tx *database.DB, note database.Note, public bool) error {
+	if note.Public == public {
+		return errors.New("Nothing changed")
+	}
+
+	if err := database.UpdateNotePublic(tx, ctx.Clock, note.RowID, public); err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
+// sortedTags returns the given tags without duplicates, ordered by name
+func sortedTags(tags []string) []string {
+	seen := map[string]bool{}
+	ret := []string{}
+
+	for _, tag := range tags {
+		if seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		ret = append(ret, tag)
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+func changeTags(ctx context.NadCtx, tx *database.DB, note database.Note, tags []string) error {
+	current, err := database.GetNoteTags(tx, note.UUID)
+	if err != nil {
+		return errors.Wrap(err, "getting the current tags")
+	}
+
+	tags = sortedTags(tags)
+	if strings.Join(current, ",") == strings.Join(tags, ",") {
+		return errors.New("Nothing changed")
+	}
+
+	if err := database.UpdateNoteTags(tx, ctx.Clock, note.RowID, tags); err != nil {
+		return errors.Wrap(err, "updating the tags")
+	}
+
+	return nil
+}
+
+func updateNote(ctx context.NadCtx, tx *database.DB, note database.Note, bookName, content string, public *bool, tags *[]string) error {
 	if bookName != "" {
 		if err := moveBook(ctx, tx, note, bookName); err != nil {
 			return errors.Wrap(err, "moving book")
@@ -110,11 +162,21 @@ func updateNote(ctx context.NadCtx, tx *database.DB, note database.Note, bookNam
 			return errors.Wrap(err, "changing content")
 		}
 	}
+	if public != nil {
+		if err := changePublic(ctx, tx, note, *public); err != nil {
+			return errors.Wrap(err, "changing public")
+		}
+	}
+	if tags != nil {
+		if err := changeTags(ctx, tx, note, *tags); err != nil {
+			return errors.Wrap(err, "changing tags")
+		}
+	}
 
 	return nil
 }
 
-func runNote(ctx context.NadCtx, rowIDArg string) error {
+func runNote(ctx context.NadCtx, rowIDArg string, publicSet, tagSet bool) error {
 	err := validateRunNoteFlags()
 	if err != nil {
 		return errors.Wrap(err, "validating flags.")
@@ -135,8 +197,22 @@ func runNote(ctx context.NadCtx, rowIDArg string) error {
 
 	content := contentFlag
 
+	var public *bool
+	if publicSet {
+		public = &publicFlag
+	}
+
+	var tags *[]string
+	if tagSet {
+		if err := validate.TagNames(tagFlag); err != nil {
+			return err
+		}
+
+		tags = &tagFlag
+	}
+
 	// If no flag was provided, launch an editor to get the content
-	if bookFlag == "" && contentFlag == "" {
+	if bookFlag == "" && contentFlag == "" && public == nil && tags == nil {
 		c, err := getContent(ctx, note)
 		if err != nil {
 			return errors.Wrap(err, "getting content from editor")
@@ -150,7 +226,7 @@ func runNote(ctx context.NadCtx, rowIDArg string) error {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	err = updateNote(ctx, tx, note, bookFlag, content)
+	err = updateNote(ctx, tx, note, bookFlag, content, public, tags)
 	if err != nil {
 		tx.Rollback()
 		return errors.Wrap(err, "updating note fields")
@@ -171,5 +247,13 @@ func runNote(ctx context.NadCtx, rowIDArg string) error {
 	log.Success("edited the note\n")
 	output.NoteInfo(noteInfo)
 
+	if public != nil {
+		if *public {
+			log.Plain("The note will be shared publicly once you run `nad sync`.\n")
+		} else {
+			log.Plain("The note will stop being shared once you run `nad sync`.\n")
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,199 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package encrypt
+
+import (
+	"encoding/base64"
+
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/nadproject/nad/pkg/cli/consts"
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/crypt"
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/nadproject/nad/pkg/cli/infra"
+	"github.com/nadproject/nad/pkg/cli/log"
+	"github.com/nadproject/nad/pkg/cli/ui"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+  nad encrypt`
+
+// ErrPassphraseMismatch is an error for a passphrase confirmation that does not match
+var ErrPassphraseMismatch = errors.New("passphrases do not match")
+
+// NewCmd returns a new encrypt command
+func NewCmd(ctx context.NadCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "encrypt",
+		Short:   "Encrypt notes and books sent to the server with a passphrase",
+		Example: example,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+// setUp derives a new cipher key from the given passphrase and registers its
+// salt and key check with the server
+func setUp(ctx context.NadCtx, passphrase string) ([]byte, error) {
+	salt, err := crypt.NewSalt()
+	if err != nil {
+		return nil, errors.Wrap(err, "generating a salt")
+	}
+
+	key := crypt.DeriveKey(passphrase, salt)
+	keyCheck, err := crypt.NewKeyCheck(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating a key check")
+	}
+
+	if _, err := client.SetEncryption(ctx, base64.StdEncoding.EncodeToString(salt), keyCheck); err != nil {
+		return nil, errors.Wrap(err, "setting up encryption in the server")
+	}
+
+	return key, nil
+}
+
+// unlock derives the cipher key from the given passphrase using the encryption
+// settings already in the server, and verifies it against the key check
+func unlock(enc client.EncryptionResp, passphrase string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding the salt")
+	}
+
+	key := crypt.DeriveKey(passphrase, salt)
+	if err := crypt.VerifyKey(key, enc.KeyCheck); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// saveKey stores the given cipher key and marks all books and notes dirty so that
+// they are encrypted in the server at the next sync. Because encrypted notes cannot
+// be public, it also makes all notes private and returns the number of the notes
+// that were public.
+func saveKey(db *database.DB, key []byte) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := database.UpsertSystem(tx, consts.SystemCipherKey, base64.StdEncoding.EncodeToString(key)); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "saving the cipher key")
+	}
+
+	var publicCount int
+	if err := tx.QueryRow("SELECT count(*) FROM notes WHERE public AND NOT deleted").Scan(&publicCount); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "counting public notes")
+	}
+
+	if _, err := tx.Exec("UPDATE books SET dirty = ? WHERE NOT deleted", true); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "marking books dirty")
+	}
+	if _, err := tx.Exec("UPDATE notes SET dirty = ?, public = ? WHERE NOT deleted", true, false); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "marking notes dirty")
+	}
+
+	tx.Commit()
+
+	return publicCount, nil
+}
+
+func promptNewPassphrase() (string, error) {
+	var passphrase, confirmation string
+	if err := ui.PromptPassword("new passphrase", &passphrase); err != nil {
+		return "", errors.Wrap(err, "getting passphrase input")
+	}
+	if passphrase == "" {
+		return "", errors.New("Passphrase is empty")
+	}
+	if err := ui.PromptPassword("confirm passphrase", &confirmation); err != nil {
+		return "", errors.Wrap(err, "getting passphrase confirmation input")
+	}
+	if passphrase != confirmation {
+		return "", ErrPassphraseMismatch
+	}
+
+	return passphrase, nil
+}
+
+func newRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if ctx.SessionKey == "" {
+			return errors.New("not logged in")
+		}
+		if ctx.CipherKey != nil {
+			return errors.New("encryption is already set up")
+		}
+
+		enc, err := client.GetEncryption(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting the encryption settings")
+		}
+
+		var key []byte
+		if enc.Salt == "" {
+			log.Plain("Notes and books will be encrypted with a passphrase before being sent to the server.\n")
+			log.Plain("The passphrase cannot be recovered. If you lose it, you lose your synced data.\n")
+
+			passphrase, err := promptNewPassphrase()
+			if err != nil {
+				return err
+			}
+
+			key, err = setUp(ctx, passphrase)
+			if err != nil {
+				return errors.Wrap(err, "setting up encryption")
+			}
+		} else {
+			var passphrase string
+			if err := ui.PromptPassword("passphrase", &passphrase); err != nil {
+				return errors.Wrap(err, "getting passphrase input")
+			}
+
+			key, err = unlock(enc, passphrase)
+			if err == crypt.ErrKeyInvalid {
+				log.Error("wrong passphrase\n")
+				return nil
+			} else if err != nil {
+				return errors.Wrap(err, "deriving the cipher key")
+			}
+		}
+
+		publicCount, err := saveKey(ctx.DB, key)
+		if err != nil {
+			return errors.Wrap(err, "saving the cipher key")
+		}
+
+		log.Success("encryption is set up. Run `nad sync` to encrypt your data in the server.\n")
+		if publicCount > 0 {
+			log.Infof("%d public notes were made private because encrypted notes cannot be shared.\n", publicCount)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,148 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package encrypt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/nadproject/nad/pkg/cli/consts"
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/crypt"
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/nadproject/nad/pkg/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestSetUp(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, "../../tmp", nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	var payload client.EncryptionResp
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() != "/v1/encryption" || r.Method != "PUT" {
+			t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(payload); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	key, err := setUp(ctx, "correct horse")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	salt, err := base64.StdEncoding.DecodeString(payload.Salt)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the salt"))
+	}
+	assert.Equal(t, len(salt), crypt.SaltSize, "salt size mismatch")
+	assert.DeepEqual(t, key, crypt.DeriveKey("correct horse", salt), "key mismatch")
+	assert.Equal(t, crypt.VerifyKey(key, payload.KeyCheck), nil, "key check mismatch")
+}
+
+func TestUnlock(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key := crypt.DeriveKey("correct horse", salt)
+	keyCheck, err := crypt.NewKeyCheck(key)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generating a key check"))
+	}
+
+	enc := client.EncryptionResp{
+		Salt:     base64.StdEncoding.EncodeToString(salt),
+		KeyCheck: keyCheck,
+	}
+
+	t.Run("right passphrase", func(t *testing.T) {
+		got, err := unlock(enc, "correct horse")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.DeepEqual(t, got, key, "key mismatch")
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		_, err := unlock(enc, "battery staple")
+		assert.Equal(t, err, crypt.ErrKeyInvalid, "error mismatch")
+	})
+}
+
+func TestSaveKey(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../../tmp/.nad", nil)
+	defer database.CloseTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, name, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", "b1-uuid", "js", 1, false, false)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, name, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", "b2-uuid", "css", 2, true, false)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 body", 1541108743, 3, true, false, false)
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 body", 1541108743, 4, false, false, false)
+	database.MustExec(t, "inserting n3", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", "n3-uuid", "b1-uuid", "", 1541108743, 5, false, true, false)
+
+	key := crypt.DeriveKey("correct horse", []byte("0123456789abcdef"))
+
+	// execute
+	publicCount, err := saveKey(db, key)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	assert.Equal(t, publicCount, 1, "public count mismatch")
+
+	var storedKey string
+	database.MustScan(t, "getting the cipher key", db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemCipherKey), &storedKey)
+	assert.Equal(t, storedKey, base64.StdEncoding.EncodeToString(key), "stored key mismatch")
+
+	var b1Dirty, b2Dirty bool
+	database.MustScan(t, "getting b1", db.QueryRow("SELECT dirty FROM books WHERE uuid = ?", "b1-uuid"), &b1Dirty)
+	database.MustScan(t, "getting b2", db.QueryRow("SELECT dirty FROM books WHERE uuid = ?", "b2-uuid"), &b2Dirty)
+	assert.Equal(t, b1Dirty, true, "b1 dirty mismatch")
+	assert.Equal(t, b2Dirty, false, "b2 dirty mismatch")
+
+	var n1Dirty, n1Public, n2Dirty, n3Dirty bool
+	database.MustScan(t, "getting n1", db.QueryRow("SELECT dirty, public FROM notes WHERE uuid = ?", "n1-uuid"), &n1Dirty, &n1Public)
+	database.MustScan(t, "getting n2", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n2-uuid"), &n2Dirty)
+	database.MustScan(t, "getting n3", db.QueryRow("SELECT dirty FROM notes WHERE uuid = ?", "n3-uuid"), &n3Dirty)
+	assert.Equal(t, n1Dirty, true, "n1 dirty mismatch")
+	assert.Equal(t, n1Public, false, "n1 public mismatch")
+	assert.Equal(t, n2Dirty, true, "n2 dirty mismatch")
+	assert.Equal(t, n3Dirty, false, "n3 dirty mismatch")
+}
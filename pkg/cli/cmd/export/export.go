@@ -0,0 +1,395 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/nadproject/nad/pkg/cli/infra"
+	"github.com/nadproject/nad/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+	formatHTML     = "html"
+)
+
+var formatFlag string
+var bookFlag []string
+
+var example = `
+  * Export all books to a directory of Markdown files
+  nad export ~/nad-backup
+
+  * Export all books to a JSON file
+  nad export ~/nad-backup.json --format json
+
+  * Export all books as JSON to the standard output
+  nad export - --format json
+
+  * Export a book and its nested books to a static HTML site
+  nad export ~/wiki --format html --book work
+`
+
+// NewCmd returns a new export command
+func NewCmd(ctx context.NadCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "export <path>",
+		Short:   "Export books and notes to Markdown, JSON or HTML",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&formatFlag, "format", "f", formatMarkdown, "the format to export to: markdown, json or html")
+	f.StringSliceVarP(&bookFlag, "book", "b", nil, "the book to export along with its nested books. Can be repeated. All books are exported by default")
+
+	return cmd
+}
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	switch formatFlag {
+	case formatMarkdown, formatJSON, formatHTML:
+	default:
+		return errors.Errorf("unknown format '%s'", formatFlag)
+	}
+
+	return nil
+}
+
+// book is a book to be exported
+type book struct {
+	database.Book
+	// Path is the path of the book, such as 'work/infra'
+	Path string
+	// Dir is the slash separated directory of the book relative to the
+	// destination, made of the sanitized names of the book and its ancestors
+	Dir string
+}
+
+// dirName returns the name of the directory for a book. The name falls back to
+// the uuid if it cannot be used as a single path segment, and the path
+// separators in it are replaced so that the directory cannot escape its parent.
+func dirName(name, uuid string) string {
+	if name == "" || name == "." || name == ".." {
+		return uuid
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '-'
+		}
+
+		return r
+	}, name)
+}
+
+// getBookDirs returns the directories of all books by their uuids. The
+// directory of a nested book is nested in the directory of its parent.
+func getBookDirs(db *database.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT uuid, name, parent_uuid FROM books")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	names := map[string]string{}
+	parents := map[string]string{}
+	for rows.Next() {
+		var uuid, name, parentUUID string
+		if err := rows.Scan(&uuid, &name, &parentUUID); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		names[uuid] = name
+		parents[uuid] = parentUUID
+	}
+
+	ret := map[string]string{}
+	for uuid := range names {
+		segments := []string{}
+		seen := map[string]bool{}
+
+		for cur := uuid; cur != "" && !seen[cur]; cur = parents[cur] {
+			name, ok := names[cur]
+			if !ok {
+				break
+			}
+
+			seen[cur] = true
+			segments = append([]string{dirName(name, cur)}, segments...)
+		}
+
+		ret[uuid] = path.Join(segments...)
+	}
+
+	return ret, nil
+}
+
+// getBookUUIDs returns the uuids of the books with the given paths and
+// of their nested books. If no path is given, it returns all books.
+func getBookUUIDs(db *database.DB, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		rows, err := db.Query("SELECT uuid FROM books WHERE deleted = false")
+		if err != nil {
+			return nil, errors.Wrap(err, "querying books")
+		}
+		defer rows.Close()
+
+		ret := []string{}
+		for rows.Next() {
+			var uuid string
+			if err := rows.Scan(&uuid); err != nil {
+				return nil, errors.Wrap(err, "scanning a row")
+			}
+
+			ret = append(ret, uuid)
+		}
+
+		return ret, nil
+	}
+
+	ret := []string{}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		uuid, err := database.GetBookUUID(db, path)
+		if err != nil {
+			return nil, errors.Wrap(err, "finding the book")
+		}
+
+		uuids, err := database.GetSubtreeBookUUIDs(db, uuid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "finding the nested books of %s", path)
+		}
+
+		for _, uuid := range uuids {
+			if !seen[uuid] {
+				seen[uuid] = true
+				ret = append(ret, uuid)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+func getNotes(db *database.DB, bookUUID string) ([]database.Note, error) {
+	rows, err := db.Query(`SELECT rowid, uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty
+		FROM notes
+		WHERE book_uuid = ? AND deleted = false
+		ORDER BY added_on ASC`, bookUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []database.Note{}
+	for rows.Next() {
+		var n database.Note
+		if err := rows.Scan(&n.RowID, &n.UUID, &n.BookUUID, &n.Body, &n.AddedOn, &n.EditedOn, &n.USN, &n.Public, &n.Deleted, &n.Dirty); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, n)
+	}
+
+	for i := range ret {
+		tags, err := database.GetNoteTags(db, ret[i].UUID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting the tags of the note %s", ret[i].UUID)
+		}
+
+		ret[i].Tags = tags
+	}
+
+	return ret, nil
+}
+
+// getBooks returns the books to export, along with their notes, ordered by path
+func getBooks(db *database.DB, paths []string) ([]book, error) {
+	uuids, err := getBookUUIDs(db, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	bookPaths, err := database.GetBookPaths(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting book paths")
+	}
+	bookDirs, err := getBookDirs(db)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting book directories")
+	}
+
+	ret := []book{}
+	for _, uuid := range uuids {
+		var b book
+		err := db.QueryRow("SELECT uuid, name, parent_uuid, usn, deleted, dirty FROM books WHERE uuid = ?", uuid).
+			Scan(&b.UUID, &b.Name, &b.ParentUUID, &b.USN, &b.Deleted, &b.Dirty)
+		if err == sql.ErrNoRows {
+			return nil, errors.Errorf("book %s not found", uuid)
+		} else if err != nil {
+			return nil, errors.Wrap(err, "querying the book")
+		}
+
+		notes, err := getNotes(db, uuid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting the notes of the book %s", uuid)
+		}
+
+		b.Notes = notes
+		b.Path = bookPaths[uuid]
+		b.Dir = bookDirs[uuid]
+
+		ret = append(ret, b)
+	}
+
+	sortBooks(ret)
+
+	return ret, nil
+}
+
+// ensureEmptyDir creates a directory at the given path, or makes sure that the
+// existing directory is empty so that no file is overwritten by an export
+func ensureEmptyDir(path string) error {
+	files, err := ioutil.ReadDir(path)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return errors.Wrapf(err, "creating the directory %s", path)
+		}
+
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "reading the directory %s", path)
+	}
+
+	if len(files) > 0 {
+		return errors.Errorf("the directory %s is not empty", path)
+	}
+
+	return nil
+}
+
+func newRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		dest := args[0]
+
+		books, err := getBooks(ctx.DB, bookFlag)
+		if err != nil {
+			return errors.Wrap(err, "getting books")
+		}
+
+		switch formatFlag {
+		case formatMarkdown:
+			err = exportMarkdown(books, dest)
+		case formatJSON:
+			err = exportJSON(books, dest)
+		case formatHTML:
+			err = exportHTML(books, dest)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "exporting to %s", formatFlag)
+		}
+
+		// Do not mix the message with the exported document.
+		if dest != stdoutPath {
+			var noteCount int
+			for _, b := range books {
+				noteCount += len(b.Notes)
+			}
+
+			log.Successf("exported %d books and %d notes to %s\n", len(books), noteCount, dest)
+		}
+
+		return nil
+	}
+}
+
+// sortBooks sorts the given books by path so that a book comes right before its nested books
+func sortBooks(books []book) {
+	sort.Slice(books, func(i, j int) bool {
+		a := database.SplitBookPath(books[i].Path)
+		b := database.SplitBookPath(books[j].Path)
+
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+
+		return len(a) < len(b)
+	})
+}
+
+// slugify returns a string that can be used as a part of a file name
+func slugify(s string, maxLen int) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(s) {
+		if b.Len() >= maxLen {
+			break
+		}
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// noteFilename returns the base name of the file for the given note, made of the
+// first line of the content and the beginning of the uuid
+func noteFilename(n database.Note, ext string) string {
+	firstLine := strings.SplitN(strings.TrimSpace(n.Body), "\n", 2)[0]
+
+	slug := slugify(firstLine, 50)
+	if slug == "" {
+		slug = "note"
+	}
+
+	shortUUID := n.UUID
+	if len(shortUUID) > 8 {
+		shortUUID = shortUUID[:8]
+	}
+
+	return fmt.Sprintf("%s-%s.%s", slug, shortUUID, ext)
+}
@@ -0,0 +1,195 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/cli/database"
+)
+
+func TestSlugify(t *testing.T) {
+	testCases := []struct {
+		input    string
+		maxLen   int
+		expected string
+	}{
+		{
+			input:    "foo",
+			maxLen:   50,
+			expected: "foo",
+		},
+		{
+			input:    "Foo Bar",
+			maxLen:   50,
+			expected: "foo-bar",
+		},
+		{
+			input:    "  # git: rebase --onto!  ",
+			maxLen:   50,
+			expected: "git-rebase-onto",
+		},
+		{
+			input:    "한국어 노트",
+			maxLen:   50,
+			expected: "한국어-노트",
+		},
+		{
+			input:    "foo bar baz",
+			maxLen:   4,
+			expected: "foo",
+		},
+		{
+			input:    "!!!",
+			maxLen:   50,
+			expected: "",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result := slugify(tc.input, tc.maxLen)
+			assert.Equal(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestNoteFilename(t *testing.T) {
+	testCases := []struct {
+		body     string
+		expected string
+	}{
+		{
+			body:     "kubectl get pods\nlists pods",
+			expected: "kubectl-get-pods-43827b9a.md",
+		},
+		{
+			body:     "\n\nfoo",
+			expected: "foo-43827b9a.md",
+		},
+		{
+			body:     "",
+			expected: "note-43827b9a.md",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			n := database.Note{UUID: "43827b9a-c2b0-4c06-a290-97991c896653", Body: tc.body}
+
+			result := noteFilename(n, "md")
+			assert.Equal(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestDirName(t *testing.T) {
+	uuid := "43827b9a-c2b0-4c06-a290-97991c896653"
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{
+			name:     "js",
+			expected: "js",
+		},
+		{
+			name:     "node.js",
+			expected: "node.js",
+		},
+		{
+			name:     "",
+			expected: uuid,
+		},
+		{
+			name:     ".",
+			expected: uuid,
+		},
+		{
+			name:     "..",
+			expected: uuid,
+		},
+		{
+			name:     "../../etc",
+			expected: "..-..-etc",
+		},
+		{
+			name:     `..\windows`,
+			expected: "..-windows",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("name %s", tc.name), func(t *testing.T) {
+			assert.Equal(t, dirName(tc.name, uuid), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestSortBooks(t *testing.T) {
+	books := []book{
+		{Path: "work/infra"},
+		{Path: "work-notes"},
+		{Path: "js"},
+		{Path: "work"},
+		{Path: "work/infra/k8s"},
+	}
+
+	sortBooks(books)
+
+	var result []string
+	for _, b := range books {
+		result = append(result, b.Path)
+	}
+
+	assert.DeepEqual(t, result, []string{"js", "work", "work/infra", "work/infra/k8s", "work-notes"}, "result mismatch")
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	n := database.Note{
+		UUID:     "43827b9a-c2b0-4c06-a290-97991c896653",
+		Body:     "foo\nbar",
+		AddedOn:  1515199943000000000,
+		EditedOn: 0,
+		Public:   true,
+		Tags:     []string{"a", "b"},
+	}
+
+	result, err := renderMarkdown(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `---
+uuid: 43827b9a-c2b0-4c06-a290-97991c896653
+added_on: "2018-01-06T00:52:23Z"
+public: true
+tags:
+- a
+- b
+---
+
+foo
+bar
+`
+	assert.Equal(t, string(result), expected, "result mismatch")
+}
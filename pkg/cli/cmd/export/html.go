@@ -0,0 +1,173 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+var htmlTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 48rem; margin: 0 auto; padding: 1rem; font-family: sans-serif; line-height: 1.5; color: #333; }
+article { border-top: 1px solid #ddd; padding: 1rem 0; }
+pre { white-space: pre-wrap; word-wrap: break-word; font-family: inherit; margin: 0; }
+.meta { color: #777; font-size: 0.875rem; }
+.tag { background: #eee; border-radius: 3px; padding: 0 0.25rem; margin-right: 0.25rem; }
+</style>
+</head>
+<body>
+{{if .Home}}<nav><a href="{{.Home}}">Home</a></nav>{{end}}
+<h1>{{.Title}}</h1>
+{{if .Books}}<ul>
+{{range .Books}}<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{end}}</ul>{{end}}
+{{range .Notes}}<article id="{{.UUID}}">
+<pre>{{.Body}}</pre>
+<p class="meta">{{.AddedOn}}{{range .Tags}} <span class="tag">{{.}}</span>{{end}}</p>
+</article>
+{{end}}
+</body>
+</html>
+`))
+
+// htmlLink is a link to a book
+type htmlLink struct {
+	Name string
+	Href string
+}
+
+// htmlNote is a note rendered in a page
+type htmlNote struct {
+	UUID    string
+	Body    string
+	AddedOn string
+	Tags    []string
+}
+
+// htmlPage is the data for a page of the site
+type htmlPage struct {
+	Title string
+	Home  string
+	Books []htmlLink
+	Notes []htmlNote
+}
+
+// writeHTMLPage writes a page at the index.html in the given directory
+func writeHTMLPage(dir string, p htmlPage) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating the directory %s", dir)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return errors.Wrap(err, "creating the file")
+	}
+	defer f.Close()
+
+	if err := htmlTemplate.Execute(f, p); err != nil {
+		return errors.Wrap(err, "rendering the page")
+	}
+
+	return nil
+}
+
+func toHTMLNotes(notes []database.Note) []htmlNote {
+	ret := []htmlNote{}
+	for _, n := range notes {
+		ret = append(ret, htmlNote{
+			UUID:    n.UUID,
+			Body:    n.Body,
+			AddedOn: formatTimestamp(n.AddedOn),
+			Tags:    n.Tags,
+		})
+	}
+
+	return ret
+}
+
+// exportHTML writes a static site with a page for each book. The directories
+// mirror the books, and the root page lists the exported books that are not
+// nested in another exported book.
+func exportHTML(books []book, dest string) error {
+	if err := ensureEmptyDir(dest); err != nil {
+		return err
+	}
+
+	exported := map[string]bool{}
+	for _, b := range books {
+		exported[b.UUID] = true
+	}
+
+	// children maps the uuid of a book to the links to its exported children.
+	// The empty key holds the books to be linked from the root page.
+	children := map[string][]htmlLink{}
+	for _, b := range books {
+		key := b.ParentUUID
+		if !exported[key] {
+			key = ""
+		}
+
+		var href string
+		if key == "" {
+			href = b.Dir + "/index.html"
+		} else {
+			href = path.Base(b.Dir) + "/index.html"
+		}
+
+		children[key] = append(children[key], htmlLink{Name: b.Path, Href: href})
+	}
+
+	root := htmlPage{
+		Title: "NAD",
+		Books: children[""],
+	}
+	if err := writeHTMLPage(dest, root); err != nil {
+		return errors.Wrap(err, "writing the root page")
+	}
+
+	for _, b := range books {
+		depth := len(strings.Split(b.Dir, "/"))
+
+		p := htmlPage{
+			Title: b.Path,
+			Home:  strings.Repeat("../", depth) + "index.html",
+			Books: children[b.UUID],
+			Notes: toHTMLNotes(b.Notes),
+		}
+
+		dir := filepath.Join(dest, filepath.FromSlash(b.Dir))
+		if err := writeHTMLPage(dir, p); err != nil {
+			return errors.Wrapf(err, "writing the page for the book %s", b.Path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+// stdoutPath is the path denoting the standard output
+const stdoutPath = "-"
+
+// document is the JSON document of an export
+type document struct {
+	Books []database.Book `json:"books"`
+}
+
+// exportJSON writes the books and their notes to a single JSON document
+func exportJSON(books []book, dest string) error {
+	doc := document{
+		Books: []database.Book{},
+	}
+	for _, b := range books {
+		doc.Books = append(doc.Books, b.Book)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling the document")
+	}
+	data = append(data, '\n')
+
+	if dest == stdoutPath {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return errors.Wrap(err, "writing to the standard output")
+		}
+
+		return nil
+	}
+
+	if err := ioutil.WriteFile(dest, data, 0644); err != nil {
+		return errors.Wrapf(err, "writing %s", dest)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package export
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// frontMatter is the metadata of a note written at the top of its Markdown file
+type frontMatter struct {
+	UUID     string   `yaml:"uuid"`
+	AddedOn  string   `yaml:"added_on"`
+	EditedOn string   `yaml:"edited_on,omitempty"`
+	Public   bool     `yaml:"public"`
+	Tags     []string `yaml:"tags,omitempty"`
+}
+
+// formatTimestamp formats the given unix timestamp in nanoseconds. It returns an
+// empty string for zero so that an unset timestamp is omitted.
+func formatTimestamp(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+
+	return time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+}
+
+// renderMarkdown returns the content of the Markdown file for the given note
+func renderMarkdown(n database.Note) ([]byte, error) {
+	fm := frontMatter{
+		UUID:     n.UUID,
+		AddedOn:  formatTimestamp(n.AddedOn),
+		EditedOn: formatTimestamp(n.EditedOn),
+		Public:   n.Public,
+		Tags:     n.Tags,
+	}
+
+	meta, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling the front matter")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(meta)
+	buf.WriteString("---\n\n")
+	buf.WriteString(n.Body)
+	if len(n.Body) > 0 && n.Body[len(n.Body)-1] != '\n' {
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// exportMarkdown writes each note to a Markdown file with a front matter. The
+// directories mirror the books, and the nested books are nested directories.
+func exportMarkdown(books []book, dest string) error {
+	if err := ensureEmptyDir(dest); err != nil {
+		return err
+	}
+
+	for _, b := range books {
+		dir := filepath.Join(dest, filepath.FromSlash(b.Dir))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrapf(err, "creating the directory for the book %s", b.Path)
+		}
+
+		for _, n := range b.Notes {
+			content, err := renderMarkdown(n)
+			if err != nil {
+				return errors.Wrapf(err, "rendering the note %s", n.UUID)
+			}
+
+			path := filepath.Join(dir, noteFilename(n, "md"))
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				return errors.Wrapf(err, "writing the note %s", n.UUID)
+			}
+		}
+	}
+
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/database"
 	"github.com/nadproject/nad/pkg/cli/infra"
 	"github.com/nadproject/nad/pkg/cli/log"
 	"github.com/pkg/errors"
@@ -39,9 +40,13 @@ var example = `
 
 	# find notes within a book
 	nad find "merge sort" -b algorithm
+
+	# find notes that have all of the given tags
+	nad find "merge sort" -t sorting -t divide-and-conquer
 	`
 
 var bookName string
+var tags []string
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) != 1 {
@@ -63,7 +68,8 @@ func NewCmd(ctx context.NadCtx) *cobra.Command {
 	}
 
 	f := cmd.Flags()
-	f.StringVarP(&bookName, "book", "b", "", "book name to find notes in")
+	f.StringVarP(&bookName, "book", "b", "", "book path to find notes in")
+	f.StringSliceVarP(&tags, "tag", "t", nil, "tag the notes must have. Can be repeated")
 
 	return cmd
 }
@@ -130,12 +136,12 @@ func escapePhrase(s string) (string, error) {
 	return b.String(), nil
 }
 
-func doQuery(ctx context.NadCtx, query, bookName string) (*sql.Rows, error) {
+func doQuery(ctx context.NadCtx, query, bookName string, tags []string) (*sql.Rows, error) {
 	db := ctx.DB
 
 	sql := `SELECT
 		notes.rowid,
-		books.name AS book_name,
+		notes.book_uuid,
 		snippet(note_fts, 0, '<nadhl>', '</nadhl>', '...', 28)
 	FROM note_fts
 	INNER JOIN notes ON notes.rowid = note_fts.rowid
@@ -144,8 +150,17 @@ func doQuery(ctx context.NadCtx, query, bookName string) (*sql.Rows, error) {
 	args := []interface{}{query}
 
 	if bookName != "" {
-		sql = fmt.Sprintf("%s AND books.name = ?", sql)
-		args = append(args, bookName)
+		bookUUID, err := database.GetBookUUID(db, bookName)
+		if err != nil {
+			return nil, errors.Wrap(err, "finding the book")
+		}
+
+		sql = fmt.Sprintf("%s AND notes.book_uuid = ?", sql)
+		args = append(args, bookUUID)
+	}
+	for _, tag := range tags {
+		sql = fmt.Sprintf("%s AND notes.uuid IN (SELECT note_uuid FROM note_tags WHERE name = ?)", sql)
+		args = append(args, tag)
 	}
 
 	rows, err := db.Query(sql, args...)
@@ -160,7 +175,12 @@ func newRun(ctx context.NadCtx) infra.RunEFunc {
 			return errors.Wrap(err, "escaping phrase")
 		}
 
-		rows, err := doQuery(ctx, phrase, bookName)
+		bookPaths, err := database.GetBookPaths(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "getting book paths")
+		}
+
+		rows, err := doQuery(ctx, phrase, bookName, tags)
 		if err != nil {
 			return errors.Wrap(err, "querying notes")
 		}
@@ -170,11 +190,12 @@ func newRun(ctx context.NadCtx) infra.RunEFunc {
 		for rows.Next() {
 			var info noteInfo
 
-			var body string
-			err = rows.Scan(&info.RowID, &info.BookLabel, &body)
+			var bookUUID, body string
+			err = rows.Scan(&info.RowID, &bookUUID, &body)
 			if err != nil {
 				return errors.Wrap(err, "scanning a row")
 			}
+			info.BookLabel = bookPaths[bookUUID]
 
 			body, err := formatFTSSnippet(body)
 			if err != nil {
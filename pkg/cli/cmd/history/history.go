@@ -0,0 +1,268 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/crypt"
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/nadproject/nad/pkg/cli/infra"
+	"github.com/nadproject/nad/pkg/cli/log"
+	"github.com/nadproject/nad/pkg/cli/ui"
+	"github.com/nadproject/nad/pkg/cli/utils/diff"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var revisionFlag int
+var restoreFlag bool
+var yesFlag bool
+
+var example = `
+  * List the revisions of a note by id
+  nad history 3
+
+  * Show the changes between the second most recent revision and the current content
+  nad history 3 -r 2
+
+  * Restore the second most recent revision
+  nad history 3 -r 2 --restore
+`
+
+// NewCmd returns a new history command
+func NewCmd(ctx context.NadCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "history <note id>",
+		Short:   "View or restore the revisions of a note",
+		Aliases: []string{"h"},
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.IntVarP(&revisionFlag, "revision", "r", 0, "the number of the revision to show, as listed by the command")
+	f.BoolVar(&restoreFlag, "restore", false, "restore the note to the revision")
+	f.BoolVarP(&yesFlag, "yes", "y", false, "Assume yes to the prompts and run in non-interactive mode")
+
+	return cmd
+}
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+	if restoreFlag && revisionFlag == 0 {
+		return errors.New("--revision is required to restore")
+	}
+
+	return nil
+}
+
+func maybeConfirm(message string, defaultValue bool) (bool, error) {
+	if yesFlag {
+		return true, nil
+	}
+
+	return ui.Confirm(message, defaultValue)
+}
+
+func formatTime(ts int64) string {
+	return time.Unix(0, ts).Format("Jan 2, 2006 3:04pm (MST)")
+}
+
+// summarize returns the first line of the given body
+func summarize(body string) string {
+	line := []rune(strings.SplitN(strings.TrimSpace(body), "\n", 2)[0])
+	if len(line) > 50 {
+		return string(line[:50]) + "..."
+	}
+
+	return string(line)
+}
+
+// formatDiff returns the lines of a line-by-line diff from s1 to s2, each
+// prefixed with '+' if inserted, '-' if deleted, or a space if unchanged.
+func formatDiff(s1, s2 string) []string {
+	var ret []string
+
+	for _, d := range diff.Do(s1, s2) {
+		var prefix string
+		switch d.Type {
+		case diff.DiffInsert:
+			prefix = "+ "
+		case diff.DiffDelete:
+			prefix = "- "
+		default:
+			prefix = "  "
+		}
+
+		text := strings.TrimSuffix(d.Text, "\n")
+		for _, line := range strings.Split(text, "\n") {
+			ret = append(ret, prefix+line)
+		}
+	}
+
+	return ret
+}
+
+func printDiff(s1, s2 string) {
+	for _, line := range formatDiff(s1, s2) {
+		switch line[0] {
+		case '+':
+			log.Plain(log.ColorGreen.Sprintf("%s\n", line))
+		case '-':
+			log.Plain(log.ColorRed.Sprintf("%s\n", line))
+		default:
+			log.Plainf("%s\n", line)
+		}
+	}
+}
+
+// decryptRevisions decrypts the bodies of the encrypted revisions in place
+func decryptRevisions(ctx context.NadCtx, revisions client.GetNoteRevisionsResp) error {
+	for idx, r := range revisions {
+		if !r.Encrypted {
+			continue
+		}
+		if ctx.CipherKey == nil {
+			return errors.New("the revisions are encrypted but no passphrase is set up. Please run `nad encrypt`")
+		}
+
+		body, err := crypt.Decrypt(ctx.CipherKey, r.Body)
+		if err != nil {
+			return errors.Wrapf(err, "decrypting the revision %s", r.UUID)
+		}
+
+		revisions[idx].Body = body
+	}
+
+	return nil
+}
+
+func printRevisions(note database.Note, revisions client.GetNoteRevisionsResp) {
+	if len(revisions) == 0 {
+		log.Infof("no revisions found for note %d\n", note.RowID)
+		return
+	}
+
+	for idx, r := range revisions {
+		log.Plainf("(%d) %s %s\n", idx+1, log.ColorGray.Sprintf("%s", formatTime(r.EditedOn)), summarize(r.Body))
+	}
+}
+
+func restore(ctx context.NadCtx, note database.Note, revision client.RespNoteRevision) error {
+	ok, err := maybeConfirm("restore the note to this revision?", false)
+	if err != nil {
+		return errors.Wrap(err, "getting confirmation")
+	}
+	if !ok {
+		log.Warnf("aborted by user\n")
+		return nil
+	}
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := database.UpdateNoteContent(tx, ctx.Clock, note.RowID, revision.Body); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "updating the note")
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	log.Success("restored the note\n")
+
+	return nil
+}
+
+func run(ctx context.NadCtx, rowIDArg string) error {
+	rowID, err := strconv.Atoi(rowIDArg)
+	if err != nil {
+		return errors.Wrap(err, "invalid rowid")
+	}
+
+	note, err := database.GetActiveNote(ctx.DB, rowID)
+	if err == sql.ErrNoRows {
+		return errors.Errorf("note %d not found", rowID)
+	} else if err != nil {
+		return errors.Wrap(err, "querying the note")
+	}
+
+	if note.USN == 0 {
+		return errors.Errorf("note %d has not been synced yet", rowID)
+	}
+
+	revisions, err := client.GetNoteRevisions(ctx, note.UUID)
+	if err != nil {
+		return errors.Wrap(err, "getting revisions")
+	}
+	if err := decryptRevisions(ctx, revisions); err != nil {
+		return errors.Wrap(err, "decrypting revisions")
+	}
+
+	if revisionFlag == 0 {
+		printRevisions(note, revisions)
+		return nil
+	}
+
+	if revisionFlag < 1 || revisionFlag > len(revisions) {
+		return errors.Errorf("revision %d not found", revisionFlag)
+	}
+	revision := revisions[revisionFlag-1]
+
+	log.Infof("changes from the current content to revision %d edited at %s\n", revisionFlag, formatTime(revision.EditedOn))
+	fmt.Printf("\n-------------------------changes-----------------------\n")
+	printDiff(note.Body, revision.Body)
+	fmt.Printf("-------------------------------------------------------\n")
+
+	if restoreFlag {
+		if err := restore(ctx, note, revision); err != nil {
+			return errors.Wrap(err, "restoring the revision")
+		}
+	}
+
+	return nil
+}
+
+func newRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if ctx.SessionKey == "" {
+			return errors.New("not logged in")
+		}
+
+		if err := run(ctx, args[0]); err != nil {
+			return errors.Wrap(err, "viewing history")
+		}
+
+		return nil
+	}
+}
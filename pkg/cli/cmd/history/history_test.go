@@ -0,0 +1,107 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package history
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/crypt"
+)
+
+func TestFormatDiff(t *testing.T) {
+	testCases := []struct {
+		s1       string
+		s2       string
+		expected []string
+	}{
+		{
+			s1:       "foo",
+			s2:       "foo",
+			expected: []string{"  foo"},
+		},
+		{
+			s1:       "foo\nbar\nbaz",
+			s2:       "foo\nbar\nquz",
+			expected: []string{"  foo", "  bar", "- baz", "+ quz"},
+		},
+		{
+			s1:       "foo\n",
+			s2:       "foo\nbar\nbaz\n",
+			expected: []string{"  foo", "+ bar", "+ baz"},
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result := formatDiff(tc.s1, tc.s2)
+			assert.DeepEqual(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	testCases := []struct {
+		body     string
+		expected string
+	}{
+		{
+			body:     "foo",
+			expected: "foo",
+		},
+		{
+			body:     "\nfoo\nbar",
+			expected: "foo",
+		},
+		{
+			body:     "0123456789012345678901234567890123456789012345678901234",
+			expected: "01234567890123456789012345678901234567890123456789...",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result := summarize(tc.body)
+			assert.Equal(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestDecryptRevisions(t *testing.T) {
+	key := crypt.DeriveKey("correct horse", []byte("0123456789abcdef"))
+	ciphertext, err := crypt.Encrypt(key, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revisions := client.GetNoteRevisionsResp{
+		{UUID: "r1-uuid", Body: ciphertext, Encrypted: true},
+		{UUID: "r2-uuid", Body: "bar"},
+	}
+
+	if err := decryptRevisions(context.NadCtx{CipherKey: key}, revisions); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, revisions[0].Body, "foo", "r1 body mismatch")
+	assert.Equal(t, revisions[1].Body, "bar", "r2 body mismatch")
+}
@@ -0,0 +1,189 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// enexNote is a note in an Evernote export
+type enexNote struct {
+	Title   string   `xml:"title"`
+	Content string   `xml:"content"`
+	Created string   `xml:"created"`
+	Updated string   `xml:"updated"`
+	Tags    []string `xml:"tag"`
+}
+
+// enmlBlockElements are the elements of ENML that end with a linebreak
+var enmlBlockElements = map[string]bool{
+	"div": true, "p": true, "li": true, "tr": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+var blankLinesRegexp = regexp.MustCompile(`\n{3,}`)
+
+// enmlToText converts the given ENML, the markup of an Evernote note, into a
+// plain text. Attachments are not supported and are dropped.
+func enmlToText(enml string) (string, error) {
+	d := xml.NewDecoder(strings.NewReader(enml))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var b strings.Builder
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", errors.Wrap(err, "parsing the content")
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "br":
+				b.WriteString("\n")
+			case "li":
+				b.WriteString("- ")
+			case "en-todo":
+				checked := false
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "checked" && attr.Value == "true" {
+						checked = true
+					}
+				}
+
+				if checked {
+					b.WriteString("[x] ")
+				} else {
+					b.WriteString("[ ] ")
+				}
+			}
+		case xml.EndElement:
+			if enmlBlockElements[t.Name.Local] {
+				b.WriteString("\n")
+			}
+		}
+	}
+
+	text := blankLinesRegexp.ReplaceAllString(b.String(), "\n\n")
+
+	return strings.TrimSpace(text), nil
+}
+
+// parseENEXNote converts a note in an Evernote export into a note
+func parseENEXNote(en enexNote) (note, error) {
+	var ret note
+
+	text, err := enmlToText(en.Content)
+	if err != nil {
+		return ret, err
+	}
+
+	title := strings.TrimSpace(en.Title)
+	if title != "" {
+		text = strings.TrimSpace("# " + title + "\n\n" + text)
+	}
+	ret.Body = text
+
+	if en.Created != "" {
+		ts, err := parseTimestamp(en.Created)
+		if err != nil {
+			return ret, errors.Wrap(err, "parsing the date the note was created")
+		}
+
+		ret.AddedOn = ts
+	}
+	if en.Updated != "" {
+		ts, err := parseTimestamp(en.Updated)
+		if err != nil {
+			return ret, errors.Wrap(err, "parsing the date the note was updated")
+		}
+
+		ret.EditedOn = ts
+	}
+
+	ret.Tags = normalizeTags(en.Tags)
+
+	return ret, nil
+}
+
+// readENEX reads the notes in the Evernote export at the given path. The notes
+// are put in the given book or, if no book is given, in a book named after the file.
+func readENEX(path, book string) ([]note, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	if book == "" {
+		base := filepath.Base(path)
+		book = normalizeName(strings.TrimSuffix(base, filepath.Ext(base)))
+	}
+
+	ret := []note{}
+
+	d := xml.NewDecoder(f)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "decoding the file")
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+
+		var en enexNote
+		if err := d.DecodeElement(&en, &start); err != nil {
+			return nil, errors.Wrap(err, "decoding a note")
+		}
+
+		n, err := parseENEXNote(en)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing the note '%s'", en.Title)
+		}
+		if n.Body == "" {
+			continue
+		}
+
+		n.BookPath = book
+		n.Source = fmt.Sprintf("%s (%s)", path, en.Title)
+
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
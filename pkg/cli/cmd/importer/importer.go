@@ -0,0 +1,362 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nadproject/nad/pkg/cli/consts"
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/nadproject/nad/pkg/cli/infra"
+	"github.com/nadproject/nad/pkg/cli/log"
+	"github.com/nadproject/nad/pkg/cli/utils"
+	"github.com/nadproject/nad/pkg/cli/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+	formatENEX     = "enex"
+)
+
+var formatFlag string
+var bookFlag string
+var dryRunFlag bool
+
+var example = `
+  * Import a directory of Markdown files, such as an export or an Obsidian vault
+  nad import ~/nad-backup
+
+  * Import a JSON export
+  nad import ~/nad-backup.json
+
+  * Import an Evernote notebook into the book 'evernote'
+  nad import ~/Notebook.enex --book evernote
+
+  * See what would be imported without importing anything
+  nad import ~/nad-backup --dry-run
+`
+
+// NewCmd returns a new import command
+func NewCmd(ctx context.NadCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "import <path>",
+		Short:   "Import notes from Markdown files, a JSON export or Evernote",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&formatFlag, "format", "f", "", "the format to import from: markdown, json or enex. Detected from the path by default")
+	f.StringVarP(&bookFlag, "book", "b", "", "the book to import the notes into. The books in the source are nested under it")
+	f.BoolVar(&dryRunFlag, "dry-run", false, "report what would be imported without importing anything")
+
+	return cmd
+}
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	switch formatFlag {
+	case "", formatMarkdown, formatJSON, formatENEX:
+	default:
+		return errors.Errorf("unknown format '%s'", formatFlag)
+	}
+
+	if bookFlag != "" {
+		if err := validate.BookPath(bookFlag); err != nil {
+			return errors.Wrap(err, "invalid book")
+		}
+	}
+
+	return nil
+}
+
+// note is a note read from a source to be imported
+type note struct {
+	// UUID is the uuid of the note in the source, if any. It is used to skip
+	// the notes that already exist.
+	UUID     string
+	BookPath string
+	Body     string
+	AddedOn  int64
+	EditedOn int64
+	Public   bool
+	Tags     []string
+	// Source describes where the note was read from, such as a file path
+	Source string
+}
+
+// detectFormat returns the format of the source at the given path
+func detectFormat(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", path)
+	}
+
+	if info.IsDir() {
+		return formatMarkdown, nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON, nil
+	case ".enex":
+		return formatENEX, nil
+	}
+
+	return "", errors.Errorf("cannot detect the format of %s. Please specify --format", path)
+}
+
+var whitespaceRegexp = regexp.MustCompile(`\s+`)
+
+// normalizeName turns a book or a tag name from another tool into a name that
+// is more likely to be valid, by replacing whitespaces and commas with a dash
+func normalizeName(name string) string {
+	name = strings.TrimSpace(name)
+	name = whitespaceRegexp.ReplaceAllString(name, "-")
+
+	return strings.Replace(name, ",", "-", -1)
+}
+
+// normalizeTags normalizes the given tag names and removes the empty ones
+func normalizeTags(tags []string) []string {
+	ret := []string{}
+	seen := map[string]bool{}
+
+	for _, tag := range tags {
+		tag = normalizeName(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		ret = append(ret, tag)
+	}
+
+	return ret
+}
+
+// parseTimestamp parses a date as written by nad export or the other tools and
+// returns a unix timestamp in nanoseconds
+func parseTimestamp(s string) (int64, error) {
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+		"20060102T150405Z",
+		"2006-01-02",
+	}
+
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t.UnixNano(), nil
+		}
+	}
+
+	return 0, errors.Errorf("unknown date format '%s'", s)
+}
+
+// readNotes reads the notes from the source at the given path. The notes without
+// a book in the source are put in the given book.
+func readNotes(path, format, book string) ([]note, error) {
+	switch format {
+	case formatMarkdown:
+		return readMarkdown(path, book)
+	case formatJSON:
+		return readJSON(path, book)
+	case formatENEX:
+		return readENEX(path, book)
+	}
+
+	return nil, errors.Errorf("unknown format '%s'", format)
+}
+
+// result is a summary of an import
+type result struct {
+	Notes     int
+	Books     int
+	Duplicate int
+}
+
+func countBooks(db *database.DB) (int, error) {
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM books").Scan(&count); err != nil {
+		return 0, errors.Wrap(err, "counting books")
+	}
+
+	return count, nil
+}
+
+// noteExists checks if a note with the given uuid exists
+func noteExists(db *database.DB, uuid string) (bool, error) {
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM notes WHERE uuid = ?", uuid).Scan(&count); err != nil {
+		return false, errors.Wrap(err, "counting notes")
+	}
+
+	return count > 0, nil
+}
+
+// importNote inserts the given note as a dirty row so that the next sync uploads it
+func importNote(ctx context.NadCtx, tx *database.DB, n note) error {
+	if err := validate.BookPath(n.BookPath); err != nil {
+		return err
+	}
+	if err := validate.TagNames(n.Tags); err != nil {
+		return err
+	}
+
+	bookUUID, err := database.FindOrCreateBook(tx, n.BookPath)
+	if err != nil {
+		return errors.Wrap(err, "finding the book")
+	}
+
+	uuid := n.UUID
+	if uuid == "" {
+		uuid = utils.GenerateUUID()
+	}
+	addedOn := n.AddedOn
+	if addedOn == 0 {
+		addedOn = ctx.Clock.Now().UnixNano()
+	}
+
+	dn := database.NewNote(uuid, bookUUID, n.Body, addedOn, n.EditedOn, 0, n.Public, false, true)
+	if err := dn.Insert(tx); err != nil {
+		return errors.Wrap(err, "creating the note")
+	}
+
+	if err := database.SetNoteTags(tx, uuid, n.Tags); err != nil {
+		return errors.Wrap(err, "tagging the note")
+	}
+
+	return nil
+}
+
+// importNotes imports the given notes in a transaction, skipping the notes whose
+// uuid already exists. If dryRun is true, the transaction is rolled back.
+func importNotes(ctx context.NadCtx, notes []note, dryRun bool) (result, error) {
+	var ret result
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return ret, errors.Wrap(err, "beginning a transaction")
+	}
+
+	bookCount, err := countBooks(tx)
+	if err != nil {
+		tx.Rollback()
+		return ret, err
+	}
+
+	for _, n := range notes {
+		if n.UUID != "" {
+			ok, err := noteExists(tx, n.UUID)
+			if err != nil {
+				tx.Rollback()
+				return ret, errors.Wrapf(err, "checking %s", n.Source)
+			}
+			if ok {
+				log.Plainf("skip %s: note %s already exists\n", n.Source, n.UUID)
+				ret.Duplicate++
+				continue
+			}
+		}
+
+		if err := importNote(ctx, tx, n); err != nil {
+			tx.Rollback()
+			return ret, errors.Wrapf(err, "importing %s", n.Source)
+		}
+
+		if dryRun {
+			log.Plainf("add %s to %s\n", n.Source, n.BookPath)
+		}
+		ret.Notes++
+	}
+
+	newBookCount, err := countBooks(tx)
+	if err != nil {
+		tx.Rollback()
+		return ret, err
+	}
+	ret.Books = newBookCount - bookCount
+
+	if dryRun {
+		tx.Rollback()
+		return ret, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return ret, errors.Wrap(err, "committing a transaction")
+	}
+
+	return ret, nil
+}
+
+func newRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+
+		format := formatFlag
+		if format == "" {
+			f, err := detectFormat(path)
+			if err != nil {
+				return err
+			}
+
+			format = f
+		}
+
+		notes, err := readNotes(path, format, strings.Trim(bookFlag, consts.BookPathSeparator))
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", path)
+		}
+
+		res, err := importNotes(ctx, notes, dryRunFlag)
+		if err != nil {
+			return errors.Wrap(err, "importing notes")
+		}
+
+		if dryRunFlag {
+			log.Infof("would import %d notes and create %d books. %d duplicate notes would be skipped\n", res.Notes, res.Books, res.Duplicate)
+			return nil
+		}
+
+		log.Successf("imported %d notes and created %d books. skipped %d duplicate notes\n", res.Notes, res.Books, res.Duplicate)
+		if res.Notes > 0 {
+			log.Plain("The notes will be uploaded once you run `nad sync`.\n")
+		}
+
+		return nil
+	}
+}
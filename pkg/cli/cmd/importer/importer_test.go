@@ -0,0 +1,255 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/cli/database"
+)
+
+func TestNormalizeName(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "js",
+			expected: "js",
+		},
+		{
+			input:    " Daily  Notes ",
+			expected: "Daily-Notes",
+		},
+		{
+			input:    "to do,later",
+			expected: "to-do-later",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result := normalizeName(tc.input)
+			assert.Equal(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	expected := time.Date(2019, time.January, 2, 3, 4, 5, 0, time.UTC).UnixNano()
+
+	testCases := []string{
+		"2019-01-02T03:04:05Z",
+		"2019-01-02T03:04:05.000Z",
+		"2019-01-02 03:04:05Z",
+		"2019-01-02 03:04:05",
+		"20190102T030405Z",
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result, err := parseTimestamp(tc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, result, expected, "result mismatch")
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseTimestamp("yesterday")
+		assert.NotEqual(t, err, nil, "error mismatch")
+	})
+}
+
+func TestParseMarkdown(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected note
+	}{
+		{
+			content: "foo\nbar\n",
+			expected: note{
+				Body: "foo\nbar",
+			},
+		},
+		{
+			content: `---
+uuid: 43827b9a-c2b0-4c06-a290-97991c896653
+added_on: "2018-01-06T00:52:23Z"
+public: true
+tags:
+- a
+- b
+---
+
+foo
+bar
+`,
+			expected: note{
+				UUID:    "43827b9a-c2b0-4c06-a290-97991c896653",
+				Body:    "foo\nbar",
+				AddedOn: 1515199943000000000,
+				Public:  true,
+				Tags:    []string{"a", "b"},
+			},
+		},
+		{
+			content: "---\r\ntitle: Plan\r\ncreated: 2018-01-06 00:52:23Z\r\nupdated: 2018-01-06 00:52:24Z\r\ntags: foo, bar baz\r\n---\r\nfoo\r\n",
+			expected: note{
+				Body:     "# Plan\n\nfoo",
+				AddedOn:  1515199943000000000,
+				EditedOn: 1515199944000000000,
+				Tags:     []string{"foo", "bar", "baz"},
+			},
+		},
+		{
+			content: "---\n---\nfoo",
+			expected: note{
+				Body: "foo",
+				Tags: []string{},
+			},
+		},
+		{
+			content: "---\nfoo",
+			expected: note{
+				Body: "---\nfoo",
+			},
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result, err := parseMarkdown([]byte(tc.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.DeepEqual(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestMarkdownBookPath(t *testing.T) {
+	testCases := []struct {
+		relDir   string
+		book     string
+		expected string
+	}{
+		{
+			relDir:   ".",
+			book:     "",
+			expected: "My-Vault",
+		},
+		{
+			relDir:   ".",
+			book:     "imported",
+			expected: "imported",
+		},
+		{
+			relDir:   "work/Daily Notes",
+			book:     "",
+			expected: "work/Daily-Notes",
+		},
+		{
+			relDir:   "work",
+			book:     "imported",
+			expected: "imported/work",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result := markdownBookPath(tc.relDir, "My Vault", tc.book)
+			assert.Equal(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestGetDocumentBookPaths(t *testing.T) {
+	t.Run("nested", func(t *testing.T) {
+		books := []database.Book{
+			{UUID: "b1-uuid", Name: "work"},
+			{UUID: "b2-uuid", Name: "infra", ParentUUID: "b1-uuid"},
+			{UUID: "b3-uuid", Name: "k8s", ParentUUID: "b2-uuid"},
+			{UUID: "b4-uuid", Name: "aws", ParentUUID: "missing-uuid"},
+		}
+
+		result, err := getDocumentBookPaths(books)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.DeepEqual(t, result, map[string]string{
+			"b1-uuid": "work",
+			"b2-uuid": "work/infra",
+			"b3-uuid": "work/infra/k8s",
+			"b4-uuid": "aws",
+		}, "result mismatch")
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		books := []database.Book{
+			{UUID: "b1-uuid", Name: "foo", ParentUUID: "b2-uuid"},
+			{UUID: "b2-uuid", Name: "bar", ParentUUID: "b1-uuid"},
+		}
+
+		_, err := getDocumentBookPaths(books)
+		assert.NotEqual(t, err, nil, "error mismatch")
+	})
+}
+
+func TestENMLToText(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    `<?xml version="1.0" encoding="UTF-8" standalone="no"?><!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd"><en-note><div>foo</div><div>bar</div></en-note>`,
+			expected: "foo\nbar",
+		},
+		{
+			input:    `<en-note><div>milk &amp; eggs&nbsp;now<br/>later</div></en-note>`,
+			expected: "milk & eggs now\nlater",
+		},
+		{
+			input:    `<en-note><div><en-todo checked="true"/>done</div><div><en-todo/>todo</div></en-note>`,
+			expected: "[x] done\n[ ] todo",
+		},
+		{
+			input:    `<en-note><ul><li>one</li><li>two</li></ul><p></p><p></p><p></p><div>end</div></en-note>`,
+			expected: "- one\n- two\n\nend",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result, err := enmlToText(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/pkg/errors"
+)
+
+// document is the JSON document written by nad export
+type document struct {
+	Books []database.Book `json:"books"`
+}
+
+// getDocumentBookPaths returns a map of the uuids of the books in the document to
+// their paths. A book whose parent is not in the document is a top-level book.
+func getDocumentBookPaths(books []database.Book) (map[string]string, error) {
+	byUUID := map[string]database.Book{}
+	for _, b := range books {
+		byUUID[b.UUID] = b
+	}
+
+	ret := map[string]string{}
+	for _, b := range books {
+		names := []string{}
+		seen := map[string]bool{}
+
+		cur, ok := b, true
+		for ok {
+			if seen[cur.UUID] {
+				return nil, errors.Errorf("the book %s is nested in itself", b.UUID)
+			}
+			seen[cur.UUID] = true
+
+			names = append([]string{cur.Name}, names...)
+			cur, ok = byUUID[cur.ParentUUID]
+		}
+
+		ret[b.UUID] = database.JoinBookPath(names...)
+	}
+
+	return ret, nil
+}
+
+// readJSON reads the notes in the JSON document at the given path. The books in
+// the document are nested under the given book, if any.
+func readJSON(path, book string) ([]note, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the file")
+	}
+	defer f.Close()
+
+	var doc document
+	if err := json.NewDecoder(f).Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "decoding the document")
+	}
+
+	paths, err := getDocumentBookPaths(doc.Books)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []note{}
+	for _, b := range doc.Books {
+		if b.Deleted {
+			continue
+		}
+
+		bookPath := paths[b.UUID]
+		if book != "" {
+			bookPath = database.JoinBookPath(book, bookPath)
+		}
+
+		for _, n := range b.Notes {
+			if n.Deleted || n.Body == "" {
+				continue
+			}
+
+			ret = append(ret, note{
+				UUID:     n.UUID,
+				BookPath: bookPath,
+				Body:     n.Body,
+				AddedOn:  n.AddedOn,
+				EditedOn: n.EditedOn,
+				Public:   n.Public,
+				Tags:     n.Tags,
+				Source:   fmt.Sprintf("%s (note %s)", path, n.UUID),
+			})
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,239 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package importer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nadproject/nad/pkg/cli/database"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// tagList is a list of tags in a front matter. Some tools write the tags as a
+// single string separated by commas or spaces, rather than a list.
+type tagList []string
+
+// UnmarshalYAML unmarshals either a list or a string into a tagList
+func (t *tagList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*t = list
+		return nil
+	}
+
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	*t = strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	return nil
+}
+
+// frontMatter is the metadata at the top of a Markdown file. It understands the
+// fields written by nad export, as well as the ones written by Joplin.
+type frontMatter struct {
+	UUID     string  `yaml:"uuid"`
+	AddedOn  string  `yaml:"added_on"`
+	EditedOn string  `yaml:"edited_on"`
+	Created  string  `yaml:"created"`
+	Updated  string  `yaml:"updated"`
+	Public   bool    `yaml:"public"`
+	Title    string  `yaml:"title"`
+	Tags     tagList `yaml:"tags"`
+}
+
+// splitFrontMatter splits the given content of a Markdown file into the front
+// matter and the body. The front matter is nil if the content has none.
+func splitFrontMatter(content []byte) ([]byte, string) {
+	content = bytes.Replace(content, []byte("\r\n"), []byte("\n"), -1)
+
+	if !bytes.HasPrefix(content, []byte("---\n")) {
+		return nil, string(content)
+	}
+
+	rest := content[len("---\n"):]
+	if bytes.HasPrefix(rest, []byte("---\n")) {
+		return []byte{}, string(rest[len("---\n"):])
+	}
+
+	idx := bytes.Index(rest, []byte("\n---\n"))
+	if idx == -1 {
+		if bytes.HasSuffix(rest, []byte("\n---")) {
+			return rest[:len(rest)-len("\n---")], ""
+		}
+
+		return nil, string(content)
+	}
+
+	return rest[:idx], string(rest[idx+len("\n---\n"):])
+}
+
+// parseMarkdown parses the content of a Markdown file into a note
+func parseMarkdown(content []byte) (note, error) {
+	var ret note
+
+	meta, body := splitFrontMatter(content)
+	ret.Body = strings.Trim(body, "\n")
+
+	if meta == nil {
+		return ret, nil
+	}
+
+	var fm frontMatter
+	if err := yaml.Unmarshal(meta, &fm); err != nil {
+		return ret, errors.Wrap(err, "parsing the front matter")
+	}
+
+	addedOn := fm.AddedOn
+	if addedOn == "" {
+		addedOn = fm.Created
+	}
+	if addedOn != "" {
+		ts, err := parseTimestamp(addedOn)
+		if err != nil {
+			return ret, errors.Wrap(err, "parsing the date the note was added on")
+		}
+
+		ret.AddedOn = ts
+	}
+
+	editedOn := fm.EditedOn
+	if editedOn == "" {
+		editedOn = fm.Updated
+	}
+	if editedOn != "" {
+		ts, err := parseTimestamp(editedOn)
+		if err != nil {
+			return ret, errors.Wrap(err, "parsing the date the note was edited on")
+		}
+
+		ret.EditedOn = ts
+	}
+
+	if fm.Title != "" && !strings.HasPrefix(ret.Body, "# "+fm.Title) {
+		ret.Body = strings.TrimRight("# "+fm.Title+"\n\n"+ret.Body, "\n")
+	}
+
+	ret.UUID = fm.UUID
+	ret.Public = fm.Public
+	ret.Tags = normalizeTags(fm.Tags)
+
+	return ret, nil
+}
+
+// markdownBookPath returns the path of the book for the given directory relative
+// to the root of the import
+func markdownBookPath(relDir, rootName, book string) string {
+	if relDir == "." {
+		if book != "" {
+			return book
+		}
+
+		return normalizeName(rootName)
+	}
+
+	var names []string
+	if book != "" {
+		names = append(names, book)
+	}
+	for _, name := range strings.Split(filepath.ToSlash(relDir), "/") {
+		names = append(names, normalizeName(name))
+	}
+
+	return database.JoinBookPath(names...)
+}
+
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+
+	return ext == ".md" || ext == ".markdown"
+}
+
+// readMarkdown reads the Markdown files in the given directory. Each directory is
+// a book, and the files in the root directory are put in the given book or,
+// if no book is given, in a book named after the directory.
+func readMarkdown(root, book string) ([]note, error) {
+	root = filepath.Clean(root)
+	rootName := filepath.Base(root)
+	if abs, err := filepath.Abs(root); err == nil {
+		rootName = filepath.Base(abs)
+	}
+
+	ret := []note{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden files and directories, such as .obsidian and .git
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+		if info.IsDir() || !isMarkdownFile(info.Name()) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", path)
+		}
+
+		n, err := parseMarkdown(content)
+		if err != nil {
+			return errors.Wrapf(err, "parsing %s", path)
+		}
+		if n.Body == "" {
+			return nil
+		}
+
+		relDir, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return errors.Wrapf(err, "getting the directory of %s", path)
+		}
+
+		n.BookPath = markdownBookPath(relDir, rootName, book)
+		if n.AddedOn == 0 {
+			n.AddedOn = info.ModTime().UnixNano()
+		}
+		n.Source = path
+
+		ret = append(ret, n)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -33,7 +33,12 @@ import (
 )
 
 var example = `
-  nad login`
+  nad login
+
+  * Sign in with the identity provider of a self-hosted server
+  nad login --sso`
+
+var ssoFlag bool
 
 // NewCmd returns a new login command
 func NewCmd(ctx context.NadCtx) *cobra.Command {
@@ -44,16 +49,56 @@ func NewCmd(ctx context.NadCtx) *cobra.Command {
 		RunE:    newRun(ctx),
 	}
 
+	f := cmd.Flags()
+	f.BoolVarP(&ssoFlag, "sso", "", false, "sign in with single sign-on in the browser")
+
 	return cmd
 }
 
-// Do dervies credentials on the client side and requests a session token from the server
+// promptTwoFactorCode asks for a code from the authenticator app or a recovery code
+func promptTwoFactorCode() (string, error) {
+	var code string
+	if err := ui.PromptInput("two-factor code (or a recovery code)", &code); err != nil {
+		return "", errors.Wrap(err, "getting two-factor code input")
+	}
+	if code == "" {
+		return "", errors.New("Two-factor code is empty")
+	}
+
+	return code, nil
+}
+
+// Do dervies credentials on the client side and requests a session token from the server.
+// If the user has enabled two-factor authentication, it prompts for a code to complete the sign in.
 func Do(ctx context.NadCtx, email, password string) error {
 	signinResp, err := client.Signin(ctx, email, password)
 	if err != nil {
 		return errors.Wrap(err, "requesting session")
 	}
 
+	return completeSignin(ctx, signinResp)
+}
+
+// completeSignin saves the session from the given response. If the user has
+// enabled two-factor authentication, it first prompts for a code to get the session.
+func completeSignin(ctx context.NadCtx, signinResp client.SigninResponse) error {
+	if signinResp.TwoFactorRequired {
+		code, err := promptTwoFactorCode()
+		if err != nil {
+			return err
+		}
+
+		signinResp, err = client.SigninTwoFactor(ctx, signinResp.TwoFactorToken, code)
+		if err != nil {
+			return errors.Wrap(err, "completing two-factor sign in")
+		}
+	}
+
+	return saveSession(ctx, signinResp)
+}
+
+// saveSession saves the session from the given response
+func saveSession(ctx context.NadCtx, signinResp client.SigninResponse) error {
 	db := ctx.DB
 	tx, err := db.Begin()
 	if err != nil {
@@ -76,6 +121,15 @@ func newRun(ctx context.NadCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
 		log.Plain("Welcome to NAD Pro (https://www.getnad.com).\n")
 
+		if ssoFlag {
+			if err := DoSSO(ctx); err != nil {
+				return errors.Wrap(err, "logging in with single sign-on")
+			}
+
+			log.Success("logged in\n")
+			return nil
+		}
+
 		var email, password string
 		if err := ui.PromptInput("email", &email); err != nil {
 			return errors.Wrap(err, "getting email input")
@@ -95,6 +149,9 @@ func newRun(ctx context.NadCtx) infra.RunEFunc {
 		if errors.Cause(err) == client.ErrInvalidLogin {
 			log.Error("invalid credentials\n")
 			return nil
+		} else if errors.Cause(err) == client.ErrInvalidTwoFactorCode {
+			log.Error("wrong two-factor code, or the sign in has expired\n")
+			return nil
 		} else if err != nil {
 			return errors.Wrap(err, "logging in")
 		}
@@ -0,0 +1,150 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package login
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/log"
+	"github.com/pkg/errors"
+)
+
+// ssoTimeout is how long to wait for the single sign-on to be completed in the browser
+const ssoTimeout = 5 * time.Minute
+
+// getWebURL returns the URL of the web application of the server, which is
+// served under the same host as the API
+func getWebURL(apiEndpoint string) string {
+	return strings.TrimSuffix(strings.TrimRight(apiEndpoint, "/"), "/api")
+}
+
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+
+	return cmd.Start()
+}
+
+type ssoResult struct {
+	code string
+	err  error
+}
+
+// newCallbackHandler returns a handler for the redirect from the server after
+// the single sign-on. It sends the code from the server to the given channel.
+func newCallbackHandler(state string, results chan<- ssoResult) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var res ssoResult
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			res.err = errors.New("state mismatch")
+			http.Error(w, "The sign in could not be verified. Please try again.", http.StatusBadRequest)
+		} else if q.Get("code") == "" {
+			res.err = errors.New("no code received")
+			http.Error(w, "The sign in failed. Please try again.", http.StatusBadRequest)
+		} else {
+			res.code = q.Get("code")
+			fmt.Fprintln(w, "Signed in to NAD. You can close this window and return to the terminal.")
+		}
+
+		// Send the response before the listener is closed
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		select {
+		case results <- res:
+		default:
+		}
+	}
+}
+
+// DoSSO signs in with the identity provider of the server in the browser. The
+// server redirects the browser to a local listener with a code, which is
+// exchanged for a session token. If the user has enabled two-factor
+// authentication, it prompts for a code to complete the sign in.
+func DoSSO(ctx context.NadCtx) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return errors.Wrap(err, "generating state")
+	}
+	state := hex.EncodeToString(b)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Wrap(err, "listening for the callback")
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	results := make(chan ssoResult, 1)
+	srv := &http.Server{Handler: newCallbackHandler(state, results)}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	q := url.Values{}
+	q.Set("cli_port", fmt.Sprintf("%d", port))
+	q.Set("cli_state", state)
+	loginURL := fmt.Sprintf("%s/login/oidc?%s", getWebURL(ctx.APIEndpoint), q.Encode())
+
+	log.Plainf("Opening the browser to sign in. If it does not open, visit:\n%s\n", loginURL)
+	if err := openBrowser(loginURL); err != nil {
+		log.Debug("opening browser: %s\n", err.Error())
+	}
+
+	var res ssoResult
+	select {
+	case res = <-results:
+	case <-time.After(ssoTimeout):
+		return errors.New("timed out waiting for the sign in")
+	}
+	if res.err != nil {
+		return res.err
+	}
+
+	signinResp, err := client.SigninOIDC(ctx, res.code)
+	if err != nil {
+		return errors.Wrap(err, "requesting session")
+	}
+
+	return completeSignin(ctx, signinResp)
+}
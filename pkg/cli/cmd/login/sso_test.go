@@ -0,0 +1,75 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package login
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestGetWebURL(t *testing.T) {
+	testCases := []struct {
+		apiEndpoint string
+		expected    string
+	}{
+		{apiEndpoint: "https://nad.example.com/api", expected: "https://nad.example.com"},
+		{apiEndpoint: "https://nad.example.com/api/", expected: "https://nad.example.com"},
+		{apiEndpoint: "http://localhost:3000/api", expected: "http://localhost:3000"},
+		{apiEndpoint: "https://api.example.com", expected: "https://api.example.com"},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			assert.Equal(t, getWebURL(tc.apiEndpoint), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestCallbackHandler(t *testing.T) {
+	testCases := []struct {
+		path         string
+		expectedCode int
+		expectedRes  string
+		expectedErr  bool
+	}{
+		{path: "/callback?code=abc&state=s1", expectedCode: http.StatusOK, expectedRes: "abc"},
+		{path: "/callback?code=abc&state=s2", expectedCode: http.StatusBadRequest, expectedErr: true},
+		{path: "/callback?state=s1", expectedCode: http.StatusBadRequest, expectedErr: true},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			results := make(chan ssoResult, 1)
+			h := newCallbackHandler("s1", results)
+
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest("GET", tc.path, nil))
+
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+
+			res := <-results
+			assert.Equal(t, res.code, tc.expectedRes, "code mismatch")
+			assert.Equal(t, res.err != nil, tc.expectedErr, "error mismatch")
+		})
+	}
+}
@@ -76,6 +76,9 @@ func Do(ctx context.NadCtx) error {
 	if err := database.DeleteSystem(tx, consts.SystemSessionKeyExpiry); err != nil {
 		return errors.Wrap(err, "deleting session key expiry")
 	}
+	if err := database.DeleteSystem(tx, consts.SystemCipherKey); err != nil {
+		return errors.Wrap(err, "deleting cipher key")
+	}
 
 	tx.Commit()
 
@@ -172,7 +172,7 @@ func runBook(ctx context.NadCtx, bookLabel string) error {
 		return errors.Wrap(err, "finding book uuid")
 	}
 
-	ok, err := maybeConfirm(fmt.Sprintf("delete book '%s' and all its notes?", bookLabel), false)
+	ok, err := maybeConfirm(fmt.Sprintf("delete book '%s', its nested books and all their notes?", bookLabel), false)
 	if err != nil {
 		return errors.Wrap(err, "getting confirmation")
 	}
@@ -186,16 +186,24 @@ func runBook(ctx context.NadCtx, bookLabel string) error {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	if _, err = tx.Exec("UPDATE notes SET deleted = ?, dirty = ?, body = ? WHERE book_uuid = ?", true, true, "", bookUUID); err != nil {
+	uuids, err := database.GetSubtreeBookUUIDs(tx, bookUUID)
+	if err != nil {
 		tx.Rollback()
-		return errors.Wrap(err, "removing notes in the book")
+		return errors.Wrap(err, "finding the nested books")
 	}
 
-	// override the name with a random string
-	uniqLabel := utils.GenerateUUID()
-	if _, err = tx.Exec("UPDATE books SET deleted = ?, dirty = ?, name = ? WHERE uuid = ?", true, true, uniqLabel, bookUUID); err != nil {
-		tx.Rollback()
-		return errors.Wrap(err, "removing the book")
+	for _, uuid := range uuids {
+		if _, err = tx.Exec("UPDATE notes SET deleted = ?, dirty = ?, body = ? WHERE book_uuid = ?", true, true, "", uuid); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "removing notes in the book")
+		}
+
+		// override the name with a random string
+		uniqLabel := utils.GenerateUUID()
+		if _, err = tx.Exec("UPDATE books SET deleted = ?, dirty = ?, name = ? WHERE uuid = ?", true, true, uniqLabel, uuid); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "removing the book")
+		}
 	}
 
 	err = tx.Commit()
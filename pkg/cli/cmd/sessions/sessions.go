@@ -0,0 +1,157 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sessions
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/infra"
+	"github.com/nadproject/nad/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var othersFlag bool
+
+var example = `
+  * List the devices signed in to your account
+  nad sessions
+
+  * Revoke a session by id
+  nad sessions revoke 3
+
+  * Revoke all sessions except the one of this machine
+  nad sessions revoke --others`
+
+// NewCmd returns a new sessions command
+func NewCmd(ctx context.NadCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "sessions",
+		Short:   "List and revoke the sessions signed in to your account",
+		Example: example,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 0 {
+				return errors.New("Incorrect number of argument")
+			}
+
+			return nil
+		},
+		RunE: newListRun(ctx),
+	}
+
+	revokeCmd := &cobra.Command{
+		Use:     "revoke <id>",
+		Short:   "Revoke a session",
+		PreRunE: revokePreRun,
+		RunE:    newRevokeRun(ctx),
+	}
+	revokeCmd.Flags().BoolVar(&othersFlag, "others", false, "revoke all sessions except the one of this machine")
+
+	cmd.AddCommand(revokeCmd)
+
+	return cmd
+}
+
+func revokePreRun(cmd *cobra.Command, args []string) error {
+	if othersFlag && len(args) != 0 {
+		return errors.New("--others cannot be used with a session id")
+	}
+	if !othersFlag && len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+func requireLogin(ctx context.NadCtx) error {
+	if ctx.SessionKey == "" {
+		return errors.New("not logged in")
+	}
+
+	return nil
+}
+
+// printSessions writes the given sessions as a table
+func printSessions(w io.Writer, sessions []client.SessionResp) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ID\tDEVICE\tIP\tLAST USED\t")
+	for _, s := range sessions {
+		var current string
+		if s.Current {
+			current = "(current)"
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", s.ID, s.UserAgent, s.IP, s.LastUsedAt.Local().Format("2006-01-02 15:04"), current)
+	}
+
+	return tw.Flush()
+}
+
+func newListRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := requireLogin(ctx); err != nil {
+			return err
+		}
+
+		sessions, err := client.GetSessions(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting the sessions")
+		}
+
+		return printSessions(os.Stdout, sessions)
+	}
+}
+
+func newRevokeRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := requireLogin(ctx); err != nil {
+			return err
+		}
+
+		if othersFlag {
+			count, err := client.DeleteOtherSessions(ctx)
+			if err != nil {
+				return errors.Wrap(err, "revoking the sessions")
+			}
+
+			log.Successf("revoked %d sessions\n", count)
+			return nil
+		}
+
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return errors.Errorf("invalid session id '%s'", args[0])
+		}
+
+		if err := client.DeleteSession(ctx, uint(id)); err != nil {
+			return errors.Wrap(err, "revoking the session")
+		}
+
+		log.Successf("revoked session %d\n", id)
+
+		return nil
+	}
+}
@@ -0,0 +1,59 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sessions
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/pkg/errors"
+)
+
+func TestPrintSessions(t *testing.T) {
+	sessions := []client.SessionResp{
+		{
+			ID:         3,
+			UserAgent:  "nad-cli/0.10.0 (linux; laptop)",
+			IP:         "10.0.0.1",
+			LastUsedAt: time.Date(2019, time.October, 1, 12, 0, 0, 0, time.Local),
+			Current:    true,
+		},
+		{
+			ID:         12,
+			UserAgent:  "Mozilla/5.0",
+			IP:         "10.0.0.2",
+			LastUsedAt: time.Date(2019, time.September, 1, 8, 30, 0, 0, time.Local),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := printSessions(&buf, sessions); err != nil {
+		t.Fatal(errors.Wrap(err, "printing"))
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	assert.Equal(t, len(lines), 3, "line count mismatch")
+	assert.Equal(t, lines[0], "ID  DEVICE                          IP        LAST USED         ", "header mismatch")
+	assert.Equal(t, lines[1], "3   nad-cli/0.10.0 (linux; laptop)  10.0.0.1  2019-10-01 12:00  (current)", "first row mismatch")
+	assert.Equal(t, lines[2], "12  Mozilla/5.0                     10.0.0.2  2019-09-01 08:30  ", "second row mismatch")
+}
@@ -21,6 +21,7 @@ package sync
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/nadproject/nad/pkg/cli/client"
@@ -112,11 +113,12 @@ func maxInt64(a, b int64) int64 {
 func reportBookConflict(tx *database.DB, body, localBookUUID, serverBookUUID string) (string, error) {
 	var builder strings.Builder
 
-	var localBookName, serverBookName string
-	if err := tx.QueryRow("SELECT name FROM books WHERE uuid = ?", localBookUUID).Scan(&localBookName); err != nil {
+	localBookName, err := database.GetBookPath(tx, localBookUUID)
+	if err != nil {
 		return "", errors.Wrapf(err, "getting book name for %s", localBookUUID)
 	}
-	if err := tx.QueryRow("SELECT name FROM books WHERE uuid = ?", serverBookUUID).Scan(&serverBookName); err != nil {
+	serverBookName, err := database.GetBookPath(tx, serverBookUUID)
+	if err != nil {
 		return "", errors.Wrapf(err, "getting book name for %s", serverBookUUID)
 	}
 
@@ -134,11 +136,11 @@ func reportBookConflict(tx *database.DB, body, localBookUUID, serverBookUUID str
 func getConflictsBookUUID(tx *database.DB) (string, error) {
 	var ret string
 
-	err := tx.QueryRow("SELECT uuid FROM books WHERE name = ?", "conflicts").Scan(&ret)
+	err := tx.QueryRow("SELECT uuid FROM books WHERE parent_uuid = '' AND name = ?", "conflicts").Scan(&ret)
 	if err == sql.ErrNoRows {
 		// Create a conflicts book
 		ret = utils.GenerateUUID()
-		b := database.NewBook(ret, "conflicts", 0, false, true)
+		b := database.NewBook(ret, "conflicts", "", 0, false, true)
 		err = b.Insert(tx)
 		if err != nil {
 			tx.Rollback()
@@ -156,6 +158,28 @@ type noteMergeReport struct {
 	body     string
 	bookUUID string
 	editedOn int64
+	tags     []string
+}
+
+// mergeTags returns the union of the local and the server tags, ordered by name
+func mergeTags(localTags, serverTags []string) []string {
+	seen := map[string]bool{}
+	ret := []string{}
+
+	for _, tags := range [][]string{localTags, serverTags} {
+		for _, tag := range tags {
+			if seen[tag] {
+				continue
+			}
+
+			seen[tag] = true
+			ret = append(ret, tag)
+		}
+	}
+
+	sort.Strings(ret)
+
+	return ret
 }
 
 // mergeNoteFields  performs a field-by-field merge between the local and the server copy. It returns a merge report
@@ -166,6 +190,7 @@ func mergeNoteFields(tx *database.DB, localNote database.Note, serverNote client
 			body:     serverNote.Body,
 			bookUUID: serverNote.BookUUID,
 			editedOn: serverNote.EditedOn,
+			tags:     serverNote.Tags,
 		}, nil
 	}
 
@@ -190,10 +215,16 @@ func mergeNoteFields(tx *database.DB, localNote database.Note, serverNote client
 		bookUUID = serverNote.BookUUID
 	}
 
+	localTags, err := database.GetNoteTags(tx, serverNote.UUID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting local tags for note %s", serverNote.UUID)
+	}
+
 	ret := noteMergeReport{
 		body:     body,
 		bookUUID: bookUUID,
 		editedOn: maxInt64(localNote.EditedOn, serverNote.EditedOn),
+		tags:     mergeTags(localTags, serverNote.Tags),
 	}
 
 	return &ret, nil
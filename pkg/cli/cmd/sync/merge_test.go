@@ -149,3 +149,35 @@ bar
 		})
 	}
 }
+
+func TestMergeTags(t *testing.T) {
+	testCases := []struct {
+		local    []string
+		server   []string
+		expected []string
+	}{
+		{
+			local:    []string{},
+			server:   []string{},
+			expected: []string{},
+		},
+		{
+			local:    []string{"scope"},
+			server:   nil,
+			expected: []string{"scope"},
+		},
+		{
+			local:    []string{"scope", "closure"},
+			server:   []string{"hoisting", "closure"},
+			expected: []string{"closure", "hoisting", "scope"},
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result := mergeTags(tc.local, tc.server)
+
+			assert.DeepEqual(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
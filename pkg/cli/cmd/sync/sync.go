@@ -21,10 +21,12 @@ package sync
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 
 	"github.com/nadproject/nad/pkg/cli/client"
 	"github.com/nadproject/nad/pkg/cli/consts"
 	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/crypt"
 	"github.com/nadproject/nad/pkg/cli/database"
 	"github.com/nadproject/nad/pkg/cli/infra"
 	"github.com/nadproject/nad/pkg/cli/log"
@@ -44,6 +46,9 @@ var example = `
 
 var isFullSync bool
 
+// ErrCipherKeyMissing is an error for receiving encrypted data without a cipher key
+var ErrCipherKeyMissing = errors.New("the server has encrypted data but no passphrase is set up. Please run `nad encrypt`")
+
 // NewCmd returns a new sync command
 func NewCmd(ctx context.NadCtx) *cobra.Command {
 	cmd := &cobra.Command{
@@ -96,7 +101,7 @@ func (l syncList) getLength() int {
 
 // processFragments categorizes items in sync fragments into a sync list. It also decrypts any
 // encrypted data in sync fragments.
-func processFragments(fragments []client.SyncFragment) (syncList, error) {
+func processFragments(fragments []client.SyncFragment, cipherKey []byte) (syncList, error) {
 	notes := map[string]client.SyncFragNote{}
 	books := map[string]client.SyncFragBook{}
 	expungedNotes := map[string]bool{}
@@ -126,6 +131,39 @@ func processFragments(fragments []client.SyncFragment) (syncList, error) {
 		}
 	}
 
+	for uuid, note := range notes {
+		if !note.Encrypted || note.Deleted {
+			continue
+		}
+		if cipherKey == nil {
+			return syncList{}, ErrCipherKeyMissing
+		}
+
+		body, err := crypt.Decrypt(cipherKey, note.Body)
+		if err != nil {
+			return syncList{}, errors.Wrapf(err, "decrypting the note %s", uuid)
+		}
+
+		note.Body = body
+		notes[uuid] = note
+	}
+	for uuid, book := range books {
+		if !book.Encrypted || book.Deleted {
+			continue
+		}
+		if cipherKey == nil {
+			return syncList{}, ErrCipherKeyMissing
+		}
+
+		name, err := crypt.Decrypt(cipherKey, book.Name)
+		if err != nil {
+			return syncList{}, errors.Wrapf(err, "decrypting the book %s", uuid)
+		}
+
+		book.Name = name
+		books[uuid] = book
+	}
+
 	sl := syncList{
 		Notes:          notes,
 		Books:          books,
@@ -146,7 +184,7 @@ func getSyncList(ctx context.NadCtx, afterUSN int) (syncList, error) {
 		return syncList{}, errors.Wrap(err, "getting sync fragments")
 	}
 
-	ret, err := processFragments(fragments)
+	ret, err := processFragments(fragments, ctx.CipherKey)
 	if err != nil {
 		return syncList{}, errors.Wrap(err, "making sync list")
 	}
@@ -183,16 +221,17 @@ func getSyncFragments(ctx context.NadCtx, afterUSN int) ([]client.SyncFragment,
 	return buf, nil
 }
 
-// resolveLabel resolves a book name conflict by repeatedly appending an increasing integer
-// to the name until it finds a unique name. It returns the first non-conflicting name.
-func resolveLabel(tx *database.DB, name string) (string, error) {
+// resolveLabel resolves a book name conflict among the children of the given parent by repeatedly
+// appending an increasing integer to the name until it finds a unique name. It returns the first
+// non-conflicting name.
+func resolveLabel(tx *database.DB, parentUUID, name string) (string, error) {
 	var ret string
 
 	for i := 2; ; i++ {
 		ret = fmt.Sprintf("%s_%d", name, i)
 
 		var cnt int
-		if err := tx.QueryRow("SELECT count(*) FROM books WHERE name = ?", ret).Scan(&cnt); err != nil {
+		if err := tx.QueryRow("SELECT count(*) FROM books WHERE parent_uuid = ? AND name = ?", parentUUID, ret).Scan(&cnt); err != nil {
 			return "", errors.Wrapf(err, "checking availability of name %s", ret)
 		}
 
@@ -205,34 +244,35 @@ func resolveLabel(tx *database.DB, name string) (string, error) {
 }
 
 // mergeBook inserts or updates the given book in the local database.
-// If a book with a duplicate name exists locally, it renames the duplicate by appending a number.
+// If a book with a duplicate name exists locally under the same parent, it renames the duplicate
+// by appending a number.
 func mergeBook(tx *database.DB, b client.SyncFragBook, mode int) error {
 	var count int
-	if err := tx.QueryRow("SELECT count(*) FROM books WHERE name = ?", b.Name).Scan(&count); err != nil {
+	if err := tx.QueryRow("SELECT count(*) FROM books WHERE parent_uuid = ? AND name = ? AND uuid != ?", b.ParentUUID, b.Name, b.UUID).Scan(&count); err != nil {
 		return errors.Wrapf(err, "checking for books with a duplicate name %s", b.Name)
 	}
 
 	// if duplicate exists locally, rename it and mark it dirty
 	if count > 0 {
-		newLabel, err := resolveLabel(tx, b.Name)
+		newLabel, err := resolveLabel(tx, b.ParentUUID, b.Name)
 		if err != nil {
 			return errors.Wrap(err, "getting a new book name for conflict resolution")
 		}
 
-		if _, err := tx.Exec("UPDATE books SET name = ?, dirty = ? WHERE name = ?", newLabel, true, b.Name); err != nil {
+		if _, err := tx.Exec("UPDATE books SET name = ?, dirty = ? WHERE parent_uuid = ? AND name = ? AND uuid != ?", newLabel, true, b.ParentUUID, b.Name, b.UUID); err != nil {
 			return errors.Wrap(err, "resolving duplicate book name")
 		}
 	}
 
 	if mode == modeInsert {
-		book := database.NewBook(b.UUID, b.Name, b.USN, false, false)
+		book := database.NewBook(b.UUID, b.Name, b.ParentUUID, b.USN, false, false)
 		if err := book.Insert(tx); err != nil {
 			return errors.Wrapf(err, "inserting note with uuid %s", b.UUID)
 		}
 	} else if mode == modeUpdate {
 		// The state from the server overwrites the local state. In other words, the server change always wins.
-		if _, err := tx.Exec("UPDATE books SET usn = ?, uuid = ?, name = ?, deleted = ? WHERE uuid = ?",
-			b.USN, b.UUID, b.Name, b.Deleted, b.UUID); err != nil {
+		if _, err := tx.Exec("UPDATE books SET usn = ?, uuid = ?, name = ?, parent_uuid = ?, deleted = ? WHERE uuid = ?",
+			b.USN, b.UUID, b.Name, b.ParentUUID, b.Deleted, b.UUID); err != nil {
 			return errors.Wrapf(err, "updating local book %s", b.UUID)
 		}
 	}
@@ -282,6 +322,9 @@ func mergeNote(tx *database.DB, serverNote client.SyncFragNote, localNote databa
 			serverNote.USN, serverNote.BookUUID, serverNote.Body, serverNote.EditedOn, serverNote.Deleted, serverNote.Public, false, serverNote.UUID); err != nil {
 			return errors.Wrapf(err, "updating local note %s", serverNote.UUID)
 		}
+		if err := database.SetNoteTags(tx, serverNote.UUID, serverNote.Tags); err != nil {
+			return errors.Wrapf(err, "setting tags for local note %s", serverNote.UUID)
+		}
 
 		return nil
 	}
@@ -295,6 +338,9 @@ func mergeNote(tx *database.DB, serverNote client.SyncFragNote, localNote databa
 		serverNote.USN, mr.bookUUID, mr.body, mr.editedOn, serverNote.Deleted, serverNote.UUID); err != nil {
 		return errors.Wrapf(err, "updating local note %s", serverNote.UUID)
 	}
+	if err := database.SetNoteTags(tx, serverNote.UUID, mr.tags); err != nil {
+		return errors.Wrapf(err, "setting tags for local note %s", serverNote.UUID)
+	}
 
 	return nil
 }
@@ -314,6 +360,9 @@ func stepSyncNote(tx *database.DB, n client.SyncFragNote) error {
 		if err := note.Insert(tx); err != nil {
 			return errors.Wrapf(err, "inserting note with uuid %s", n.UUID)
 		}
+		if err := database.SetNoteTags(tx, n.UUID, n.Tags); err != nil {
+			return errors.Wrapf(err, "setting tags for note with uuid %s", n.UUID)
+		}
 	} else {
 		if err := mergeNote(tx, n, localNote); err != nil {
 			return errors.Wrap(err, "merging local note")
@@ -338,6 +387,9 @@ func fullSyncNote(tx *database.DB, n client.SyncFragNote) error {
 		if err := note.Insert(tx); err != nil {
 			return errors.Wrapf(err, "inserting note with uuid %s", n.UUID)
 		}
+		if err := database.SetNoteTags(tx, n.UUID, n.Tags); err != nil {
+			return errors.Wrapf(err, "setting tags for note with uuid %s", n.UUID)
+		}
 	} else if n.USN > localNote.USN {
 		if err := mergeNote(tx, n, localNote); err != nil {
 			return errors.Wrap(err, "merging local note")
@@ -366,6 +418,10 @@ func syncDeleteNote(tx *database.DB, noteUUID string) error {
 		if err != nil {
 			return errors.Wrapf(err, "deleting local note %s", noteUUID)
 		}
+		_, err = tx.Exec("DELETE FROM note_tags WHERE note_uuid = ?", noteUUID)
+		if err != nil {
+			return errors.Wrapf(err, "deleting tags of local note %s", noteUUID)
+		}
 	}
 
 	return nil
@@ -418,6 +474,11 @@ func syncDeleteBook(tx *database.DB, bookUUID string) error {
 		return nil
 	}
 
+	_, err = tx.Exec("DELETE FROM note_tags WHERE note_uuid IN (SELECT uuid FROM notes WHERE book_uuid = ?)", bookUUID)
+	if err != nil {
+		return errors.Wrapf(err, "deleting tags of local notes of the book %s", bookUUID)
+	}
+
 	_, err = tx.Exec("DELETE FROM notes WHERE book_uuid = ?", bookUUID)
 	if err != nil {
 		return errors.Wrapf(err, "deleting local notes of the book %s", bookUUID)
@@ -629,24 +690,68 @@ func stepSync(ctx context.NadCtx, tx *database.DB, afterUSN int) error {
 	return nil
 }
 
-func sendBooks(ctx context.NadCtx, tx *database.DB) (bool, error) {
-	isBehind := false
-
-	rows, err := tx.Query("SELECT uuid, name, usn, deleted FROM books WHERE dirty")
+// getSyncableBooks returns the dirty books ordered so that a book comes after its dirty ancestors,
+// because the server requires the parent of a book to exist before the book itself.
+func getSyncableBooks(tx *database.DB) ([]database.Book, error) {
+	rows, err := tx.Query("SELECT uuid, name, parent_uuid, usn, deleted FROM books WHERE dirty")
 	if err != nil {
-		return isBehind, errors.Wrap(err, "getting syncable books")
+		return nil, errors.Wrap(err, "getting syncable books")
 	}
 	defer rows.Close()
 
+	books := []database.Book{}
 	for rows.Next() {
 		var book database.Book
 
-		if err = rows.Scan(&book.UUID, &book.Name, &book.USN, &book.Deleted); err != nil {
-			return isBehind, errors.Wrap(err, "scanning a syncable book")
+		if err = rows.Scan(&book.UUID, &book.Name, &book.ParentUUID, &book.USN, &book.Deleted); err != nil {
+			return nil, errors.Wrap(err, "scanning a syncable book")
+		}
+
+		books = append(books, book)
+	}
+
+	parents := map[string]string{}
+	for _, book := range books {
+		parents[book.UUID] = book.ParentUUID
+	}
+
+	depths := map[string]int{}
+	for _, book := range books {
+		seen := map[string]bool{}
+		for p := parents[book.UUID]; p != "" && !seen[p]; p = parents[p] {
+			seen[p] = true
+			depths[book.UUID]++
+		}
+	}
+
+	sort.SliceStable(books, func(i, j int) bool {
+		return depths[books[i].UUID] < depths[books[j].UUID]
+	})
+
+	return books, nil
+}
+
+func sendBooks(ctx context.NadCtx, tx *database.DB) (bool, error) {
+	isBehind := false
+
+	books, err := getSyncableBooks(tx)
+	if err != nil {
+		return isBehind, errors.Wrap(err, "getting syncable books")
+	}
+
+	for _, book := range books {
+		// The parent might have been given a new uuid by the server while sending the books before.
+		if err := tx.QueryRow("SELECT parent_uuid FROM books WHERE uuid = ?", book.UUID).Scan(&book.ParentUUID); err != nil {
+			return isBehind, errors.Wrapf(err, "getting the parent of the book %s", book.UUID)
 		}
 
 		log.Debug("sending book %s\n", book.UUID)
 
+		name, encrypted, err := encryptContent(ctx, book.Name)
+		if err != nil {
+			return isBehind, errors.Wrap(err, "encrypting the book name")
+		}
+
 		var respUSN int
 
 		// if new, create it in the server, or else, update.
@@ -659,7 +764,7 @@ func sendBooks(ctx context.NadCtx, tx *database.DB) (bool, error) {
 
 				continue
 			} else {
-				resp, err := client.CreateBook(ctx, book.Name)
+				resp, err := client.CreateBook(ctx, name, book.ParentUUID, encrypted)
 				if err != nil {
 					return isBehind, errors.Wrap(err, "creating a book")
 				}
@@ -697,7 +802,7 @@ func sendBooks(ctx context.NadCtx, tx *database.DB) (bool, error) {
 
 				respUSN = resp.Book.USN
 			} else {
-				resp, err := client.UpdateBook(ctx, book.Name, book.UUID)
+				resp, err := client.UpdateBook(ctx, name, book.ParentUUID, book.UUID, encrypted)
 				if err != nil {
 					return isBehind, errors.Wrap(err, "updating a book")
 				}
@@ -733,6 +838,21 @@ func sendBooks(ctx context.NadCtx, tx *database.DB) (bool, error) {
 	return isBehind, nil
 }
 
+// encryptContent encrypts the given content to be sent to the server if a cipher
+// key is set up. It returns the content and whether it was encrypted.
+func encryptContent(ctx context.NadCtx, content string) (string, bool, error) {
+	if ctx.CipherKey == nil {
+		return content, false, nil
+	}
+
+	ciphertext, err := crypt.Encrypt(ctx.CipherKey, content)
+	if err != nil {
+		return "", false, err
+	}
+
+	return ciphertext, true, nil
+}
+
 func sendNotes(ctx context.NadCtx, tx *database.DB) (bool, error) {
 	isBehind := false
 
@@ -751,6 +871,11 @@ func sendNotes(ctx context.NadCtx, tx *database.DB) (bool, error) {
 
 		log.Debug("sending note %s\n", note.UUID)
 
+		body, encrypted, err := encryptContent(ctx, note.Body)
+		if err != nil {
+			return isBehind, errors.Wrap(err, "encrypting the note body")
+		}
+
 		var respUSN int
 
 		// if new, create it in the server, or else, update.
@@ -764,7 +889,12 @@ func sendNotes(ctx context.NadCtx, tx *database.DB) (bool, error) {
 
 				continue
 			} else {
-				resp, err := client.CreateNote(ctx, note.BookUUID, note.Body)
+				tags, err := database.GetNoteTags(tx, note.UUID)
+				if err != nil {
+					return isBehind, errors.Wrap(err, "getting note tags")
+				}
+
+				resp, err := client.CreateNote(ctx, note.BookUUID, body, tags, encrypted)
 				if err != nil {
 					return isBehind, errors.Wrap(err, "creating a note")
 				}
@@ -797,7 +927,12 @@ func sendNotes(ctx context.NadCtx, tx *database.DB) (bool, error) {
 
 				respUSN = resp.Result.USN
 			} else {
-				resp, err := client.UpdateNote(ctx, note.UUID, note.BookUUID, note.Body, note.Public)
+				tags, err := database.GetNoteTags(tx, note.UUID)
+				if err != nil {
+					return isBehind, errors.Wrap(err, "getting note tags")
+				}
+
+				resp, err := client.UpdateNote(ctx, note.UUID, note.BookUUID, body, note.Public, tags, encrypted)
 				if err != nil {
 					return isBehind, errors.Wrap(err, "updating a note")
 				}
@@ -31,6 +31,7 @@ import (
 	"github.com/nadproject/nad/pkg/cli/client"
 	"github.com/nadproject/nad/pkg/cli/consts"
 	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/crypt"
 	"github.com/nadproject/nad/pkg/cli/database"
 	"github.com/nadproject/nad/pkg/cli/testutils"
 	"github.com/nadproject/nad/pkg/cli/utils"
@@ -71,7 +72,7 @@ func TestProcessFragments(t *testing.T) {
 	}
 
 	// exec
-	sl, err := processFragments(fragments)
+	sl, err := processFragments(fragments, nil)
 	if err != nil {
 		t.Fatalf(errors.Wrap(err, "executing").Error())
 	}
@@ -107,6 +108,61 @@ func TestProcessFragments(t *testing.T) {
 	assert.DeepEqual(t, sl, expected, "syncList mismatch")
 }
 
+func TestProcessFragments_encrypted(t *testing.T) {
+	key := crypt.DeriveKey("correct horse", []byte("0123456789abcdef"))
+
+	noteBody, err := crypt.Encrypt(key, "n1-body")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encrypting the note body"))
+	}
+	bookName, err := crypt.Encrypt(key, "js")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encrypting the book name"))
+	}
+
+	fragments := []client.SyncFragment{
+		{
+			FragMaxUSN:  3,
+			UserMaxUSN:  3,
+			CurrentTime: 1550436136,
+			Notes: []client.SyncFragNote{
+				{UUID: "n1-uuid", Body: noteBody, Encrypted: true},
+				{UUID: "n2-uuid", Body: "n2-body"},
+				{UUID: "n3-uuid", Body: "", Encrypted: true, Deleted: true},
+			},
+			Books: []client.SyncFragBook{
+				{UUID: "b1-uuid", Name: bookName, Encrypted: true},
+			},
+			ExpungedNotes: []string{},
+			ExpungedBooks: []string{},
+		},
+	}
+
+	t.Run("with cipher key", func(t *testing.T) {
+		sl, err := processFragments(fragments, key)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		assert.Equal(t, sl.Notes["n1-uuid"].Body, "n1-body", "n1 body mismatch")
+		assert.Equal(t, sl.Notes["n2-uuid"].Body, "n2-body", "n2 body mismatch")
+		assert.Equal(t, sl.Notes["n3-uuid"].Body, "", "n3 body mismatch")
+		assert.Equal(t, sl.Books["b1-uuid"].Name, "js", "b1 name mismatch")
+	})
+
+	t.Run("without cipher key", func(t *testing.T) {
+		_, err := processFragments(fragments, nil)
+		assert.Equal(t, err, ErrCipherKeyMissing, "error mismatch")
+	})
+
+	t.Run("wrong cipher key", func(t *testing.T) {
+		otherKey := crypt.DeriveKey("battery staple", []byte("0123456789abcdef"))
+
+		_, err := processFragments(fragments, otherKey)
+		assert.Equal(t, errors.Cause(err), crypt.ErrCiphertextInvalid, "error mismatch")
+	})
+}
+
 func TestGetLastSyncAt(t *testing.T) {
 	// set up
 	db := database.InitTestDB(t, "../../tmp/.nad", nil)
@@ -155,8 +211,9 @@ func TestGetLastMaxUSN(t *testing.T) {
 
 func TestResolveLabel(t *testing.T) {
 	testCases := []struct {
-		input    string
-		expected string
+		parentUUID string
+		input      string
+		expected   string
 	}{
 		{
 			input:    "js",
@@ -174,6 +231,12 @@ func TestResolveLabel(t *testing.T) {
 			input:    "cool_ideas",
 			expected: "cool_ideas_2",
 		},
+		// names are unique only among the children of the same parent
+		{
+			parentUUID: "b1-uuid",
+			input:      "css",
+			expected:   "css_2",
+		},
 	}
 
 	for idx, tc := range testCases {
@@ -195,7 +258,7 @@ func TestResolveLabel(t *testing.T) {
 				t.Fatalf(errors.Wrap(err, fmt.Sprintf("beginning a transaction for test case %d", idx)).Error())
 			}
 
-			got, err := resolveLabel(tx, tc.input)
+			got, err := resolveLabel(tx, tc.parentUUID, tc.input)
 			if err != nil {
 				t.Fatalf(errors.Wrap(err, fmt.Sprintf("executing for test case %d", idx)).Error())
 			}
@@ -1296,6 +1359,121 @@ n1 body edited
 	})
 }
 
+func TestStepSyncNote_tags(t *testing.T) {
+	t.Run("exists on server only", func(t *testing.T) {
+		// set up
+		db := database.InitTestDB(t, dbPath, nil)
+		defer database.CloseTestDB(t, db)
+
+		b1UUID := utils.GenerateUUID()
+		database.MustExec(t, "inserting book", db, "INSERT INTO books (uuid, name) VALUES (?, ?)", b1UUID, "b1-name")
+
+		// execute
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+		}
+
+		n := client.SyncFragNote{
+			UUID:     "n1-uuid",
+			BookUUID: b1UUID,
+			USN:      128,
+			AddedOn:  1541232118,
+			Body:     "n1-body",
+			Tags:     []string{"scope", "closure"},
+		}
+
+		if err := stepSyncNote(tx, n); err != nil {
+			tx.Rollback()
+			t.Fatalf(errors.Wrap(err, "executing").Error())
+		}
+
+		tx.Commit()
+
+		// test
+		tags, err := database.GetNoteTags(db, n.UUID)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting tags"))
+		}
+
+		assert.DeepEqual(t, tags, []string{"closure", "scope"}, "tags mismatch")
+	})
+
+	t.Run("exists on server and client", func(t *testing.T) {
+		testCases := []struct {
+			clientDirty  bool
+			clientTags   []string
+			serverTags   []string
+			expectedTags []string
+		}{
+			{
+				clientDirty:  false,
+				clientTags:   []string{"closure", "hoisting"},
+				serverTags:   []string{"closure", "scope"},
+				expectedTags: []string{"closure", "scope"},
+			},
+			{
+				clientDirty:  false,
+				clientTags:   []string{"closure"},
+				serverTags:   []string{},
+				expectedTags: []string{},
+			},
+			{
+				clientDirty:  true,
+				clientTags:   []string{"closure", "hoisting"},
+				serverTags:   []string{"closure", "scope"},
+				expectedTags: []string{"closure", "hoisting", "scope"},
+			},
+		}
+
+		for idx, tc := range testCases {
+			t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+				// set up
+				db := database.InitTestDB(t, dbPath, nil)
+				defer database.CloseTestDB(t, db)
+
+				b1UUID := utils.GenerateUUID()
+				database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, name) VALUES (?, ?)", b1UUID, "b1-name")
+				n1UUID := utils.GenerateUUID()
+				database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, added_on, edited_on, body,  deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", n1UUID, b1UUID, 1, 1541232118, 0, "n1-body", false, tc.clientDirty)
+				for _, tag := range tc.clientTags {
+					database.MustExec(t, "inserting n1 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", n1UUID, tag)
+				}
+
+				// execute
+				tx, err := db.Begin()
+				if err != nil {
+					t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+				}
+
+				n := client.SyncFragNote{
+					UUID:     n1UUID,
+					BookUUID: b1UUID,
+					USN:      2,
+					AddedOn:  1541232118,
+					Body:     "n1-body",
+					Tags:     tc.serverTags,
+				}
+
+				if err := stepSyncNote(tx, n); err != nil {
+					tx.Rollback()
+					t.Fatalf(errors.Wrap(err, "executing").Error())
+				}
+
+				tx.Commit()
+
+				// test
+				tags, err := database.GetNoteTags(db, n1UUID)
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "getting tags"))
+				}
+
+				assert.DeepEqual(t, tags, tc.expectedTags, "tags mismatch")
+			})
+		}
+	})
+}
+
 func TestStepSyncBook(t *testing.T) {
 	t.Run("exists on server only", func(t *testing.T) {
 		// set up
@@ -1830,6 +2008,49 @@ func TestMergeBook(t *testing.T) {
 	})
 }
 
+func TestMergeBook_nested(t *testing.T) {
+	// set up
+	db := database.InitTestDB(t, "../../tmp/.nad", nil)
+	defer database.CloseTestDB(t, db)
+
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, name, parent_uuid, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?)", "b1-uuid", "work", "", 1, false, false)
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, name, parent_uuid, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?)", "b2-uuid", "infra", "", 2, false, false)
+	database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, name, parent_uuid, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?)", "b3-uuid", "k8s", "b1-uuid", 0, false, true)
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	// a book with the same name under another parent does not conflict
+	if err := mergeBook(tx, client.SyncFragBook{UUID: "b4-uuid", Name: "infra", ParentUUID: "b1-uuid", USN: 3}, modeInsert); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "merging b4").Error())
+	}
+	if err := mergeBook(tx, client.SyncFragBook{UUID: "b5-uuid", Name: "k8s", ParentUUID: "b1-uuid", USN: 4}, modeInsert); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "merging b5").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	var b2, b3, b4, b5 database.Book
+	database.MustScan(t, "getting b2", db.QueryRow("SELECT name, parent_uuid FROM books WHERE uuid = ?", "b2-uuid"), &b2.Name, &b2.ParentUUID)
+	database.MustScan(t, "getting b3", db.QueryRow("SELECT name, parent_uuid FROM books WHERE uuid = ?", "b3-uuid"), &b3.Name, &b3.ParentUUID)
+	database.MustScan(t, "getting b4", db.QueryRow("SELECT name, parent_uuid FROM books WHERE uuid = ?", "b4-uuid"), &b4.Name, &b4.ParentUUID)
+	database.MustScan(t, "getting b5", db.QueryRow("SELECT name, parent_uuid FROM books WHERE uuid = ?", "b5-uuid"), &b5.Name, &b5.ParentUUID)
+
+	assert.Equal(t, b2.Name, "infra", "b2 name mismatch")
+	assert.Equal(t, b3.Name, "k8s_2", "b3 name mismatch")
+	assert.Equal(t, b3.ParentUUID, "b1-uuid", "b3 parent_uuid mismatch")
+	assert.Equal(t, b4.Name, "infra", "b4 name mismatch")
+	assert.Equal(t, b4.ParentUUID, "b1-uuid", "b4 parent_uuid mismatch")
+	assert.Equal(t, b5.Name, "k8s", "b5 name mismatch")
+	assert.Equal(t, b5.ParentUUID, "b1-uuid", "b5 parent_uuid mismatch")
+}
+
 func TestSaveServerState(t *testing.T) {
 	// set up
 	ctx := context.InitTestCtx(t, "../../tmp", nil)
@@ -2029,6 +2250,98 @@ func TestSendBooks(t *testing.T) {
 	assert.Equal(t, n7.BookUUID, "server-b4-name-uuid", "n7 bookUUID mismatch")
 }
 
+// TestSendBooks_nested tests that the parents are created in the server before their children,
+// and that the children refer to the uuid of their parent given by the server.
+func TestSendBooks_nested(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, "../../tmp", nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+
+	// the child is inserted before the parent
+	database.MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, name, parent_uuid, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?)", "b2-uuid", "k8s", "b1-uuid", 0, false, true)
+	database.MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, name, parent_uuid, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?)", "b3-uuid", "infra", "b1-uuid", 5, false, true)
+	database.MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, name, parent_uuid, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?)", "b1-uuid", "work", "", 0, false, true)
+
+	var createdPayloads []client.CreateBookPayload
+	var updatedParentUUIDs []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() == "/v1/books" && r.Method == "POST" {
+			var payload client.CreateBookPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Fatalf(errors.Wrap(err, "decoding payload in the test server").Error())
+				return
+			}
+
+			createdPayloads = append(createdPayloads, payload)
+
+			resp := client.RespBook{
+				UUID: fmt.Sprintf("server-%s-uuid", payload.Name),
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		if r.URL.Path == "/v1/books/b3-uuid" && r.Method == "PATCH" {
+			var payload struct {
+				ParentUUID string `json:"parent_uuid"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Fatalf(errors.Wrap(err, "decoding payload in the test server").Error())
+				return
+			}
+
+			updatedParentUUIDs = append(updatedParentUUIDs, payload.ParentUUID)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}"))
+			return
+		}
+
+		t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	if _, err := sendBooks(ctx, tx); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.DeepEqual(t, createdPayloads, []client.CreateBookPayload{
+		{Name: "work", ParentUUID: ""},
+		{Name: "k8s", ParentUUID: "server-work-uuid"},
+	}, "createdPayloads mismatch")
+	assert.DeepEqual(t, updatedParentUUIDs, []string{"server-work-uuid"}, "updatedParentUUIDs mismatch")
+
+	var b2ParentUUID, b3ParentUUID string
+	database.MustScan(t, "getting b2", db.QueryRow("SELECT parent_uuid FROM books WHERE name = ?", "k8s"), &b2ParentUUID)
+	database.MustScan(t, "getting b3", db.QueryRow("SELECT parent_uuid FROM books WHERE name = ?", "infra"), &b3ParentUUID)
+
+	assert.Equal(t, b2ParentUUID, "server-work-uuid", "b2 parent_uuid mismatch")
+	assert.Equal(t, b3ParentUUID, "server-work-uuid", "b3 parent_uuid mismatch")
+}
+
 func TestSendBooks_isBehind(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.String() == "/v1/books" && r.Method == "POST" {
@@ -2443,6 +2756,171 @@ func TestSendNotes_addedOn(t *testing.T) {
 	assert.Equal(t, n1.AddedOn, int64(1541108743), "n1 AddedOn mismatch")
 }
 
+func TestSendNotes_tags(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, "../../tmp", nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+
+	// should be created
+	b1UUID := "b1-uuid"
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", b1UUID, 0, "n1-body", 1541108743, false, true)
+	database.MustExec(t, "inserting n1 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", "n1-uuid", "closure")
+	// should be updated
+	database.MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n2-uuid", b1UUID, 3, "n2-body", 1541108743, false, true)
+	database.MustExec(t, "inserting n2 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", "n2-uuid", "scope")
+
+	n1NewUUID := utils.GenerateUUID()
+	var createPayload client.CreateNotePayload
+	var updatePayload struct {
+		Tags []string `json:"tags"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() == "/v1/notes" && r.Method == "POST" {
+			if err := json.NewDecoder(r.Body).Decode(&createPayload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload"))
+			}
+
+			resp := client.CreateNoteResp{
+				Result: client.RespNote{
+					UUID: n1NewUUID,
+					USN:  1,
+				},
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		if r.URL.String() == "/v1/notes/n2-uuid" && r.Method == "PATCH" {
+			if err := json.NewDecoder(r.Body).Decode(&updatePayload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload"))
+			}
+
+			resp := client.UpdateNoteResp{
+				Result: client.RespNote{
+					UUID: "n2-uuid",
+					USN:  2,
+				},
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	if _, err := sendNotes(ctx, tx); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.DeepEqual(t, createPayload.Tags, []string{"closure"}, "create payload tags mismatch")
+	assert.DeepEqual(t, updatePayload.Tags, []string{"scope"}, "update payload tags mismatch")
+
+	n1Tags, err := database.GetNoteTags(db, n1NewUUID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting n1 tags"))
+	}
+	assert.DeepEqual(t, n1Tags, []string{"closure"}, "n1 tags mismatch")
+}
+
+func TestSendNotes_encrypted(t *testing.T) {
+	// set up
+	ctx := context.InitTestCtx(t, "../../tmp", nil)
+	defer context.TeardownTestCtx(t, ctx)
+	testutils.Login(t, &ctx)
+	ctx.CipherKey = crypt.DeriveKey("correct horse", []byte("0123456789abcdef"))
+
+	db := ctx.DB
+
+	database.MustExec(t, "inserting last max usn", db, "INSERT INTO system (key, value) VALUES (?, ?)", consts.SystemLastMaxUSN, 0)
+	database.MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, body, added_on, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", 0, "n1-body", 1541108743, false, true)
+
+	n1NewUUID := utils.GenerateUUID()
+	var createPayload client.CreateNotePayload
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() == "/v1/notes" && r.Method == "POST" {
+			if err := json.NewDecoder(r.Body).Decode(&createPayload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload"))
+			}
+
+			resp := client.CreateNoteResp{
+				Result: client.RespNote{
+					UUID: n1NewUUID,
+					USN:  1,
+				},
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+
+		t.Fatalf("unrecognized endpoint reached Method: %s Path: %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	ctx.APIEndpoint = ts.URL
+
+	// execute
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf(errors.Wrap(err, "beginning a transaction").Error())
+	}
+
+	if _, err := sendNotes(ctx, tx); err != nil {
+		tx.Rollback()
+		t.Fatalf(errors.Wrap(err, "executing").Error())
+	}
+
+	tx.Commit()
+
+	// test
+	assert.Equal(t, createPayload.Encrypted, true, "payload encrypted mismatch")
+	assert.NotEqual(t, createPayload.Body, "n1-body", "payload body should not be plaintext")
+
+	body, err := crypt.Decrypt(ctx.CipherKey, createPayload.Body)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decrypting the payload body"))
+	}
+	assert.Equal(t, body, "n1-body", "decrypted payload body mismatch")
+
+	var n1Body string
+	database.MustScan(t, "getting n1 body", db.QueryRow("SELECT body FROM notes WHERE uuid = ?", n1NewUUID), &n1Body)
+	assert.Equal(t, n1Body, "n1-body", "local body should remain plaintext")
+}
+
 func TestSendNotes_isBehind(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.String() == "/v1/notes" && r.Method == "POST" {
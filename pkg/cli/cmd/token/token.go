@@ -0,0 +1,190 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package token
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/infra"
+	"github.com/nadproject/nad/pkg/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var scopeFlag []string
+var expiresInFlag int
+
+var example = `
+  * Create a token for a CI job that adds notes
+  nad token create ci --scope notes:write --expires-in 90
+
+  * Create a token for syncing that never expires
+  nad token create backup --scope sync --expires-in 0
+
+  * List tokens
+  nad token list
+
+  * Revoke a token by id
+  nad token revoke 3`
+
+// NewCmd returns a new token command
+func NewCmd(ctx context.NadCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "token",
+		Short:   "Manage personal access tokens for scripts and CI",
+		Example: example,
+	}
+
+	createCmd := &cobra.Command{
+		Use:     "create <name>",
+		Short:   "Create an access token",
+		PreRunE: requireArgs(1),
+		RunE:    newCreateRun(ctx),
+	}
+	f := createCmd.Flags()
+	f.StringSliceVarP(&scopeFlag, "scope", "s", nil, "the scopes of the token: notes:read, notes:write, sync or admin")
+	f.IntVar(&expiresInFlag, "expires-in", 30, "the number of days until the token expires. 0 means no expiry")
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List access tokens",
+		PreRunE: requireArgs(0),
+		RunE:    newListRun(ctx),
+	}
+
+	revokeCmd := &cobra.Command{
+		Use:     "revoke <id>",
+		Short:   "Revoke an access token",
+		PreRunE: requireArgs(1),
+		RunE:    newRevokeRun(ctx),
+	}
+
+	cmd.AddCommand(createCmd, listCmd, revokeCmd)
+
+	return cmd
+}
+
+func requireArgs(n int) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) != n {
+			return errors.New("Incorrect number of argument")
+		}
+
+		return nil
+	}
+}
+
+func requireLogin(ctx context.NadCtx) error {
+	if ctx.SessionKey == "" {
+		return errors.New("not logged in")
+	}
+
+	return nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// printTokens writes the given tokens as a table
+func printTokens(w io.Writer, tokens []client.AccessTokenResp) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tEXPIRES\tLAST USED")
+	for _, t := range tokens {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(t.Scopes, ","), formatTime(t.ExpiresAt), formatTime(t.LastUsedAt))
+	}
+
+	return tw.Flush()
+}
+
+func newCreateRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := requireLogin(ctx); err != nil {
+			return err
+		}
+		if len(scopeFlag) == 0 {
+			return errors.New("at least one --scope is required")
+		}
+
+		resp, err := client.CreateAccessToken(ctx, args[0], scopeFlag, expiresInFlag)
+		if err != nil {
+			return errors.Wrap(err, "creating the access token")
+		}
+
+		log.Successf("created token %d. Copy it now, as it will not be shown again.\n", resp.Token.ID)
+		fmt.Println(resp.Key)
+
+		return nil
+	}
+}
+
+func newListRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := requireLogin(ctx); err != nil {
+			return err
+		}
+
+		tokens, err := client.GetAccessTokens(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting the access tokens")
+		}
+
+		if len(tokens) == 0 {
+			log.Info("no access tokens\n")
+			return nil
+		}
+
+		return printTokens(os.Stdout, tokens)
+	}
+}
+
+func newRevokeRun(ctx context.NadCtx) infra.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := requireLogin(ctx); err != nil {
+			return err
+		}
+
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return errors.Errorf("invalid token id '%s'", args[0])
+		}
+
+		if err := client.DeleteAccessToken(ctx, uint(id)); err != nil {
+			return errors.Wrap(err, "revoking the access token")
+		}
+
+		log.Successf("revoked token %d\n", id)
+
+		return nil
+	}
+}
@@ -0,0 +1,59 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package token
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/cli/client"
+	"github.com/pkg/errors"
+)
+
+func TestPrintTokens(t *testing.T) {
+	expiresAt := time.Date(2019, time.December, 1, 0, 0, 0, 0, time.Local)
+
+	tokens := []client.AccessTokenResp{
+		{
+			ID:        1,
+			Name:      "ci",
+			Scopes:    []string{"notes:write", "sync"},
+			ExpiresAt: &expiresAt,
+		},
+		{
+			ID:     12,
+			Name:   "backup",
+			Scopes: []string{"notes:read"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := printTokens(&buf, tokens); err != nil {
+		t.Fatal(errors.Wrap(err, "printing"))
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	assert.Equal(t, len(lines), 3, "line count mismatch")
+	assert.Equal(t, lines[0], "ID  NAME    SCOPES            EXPIRES           LAST USED", "header mismatch")
+	assert.Equal(t, lines[1], "1   ci      notes:write,sync  2019-12-01 00:00  never", "first row mismatch")
+	assert.Equal(t, lines[2], "12  backup  notes:read        never             never", "second row mismatch")
+}
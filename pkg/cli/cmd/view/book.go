@@ -19,11 +19,12 @@
 package view
 
 import (
-	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/nadproject/nad/pkg/cli/context"
+	"github.com/nadproject/nad/pkg/cli/database"
 	"github.com/nadproject/nad/pkg/cli/log"
 	"github.com/pkg/errors"
 )
@@ -36,8 +37,32 @@ type bookInfo struct {
 
 // noteInfo is an information about the note to be printed on screen
 type noteInfo struct {
-	RowID int
-	Body  string
+	RowID     int
+	BookLabel string
+	Body      string
+}
+
+// whereTags appends to the given query a condition for each of the given tags
+// so that only the notes having all of the tags are matched
+func whereTags(query string, args []interface{}, tags []string) (string, []interface{}) {
+	for _, tag := range tags {
+		query = fmt.Sprintf("%s AND notes.uuid IN (SELECT note_uuid FROM note_tags WHERE name = ?)", query)
+		args = append(args, tag)
+	}
+
+	return query, args
+}
+
+// formatNoteLine returns the line to print for the given note
+func formatNoteLine(info noteInfo) string {
+	body, isExcerpt := formatBody(info.Body)
+
+	rowid := log.ColorYellow.Sprintf("(%d)", info.RowID)
+	if isExcerpt {
+		body = fmt.Sprintf("%s %s", body, log.ColorYellow.Sprintf("[---More---]"))
+	}
+
+	return fmt.Sprintf("%s %s", rowid, body)
 }
 
 // getNewlineIdx returns the index of newline character in a string
@@ -79,12 +104,16 @@ func printBookLine(info bookInfo, nameOnly bool) {
 func printBooks(ctx context.NadCtx, nameOnly bool) error {
 	db := ctx.DB
 
-	rows, err := db.Query(`SELECT books.name, count(notes.uuid) note_count
+	bookPaths, err := database.GetBookPaths(db)
+	if err != nil {
+		return errors.Wrap(err, "getting book paths")
+	}
+
+	rows, err := db.Query(`SELECT books.uuid, count(notes.uuid) note_count
 	FROM books
 	LEFT JOIN notes ON notes.book_uuid = books.uuid AND notes.deleted = false
 	WHERE books.deleted = false
-	GROUP BY books.uuid
-	ORDER BY books.name ASC;`)
+	GROUP BY books.uuid;`)
 	if err != nil {
 		return errors.Wrap(err, "querying books")
 	}
@@ -93,14 +122,21 @@ func printBooks(ctx context.NadCtx, nameOnly bool) error {
 	infos := []bookInfo{}
 	for rows.Next() {
 		var info bookInfo
-		err = rows.Scan(&info.BookLabel, &info.NoteCount)
+		var bookUUID string
+		err = rows.Scan(&bookUUID, &info.NoteCount)
 		if err != nil {
 			return errors.Wrap(err, "scanning a row")
 		}
+		info.BookLabel = bookPaths[bookUUID]
 
 		infos = append(infos, info)
 	}
 
+	// Sort by path so that the nested books are listed right after their parents.
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].BookLabel < infos[j].BookLabel
+	})
+
 	for _, info := range infos {
 		printBookLine(info, nameOnly)
 	}
@@ -108,18 +144,17 @@ func printBooks(ctx context.NadCtx, nameOnly bool) error {
 	return nil
 }
 
-func printBookNotes(ctx context.NadCtx, bookName string) error {
+func printBookNotes(ctx context.NadCtx, bookName string, tags []string) error {
 	db := ctx.DB
 
-	var bookUUID string
-	err := db.QueryRow("SELECT uuid FROM books WHERE name = ?", bookName).Scan(&bookUUID)
-	if err == sql.ErrNoRows {
-		return errors.New("book not found")
-	} else if err != nil {
-		return errors.Wrap(err, "querying the book")
+	bookUUID, err := database.GetBookUUID(db, bookName)
+	if err != nil {
+		return errors.Wrap(err, "finding the book")
 	}
 
-	rows, err := db.Query(`SELECT rowid, body FROM notes WHERE book_uuid = ? AND deleted = ? ORDER BY added_on ASC;`, bookUUID, false)
+	query, args := whereTags("SELECT notes.rowid, notes.body FROM notes WHERE notes.book_uuid = ? AND notes.deleted = ?", []interface{}{bookUUID, false}, tags)
+
+	rows, err := db.Query(fmt.Sprintf("%s ORDER BY notes.added_on ASC;", query), args...)
 	if err != nil {
 		return errors.Wrap(err, "querying notes")
 	}
@@ -139,14 +174,54 @@ func printBookNotes(ctx context.NadCtx, bookName string) error {
 	log.Infof("on book %s\n", bookName)
 
 	for _, info := range infos {
-		body, isExcerpt := formatBody(info.Body)
+		log.Plainf("%s\n", formatNoteLine(info))
+	}
+
+	return nil
+}
+
+func printTaggedNotes(ctx context.NadCtx, tags []string) error {
+	db := ctx.DB
 
-		rowid := log.ColorYellow.Sprintf("(%d)", info.RowID)
-		if isExcerpt {
-			body = fmt.Sprintf("%s %s", body, log.ColorYellow.Sprintf("[---More---]"))
+	bookPaths, err := database.GetBookPaths(db)
+	if err != nil {
+		return errors.Wrap(err, "getting book paths")
+	}
+
+	query, args := whereTags(`SELECT notes.rowid, notes.book_uuid, notes.body
+	FROM notes
+	INNER JOIN books ON books.uuid = notes.book_uuid
+	WHERE notes.deleted = ?`, []interface{}{false}, tags)
+
+	rows, err := db.Query(fmt.Sprintf("%s ORDER BY notes.added_on ASC;", query), args...)
+	if err != nil {
+		return errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	infos := []noteInfo{}
+	for rows.Next() {
+		var info noteInfo
+		var bookUUID string
+		err = rows.Scan(&info.RowID, &bookUUID, &info.Body)
+		if err != nil {
+			return errors.Wrap(err, "scanning a row")
 		}
+		info.BookLabel = bookPaths[bookUUID]
+
+		infos = append(infos, info)
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].BookLabel < infos[j].BookLabel
+	})
+
+	log.Infof("tagged %s\n", strings.Join(tags, ", "))
+
+	for _, info := range infos {
+		bookLabel := log.ColorYellow.Sprintf("(%s)", info.BookLabel)
 
-		log.Plainf("%s %s\n", rowid, body)
+		log.Plainf("%s %s\n", bookLabel, formatNoteLine(info))
 	}
 
 	return nil
@@ -34,11 +34,21 @@ var example = `
  * List notes in a book
  nad view javascript
 
+ * List notes in a nested book
+ nad view work/infra/k8s
+
  * View a particular note in a book
  nad view javascript 0
+
+ * List notes that have all of the given tags
+ nad view --tag closure
+
+ * List notes in a book that have the given tag
+ nad view javascript --tag closure
  `
 
 var nameOnly bool
+var tagFlag []string
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) > 2 {
@@ -61,13 +71,22 @@ func NewCmd(ctx context.NadCtx) *cobra.Command {
 
 	f := cmd.Flags()
 	f.BoolVarP(&nameOnly, "name-only", "", false, "print book names only")
+	f.StringSliceVarP(&tagFlag, "tag", "t", nil, "list only the notes that have the tag. Can be repeated")
 
 	return cmd
 }
 
 func newRun(ctx context.NadCtx) infra.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
+		if len(tagFlag) > 0 && nameOnly {
+			return errors.New("--name-only flag is invalid when listing notes by tags")
+		}
+
 		if len(args) == 0 {
+			if len(tagFlag) > 0 {
+				return printTaggedNotes(ctx, tagFlag)
+			}
+
 			return printBooks(ctx, nameOnly)
 		} else if len(args) == 1 {
 			if nameOnly {
@@ -75,9 +94,13 @@ func newRun(ctx context.NadCtx) infra.RunEFunc {
 			}
 
 			if utils.IsNumber(args[0]) {
+				if len(tagFlag) > 0 {
+					return errors.New("--tag flag is only valid when listing notes")
+				}
+
 				return printNote(ctx, args[0])
 			} else {
-				return printBookNotes(ctx, args[0])
+				return printBookNotes(ctx, args[0], tagFlag)
 			}
 		}
 
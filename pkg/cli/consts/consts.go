@@ -30,6 +30,8 @@ var (
 	TmpContentFileExt = "md"
 	// ConfigFilename is the name of the config file
 	ConfigFilename = "nadrc"
+	// BookPathSeparator separates the names of the books in a book path
+	BookPathSeparator = "/"
 
 	// SystemSchema is the key for schema in the system table
 	SystemSchema = "schema"
@@ -45,4 +47,6 @@ var (
 	SystemSessionKey = "session_token"
 	// SystemSessionKeyExpiry is the timestamp at which the session key will expire
 	SystemSessionKeyExpiry = "session_token_expiry"
+	// SystemCipherKey is the base64 encoded key used to encrypt the content sent to the server
+	SystemCipherKey = "cipher_key"
 )
@@ -33,6 +33,7 @@ type NadCtx struct {
 	DB               *database.DB
 	SessionKey       string
 	SessionKeyExpiry int64
+	CipherKey        []byte
 	Editor           string
 	Clock            clock.Clock
 }
@@ -48,5 +49,9 @@ func Redact(ctx NadCtx) NadCtx {
 	}
 	ctx.SessionKey = sessionKey
 
+	if ctx.CipherKey != nil {
+		ctx.CipherKey = []byte("1")
+	}
+
 	return ctx
 }
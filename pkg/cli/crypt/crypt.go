@@ -0,0 +1,136 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package crypt provides the end-to-end encryption of the content sent to the server.
+// The content is encrypted with AES-256-GCM using a key derived from a passphrase.
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// KeySize is the size of a cipher key in bytes
+	KeySize = 32
+	// SaltSize is the size of a salt for deriving a cipher key in bytes
+	SaltSize = 16
+
+	// keyCheckPlaintext is encrypted into a key check, which is used to tell
+	// if a cipher key was derived from the right passphrase
+	keyCheckPlaintext = "nad"
+)
+
+// ErrKeyInvalid is an error for a cipher key that does not match the key check
+var ErrKeyInvalid = errors.New("the passphrase is incorrect")
+
+// ErrCiphertextInvalid is an error for a ciphertext that cannot be decrypted
+var ErrCiphertextInvalid = errors.New("the ciphertext is invalid")
+
+// NewSalt returns a new random salt for deriving a cipher key
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, errors.Wrap(err, "generating random bytes")
+	}
+
+	return salt, nil
+}
+
+// DeriveKey derives a cipher key from the given passphrase and salt using Argon2id
+func DeriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, KeySize)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing the block cipher")
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing GCM")
+	}
+
+	return gcm, nil
+}
+
+// Encrypt encrypts the given plaintext with the given key, and returns the
+// nonce and the ciphertext encoded in base64
+func Encrypt(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "generating a nonce")
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts the given ciphertext produced by Encrypt with the given key
+func Decrypt(key []byte, ciphertext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", ErrCiphertextInvalid
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", ErrCiphertextInvalid
+	}
+
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", ErrCiphertextInvalid
+	}
+
+	return string(plaintext), nil
+}
+
+// NewKeyCheck returns a key check for the given key, which can be stored
+// alongside the salt to verify a key derived later
+func NewKeyCheck(key []byte) (string, error) {
+	return Encrypt(key, keyCheckPlaintext)
+}
+
+// VerifyKey checks that the given key is the one that produced the given key check
+func VerifyKey(key []byte, keyCheck string) error {
+	plaintext, err := Decrypt(key, keyCheck)
+	if err != nil || plaintext != keyCheckPlaintext {
+		return ErrKeyInvalid
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package crypt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestDeriveKey(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+
+	k1 := DeriveKey("correct horse", salt)
+	k2 := DeriveKey("correct horse", salt)
+	k3 := DeriveKey("correct horse", []byte("fedcba9876543210"))
+	k4 := DeriveKey("battery staple", salt)
+
+	assert.Equal(t, len(k1), KeySize, "key size mismatch")
+	assert.Equal(t, bytes.Equal(k1, k2), true, "the same passphrase and salt should derive the same key")
+	assert.Equal(t, bytes.Equal(k1, k3), false, "a different salt should derive a different key")
+	assert.Equal(t, bytes.Equal(k1, k4), false, "a different passphrase should derive a different key")
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := DeriveKey("correct horse", []byte("0123456789abcdef"))
+
+	testCases := []string{
+		"",
+		"foo",
+		"multi\nline 한국어 content",
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc, func(t *testing.T) {
+			c1, err := Encrypt(key, tc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c2, err := Encrypt(key, tc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.NotEqual(t, c1, c2, "ciphertexts should differ by nonce")
+
+			result, err := Decrypt(key, c1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, result, tc, "plaintext mismatch")
+		})
+	}
+}
+
+func TestDecrypt_invalid(t *testing.T) {
+	key := DeriveKey("correct horse", []byte("0123456789abcdef"))
+	otherKey := DeriveKey("battery staple", []byte("0123456789abcdef"))
+
+	c, err := Encrypt(key, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name       string
+		key        []byte
+		ciphertext string
+	}{
+		{
+			name:       "wrong key",
+			key:        otherKey,
+			ciphertext: c,
+		},
+		{
+			name:       "not base64",
+			key:        key,
+			ciphertext: "!!!",
+		},
+		{
+			name:       "too short",
+			key:        key,
+			ciphertext: "Zm9v",
+		},
+		{
+			name:       "tampered",
+			key:        key,
+			ciphertext: "A" + c[1:],
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decrypt(tc.key, tc.ciphertext)
+			assert.Equal(t, err, ErrCiphertextInvalid, "error mismatch")
+		})
+	}
+}
+
+func TestVerifyKey(t *testing.T) {
+	key := DeriveKey("correct horse", []byte("0123456789abcdef"))
+	otherKey := DeriveKey("battery staple", []byte("0123456789abcdef"))
+
+	keyCheck, err := NewKeyCheck(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, VerifyKey(key, keyCheck), nil, "right key mismatch")
+	assert.Equal(t, VerifyKey(otherKey, keyCheck), ErrKeyInvalid, "wrong key mismatch")
+}
@@ -24,12 +24,13 @@ import (
 
 // Book holds a metadata and its notes
 type Book struct {
-	UUID    string `json:"uuid"`
-	Name    string `json:"name"`
-	USN     int    `json:"usn"`
-	Notes   []Note `json:"notes"`
-	Deleted bool   `json:"deleted"`
-	Dirty   bool   `json:"dirty"`
+	UUID       string `json:"uuid"`
+	Name       string `json:"name"`
+	ParentUUID string `json:"parent_uuid"`
+	USN        int    `json:"usn"`
+	Notes      []Note `json:"notes"`
+	Deleted    bool   `json:"deleted"`
+	Dirty      bool   `json:"dirty"`
 }
 
 // Note represents a note
@@ -44,6 +45,8 @@ type Note struct {
 	Public   bool   `json:"public"`
 	Deleted  bool   `json:"deleted"`
 	Dirty    bool   `json:"dirty"`
+	// Tags is not a column of the notes table, and is populated only when needed
+	Tags []string `json:"tags,omitempty"`
 }
 
 // NewNote constructs a note with the given data
@@ -93,6 +96,10 @@ func (n *Note) UpdateUUID(db *DB, newUUID string) error {
 		return errors.Wrapf(err, "updating note uuid from '%s' to '%s'", n.UUID, newUUID)
 	}
 
+	if _, err := db.Exec("UPDATE note_tags SET note_uuid = ? WHERE note_uuid = ?", newUUID, n.UUID); err != nil {
+		return errors.Wrapf(err, "updating note tags from '%s' to '%s'", n.UUID, newUUID)
+	}
+
 	n.UUID = newUUID
 
 	return nil
@@ -105,24 +112,29 @@ func (n Note) Expunge(db *DB) error {
 		return errors.Wrap(err, "expunging a note locally")
 	}
 
+	if _, err := db.Exec("DELETE FROM note_tags WHERE note_uuid = ?", n.UUID); err != nil {
+		return errors.Wrap(err, "expunging note tags locally")
+	}
+
 	return nil
 }
 
 // NewBook constructs a book with the given data
-func NewBook(uuid, name string, usn int, deleted, dirty bool) Book {
+func NewBook(uuid, name, parentUUID string, usn int, deleted, dirty bool) Book {
 	return Book{
-		UUID:    uuid,
-		Name:    name,
-		USN:     usn,
-		Deleted: deleted,
-		Dirty:   dirty,
+		UUID:       uuid,
+		Name:       name,
+		ParentUUID: parentUUID,
+		USN:        usn,
+		Deleted:    deleted,
+		Dirty:      dirty,
 	}
 }
 
 // Insert inserts a new book
 func (b Book) Insert(db *DB) error {
-	_, err := db.Exec("INSERT INTO books (uuid, name, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?)",
-		b.UUID, b.Name, b.USN, b.Dirty, b.Deleted)
+	_, err := db.Exec("INSERT INTO books (uuid, name, parent_uuid, usn, dirty, deleted) VALUES (?, ?, ?, ?, ?, ?)",
+		b.UUID, b.Name, b.ParentUUID, b.USN, b.Dirty, b.Deleted)
 
 	if err != nil {
 		return errors.Wrapf(err, "inserting book with uuid %s", b.UUID)
@@ -133,8 +145,8 @@ func (b Book) Insert(db *DB) error {
 
 // Update updates the book with the given data
 func (b Book) Update(db *DB) error {
-	_, err := db.Exec("UPDATE books SET name = ?, usn = ?, dirty = ?, deleted = ? WHERE uuid = ?",
-		b.Name, b.USN, b.Dirty, b.Deleted, b.UUID)
+	_, err := db.Exec("UPDATE books SET name = ?, parent_uuid = ?, usn = ?, dirty = ?, deleted = ? WHERE uuid = ?",
+		b.Name, b.ParentUUID, b.USN, b.Dirty, b.Deleted, b.UUID)
 
 	if err != nil {
 		return errors.Wrapf(err, "updating the book with uuid %s", b.UUID)
@@ -151,6 +163,10 @@ func (b *Book) UpdateUUID(db *DB, newUUID string) error {
 		return errors.Wrapf(err, "updating book uuid from '%s' to '%s'", b.UUID, newUUID)
 	}
 
+	if _, err := db.Exec("UPDATE books SET parent_uuid = ? WHERE parent_uuid = ?", newUUID, b.UUID); err != nil {
+		return errors.Wrapf(err, "updating parent_uuid of the child books from '%s' to '%s'", b.UUID, newUUID)
+	}
+
 	b.UUID = newUUID
 
 	return nil
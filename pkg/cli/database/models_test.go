@@ -383,6 +383,7 @@ func TestNoteUpdateUUID(t *testing.T) {
 
 			MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", n1.UUID, n1.BookUUID, n1.Body, n1.AddedOn, n1.USN, n1.Deleted, n1.Dirty)
 			MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?)", n2.UUID, n2.BookUUID, n2.Body, n2.AddedOn, n2.USN, n2.Deleted, n2.Dirty)
+			MustExec(t, "inserting n1 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", n1.UUID, "t1")
 
 			// execute
 			tx, err := db.Begin()
@@ -408,6 +409,10 @@ func TestNoteUpdateUUID(t *testing.T) {
 			assert.Equal(t, n1.UUID, tc.newUUID, "n1 original reference uuid mismatch")
 			assert.Equal(t, n1Record.UUID, tc.newUUID, "n1 uuid mismatch")
 			assert.Equal(t, n2Record.UUID, n2.UUID, "n2 uuid mismatch")
+
+			var tagNoteUUID string
+			MustScan(t, "getting n1 tag", db.QueryRow("SELECT note_uuid FROM note_tags WHERE name = ?", "t1"), &tagNoteUUID)
+			assert.Equal(t, tagNoteUUID, tc.newUUID, "n1 tag note_uuid mismatch")
 		})
 	}
 }
@@ -442,6 +447,8 @@ func TestNoteExpunge(t *testing.T) {
 
 	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, usn, added_on, edited_on, body, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", n1.UUID, n1.BookUUID, n1.USN, n1.AddedOn, n1.EditedOn, n1.Body, n1.Public, n1.Deleted, n1.Dirty)
 	MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, usn, added_on, edited_on, body, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", n2.UUID, n2.BookUUID, n2.USN, n2.AddedOn, n2.EditedOn, n2.Body, n2.Public, n2.Deleted, n2.Dirty)
+	MustExec(t, "inserting n1 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", n1.UUID, "t1")
+	MustExec(t, "inserting n2 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", n2.UUID, "t1")
 
 	// execute
 	tx, err := db.Begin()
@@ -462,6 +469,10 @@ func TestNoteExpunge(t *testing.T) {
 
 	assert.Equalf(t, noteCount, 1, "note count mismatch")
 
+	var tagNoteUUID string
+	MustScan(t, "getting the remaining tag", db.QueryRow("SELECT note_uuid FROM note_tags"), &tagNoteUUID)
+	assert.Equal(t, tagNoteUUID, n2.UUID, "remaining tag note_uuid mismatch")
+
 	var n2Record Note
 	MustScan(t, "getting n2",
 		db.QueryRow("SELECT uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty FROM notes WHERE uuid = ?", n2.UUID),
@@ -482,35 +493,39 @@ func TestNewBook(t *testing.T) {
 	testCases := []struct {
 		uuid string
 
-		name    string
-		usn     int
-		deleted bool
-		dirty   bool
+		name       string
+		parentUUID string
+		usn        int
+		deleted    bool
+		dirty      bool
 	}{
 		{
 			uuid: "b1-uuid",
 
-			name:    "b1-name",
-			usn:     0,
-			deleted: false,
-			dirty:   false,
+			name:       "b1-name",
+			parentUUID: "",
+			usn:        0,
+			deleted:    false,
+			dirty:      false,
 		},
 		{
 			uuid: "b2-uuid",
 
-			name:    "b2-name",
-			usn:     1008,
-			deleted: false,
-			dirty:   true,
+			name:       "b2-name",
+			parentUUID: "b1-uuid",
+			usn:        1008,
+			deleted:    false,
+			dirty:      true,
 		},
 	}
 
 	for idx, tc := range testCases {
-		got := NewBook(tc.uuid, tc.name, tc.usn, tc.deleted, tc.dirty)
+		got := NewBook(tc.uuid, tc.name, tc.parentUUID, tc.usn, tc.deleted, tc.dirty)
 
 		assert.Equal(t, got.UUID, tc.uuid, fmt.Sprintf("UUID mismatch for test case %d", idx))
 
 		assert.Equal(t, got.Name, tc.name, fmt.Sprintf("Name mismatch for test case %d", idx))
+		assert.Equal(t, got.ParentUUID, tc.parentUUID, fmt.Sprintf("ParentUUID mismatch for test case %d", idx))
 		assert.Equal(t, got.USN, tc.usn, fmt.Sprintf("USN mismatch for test case %d", idx))
 		assert.Equal(t, got.Deleted, tc.deleted, fmt.Sprintf("Deleted mismatch for test case %d", idx))
 		assert.Equal(t, got.Dirty, tc.dirty, fmt.Sprintf("Dirty mismatch for test case %d", idx))
@@ -521,26 +536,29 @@ func TestBookInsert(t *testing.T) {
 	testCases := []struct {
 		uuid string
 
-		name    string
-		usn     int
-		deleted bool
-		dirty   bool
+		name       string
+		parentUUID string
+		usn        int
+		deleted    bool
+		dirty      bool
 	}{
 		{
 			uuid: "b1-uuid",
 
-			name:    "b1-name",
-			usn:     10808,
-			deleted: false,
-			dirty:   false,
+			name:       "b1-name",
+			parentUUID: "",
+			usn:        10808,
+			deleted:    false,
+			dirty:      false,
 		},
 		{
 			uuid: "b1-uuid",
 
-			name:    "b1-name",
-			usn:     10808,
-			deleted: false,
-			dirty:   true,
+			name:       "b1-name",
+			parentUUID: "b0-uuid",
+			usn:        10808,
+			deleted:    false,
+			dirty:      true,
 		},
 	}
 
@@ -553,10 +571,11 @@ func TestBookInsert(t *testing.T) {
 			b := Book{
 				UUID: tc.uuid,
 
-				Name:    tc.name,
-				USN:     tc.usn,
-				Dirty:   tc.dirty,
-				Deleted: tc.deleted,
+				Name:       tc.name,
+				ParentUUID: tc.parentUUID,
+				USN:        tc.usn,
+				Dirty:      tc.dirty,
+				Deleted:    tc.deleted,
 			}
 
 			// execute
@@ -574,15 +593,16 @@ func TestBookInsert(t *testing.T) {
 			tx.Commit()
 
 			// test
-			var uuid, name string
+			var uuid, name, parentUUID string
 			var usn int
 			var deleted, dirty bool
 			MustScan(t, "getting b1",
-				db.QueryRow("SELECT uuid, name, usn, deleted, dirty FROM books WHERE uuid = ?", tc.uuid),
-				&uuid, &name, &usn, &deleted, &dirty)
+				db.QueryRow("SELECT uuid, name, parent_uuid, usn, deleted, dirty FROM books WHERE uuid = ?", tc.uuid),
+				&uuid, &name, &parentUUID, &usn, &deleted, &dirty)
 
 			assert.Equal(t, uuid, tc.uuid, fmt.Sprintf("uuid mismatch for test case %d", idx))
 			assert.Equal(t, name, tc.name, fmt.Sprintf("name mismatch for test case %d", idx))
+			assert.Equal(t, parentUUID, tc.parentUUID, fmt.Sprintf("parent_uuid mismatch for test case %d", idx))
 			assert.Equal(t, usn, tc.usn, fmt.Sprintf("usn mismatch for test case %d", idx))
 			assert.Equal(t, deleted, tc.deleted, fmt.Sprintf("deleted mismatch for test case %d", idx))
 			assert.Equal(t, dirty, tc.dirty, fmt.Sprintf("dirty mismatch for test case %d", idx))
@@ -594,38 +614,41 @@ func TestBookUpdate(t *testing.T) {
 	testCases := []struct {
 		uuid string
 
-		name       string
-		usn        int
-		deleted    bool
-		dirty      bool
-		newLabel   string
-		newUSN     int
-		newDeleted bool
-		newDirty   bool
+		name          string
+		usn           int
+		deleted       bool
+		dirty         bool
+		newLabel      string
+		newParentUUID string
+		newUSN        int
+		newDeleted    bool
+		newDirty      bool
 	}{
 		{
 			uuid: "b1-uuid",
 
-			name:       "b1-name",
-			usn:        0,
-			deleted:    false,
-			dirty:      false,
-			newLabel:   "b1-name-edited",
-			newUSN:     0,
-			newDeleted: false,
-			newDirty:   true,
+			name:          "b1-name",
+			usn:           0,
+			deleted:       false,
+			dirty:         false,
+			newLabel:      "b1-name-edited",
+			newParentUUID: "b2-uuid",
+			newUSN:        0,
+			newDeleted:    false,
+			newDirty:      true,
 		},
 		{
 			uuid: "b1-uuid",
 
-			name:       "b1-name",
-			usn:        0,
-			deleted:    false,
-			dirty:      false,
-			newLabel:   "",
-			newUSN:     10,
-			newDeleted: true,
-			newDirty:   false,
+			name:          "b1-name",
+			usn:           0,
+			deleted:       false,
+			dirty:         false,
+			newLabel:      "",
+			newParentUUID: "",
+			newUSN:        10,
+			newDeleted:    true,
+			newDirty:      false,
 		},
 	}
 
@@ -662,6 +685,7 @@ func TestBookUpdate(t *testing.T) {
 			}
 
 			b1.Name = tc.newLabel
+			b1.ParentUUID = tc.newParentUUID
 			b1.USN = tc.newUSN
 			b1.Deleted = tc.newDeleted
 			b1.Dirty = tc.newDirty
@@ -676,15 +700,16 @@ func TestBookUpdate(t *testing.T) {
 			// test
 			var b1Record, b2Record Book
 			MustScan(t, "getting b1",
-				db.QueryRow("SELECT uuid, name, usn, deleted, dirty FROM books WHERE uuid = ?", tc.uuid),
+				db.QueryRow("SELECT uuid, name, parent_uuid, usn, deleted, dirty FROM books WHERE uuid = ?", tc.uuid),
 
-				&b1Record.UUID, &b1Record.Name, &b1Record.USN, &b1Record.Deleted, &b1Record.Dirty)
+				&b1Record.UUID, &b1Record.Name, &b1Record.ParentUUID, &b1Record.USN, &b1Record.Deleted, &b1Record.Dirty)
 			MustScan(t, "getting b2",
 				db.QueryRow("SELECT uuid, name, usn, deleted, dirty FROM books WHERE uuid = ?", b2.UUID),
 				&b2Record.UUID, &b2Record.Name, &b2Record.USN, &b2Record.Deleted, &b2Record.Dirty)
 
 			assert.Equal(t, b1Record.UUID, b1.UUID, fmt.Sprintf("b1 uuid mismatch for test case %d", idx))
 			assert.Equal(t, b1Record.Name, tc.newLabel, fmt.Sprintf("b1 name mismatch for test case %d", idx))
+			assert.Equal(t, b1Record.ParentUUID, tc.newParentUUID, fmt.Sprintf("b1 parent_uuid mismatch for test case %d", idx))
 			assert.Equal(t, b1Record.USN, tc.newUSN, fmt.Sprintf("b1 usn mismatch for test case %d", idx))
 			assert.Equal(t, b1Record.Deleted, tc.newDeleted, fmt.Sprintf("b1 deleted mismatch for test case %d", idx))
 			assert.Equal(t, b1Record.Dirty, tc.newDirty, fmt.Sprintf("b1 dirty mismatch for test case %d", idx))
@@ -736,7 +761,7 @@ func TestBookUpdateUUID(t *testing.T) {
 			}
 
 			MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, name, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", b1.UUID, b1.Name, b1.USN, b1.Deleted, b1.Dirty)
-			MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, name, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?)", b2.UUID, b2.Name, b2.USN, b2.Deleted, b2.Dirty)
+			MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, name, parent_uuid, usn, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?)", b2.UUID, b2.Name, b1.UUID, b2.USN, b2.Deleted, b2.Dirty)
 
 			// execute
 			tx, err := db.Begin()
@@ -757,12 +782,13 @@ func TestBookUpdateUUID(t *testing.T) {
 
 				&b1Record.UUID, &b1Record.Name, &b1Record.USN, &b1Record.Deleted, &b1Record.Dirty)
 			MustScan(t, "getting b2",
-				db.QueryRow("SELECT uuid, name, usn, deleted, dirty FROM books WHERE name = ?", "b2-name"),
-				&b2Record.UUID, &b2Record.Name, &b2Record.USN, &b2Record.Deleted, &b2Record.Dirty)
+				db.QueryRow("SELECT uuid, name, parent_uuid, usn, deleted, dirty FROM books WHERE name = ?", "b2-name"),
+				&b2Record.UUID, &b2Record.Name, &b2Record.ParentUUID, &b2Record.USN, &b2Record.Deleted, &b2Record.Dirty)
 
 			assert.Equal(t, b1.UUID, tc.newUUID, "b1 original reference uuid mismatch")
 			assert.Equal(t, b1Record.UUID, tc.newUUID, "b1 uuid mismatch")
 			assert.Equal(t, b2Record.UUID, b2.UUID, "b2 uuid mismatch")
+			assert.Equal(t, b2Record.ParentUUID, tc.newUUID, "b2 parent_uuid mismatch")
 		})
 	}
 }
@@ -20,7 +20,10 @@ package database
 
 import (
 	"database/sql"
+	"strings"
 
+	"github.com/nadproject/nad/pkg/cli/consts"
+	"github.com/nadproject/nad/pkg/cli/utils"
 	"github.com/nadproject/nad/pkg/clock"
 	"github.com/pkg/errors"
 )
@@ -89,23 +92,37 @@ type NoteInfo struct {
 	Content   string
 	AddedOn   int64
 	EditedOn  int64
+	Tags      []string
 }
 
 // GetNoteInfo returns a NoteInfo for the note with the given noteRowID
 func GetNoteInfo(db *DB, noteRowID int) (NoteInfo, error) {
 	var ret NoteInfo
 
-	err := db.QueryRow(`SELECT books.name, notes.uuid, notes.body, notes.added_on, notes.edited_on, notes.rowid
+	var bookUUID string
+	err := db.QueryRow(`SELECT notes.book_uuid, notes.uuid, notes.body, notes.added_on, notes.edited_on, notes.rowid
 			FROM notes
 			INNER JOIN books ON books.uuid = notes.book_uuid
 			WHERE notes.rowid = ? AND notes.deleted = false`, noteRowID).
-		Scan(&ret.BookLabel, &ret.UUID, &ret.Content, &ret.AddedOn, &ret.EditedOn, &ret.RowID)
+		Scan(&bookUUID, &ret.UUID, &ret.Content, &ret.AddedOn, &ret.EditedOn, &ret.RowID)
 	if err == sql.ErrNoRows {
 		return ret, errors.Errorf("note %d not found", noteRowID)
 	} else if err != nil {
 		return ret, errors.Wrap(err, "querying the note")
 	}
 
+	bookPath, err := GetBookPath(db, bookUUID)
+	if err != nil {
+		return ret, errors.Wrap(err, "getting the book path")
+	}
+	ret.BookLabel = bookPath
+
+	tags, err := GetNoteTags(db, ret.UUID)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying the note tags")
+	}
+	ret.Tags = tags
+
 	return ret, nil
 }
 
@@ -114,6 +131,7 @@ type BookInfo struct {
 	RowID int
 	UUID  string
 	Name  string
+	Path  string
 }
 
 // GetBookInfo returns a BookInfo for the book with the given uuid
@@ -130,15 +148,50 @@ func GetBookInfo(db *DB, uuid string) (BookInfo, error) {
 		return ret, errors.Wrap(err, "querying the note")
 	}
 
+	path, err := GetBookPath(db, uuid)
+	if err != nil {
+		return ret, errors.Wrap(err, "getting the book path")
+	}
+	ret.Path = path
+
 	return ret, nil
 }
 
-// GetBookUUID returns a uuid of a book given a name
-func GetBookUUID(db *DB, name string) (string, error) {
+// SplitBookPath splits the given book path into the names of the books in it,
+// starting from the top-level book
+func SplitBookPath(path string) []string {
+	return strings.Split(strings.Trim(path, consts.BookPathSeparator), consts.BookPathSeparator)
+}
+
+// JoinBookPath joins the given book names into a book path
+func JoinBookPath(names ...string) string {
+	return strings.Join(names, consts.BookPathSeparator)
+}
+
+// GetBookUUID returns a uuid of a book given a path. A path is made of book
+// names separated by a slash, such as 'work/infra/k8s', and a top-level book is
+// addressed by its name.
+func GetBookUUID(db *DB, path string) (string, error) {
 	var ret string
-	err := db.QueryRow("SELECT uuid FROM books WHERE name = ?", name).Scan(&ret)
+	for _, name := range SplitBookPath(path) {
+		err := db.QueryRow("SELECT uuid FROM books WHERE parent_uuid = ? AND name = ?", ret, name).Scan(&ret)
+		if err == sql.ErrNoRows {
+			return getLegacyBookUUID(db, path)
+		} else if err != nil {
+			return ret, errors.Wrap(err, "querying the book")
+		}
+	}
+
+	return ret, nil
+}
+
+// getLegacyBookUUID looks up a top-level book whose name is the whole path.
+// Books created before nesting was supported may have a slash in the name.
+func getLegacyBookUUID(db *DB, path string) (string, error) {
+	var ret string
+	err := db.QueryRow("SELECT uuid FROM books WHERE parent_uuid = '' AND name = ?", path).Scan(&ret)
 	if err == sql.ErrNoRows {
-		return ret, errors.Errorf("book '%s' not found", name)
+		return ret, errors.Errorf("book '%s' not found", path)
 	} else if err != nil {
 		return ret, errors.Wrap(err, "querying the book")
 	}
@@ -146,6 +199,97 @@ func GetBookUUID(db *DB, name string) (string, error) {
 	return ret, nil
 }
 
+// GetBookPath returns the path of the book with the given uuid
+func GetBookPath(db *DB, uuid string) (string, error) {
+	names := []string{}
+	seen := map[string]bool{}
+
+	for uuid != "" && !seen[uuid] {
+		seen[uuid] = true
+
+		var name, parentUUID string
+		err := db.QueryRow("SELECT name, parent_uuid FROM books WHERE uuid = ?", uuid).Scan(&name, &parentUUID)
+		if err == sql.ErrNoRows {
+			// An ancestor might not have been synced yet. Treat the book as a top-level one.
+			if len(names) > 0 {
+				break
+			}
+
+			return "", errors.Errorf("book %s not found", uuid)
+		} else if err != nil {
+			return "", errors.Wrap(err, "querying the book")
+		}
+
+		names = append([]string{name}, names...)
+		uuid = parentUUID
+	}
+
+	return JoinBookPath(names...), nil
+}
+
+// GetBookPaths returns a map of the uuids of all books to their paths
+func GetBookPaths(db *DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT uuid, name, parent_uuid FROM books")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	names := map[string]string{}
+	parents := map[string]string{}
+	for rows.Next() {
+		var uuid, name, parentUUID string
+		if err := rows.Scan(&uuid, &name, &parentUUID); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		names[uuid] = name
+		parents[uuid] = parentUUID
+	}
+
+	ret := map[string]string{}
+	for uuid := range names {
+		path := []string{}
+		seen := map[string]bool{}
+
+		for cur := uuid; cur != "" && !seen[cur]; cur = parents[cur] {
+			name, ok := names[cur]
+			if !ok {
+				break
+			}
+
+			seen[cur] = true
+			path = append([]string{name}, path...)
+		}
+
+		ret[uuid] = JoinBookPath(path...)
+	}
+
+	return ret, nil
+}
+
+// IsBookAncestor returns true if the book with the given ancestorUUID is the
+// book with the given uuid or one of its ancestors
+func IsBookAncestor(db *DB, ancestorUUID, uuid string) (bool, error) {
+	seen := map[string]bool{}
+
+	for uuid != "" && !seen[uuid] {
+		if uuid == ancestorUUID {
+			return true, nil
+		}
+		seen[uuid] = true
+
+		err := db.QueryRow("SELECT parent_uuid FROM books WHERE uuid = ?", uuid).Scan(&uuid)
+		if err == sql.ErrNoRows {
+			return false, nil
+		} else if err != nil {
+			return false, errors.Wrap(err, "querying the book")
+		}
+	}
+
+	return false, nil
+}
+
 // UpdateBookName updates a book name
 func UpdateBookName(db *DB, uuid string, name string) error {
 	_, err := db.Exec(`UPDATE books
@@ -158,6 +302,73 @@ func UpdateBookName(db *DB, uuid string, name string) error {
 	return nil
 }
 
+// GetSubtreeBookUUIDs returns the uuids of the book with the given uuid and
+// all of its undeleted descendants
+func GetSubtreeBookUUIDs(db *DB, bookUUID string) ([]string, error) {
+	rows, err := db.Query(`WITH RECURSIVE subtree(uuid) AS (
+			SELECT ?
+			UNION
+			SELECT books.uuid FROM books
+			INNER JOIN subtree ON books.parent_uuid = subtree.uuid
+			WHERE books.deleted = false
+		)
+		SELECT uuid FROM subtree`, bookUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	ret := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, uuid)
+	}
+
+	return ret, nil
+}
+
+// UpdateBookParent moves a book under the book with the given parentUUID. An
+// empty parentUUID moves the book to the top level.
+func UpdateBookParent(db *DB, uuid string, parentUUID string) error {
+	_, err := db.Exec(`UPDATE books
+		SET parent_uuid = ?, dirty = ?
+		WHERE uuid = ?`, parentUUID, true, uuid)
+	if err != nil {
+		return errors.Wrap(err, "updating the book")
+	}
+
+	return nil
+}
+
+// FindOrCreateBook returns the uuid of the book with the given path, creating
+// the books in the path that do not exist yet
+func FindOrCreateBook(db *DB, path string) (string, error) {
+	var parentUUID string
+
+	for _, name := range SplitBookPath(path) {
+		var uuid string
+		err := db.QueryRow("SELECT uuid FROM books WHERE parent_uuid = ? AND name = ?", parentUUID, name).Scan(&uuid)
+		if err == sql.ErrNoRows {
+			uuid = utils.GenerateUUID()
+
+			b := NewBook(uuid, name, parentUUID, 0, false, true)
+			if err := b.Insert(db); err != nil {
+				return "", errors.Wrapf(err, "creating the book %s", name)
+			}
+		} else if err != nil {
+			return "", errors.Wrapf(err, "finding the book %s", name)
+		}
+
+		parentUUID = uuid
+	}
+
+	return parentUUID, nil
+}
+
 // GetActiveNote gets the note which has the given rowid and is not deleted
 func GetActiveNote(db *DB, rowid int) (Note, error) {
 	var ret Note
@@ -209,6 +420,20 @@ func UpdateNoteContent(db *DB, c clock.Clock, rowID int, content string) error {
 	return nil
 }
 
+// UpdateNotePublic sets whether the note is public and marks the note as dirty
+func UpdateNotePublic(db *DB, c clock.Clock, rowID int, public bool) error {
+	ts := c.Now().UnixNano()
+
+	_, err := db.Exec(`UPDATE notes
+			SET public = ?, edited_on = ?, dirty = ?
+			WHERE rowid = ?`, public, ts, true, rowID)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
+
 // UpdateNoteBook moves the note to a different book and marks the note as dirty
 func UpdateNoteBook(db *DB, c clock.Clock, rowID int, bookUUID string) error {
 	ts := c.Now().UnixNano()
@@ -222,3 +447,61 @@ func UpdateNoteBook(db *DB, c clock.Clock, rowID int, bookUUID string) error {
 
 	return nil
 }
+
+// GetNoteTags returns the names of the tags of the note with the given uuid, ordered by name
+func GetNoteTags(db *DB, noteUUID string) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM note_tags WHERE note_uuid = ? ORDER BY name ASC", noteUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying note tags")
+	}
+	defer rows.Close()
+
+	ret := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, name)
+	}
+
+	return ret, nil
+}
+
+// SetNoteTags replaces the tags of the note with the given uuid
+func SetNoteTags(db *DB, noteUUID string, tags []string) error {
+	if _, err := db.Exec("DELETE FROM note_tags WHERE note_uuid = ?", noteUUID); err != nil {
+		return errors.Wrap(err, "deleting note tags")
+	}
+
+	for _, tag := range tags {
+		if _, err := db.Exec("INSERT OR IGNORE INTO note_tags (note_uuid, name) VALUES (?, ?)", noteUUID, tag); err != nil {
+			return errors.Wrapf(err, "inserting tag %s", tag)
+		}
+	}
+
+	return nil
+}
+
+// UpdateNoteTags replaces the tags of the note and marks the note as dirty
+func UpdateNoteTags(db *DB, c clock.Clock, rowID int, tags []string) error {
+	var uuid string
+	if err := db.QueryRow("SELECT uuid FROM notes WHERE rowid = ?", rowID).Scan(&uuid); err != nil {
+		return errors.Wrap(err, "finding the note")
+	}
+
+	if err := SetNoteTags(db, uuid, tags); err != nil {
+		return errors.Wrap(err, "setting tags")
+	}
+
+	ts := c.Now().UnixNano()
+	_, err := db.Exec(`UPDATE notes
+			SET edited_on = ?, dirty = ?
+			WHERE rowid = ?`, ts, true, rowID)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	return nil
+}
@@ -322,6 +322,126 @@ func TestUpdateNoteContent(t *testing.T) {
 	assert.Equal(t, dirty, true, "dirty mismatch")
 }
 
+func TestUpdateNotePublic(t *testing.T) {
+	testCases := []struct {
+		public   bool
+		expected bool
+	}{
+		{
+			public:   false,
+			expected: true,
+		},
+		{
+			public:   true,
+			expected: false,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// set up
+			db := InitTestDB(t, "../tmp/nad-test.db", nil)
+			defer CloseTestDB(t, db)
+
+			uuid := "n1-uuid"
+			MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, "b1-uuid", "n1 content", 1542058875, 0, 1, tc.public, false, false)
+
+			var rowid int
+			MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", uuid), &rowid)
+
+			// execute
+			c := clock.NewMock()
+			now := time.Date(2017, time.March, 14, 21, 15, 0, 0, time.UTC)
+			c.SetNow(now)
+
+			err := UpdateNotePublic(db, c, rowid, tc.expected)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			var public bool
+			var editedOn int
+			var dirty bool
+
+			MustScan(t, "getting the note record", db.QueryRow("SELECT public, edited_on, dirty FROM notes WHERE rowid = ?", rowid), &public, &editedOn, &dirty)
+
+			assert.Equal(t, public, tc.expected, "public mismatch")
+			assert.Equal(t, int64(editedOn), now.UnixNano(), "editedOn mismatch")
+			assert.Equal(t, dirty, true, "dirty mismatch")
+		})
+	}
+}
+
+func TestNoteTags(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/nad-test.db", nil)
+	defer CloseTestDB(t, db)
+
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", "n1-uuid", "b1-uuid", "n1 content", 1542058875, 0, 1, false, false, false)
+	MustExec(t, "inserting n2", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", "n2-uuid", "b1-uuid", "n2 content", 1542058876, 0, 1, false, false, false)
+	MustExec(t, "inserting n2 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", "n2-uuid", "closure")
+
+	// execute
+	if err := SetNoteTags(db, "n1-uuid", []string{"scope", "closure", "scope"}); err != nil {
+		t.Fatal(errors.Wrap(err, "setting n1 tags"))
+	}
+	n1Tags, err := GetNoteTags(db, "n1-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting n1 tags"))
+	}
+
+	if err := SetNoteTags(db, "n1-uuid", []string{"hoisting"}); err != nil {
+		t.Fatal(errors.Wrap(err, "replacing n1 tags"))
+	}
+	n1ReplacedTags, err := GetNoteTags(db, "n1-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting replaced n1 tags"))
+	}
+
+	n2Tags, err := GetNoteTags(db, "n2-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting n2 tags"))
+	}
+
+	// test
+	assert.DeepEqual(t, n1Tags, []string{"closure", "scope"}, "n1 tags mismatch")
+	assert.DeepEqual(t, n1ReplacedTags, []string{"hoisting"}, "n1 replaced tags mismatch")
+	assert.DeepEqual(t, n2Tags, []string{"closure"}, "n2 tags mismatch")
+}
+
+func TestUpdateNoteTags(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/nad-test.db", nil)
+	defer CloseTestDB(t, db)
+
+	uuid := "n1-uuid"
+	MustExec(t, "inserting n1", db, "INSERT INTO notes (uuid, book_uuid, body, added_on, edited_on, usn, public, deleted, dirty) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", uuid, "b1-uuid", "n1 content", 1542058875, 0, 1, false, false, false)
+	MustExec(t, "inserting n1 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", uuid, "closure")
+
+	var rowid int
+	MustScan(t, "getting rowid", db.QueryRow("SELECT rowid FROM notes WHERE uuid = ?", uuid), &rowid)
+
+	// execute
+	c := clock.NewMock()
+	now := time.Date(2017, time.March, 14, 21, 15, 0, 0, time.UTC)
+	c.SetNow(now)
+
+	if err := UpdateNoteTags(db, c, rowid, []string{}); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var tagCount int
+	var editedOn int
+	var dirty bool
+	MustScan(t, "counting tags", db.QueryRow("SELECT count(*) FROM note_tags"), &tagCount)
+	MustScan(t, "getting the note record", db.QueryRow("SELECT edited_on, dirty FROM notes WHERE rowid = ?", rowid), &editedOn, &dirty)
+
+	assert.Equal(t, tagCount, 0, "tag count mismatch")
+	assert.Equal(t, int64(editedOn), now.UnixNano(), "editedOn mismatch")
+	assert.Equal(t, dirty, true, "dirty mismatch")
+}
+
 func TestUpdateNoteBook(t *testing.T) {
 	// set up
 	db := InitTestDB(t, "../tmp/nad-test.db", nil)
@@ -383,3 +503,235 @@ func TestUpdateBookName(t *testing.T) {
 	assert.Equal(t, b1.USN, 8, "USN mismatch")
 	assert.Equal(t, b1.Deleted, false, "Deleted mismatch")
 }
+
+// setupBookTree inserts the books 'work', 'work/infra', 'work/infra/k8s' and 'personal'
+func setupBookTree(t *testing.T, db *DB) {
+	MustExec(t, "inserting b1", db, "INSERT INTO books (uuid, name, parent_uuid) VALUES (?, ?, ?)", "b1-uuid", "work", "")
+	MustExec(t, "inserting b2", db, "INSERT INTO books (uuid, name, parent_uuid) VALUES (?, ?, ?)", "b2-uuid", "infra", "b1-uuid")
+	MustExec(t, "inserting b3", db, "INSERT INTO books (uuid, name, parent_uuid) VALUES (?, ?, ?)", "b3-uuid", "k8s", "b2-uuid")
+	MustExec(t, "inserting b4", db, "INSERT INTO books (uuid, name, parent_uuid) VALUES (?, ?, ?)", "b4-uuid", "personal", "")
+}
+
+func TestGetBookUUID(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{
+			path:     "work",
+			expected: "b1-uuid",
+		},
+		{
+			path:     "work/infra/k8s",
+			expected: "b3-uuid",
+		},
+		{
+			path:     "/work/infra/",
+			expected: "b2-uuid",
+		},
+		// a top-level book created before nesting was supported
+		{
+			path:     "c/c++",
+			expected: "b5-uuid",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			// set up
+			db := InitTestDB(t, "../tmp/nad-test.db", nil)
+			defer CloseTestDB(t, db)
+
+			setupBookTree(t, db)
+			MustExec(t, "inserting b5", db, "INSERT INTO books (uuid, name, parent_uuid) VALUES (?, ?, ?)", "b5-uuid", "c/c++", "")
+
+			// execute
+			got, err := GetBookUUID(db, tc.path)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			assert.Equal(t, got, tc.expected, "uuid mismatch")
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		// set up
+		db := InitTestDB(t, "../tmp/nad-test.db", nil)
+		defer CloseTestDB(t, db)
+
+		setupBookTree(t, db)
+
+		// execute
+		_, err := GetBookUUID(db, "infra")
+
+		// test
+		assert.Equal(t, err.Error(), "book 'infra' not found", "error mismatch")
+	})
+}
+
+func TestGetBookPath(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/nad-test.db", nil)
+	defer CloseTestDB(t, db)
+
+	setupBookTree(t, db)
+
+	// execute
+	b3Path, err := GetBookPath(db, "b3-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing for b3"))
+	}
+	b4Path, err := GetBookPath(db, "b4-uuid")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing for b4"))
+	}
+
+	// test
+	assert.Equal(t, b3Path, "work/infra/k8s", "b3 path mismatch")
+	assert.Equal(t, b4Path, "personal", "b4 path mismatch")
+}
+
+func TestGetBookPaths(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/nad-test.db", nil)
+	defer CloseTestDB(t, db)
+
+	setupBookTree(t, db)
+
+	// execute
+	got, err := GetBookPaths(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	expected := map[string]string{
+		"b1-uuid": "work",
+		"b2-uuid": "work/infra",
+		"b3-uuid": "work/infra/k8s",
+		"b4-uuid": "personal",
+	}
+	assert.DeepEqual(t, got, expected, "paths mismatch")
+}
+
+func TestIsBookAncestor(t *testing.T) {
+	testCases := []struct {
+		ancestorUUID string
+		uuid         string
+		expected     bool
+	}{
+		{
+			ancestorUUID: "b1-uuid",
+			uuid:         "b3-uuid",
+			expected:     true,
+		},
+		{
+			ancestorUUID: "b3-uuid",
+			uuid:         "b3-uuid",
+			expected:     true,
+		},
+		{
+			ancestorUUID: "b3-uuid",
+			uuid:         "b1-uuid",
+			expected:     false,
+		},
+		{
+			ancestorUUID: "b4-uuid",
+			uuid:         "b2-uuid",
+			expected:     false,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// set up
+			db := InitTestDB(t, "../tmp/nad-test.db", nil)
+			defer CloseTestDB(t, db)
+
+			setupBookTree(t, db)
+
+			// execute
+			got, err := IsBookAncestor(db, tc.ancestorUUID, tc.uuid)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "executing"))
+			}
+
+			// test
+			assert.Equal(t, got, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestUpdateBookParent(t *testing.T) {
+	// set up
+	db := InitTestDB(t, "../tmp/nad-test.db", nil)
+	defer CloseTestDB(t, db)
+
+	setupBookTree(t, db)
+
+	// execute
+	if err := UpdateBookParent(db, "b3-uuid", "b4-uuid"); err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	// test
+	var parentUUID string
+	var dirty bool
+	MustScan(t, "getting b3", db.QueryRow("SELECT parent_uuid, dirty FROM books WHERE uuid = ?", "b3-uuid"), &parentUUID, &dirty)
+	assert.Equal(t, parentUUID, "b4-uuid", "parent_uuid mismatch")
+	assert.Equal(t, dirty, true, "dirty mismatch")
+}
+
+func TestFindOrCreateBook(t *testing.T) {
+	t.Run("existing", func(t *testing.T) {
+		// set up
+		db := InitTestDB(t, "../tmp/nad-test.db", nil)
+		defer CloseTestDB(t, db)
+
+		setupBookTree(t, db)
+
+		// execute
+		uuid, err := FindOrCreateBook(db, "work/infra")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		var bookCount int
+		MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+
+		assert.Equal(t, uuid, "b2-uuid", "uuid mismatch")
+		assert.Equal(t, bookCount, 4, "book count mismatch")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		// set up
+		db := InitTestDB(t, "../tmp/nad-test.db", nil)
+		defer CloseTestDB(t, db)
+
+		setupBookTree(t, db)
+
+		// execute
+		uuid, err := FindOrCreateBook(db, "work/infra/aws/ec2")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "executing"))
+		}
+
+		// test
+		var bookCount int
+		MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+		assert.Equal(t, bookCount, 6, "book count mismatch")
+
+		var aws, ec2 Book
+		MustScan(t, "getting aws", db.QueryRow("SELECT uuid, parent_uuid, dirty FROM books WHERE name = ?", "aws"), &aws.UUID, &aws.ParentUUID, &aws.Dirty)
+		MustScan(t, "getting ec2", db.QueryRow("SELECT uuid, parent_uuid, dirty FROM books WHERE name = ?", "ec2"), &ec2.UUID, &ec2.ParentUUID, &ec2.Dirty)
+
+		assert.Equal(t, aws.ParentUUID, "b2-uuid", "aws parent_uuid mismatch")
+		assert.Equal(t, aws.Dirty, true, "aws dirty mismatch")
+		assert.Equal(t, ec2.ParentUUID, aws.UUID, "ec2 parent_uuid mismatch")
+		assert.Equal(t, ec2.Dirty, true, "ec2 dirty mismatch")
+		assert.Equal(t, uuid, ec2.UUID, "uuid mismatch")
+	})
+}
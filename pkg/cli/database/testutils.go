@@ -34,13 +34,13 @@ var defaultSchemaSQL = `CREATE TABLE books
 		(
 			uuid text PRIMARY KEY,
 			name text NOT NULL
-		, dirty bool DEFAULT false, usn int DEFAULT 0 NOT NULL, deleted bool DEFAULT false);
+		, dirty bool DEFAULT false, usn int DEFAULT 0 NOT NULL, deleted bool DEFAULT false, parent_uuid text NOT NULL DEFAULT '');
 CREATE TABLE system
 		(
 			key string NOT NULL,
 			value text NOT NULL
 		);
-CREATE UNIQUE INDEX idx_books_name ON books(name);
+CREATE UNIQUE INDEX idx_books_parent_uuid_name ON books(parent_uuid, name);
 CREATE UNIQUE INDEX idx_books_uuid ON books(uuid);
 CREATE TABLE IF NOT EXISTS "notes"
 		(
@@ -79,7 +79,14 @@ CREATE TABLE actions
 			timestamp integer NOT NULL
 		);
 CREATE UNIQUE INDEX idx_notes_uuid ON notes(uuid);
-CREATE INDEX idx_notes_book_uuid ON notes(book_uuid);`
+CREATE INDEX idx_notes_book_uuid ON notes(book_uuid);
+CREATE TABLE note_tags
+		(
+			note_uuid text NOT NULL,
+			name text NOT NULL
+		);
+CREATE UNIQUE INDEX idx_note_tags_note_uuid_name ON note_tags(note_uuid, name);
+CREATE INDEX idx_note_tags_name ON note_tags(name);`
 
 // MustScan scans the given row and fails a test in case of any errors
 func MustScan(t *testing.T, message string, row *sql.Row, args ...interface{}) {
@@ -161,7 +168,7 @@ func OpenTestDB(t *testing.T, nadDir string) *DB {
 
 // MarkMigrationComplete marks all migrations as complete in the database
 func MarkMigrationComplete(t *testing.T, db *DB) {
-	if _, err := db.Exec("INSERT INTO system (key, value) VALUES (? , ?);", consts.SystemSchema, 1); err != nil {
+	if _, err := db.Exec("INSERT INTO system (key, value) VALUES (? , ?);", consts.SystemSchema, 3); err != nil {
 		t.Fatal(errors.Wrap(err, "inserting schema"))
 	}
 	if _, err := db.Exec("INSERT INTO system (key, value) VALUES (? , ?);", consts.SystemRemoteSchema, 1); err != nil {
@@ -22,6 +22,7 @@ package infra
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"os/user"
@@ -112,6 +113,19 @@ func SetupCtx(ctx context.NadCtx) (context.NadCtx, error) {
 		return ctx, errors.Wrap(err, "finding sesison key expiry")
 	}
 
+	var cipherKey []byte
+	var encodedCipherKey string
+	err = db.QueryRow("SELECT value FROM system WHERE key = ?", consts.SystemCipherKey).Scan(&encodedCipherKey)
+	if err != nil && err != sql.ErrNoRows {
+		return ctx, errors.Wrap(err, "finding cipher key")
+	}
+	if encodedCipherKey != "" {
+		cipherKey, err = base64.StdEncoding.DecodeString(encodedCipherKey)
+		if err != nil {
+			return ctx, errors.Wrap(err, "decoding cipher key")
+		}
+	}
+
 	cf, err := config.Read(ctx)
 	if err != nil {
 		return ctx, errors.Wrap(err, "reading config")
@@ -124,6 +138,7 @@ func SetupCtx(ctx context.NadCtx) (context.NadCtx, error) {
 		DB:               ctx.DB,
 		SessionKey:       sessionKey,
 		SessionKeyExpiry: sessionKeyExpiry,
+		CipherKey:        cipherKey,
 		APIEndpoint:      cf.APIEndpoint,
 		Editor:           cf.Editor,
 		Clock:            clock.New(),
@@ -29,12 +29,18 @@ import (
 	// commands
 	"github.com/nadproject/nad/pkg/cli/cmd/add"
 	"github.com/nadproject/nad/pkg/cli/cmd/edit"
+	"github.com/nadproject/nad/pkg/cli/cmd/encrypt"
+	"github.com/nadproject/nad/pkg/cli/cmd/export"
 	"github.com/nadproject/nad/pkg/cli/cmd/find"
+	"github.com/nadproject/nad/pkg/cli/cmd/history"
+	"github.com/nadproject/nad/pkg/cli/cmd/importer"
 	"github.com/nadproject/nad/pkg/cli/cmd/login"
 	"github.com/nadproject/nad/pkg/cli/cmd/logout"
 	"github.com/nadproject/nad/pkg/cli/cmd/remove"
 	"github.com/nadproject/nad/pkg/cli/cmd/root"
+	"github.com/nadproject/nad/pkg/cli/cmd/sessions"
 	"github.com/nadproject/nad/pkg/cli/cmd/sync"
+	"github.com/nadproject/nad/pkg/cli/cmd/token"
 	"github.com/nadproject/nad/pkg/cli/cmd/version"
 	"github.com/nadproject/nad/pkg/cli/cmd/view"
 )
@@ -59,6 +65,12 @@ func main() {
 	root.Register(version.NewCmd(*ctx))
 	root.Register(view.NewCmd(*ctx))
 	root.Register(find.NewCmd(*ctx))
+	root.Register(history.NewCmd(*ctx))
+	root.Register(export.NewCmd(*ctx))
+	root.Register(importer.NewCmd(*ctx))
+	root.Register(encrypt.NewCmd(*ctx))
+	root.Register(token.NewCmd(*ctx))
+	root.Register(sessions.NewCmd(*ctx))
 
 	if err := root.Execute(); err != nil {
 		log.Errorf("%s\n", err.Error())
@@ -19,10 +19,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"testing"
 
 	"github.com/nadproject/nad/pkg/assert"
@@ -73,17 +76,20 @@ func TestInit(t *testing.T) {
 		t.Errorf("config file was not initialized")
 	}
 
-	var notesTableCount, booksTableCount, systemTableCount int
+	var notesTableCount, booksTableCount, systemTableCount, noteTagsTableCount int
 	database.MustScan(t, "counting notes",
 		db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = ? AND name = ?", "table", "notes"), &notesTableCount)
 	database.MustScan(t, "counting books",
 		db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = ? AND name = ?", "table", "books"), &booksTableCount)
 	database.MustScan(t, "counting system",
 		db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = ? AND name = ?", "table", "system"), &systemTableCount)
+	database.MustScan(t, "counting note_tags",
+		db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = ? AND name = ?", "table", "note_tags"), &noteTagsTableCount)
 
 	assert.Equal(t, notesTableCount, 1, "notes table count mismatch")
 	assert.Equal(t, booksTableCount, 1, "books table count mismatch")
 	assert.Equal(t, systemTableCount, 1, "system table count mismatch")
+	assert.Equal(t, noteTagsTableCount, 1, "note_tags table count mismatch")
 
 	// test that all default system configurations are generated
 	var lastUpgrade, lastMaxUSN, lastSyncAt string
@@ -167,6 +173,56 @@ func TestAddNote(t *testing.T) {
 		assert.Equal(t, n2.Body, "foo", "n2 body mismatch")
 		assert.Equal(t, n2.Dirty, true, "n2 dirty mismatch")
 	})
+
+	t.Run("tag flag", func(t *testing.T) {
+		// Set up and execute
+		testutils.RunNADCmd(t, opts, binaryName, "add", "js", "-c", "foo", "--tag", "closure", "-t", "scope,hoisting")
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		db := database.OpenTestDB(t, opts.NADDir)
+
+		// Test
+		var noteUUID string
+		database.MustScan(t, "getting note", db.QueryRow("SELECT uuid FROM notes WHERE body = ?", "foo"), &noteUUID)
+
+		tags, err := database.GetNoteTags(db, noteUUID)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting tags"))
+		}
+
+		assert.DeepEqual(t, tags, []string{"closure", "hoisting", "scope"}, "tags mismatch")
+	})
+
+	t.Run("nested book", func(t *testing.T) {
+		// Set up and execute
+		testutils.RunNADCmd(t, opts, binaryName, "add", "work/infra", "-c", "foo")
+		testutils.RunNADCmd(t, opts, binaryName, "add", "work/infra/k8s", "-c", "bar")
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		db := database.OpenTestDB(t, opts.NADDir)
+
+		// Test
+		var bookCount int
+		database.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+		assert.Equalf(t, bookCount, 3, "book count mismatch")
+
+		var b1, b2, b3 database.Book
+		database.MustScan(t, "getting b1", db.QueryRow("SELECT uuid, parent_uuid, dirty FROM books WHERE name = ?", "work"), &b1.UUID, &b1.ParentUUID, &b1.Dirty)
+		database.MustScan(t, "getting b2", db.QueryRow("SELECT uuid, parent_uuid, dirty FROM books WHERE name = ?", "infra"), &b2.UUID, &b2.ParentUUID, &b2.Dirty)
+		database.MustScan(t, "getting b3", db.QueryRow("SELECT uuid, parent_uuid, dirty FROM books WHERE name = ?", "k8s"), &b3.UUID, &b3.ParentUUID, &b3.Dirty)
+
+		assert.Equal(t, b1.ParentUUID, "", "b1 parent_uuid mismatch")
+		assert.Equal(t, b2.ParentUUID, b1.UUID, "b2 parent_uuid mismatch")
+		assert.Equal(t, b3.ParentUUID, b2.UUID, "b3 parent_uuid mismatch")
+		assert.Equal(t, b1.Dirty, true, "b1 dirty mismatch")
+
+		var fooBookUUID, barBookUUID string
+		database.MustScan(t, "getting foo", db.QueryRow("SELECT book_uuid FROM notes WHERE body = ?", "foo"), &fooBookUUID)
+		database.MustScan(t, "getting bar", db.QueryRow("SELECT book_uuid FROM notes WHERE body = ?", "bar"), &barBookUUID)
+
+		assert.Equal(t, fooBookUUID, b2.UUID, "foo book_uuid mismatch")
+		assert.Equal(t, barBookUUID, b3.UUID, "bar book_uuid mismatch")
+	})
 }
 
 func TestEditNote(t *testing.T) {
@@ -270,6 +326,74 @@ func TestEditNote(t *testing.T) {
 		assert.Equal(t, n2.Dirty, true, "n2 Dirty mismatch")
 		assert.NotEqual(t, n2.EditedOn, 0, "n2 EditedOn mismatch")
 	})
+
+	t.Run("public flag", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+		testutils.Setup4(t, db)
+
+		// Execute
+		testutils.RunNADCmd(t, opts, binaryName, "edit", "2", "--public")
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		// Test
+		var n1, n2 database.Note
+		database.MustScan(t, "getting n1",
+			db.QueryRow("SELECT uuid, body, public, dirty FROM notes where uuid = ?", "43827b9a-c2b0-4c06-a290-97991c896653"), &n1.UUID, &n1.Body, &n1.Public, &n1.Dirty)
+		database.MustScan(t, "getting n2",
+			db.QueryRow("SELECT uuid, body, public, dirty, edited_on FROM notes where uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &n2.UUID, &n2.Body, &n2.Public, &n2.Dirty, &n2.EditedOn)
+
+		assert.Equal(t, n1.Public, false, "n1 Public mismatch")
+		assert.Equal(t, n1.Dirty, false, "n1 Dirty mismatch")
+
+		assert.Equal(t, n2.Body, "Date object implements mathematical comparisons", "n2 Body mismatch")
+		assert.Equal(t, n2.Public, true, "n2 Public mismatch")
+		assert.Equal(t, n2.Dirty, true, "n2 Dirty mismatch")
+		assert.NotEqual(t, n2.EditedOn, 0, "n2 EditedOn mismatch")
+	})
+
+	t.Run("tag flag", func(t *testing.T) {
+		testCases := []struct {
+			args     []string
+			expected []string
+		}{
+			{
+				args:     []string{"--tag", "scope", "--tag", "hoisting"},
+				expected: []string{"hoisting", "scope"},
+			},
+			{
+				args:     []string{"--tag", ""},
+				expected: []string{},
+			},
+		}
+
+		for idx, tc := range testCases {
+			t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+				// Setup
+				db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+				testutils.Setup4(t, db)
+				database.MustExec(t, "inserting n2 tag", db, "INSERT INTO note_tags (note_uuid, name) VALUES (?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "closure")
+
+				// Execute
+				testutils.RunNADCmd(t, opts, binaryName, append([]string{"edit", "2"}, tc.args...)...)
+				defer testutils.RemoveDir(t, opts.HomeDir)
+
+				// Test
+				var n2 database.Note
+				database.MustScan(t, "getting n2",
+					db.QueryRow("SELECT body, dirty FROM notes where uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &n2.Body, &n2.Dirty)
+
+				tags, err := database.GetNoteTags(db, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "getting tags"))
+				}
+
+				assert.Equal(t, n2.Body, "Date object implements mathematical comparisons", "n2 Body mismatch")
+				assert.Equal(t, n2.Dirty, true, "n2 Dirty mismatch")
+				assert.DeepEqual(t, tags, tc.expected, "tags mismatch")
+			})
+		}
+	})
 }
 
 func TestEditBook(t *testing.T) {
@@ -318,6 +442,67 @@ func TestEditBook(t *testing.T) {
 		assert.Equal(t, n1.Dirty, false, "n1 Dirty mismatch")
 		assert.Equal(t, n1.USN, 0, "n1 USN mismatch")
 	})
+
+	t.Run("book flag", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+		testutils.Setup1(t, db)
+
+		// Execute
+		testutils.RunNADCmd(t, opts, binaryName, "edit", "linux", "-b", "js")
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		// Test
+		var b1, b2 database.Book
+		database.MustScan(t, "getting b1",
+			db.QueryRow("SELECT name, parent_uuid, dirty FROM books WHERE uuid = ?", "js-book-uuid"), &b1.Name, &b1.ParentUUID, &b1.Dirty)
+		database.MustScan(t, "getting b2",
+			db.QueryRow("SELECT name, parent_uuid, dirty FROM books WHERE uuid = ?", "linux-book-uuid"), &b2.Name, &b2.ParentUUID, &b2.Dirty)
+
+		assert.Equal(t, b1.ParentUUID, "", "b1 parent_uuid mismatch")
+		assert.Equal(t, b1.Dirty, false, "b1 Dirty mismatch")
+
+		assert.Equal(t, b2.Name, "linux", "b2 Name mismatch")
+		assert.Equal(t, b2.ParentUUID, "js-book-uuid", "b2 parent_uuid mismatch")
+		assert.Equal(t, b2.Dirty, true, "b2 Dirty mismatch")
+
+		// Execute
+		testutils.RunNADCmd(t, opts, binaryName, "edit", "js/linux", "-b", "/", "-n", "unix")
+
+		// Test
+		database.MustScan(t, "getting b2",
+			db.QueryRow("SELECT name, parent_uuid, dirty FROM books WHERE uuid = ?", "linux-book-uuid"), &b2.Name, &b2.ParentUUID, &b2.Dirty)
+
+		assert.Equal(t, b2.Name, "unix", "b2 Name mismatch")
+		assert.Equal(t, b2.ParentUUID, "", "b2 parent_uuid mismatch")
+	})
+
+	t.Run("book flag into descendant", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+		testutils.Setup1(t, db)
+		database.MustExec(t, "nesting linux", db, "UPDATE books SET parent_uuid = ? WHERE uuid = ?", "js-book-uuid", "linux-book-uuid")
+
+		// Execute
+		cmd, _, _, err := testutils.NewNADCmd(opts, binaryName, "edit", "js", "-b", "js/linux")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "getting command"))
+		}
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		if err := cmd.Run(); err == nil {
+			t.Fatal("the command should have failed")
+		}
+
+		// Test
+		var parentUUID string
+		var dirty bool
+		database.MustScan(t, "getting b1",
+			db.QueryRow("SELECT parent_uuid, dirty FROM books WHERE uuid = ?", "js-book-uuid"), &parentUUID, &dirty)
+
+		assert.Equal(t, parentUUID, "", "b1 parent_uuid mismatch")
+		assert.Equal(t, dirty, false, "b1 Dirty mismatch")
+	})
 }
 
 func TestRemoveNote(t *testing.T) {
@@ -496,3 +681,199 @@ func TestRemoveBook(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoveBook_nested(t *testing.T) {
+	// Setup
+	db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+	testutils.Setup2(t, db)
+	database.MustExec(t, "nesting linux", db, "UPDATE books SET parent_uuid = ? WHERE uuid = ?", "js-book-uuid", "linux-book-uuid")
+
+	// Execute
+	testutils.RunNADCmd(t, opts, binaryName, "remove", "-y", "js")
+	defer testutils.RemoveDir(t, opts.HomeDir)
+
+	// Test
+	var b1, b2 database.Book
+	var n3 database.Note
+	database.MustScan(t, "getting b1",
+		db.QueryRow("SELECT name, dirty, deleted FROM books WHERE uuid = ?", "js-book-uuid"), &b1.Name, &b1.Dirty, &b1.Deleted)
+	database.MustScan(t, "getting b2",
+		db.QueryRow("SELECT name, dirty, deleted FROM books WHERE uuid = ?", "linux-book-uuid"), &b2.Name, &b2.Dirty, &b2.Deleted)
+	database.MustScan(t, "getting n3",
+		db.QueryRow("SELECT body, dirty, deleted FROM notes WHERE uuid = ?", "3e065d55-6d47-42f2-a6bf-f5844130b2d2"), &n3.Body, &n3.Dirty, &n3.Deleted)
+
+	assert.Equal(t, b1.Deleted, true, "b1 deleted mismatch")
+	assert.Equal(t, b1.Dirty, true, "b1 Dirty mismatch")
+
+	assert.NotEqual(t, b2.Name, "linux", "b2 name mismatch")
+	assert.Equal(t, b2.Deleted, true, "b2 deleted mismatch")
+	assert.Equal(t, b2.Dirty, true, "b2 Dirty mismatch")
+
+	assert.Equal(t, n3.Body, "", "n3 body mismatch")
+	assert.Equal(t, n3.Dirty, true, "n3 Dirty mismatch")
+	assert.Equal(t, n3.Deleted, true, "n3 deleted mismatch")
+}
+
+func TestExport(t *testing.T) {
+	t.Run("markdown", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+		testutils.Setup2(t, db)
+		database.MustExec(t, "nesting linux", db, "UPDATE books SET parent_uuid = ? WHERE uuid = ?", "js-book-uuid", "linux-book-uuid")
+
+		// Execute
+		dest := fmt.Sprintf("%s/export", opts.HomeDir)
+		testutils.RunNADCmd(t, opts, binaryName, "export", dest)
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		// Test
+		content, err := ioutil.ReadFile(fmt.Sprintf("%s/js/linux/n3-body-3e065d55.md", dest))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the exported note"))
+		}
+
+		assert.Equal(t, strings.HasPrefix(string(content), "---\nuuid: 3e065d55-6d47-42f2-a6bf-f5844130b2d2\n"), true, "front matter mismatch")
+		assert.Equal(t, strings.HasSuffix(string(content), "---\n\nn3 body\n"), true, "body mismatch")
+
+		files, err := ioutil.ReadDir(fmt.Sprintf("%s/js", dest))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the book directory"))
+		}
+		assert.Equal(t, len(files), 3, "file count mismatch")
+	})
+
+	t.Run("json with book", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+		testutils.Setup2(t, db)
+
+		// Execute
+		dest := fmt.Sprintf("%s/export.json", opts.HomeDir)
+		testutils.RunNADCmd(t, opts, binaryName, "export", dest, "--format", "json", "--book", "linux")
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		// Test
+		content, err := ioutil.ReadFile(dest)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the exported document"))
+		}
+
+		var doc struct {
+			Books []database.Book `json:"books"`
+		}
+		if err := json.Unmarshal(content, &doc); err != nil {
+			t.Fatal(errors.Wrap(err, "unmarshalling the document"))
+		}
+
+		assert.Equal(t, len(doc.Books), 1, "book count mismatch")
+		assert.Equal(t, doc.Books[0].UUID, "linux-book-uuid", "book uuid mismatch")
+		assert.Equal(t, len(doc.Books[0].Notes), 1, "note count mismatch")
+		assert.Equal(t, doc.Books[0].Notes[0].UUID, "3e065d55-6d47-42f2-a6bf-f5844130b2d2", "note uuid mismatch")
+		assert.Equal(t, doc.Books[0].Notes[0].Body, "n3 body", "note body mismatch")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+		testutils.Setup2(t, db)
+		database.MustExec(t, "adding a note with markup", db, "INSERT INTO notes (uuid, book_uuid, body, added_on) VALUES (?, ?, ?, ?)", "note-uuid", "js-book-uuid", "<script>x</script>", 1515199962)
+
+		// Execute
+		dest := fmt.Sprintf("%s/site", opts.HomeDir)
+		testutils.RunNADCmd(t, opts, binaryName, "export", dest, "--format", "html")
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		// Test
+		index, err := ioutil.ReadFile(fmt.Sprintf("%s/index.html", dest))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the root page"))
+		}
+		assert.Equal(t, strings.Contains(string(index), `href="js/index.html"`), true, "js link mismatch")
+		assert.Equal(t, strings.Contains(string(index), `href="linux/index.html"`), true, "linux link mismatch")
+
+		page, err := ioutil.ReadFile(fmt.Sprintf("%s/js/index.html", dest))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the book page"))
+		}
+		assert.Equal(t, strings.Contains(string(page), "n1 body"), true, "n1 mismatch")
+		assert.Equal(t, strings.Contains(string(page), "&lt;script&gt;x&lt;/script&gt;"), true, "escaping mismatch")
+	})
+}
+
+func TestImport(t *testing.T) {
+	writeSource := func(t *testing.T, dir string) {
+		if err := os.MkdirAll(fmt.Sprintf("%s/linux/shell", dir), 0755); err != nil {
+			t.Fatal(errors.Wrap(err, "creating the source directory"))
+		}
+
+		files := map[string]string{
+			// a duplicate of n3 in Setup2
+			"linux/n3.md":        "---\nuuid: 3e065d55-6d47-42f2-a6bf-f5844130b2d2\n---\n\nn3 body\n",
+			"linux/shell/new.md": "---\nuuid: new-note-uuid\nadded_on: \"2018-01-06T00:52:23Z\"\ntags:\n- bash\n---\n\nnew body\n",
+		}
+		for path, content := range files {
+			if err := ioutil.WriteFile(fmt.Sprintf("%s/%s", dir, path), []byte(content), 0644); err != nil {
+				t.Fatal(errors.Wrapf(err, "writing %s", path))
+			}
+		}
+	}
+
+	t.Run("markdown", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+		testutils.Setup2(t, db)
+
+		src := fmt.Sprintf("%s/source", opts.HomeDir)
+		writeSource(t, src)
+
+		// Execute
+		testutils.RunNADCmd(t, opts, binaryName, "import", src)
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		// Test
+		var noteCount, bookCount int
+		database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+		database.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+		assert.Equal(t, noteCount, 4, "note count mismatch")
+		assert.Equal(t, bookCount, 3, "book count mismatch")
+
+		var n database.Note
+		database.MustScan(t, "getting the new note",
+			db.QueryRow("SELECT book_uuid, body, added_on, usn, dirty FROM notes WHERE uuid = ?", "new-note-uuid"), &n.BookUUID, &n.Body, &n.AddedOn, &n.USN, &n.Dirty)
+		assert.Equal(t, n.Body, "new body", "body mismatch")
+		assert.Equal(t, n.AddedOn, int64(1515199943000000000), "added_on mismatch")
+		assert.Equal(t, n.USN, 0, "usn mismatch")
+		assert.Equal(t, n.Dirty, true, "dirty mismatch")
+
+		var b database.Book
+		database.MustScan(t, "getting the new book",
+			db.QueryRow("SELECT name, parent_uuid, dirty FROM books WHERE uuid = ?", n.BookUUID), &b.Name, &b.ParentUUID, &b.Dirty)
+		assert.Equal(t, b.Name, "shell", "book name mismatch")
+		assert.Equal(t, b.ParentUUID, "linux-book-uuid", "book parent_uuid mismatch")
+		assert.Equal(t, b.Dirty, true, "book dirty mismatch")
+
+		var tag string
+		database.MustScan(t, "getting the tag", db.QueryRow("SELECT name FROM note_tags WHERE note_uuid = ?", "new-note-uuid"), &tag)
+		assert.Equal(t, tag, "bash", "tag mismatch")
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		// Setup
+		db := database.InitTestDB(t, fmt.Sprintf("%s/%s", opts.NADDir, consts.NADDBFileName), nil)
+		testutils.Setup2(t, db)
+
+		src := fmt.Sprintf("%s/source", opts.HomeDir)
+		writeSource(t, src)
+
+		// Execute
+		testutils.RunNADCmd(t, opts, binaryName, "import", src, "--dry-run")
+		defer testutils.RemoveDir(t, opts.HomeDir)
+
+		// Test
+		var noteCount, bookCount int
+		database.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+		database.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+		assert.Equal(t, noteCount, 3, "note count mismatch")
+		assert.Equal(t, bookCount, 2, "book count mismatch")
+	})
+}
@@ -36,6 +36,8 @@ const (
 // LocalSequence is a list of local migrations to be run
 var LocalSequence = []migration{
 	lm1,
+	lm2,
+	lm3,
 }
 
 // RemoteSequence is a list of remote migrations to be run
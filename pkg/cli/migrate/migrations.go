@@ -93,3 +93,46 @@ var lm1 = migration{
 		return nil
 	},
 }
+
+var lm2 = migration{
+	name: "create note_tags table",
+	run: func(ctx context.NadCtx, tx *database.DB) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS note_tags
+		(
+			note_uuid text NOT NULL,
+			name text NOT NULL
+		)`)
+		if err != nil {
+			return errors.Wrap(err, "creating note_tags table")
+		}
+
+		_, err = tx.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_note_tags_note_uuid_name ON note_tags(note_uuid, name);
+		CREATE INDEX IF NOT EXISTS idx_note_tags_name ON note_tags(name);`)
+		if err != nil {
+			return errors.Wrap(err, "creating indices")
+		}
+
+		return nil
+	},
+}
+
+var lm3 = migration{
+	name: "add parent_uuid to books",
+	run: func(ctx context.NadCtx, tx *database.DB) error {
+		_, err := tx.Exec("ALTER TABLE books ADD COLUMN parent_uuid text NOT NULL DEFAULT ''")
+		if err != nil {
+			return errors.Wrap(err, "adding parent_uuid column")
+		}
+
+		// Book names are now unique only among the siblings.
+		_, err = tx.Exec(`
+		DROP INDEX IF EXISTS idx_books_name;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_books_parent_uuid_name ON books(parent_uuid, name);`)
+		if err != nil {
+			return errors.Wrap(err, "creating indices")
+		}
+
+		return nil
+	},
+}
@@ -22,6 +22,7 @@ package output
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/nadproject/nad/pkg/cli/database"
@@ -37,6 +38,9 @@ func NoteInfo(info database.NoteInfo) {
 	}
 	log.Infof("note id: %d\n", info.RowID)
 	log.Infof("note uuid: %s\n", info.UUID)
+	if len(info.Tags) > 0 {
+		log.Infof("tags: %s\n", strings.Join(info.Tags, ", "))
+	}
 
 	fmt.Printf("\n------------------------content------------------------\n")
 	fmt.Printf("%s", info.Content)
@@ -46,6 +50,7 @@ func NoteInfo(info database.NoteInfo) {
 // BookInfo prints a note information
 func BookInfo(info database.BookInfo) {
 	log.Infof("book name: %s\n", info.Name)
+	log.Infof("book path: %s\n", info.Path)
 	log.Infof("book id: %d\n", info.RowID)
 	log.Infof("book uuid: %s\n", info.UUID)
 }
@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"github.com/nadproject/nad/pkg/assert"
+	"github.com/pkg/errors"
 )
 
 func TestValidateBookName(t *testing.T) {
@@ -141,6 +142,16 @@ func TestValidateBookName(t *testing.T) {
 			expected: ErrBookNameMultiline,
 		},
 
+		// slash separates the books in a path
+		{
+			input:    "work/infra",
+			expected: ErrBookNameHasSlash,
+		},
+		{
+			input:    "/work",
+			expected: ErrBookNameHasSlash,
+		},
+
 		// reserved book names
 		{
 			input:    "trash",
@@ -150,6 +161,24 @@ func TestValidateBookName(t *testing.T) {
 			input:    "conflicts",
 			expected: ErrBookNameReserved,
 		},
+
+		// relative path elements
+		{
+			input:    ".",
+			expected: ErrBookNameDot,
+		},
+		{
+			input:    "..",
+			expected: ErrBookNameDot,
+		},
+		{
+			input:    "...",
+			expected: nil,
+		},
+		{
+			input:    ".vim",
+			expected: nil,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -158,3 +187,47 @@ func TestValidateBookName(t *testing.T) {
 		assert.Equal(t, actual, tc.expected, fmt.Sprintf("result does not match for the input '%s'", tc.input))
 	}
 }
+
+func TestValidateBookPath(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected error
+	}{
+		{
+			input:    "javascript",
+			expected: nil,
+		},
+		{
+			input:    "work/infra/k8s",
+			expected: nil,
+		},
+		{
+			input:    "work/infra/",
+			expected: nil,
+		},
+		{
+			input:    "work//k8s",
+			expected: ErrBookNameEmpty,
+		},
+		{
+			input:    "work/infra tools",
+			expected: ErrBookNameHasSpace,
+		},
+		{
+			input:    "work/123",
+			expected: ErrBookNameNumeric,
+		},
+		{
+			input:    "",
+			expected: ErrBookNameEmpty,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			actual := BookPath(tc.input)
+
+			assert.Equal(t, errors.Cause(actual), tc.expected, fmt.Sprintf("result does not match for the input '%s'", tc.input))
+		})
+	}
+}
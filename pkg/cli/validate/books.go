@@ -21,6 +21,7 @@ package validate
 import (
 	"strings"
 
+	"github.com/nadproject/nad/pkg/cli/consts"
 	"github.com/nadproject/nad/pkg/cli/utils"
 	"github.com/pkg/errors"
 )
@@ -42,6 +43,12 @@ var ErrBookNameEmpty = errors.New("The book name is empty")
 // ErrBookNameMultiline is an error for a book name that has linebreaks
 var ErrBookNameMultiline = errors.New("The book name contains multiple lines")
 
+// ErrBookNameHasSlash is an error for a book name that has a slash, which separates the books in a path
+var ErrBookNameHasSlash = errors.New("The book name cannot contain a slash")
+
+// ErrBookNameDot is an error for a book name that is a relative path element, such as '.' or '..'
+var ErrBookNameDot = errors.New("The book name cannot be '.' or '..'")
+
 func isReservedName(name string) bool {
 	for _, n := range reservedBookNames {
 		if name == n {
@@ -62,6 +69,10 @@ func BookName(name string) error {
 		return ErrBookNameReserved
 	}
 
+	if name == "." || name == ".." {
+		return ErrBookNameDot
+	}
+
 	if utils.IsNumber(name) {
 		return ErrBookNameNumeric
 	}
@@ -74,5 +85,21 @@ func BookName(name string) error {
 		return ErrBookNameMultiline
 	}
 
+	if strings.Contains(name, consts.BookPathSeparator) {
+		return ErrBookNameHasSlash
+	}
+
+	return nil
+}
+
+// BookPath validates a book path, such as 'work/infra/k8s', by validating the
+// name of each book in it
+func BookPath(path string) error {
+	for _, name := range strings.Split(strings.Trim(path, consts.BookPathSeparator), consts.BookPathSeparator) {
+		if err := BookName(name); err != nil {
+			return errors.Wrapf(err, "invalid book '%s'", name)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,66 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package validate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestValidateTagName(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected error
+	}{
+		{
+			input:    "javascript",
+			expected: nil,
+		},
+		{
+			input:    "node.js",
+			expected: nil,
+		},
+		{
+			input:    "",
+			expected: ErrTagNameEmpty,
+		},
+		{
+			input:    "foo bar",
+			expected: ErrTagNameHasSpace,
+		},
+		{
+			input:    "foo\tbar",
+			expected: ErrTagNameHasSpace,
+		},
+		{
+			input:    "foo,bar",
+			expected: ErrTagNameHasComma,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			actual := TagName(tc.input)
+
+			assert.Equal(t, actual, tc.expected, fmt.Sprintf("result does not match for the input '%s'", tc.input))
+		})
+	}
+}
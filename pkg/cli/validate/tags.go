@@ -0,0 +1,63 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package validate
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTagNameEmpty is an error for an empty tag name
+var ErrTagNameEmpty = errors.New("The tag name is empty")
+
+// ErrTagNameHasSpace is an error for a tag name that has any whitespace
+var ErrTagNameHasSpace = errors.New("The tag name cannot contain spaces")
+
+// ErrTagNameHasComma is an error for a tag name that has a comma
+var ErrTagNameHasComma = errors.New("The tag name cannot contain commas")
+
+// TagName validates a tag name
+func TagName(name string) error {
+	if name == "" {
+		return ErrTagNameEmpty
+	}
+
+	if strings.IndexFunc(name, unicode.IsSpace) != -1 {
+		return ErrTagNameHasSpace
+	}
+
+	if strings.Contains(name, ",") {
+		return ErrTagNameHasComma
+	}
+
+	return nil
+}
+
+// TagNames validates each of the given tag names
+func TagNames(names []string) error {
+	for _, name := range names {
+		if err := TagName(name); err != nil {
+			return errors.Wrapf(err, "invalid tag '%s'", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,292 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/migrations"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// exit prints the given message to stderr and exits with a non-zero status
+func exit(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
+
+func parseArgs(fs *flag.FlagSet, args []string) {
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+}
+
+func openServices() *models.Services {
+	cfg := config.Load()
+
+	services, err := initServices(cfg)
+	must(err)
+
+	return services
+}
+
+func findUser(services *models.Services, email string) *models.User {
+	if email == "" {
+		exit("-email is required")
+	}
+
+	user, err := services.User.ByEmail(email)
+	if err == models.ErrNotFound {
+		exit("user %s not found", email)
+	}
+	must(err)
+
+	return user
+}
+
+// readPassword returns the given password, or prompts for one if it is empty
+func readPassword(password string) string {
+	if password != "" {
+		return password
+	}
+
+	fmt.Print("password: ")
+	b, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Println("")
+	must(errors.Wrap(err, "reading password"))
+
+	return string(b)
+}
+
+func confirm(question string) bool {
+	fmt.Printf("%s (y/N): ", question)
+
+	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	input = strings.ToLower(strings.TrimSpace(input))
+	return input == "y" || input == "yes"
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func userCmd(args []string) {
+	if len(args) == 0 {
+		exit("Usage: nad-server user [create|list|delete|reset-password|verify-email]")
+	}
+
+	fs := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	email := fs.String("email", "", "the email of the user")
+
+	switch args[0] {
+	case "create":
+		password := fs.String("password", "", "the password of the user. Prompted if not given")
+		pro := fs.Bool("pro", false, "whether the user has access to the pro features")
+		verified := fs.Bool("verified", false, "whether to mark the email as verified")
+		parseArgs(fs, args[1:])
+
+		if *email == "" {
+			exit("-email is required")
+		}
+
+		services := openServices()
+		defer services.Close()
+
+		user := models.User{
+			Email:         *email,
+			Password:      readPassword(*password),
+			Pro:           *pro,
+			EmailVerified: *verified,
+		}
+		if err := services.User.Create(&user); err != nil {
+			exit("creating user: %s", err)
+		}
+
+		fmt.Printf("created user %s (%s)\n", user.Email, user.UUID)
+	case "list":
+		parseArgs(fs, args[1:])
+
+		services := openServices()
+		defer services.Close()
+
+		users, err := services.User.List()
+		must(err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEMAIL\tPRO\tVERIFIED\tCREATED\tLAST LOGIN")
+		for _, u := range users {
+			fmt.Fprintf(w, "%d\t%s\t%t\t%t\t%s\t%s\n", u.ID, u.Email, u.Pro, u.EmailVerified, formatTime(&u.CreatedAt), formatTime(u.LastLoginAt))
+		}
+		w.Flush()
+	case "delete":
+		yes := fs.Bool("yes", false, "skip the confirmation")
+		parseArgs(fs, args[1:])
+
+		services := openServices()
+		defer services.Close()
+
+		user := findUser(services, *email)
+		if !*yes && !confirm(fmt.Sprintf("delete %s and all of their notes and books?", user.Email)) {
+			exit("aborted")
+		}
+
+		must(services.User.Delete(user))
+		fmt.Printf("deleted user %s\n", user.Email)
+	case "reset-password":
+		password := fs.String("password", "", "the new password. Prompted if not given")
+		parseArgs(fs, args[1:])
+
+		services := openServices()
+		defer services.Close()
+
+		user := findUser(services, *email)
+		user.Password = readPassword(*password)
+		if err := services.User.Update(user, nil); err != nil {
+			exit("updating user: %s", err)
+		}
+
+		// Sign out everywhere so that the old password cannot be used to keep a session
+		n, err := services.Session.DeleteByUserID(user.ID)
+		must(err)
+
+		fmt.Printf("reset the password of %s and revoked %d sessions\n", user.Email, n)
+	case "verify-email":
+		parseArgs(fs, args[1:])
+
+		services := openServices()
+		defer services.Close()
+
+		user := findUser(services, *email)
+		user.EmailVerified = true
+		if err := services.User.Update(user, nil); err != nil {
+			exit("updating user: %s", err)
+		}
+
+		fmt.Printf("verified the email of %s\n", user.Email)
+	default:
+		exit("Unknown user command %s", args[0])
+	}
+}
+
+func sessionCmd(args []string) {
+	if len(args) == 0 || args[0] != "revoke" {
+		exit("Usage: nad-server session revoke -email <email>")
+	}
+
+	fs := flag.NewFlagSet("session revoke", flag.ExitOnError)
+	email := fs.String("email", "", "the email of the user whose sessions to revoke")
+	parseArgs(fs, args[1:])
+
+	services := openServices()
+	defer services.Close()
+
+	user := findUser(services, *email)
+	n, err := services.Session.DeleteByUserID(user.ID)
+	must(err)
+
+	fmt.Printf("revoked %d sessions of %s\n", n, user.Email)
+}
+
+func statsCmd() {
+	services := openServices()
+	defer services.Close()
+
+	stats, err := models.GetStats(services.DB)
+	must(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "users\t%d\n", stats.Users)
+	fmt.Fprintf(w, "pro users\t%d\n", stats.ProUsers)
+	fmt.Fprintf(w, "sessions\t%d\n", stats.Sessions)
+	fmt.Fprintf(w, "books\t%d\n", stats.Books)
+	fmt.Fprintf(w, "notes\t%d\n", stats.Notes)
+	fmt.Fprintf(w, "note revisions\t%d\n", stats.NoteRevisions)
+	fmt.Fprintf(w, "tags\t%d\n", stats.Tags)
+	w.Flush()
+}
+
+func dbCmd(args []string) {
+	if len(args) == 0 {
+		exit("Usage: nad-server db [migrate|status|rollback]")
+	}
+
+	fs := flag.NewFlagSet("db "+args[0], flag.ExitOnError)
+
+	switch args[0] {
+	case "migrate":
+		parseArgs(fs, args[1:])
+
+		services := openServices()
+		defer services.Close()
+
+		must(services.InitDB())
+		must(services.MigrateDB())
+	case "status":
+		parseArgs(fs, args[1:])
+
+		services := openServices()
+		defer services.Close()
+
+		records, err := migrations.Status(services.DB)
+		must(err)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tAPPLIED AT")
+		for _, r := range records {
+			appliedAt := "pending"
+			if r.Applied {
+				appliedAt = r.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\n", r.ID, appliedAt)
+		}
+		w.Flush()
+	case "rollback":
+		n := fs.Int("n", 1, "the number of the migrations to roll back")
+		parseArgs(fs, args[1:])
+
+		services := openServices()
+		defer services.Close()
+
+		count, err := migrations.Rollback(services.DB, *n)
+		must(err)
+
+		fmt.Printf("rolled back %d migrations\n", count)
+	default:
+		exit("Unknown db command %s", args[0])
+	}
+}
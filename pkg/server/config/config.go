@@ -20,8 +20,12 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/nadproject/nad/pkg/server/crypt"
 	"github.com/pkg/errors"
@@ -41,14 +45,46 @@ var (
 	ErrDBMissingName = errors.New("DB Name is empty")
 	// ErrDBMissingUser is an error for an incomplete configuration missing the user
 	ErrDBMissingUser = errors.New("DB User is empty")
+	// ErrDBMissingPath is an error for a SQLite configuration missing the path of the database file
+	ErrDBMissingPath = errors.New("DB Path is empty")
+	// ErrDBDialectInvalid is an error for an unsupported database dialect
+	ErrDBDialectInvalid = errors.New("DB Dialect must be postgres or sqlite3")
 	// ErrWebURLInvalid is an error for an incomplete configuration missing the user
 	ErrWebURLInvalid = errors.New("DB invalid WebURL")
 	// ErrCSRFAuthKeyRequired  is an error for a missing CSRF auth key
 	ErrCSRFAuthKeyRequired = errors.New("CSRF auth key is required")
+	// ErrOIDCMissingClientID is an error for an OIDC configuration with an issuer but without a client id
+	ErrOIDCMissingClientID = errors.New("OIDC client id is empty")
+	// ErrRateLimitPolicyInvalid is an error for a rate limit policy not in the form of <limit>/<window>
+	ErrRateLimitPolicyInvalid = errors.New("invalid rate limit policy")
+	// ErrRateLimitStoreInvalid is an error for an unknown rate limit store
+	ErrRateLimitStoreInvalid = errors.New("invalid rate limit store")
+	// ErrTrustedProxyInvalid is an error for a trusted proxy that is not an IP address or a CIDR
+	ErrTrustedProxyInvalid = errors.New("invalid trusted proxy")
+	// ErrTLSIncomplete is an error for a TLS configuration with only one of the certificate and the key
+	ErrTLSIncomplete = errors.New("both TLS certificate and key files are required")
 )
 
-// PostgresConfig holds the postgres connection configuration.
-type PostgresConfig struct {
+const (
+	// RateLimitStoreMemory keeps the rate limits in the memory of the process
+	RateLimitStoreMemory = "memory"
+	// RateLimitStorePostgres keeps the rate limits in the database, shared by all replicas
+	RateLimitStorePostgres = "postgres"
+)
+
+const (
+	// DBDialectPostgres stores the data in Postgres
+	DBDialectPostgres = "postgres"
+	// DBDialectSQLite stores the data in a SQLite database file
+	DBDialectSQLite = "sqlite3"
+)
+
+// DBConfig holds the database connection configuration.
+type DBConfig struct {
+	// Dialect is either DBDialectPostgres or DBDialectSQLite
+	Dialect string
+	// Path is the path of the SQLite database file
+	Path     string
 	SSLMode  string
 	Host     string
 	Port     string
@@ -57,17 +93,74 @@ type PostgresConfig struct {
 	Password string
 }
 
+// OIDCConfig holds the configuration for signing in with an OpenID Connect provider
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
+
+// Enabled checks if signing in with an OpenID Connect provider is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// ServerConfig holds the configuration of the HTTP server
+type ServerConfig struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is how long to wait for the requests in flight to complete when shutting down
+	ShutdownTimeout time.Duration
+	TLSCertFile     string
+	TLSKeyFile      string
+	// UnixSocket is the path of a Unix socket to listen on instead of the port
+	UnixSocket string
+}
+
+// TLSEnabled checks if the server serves TLS by itself
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != ""
+}
+
+// RateLimitPolicy allows Limit requests in every Window. A zero Limit disables
+// the rate limit.
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitConfig holds the rate limit policies for each group of routes
+type RateLimitConfig struct {
+	Store string
+	// Default applies to the routes not in any other group
+	Default RateLimitPolicy
+	// Login applies to signing in, registering and resetting passwords, per IP address
+	Login RateLimitPolicy
+	// Sync applies to the sync API, per user
+	Sync RateLimitPolicy
+	// Write applies to creating, updating and deleting resources, per user
+	Write RateLimitPolicy
+}
+
 // Config holds the application configuration
 type Config struct {
-	AppEnv              string
-	Port                string
-	WebURL              string
-	CSRFAuthKey         string
-	PageTemplateDir     string
-	StaticDir           string
-	OnPremise           bool
-	DisableRegistration bool
-	DB                  PostgresConfig
+	AppEnv                   string
+	Port                     string
+	WebURL                   string
+	CSRFAuthKey              string
+	PageTemplateDir          string
+	StaticDir                string
+	OnPremise                bool
+	DisableRegistration      bool
+	RequireEmailVerification bool
+	RequireTwoFactor         bool
+	OIDC                     OIDCConfig
+	RateLimit                RateLimitConfig
+	TrustedProxies           []*net.IPNet
+	MetricsToken             string
+	Server                   ServerConfig
+	DB                       DBConfig
 }
 
 func readBoolEnv(name string) bool {
@@ -78,7 +171,12 @@ func readBoolEnv(name string) bool {
 	return false
 }
 
-func loadDBConfig() PostgresConfig {
+func loadDBConfig() DBConfig {
+	dialect := os.Getenv("DB_DIALECT")
+	if dialect == "" {
+		dialect = DBDialectPostgres
+	}
+
 	var sslmode string
 	if readBoolEnv("DB_SKIP_SSL") {
 		sslmode = "disable"
@@ -86,7 +184,9 @@ func loadDBConfig() PostgresConfig {
 		sslmode = "require"
 	}
 
-	return PostgresConfig{
+	return DBConfig{
+		Dialect:  dialect,
+		Path:     os.Getenv("DB_PATH"),
 		SSLMode:  sslmode,
 		Host:     os.Getenv("DB_HOST"),
 		Port:     os.Getenv("DB_PORT"),
@@ -96,6 +196,145 @@ func loadDBConfig() PostgresConfig {
 	}
 }
 
+func loadOIDCConfig() OIDCConfig {
+	return OIDCConfig{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+	}
+}
+
+func readDurationEnv(name string, defaultVal time.Duration) time.Duration {
+	val := os.Getenv(name)
+	if val == "" {
+		return defaultVal
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		panic(errors.Wrapf(err, "reading %s", name))
+	}
+
+	return d
+}
+
+func loadServerConfig() ServerConfig {
+	return ServerConfig{
+		ReadTimeout:     readDurationEnv("SERVER_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:    readDurationEnv("SERVER_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:     readDurationEnv("SERVER_IDLE_TIMEOUT", 120*time.Second),
+		ShutdownTimeout: readDurationEnv("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+		TLSCertFile:     os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:      os.Getenv("TLS_KEY_FILE"),
+		UnixSocket:      os.Getenv("UNIX_SOCKET"),
+	}
+}
+
+// parseRateLimitPolicy parses a rate limit policy in the form of <limit>/<window>,
+// such as 60/1m. "off" disables the rate limit.
+func parseRateLimitPolicy(s string) (RateLimitPolicy, error) {
+	if s == "off" {
+		return RateLimitPolicy{}, nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return RateLimitPolicy{}, ErrRateLimitPolicyInvalid
+	}
+
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 {
+		return RateLimitPolicy{}, ErrRateLimitPolicyInvalid
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window < time.Second {
+		return RateLimitPolicy{}, ErrRateLimitPolicyInvalid
+	}
+
+	return RateLimitPolicy{Limit: limit, Window: window}, nil
+}
+
+func readRateLimitPolicy(name, defaultVal string) RateLimitPolicy {
+	val := os.Getenv(name)
+	if val == "" {
+		val = defaultVal
+	}
+
+	p, err := parseRateLimitPolicy(val)
+	if err != nil {
+		panic(errors.Wrapf(err, "reading %s", name))
+	}
+
+	return p
+}
+
+func loadRateLimitConfig() RateLimitConfig {
+	store := os.Getenv("RATE_LIMIT_STORE")
+	if store == "" {
+		store = RateLimitStoreMemory
+	}
+
+	return RateLimitConfig{
+		Store:   store,
+		Default: readRateLimitPolicy("RATE_LIMIT_DEFAULT", "60/1m"),
+		Login:   readRateLimitPolicy("RATE_LIMIT_LOGIN", "10/1m"),
+		Sync:    readRateLimitPolicy("RATE_LIMIT_SYNC", "300/1m"),
+		Write:   readRateLimitPolicy("RATE_LIMIT_WRITE", "300/1m"),
+	}
+}
+
+// parseTrustedProxies parses a comma separated list of IP addresses and CIDRs
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var ret []*net.IPNet
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, errors.Wrap(ErrTrustedProxyInvalid, part)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			ret = append(ret, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, errors.Wrap(ErrTrustedProxyInvalid, part)
+		}
+		ret = append(ret, ipNet)
+	}
+
+	return ret, nil
+}
+
+// readTrustedProxies reads the proxies whose forwarding headers are trusted
+// for the IP address of the client. By default, only a proxy on the same
+// machine is trusted.
+func readTrustedProxies() []*net.IPNet {
+	val, ok := os.LookupEnv("TRUSTED_PROXIES")
+	if !ok {
+		val = "127.0.0.1/8,::1"
+	}
+
+	ret, err := parseTrustedProxies(val)
+	if err != nil {
+		panic(errors.Wrap(err, "reading TRUSTED_PROXIES"))
+	}
+
+	return ret
+}
+
 func readCSRFAuthKey() string {
 	key := os.Getenv("CSRF_AUTH_KEY")
 	if key != "" {
@@ -119,13 +358,20 @@ func Load() Config {
 	}
 
 	c := Config{
-		AppEnv:              os.Getenv("APP_ENV"),
-		WebURL:              os.Getenv("WEB_URL"),
-		CSRFAuthKey:         readCSRFAuthKey(),
-		Port:                port,
-		OnPremise:           readBoolEnv("ON_PREMISE"),
-		DisableRegistration: readBoolEnv("DISABLE_REGISTRATION"),
-		DB:                  loadDBConfig(),
+		AppEnv:                   os.Getenv("APP_ENV"),
+		WebURL:                   os.Getenv("WEB_URL"),
+		CSRFAuthKey:              readCSRFAuthKey(),
+		Port:                     port,
+		OnPremise:                readBoolEnv("ON_PREMISE"),
+		DisableRegistration:      readBoolEnv("DISABLE_REGISTRATION"),
+		RequireEmailVerification: readBoolEnv("REQUIRE_EMAIL_VERIFICATION"),
+		RequireTwoFactor:         readBoolEnv("REQUIRE_TWO_FACTOR"),
+		OIDC:                     loadOIDCConfig(),
+		RateLimit:                loadRateLimitConfig(),
+		TrustedProxies:           readTrustedProxies(),
+		MetricsToken:             os.Getenv("METRICS_TOKEN"),
+		Server:                   loadServerConfig(),
+		DB:                       loadDBConfig(),
 	}
 
 	if err := validate(c); err != nil {
@@ -158,24 +404,64 @@ func validate(c Config) error {
 		return ErrCSRFAuthKeyRequired
 	}
 
-	if c.DB.Host == "" {
-		return ErrDBMissingHost
+	if err := validateDB(c.DB); err != nil {
+		return err
+	}
+
+	if c.OIDC.Enabled() && c.OIDC.ClientID == "" {
+		return ErrOIDCMissingClientID
 	}
-	if c.DB.Port == "" {
-		return ErrDBMissingPort
+
+	if c.Server.TLSEnabled() && (c.Server.TLSCertFile == "" || c.Server.TLSKeyFile == "") {
+		return ErrTLSIncomplete
 	}
-	if c.DB.Name == "" {
-		return ErrDBMissingName
+
+	if c.RateLimit.Store != RateLimitStoreMemory && c.RateLimit.Store != RateLimitStorePostgres {
+		return ErrRateLimitStoreInvalid
 	}
-	if c.DB.User == "" {
-		return ErrDBMissingUser
+	if c.RateLimit.Store == RateLimitStorePostgres && c.DB.Dialect != DBDialectPostgres {
+		return ErrRateLimitStoreInvalid
 	}
 
 	return nil
 }
 
-// GetConnectionStr returns a postgres connection string.
-func (c PostgresConfig) GetConnectionStr() string {
+func validateDB(c DBConfig) error {
+	switch c.Dialect {
+	case DBDialectSQLite:
+		if c.Path == "" {
+			return ErrDBMissingPath
+		}
+
+		return nil
+	case DBDialectPostgres:
+		if c.Host == "" {
+			return ErrDBMissingHost
+		}
+		if c.Port == "" {
+			return ErrDBMissingPort
+		}
+		if c.Name == "" {
+			return ErrDBMissingName
+		}
+		if c.User == "" {
+			return ErrDBMissingUser
+		}
+
+		return nil
+	}
+
+	return ErrDBDialectInvalid
+}
+
+// GetConnectionStr returns a connection string for the dialect. For SQLite,
+// concurrent writers wait for each other instead of failing, and transactions
+// take the write lock when they begin so that they cannot deadlock upgrading it.
+func (c DBConfig) GetConnectionStr() string {
+	if c.Dialect == DBDialectSQLite {
+		return fmt.Sprintf("%s?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", c.Path)
+	}
+
 	return fmt.Sprintf(
 		"sslmode=%s host=%s port=%s dbname=%s user=%s password=%s",
 		c.SSLMode, c.Host, c.Port, c.Name, c.User, c.Password)
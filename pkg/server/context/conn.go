@@ -0,0 +1,26 @@
+package context
+
+import (
+	"context"
+	"net"
+)
+
+const connKey privateKey = "conn"
+
+// WithConn creates a new context with the connection on which the request
+// was received. It can be used as the ConnContext of a http.Server.
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey, c)
+}
+
+// Conn retrieves the connection on which the request was received from the
+// given context. If the context does not contain one, it returns nil.
+func Conn(ctx context.Context) net.Conn {
+	if temp := ctx.Value(connKey); temp != nil {
+		if c, ok := temp.(net.Conn); ok {
+			return c
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package context
+
+import (
+	"context"
+)
+
+const clientIPKey privateKey = "clientIP"
+
+// WithClientIP creates a new context with the IP address of the client that made the request
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// ClientIP retrieves the IP address of the client from the given context. If
+// the context does not contain one, it returns an empty string.
+func ClientIP(ctx context.Context) string {
+	if temp := ctx.Value(clientIPKey); temp != nil {
+		if ip, ok := temp.(string); ok {
+			return ip
+		}
+	}
+
+	return ""
+}
@@ -7,7 +7,8 @@ import (
 )
 
 const (
-	userKey privateKey = "user"
+	userKey        privateKey = "user"
+	accessTokenKey privateKey = "accessToken"
 )
 
 type privateKey string
@@ -28,3 +29,20 @@ func User(ctx context.Context) *models.User {
 
 	return nil
 }
+
+// WithAccessToken creates a new context with the access token that authenticated the request
+func WithAccessToken(ctx context.Context, token *models.AccessToken) context.Context {
+	return context.WithValue(ctx, accessTokenKey, token)
+}
+
+// AccessToken retrieves an access token from the given context. If the request
+// was not authenticated with an access token, it returns nil.
+func AccessToken(ctx context.Context) *models.AccessToken {
+	if temp := ctx.Value(accessTokenKey); temp != nil {
+		if token, ok := temp.(*models.AccessToken); ok {
+			return token
+		}
+	}
+
+	return nil
+}
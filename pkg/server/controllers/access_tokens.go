@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/presenters"
+	"github.com/nadproject/nad/pkg/server/views"
+	"github.com/pkg/errors"
+)
+
+// NewAccessTokens creates a new AccessTokens controller.
+// It panics if the necessary templates are not parsed.
+func NewAccessTokens(cfg config.Config, ats models.AccessTokenService, c clock.Clock) *AccessTokens {
+	return &AccessTokens{
+		IndexView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "Access tokens", Layout: "base", HeaderTemplate: "navbar"}, "access_tokens/index"),
+		ats:       ats,
+		c:         c,
+	}
+}
+
+// AccessTokens is a controller for personal access tokens
+type AccessTokens struct {
+	IndexView *views.View
+	ats       models.AccessTokenService
+	c         clock.Clock
+}
+
+// AccessTokenForm is the form data for creating an access token
+type AccessTokenForm struct {
+	Name   string   `schema:"name" json:"name"`
+	Scopes []string `schema:"scopes" json:"scopes"`
+	// ExpiresIn is the number of days until the token expires. Zero means no expiry.
+	ExpiresIn int `schema:"expires_in" json:"expires_in"`
+}
+
+// accessTokensData is the data for the access tokens page
+type accessTokensData struct {
+	Tokens []presenters.AccessToken
+	Scopes []string
+	// NewKey is the key of the token that has just been created
+	NewKey string
+}
+
+func (a *AccessTokens) getData(userID uint) (accessTokensData, error) {
+	tokens, err := a.ats.ByUserID(userID)
+	if err != nil {
+		return accessTokensData{}, errors.Wrap(err, "finding access tokens")
+	}
+
+	ret := accessTokensData{
+		Tokens: presenters.PresentAccessTokens(tokens),
+		Scopes: models.Scopes,
+	}
+
+	return ret, nil
+}
+
+func (a *AccessTokens) create(userID uint, form AccessTokenForm) (*models.AccessToken, string, error) {
+	if form.ExpiresIn < 0 {
+		return nil, "", models.ErrAccessTokenExpiryInvalid
+	}
+
+	token := models.AccessToken{
+		UserID: userID,
+		Name:   form.Name,
+		Scopes: strings.Join(form.Scopes, ","),
+	}
+	if form.ExpiresIn > 0 {
+		expiresAt := a.c.Now().Add(time.Duration(form.ExpiresIn) * 24 * time.Hour)
+		token.ExpiresAt = &expiresAt
+	}
+
+	key, err := a.ats.Generate(&token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &token, key, nil
+}
+
+func parseAccessTokenID(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["tokenID"], 10, 64)
+	if err != nil {
+		return 0, models.ErrNotFound
+	}
+
+	return uint(id), nil
+}
+
+// renderIndex renders the access tokens page of the user with the given id
+func (a *AccessTokens) renderIndex(w http.ResponseWriter, r *http.Request, userID uint, vd views.Data) {
+	data, err := a.getData(userID)
+	vd.Yield = data
+	if err != nil {
+		handleHTMLError(w, err, "getting access tokens", &vd)
+	}
+
+	a.IndexView.Render(w, r, vd)
+}
+
+// Index handles GET /tokens
+func (a *AccessTokens) Index(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	a.renderIndex(w, r, user.ID, views.Data{})
+}
+
+// Create handles POST /tokens. It displays the key of the new token, which
+// cannot be retrieved again.
+func (a *AccessTokens) Create(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var vd views.Data
+	var form AccessTokenForm
+	if err := parseForm(r, &form); err != nil {
+		vd.SetAlert(err)
+		a.renderIndex(w, r, user.ID, vd)
+		return
+	}
+
+	_, key, err := a.create(user.ID, form)
+	if err != nil {
+		handleHTMLError(w, err, "creating access token", &vd)
+		a.renderIndex(w, r, user.ID, vd)
+		return
+	}
+
+	data, err := a.getData(user.ID)
+	if err != nil {
+		handleHTMLError(w, err, "getting access tokens", &vd)
+		a.IndexView.Render(w, r, vd)
+		return
+	}
+	data.NewKey = key
+
+	vd.Yield = data
+	vd.Alert = &views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The token has been created. Copy it now, as it will not be shown again.",
+	}
+	a.IndexView.Render(w, r, vd)
+}
+
+// Delete handles POST /tokens/:tokenID/delete
+func (a *AccessTokens) Delete(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	id, err := parseAccessTokenID(r)
+	if err == nil {
+		err = a.ats.Delete(user.ID, id)
+	}
+	if err != nil {
+		logError(err, "deleting access token")
+
+		var vd views.Data
+		vd.SetAlert(err)
+		views.RedirectAlert(w, r, "/tokens", http.StatusFound, *vd.Alert)
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The token has been revoked.",
+	}
+	views.RedirectAlert(w, r, "/tokens", http.StatusFound, alert)
+}
+
+// V1Index handles GET /api/v1/tokens
+func (a *AccessTokens) V1Index(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	tokens, err := a.ats.ByUserID(user.ID)
+	if err != nil {
+		handleJSONError(w, err, "finding access tokens")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, presenters.PresentAccessTokens(tokens))
+}
+
+// CreateAccessTokenResp is the response from creating an access token
+type CreateAccessTokenResp struct {
+	Token presenters.AccessToken `json:"token"`
+	Key   string                 `json:"key"`
+}
+
+// V1Create handles POST /api/v1/tokens
+func (a *AccessTokens) V1Create(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form AccessTokenForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	token, key, err := a.create(user.ID, form)
+	if err != nil {
+		handleJSONError(w, err, "creating access token")
+		return
+	}
+
+	resp := CreateAccessTokenResp{
+		Token: presenters.PresentAccessToken(*token),
+		Key:   key,
+	}
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+// V1Delete handles DELETE /api/v1/tokens/:tokenID
+func (a *AccessTokens) V1Delete(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	id, err := parseAccessTokenID(r)
+	if err != nil {
+		handleJSONError(w, err, "parsing token id")
+		return
+	}
+
+	if err := a.ats.Delete(user.ID, id); err != nil {
+		handleJSONError(w, err, "deleting access token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/pkg/errors"
+)
+
+func TestAccessTokensV1Create(t *testing.T) {
+	testCases := []struct {
+		payload           string
+		expectedCode      int
+		expectedScopes    string
+		expectedExpiresAt *time.Time
+	}{
+		{
+			payload:        `{"name": "ci", "scopes": ["notes:write", "sync"]}`,
+			expectedCode:   http.StatusCreated,
+			expectedScopes: "notes:write,sync",
+		},
+		{
+			payload:           `{"name": "ci", "scopes": ["notes:read"], "expires_in": 30}`,
+			expectedCode:      http.StatusCreated,
+			expectedScopes:    "notes:read",
+			expectedExpiresAt: func() *time.Time { t := time.Date(2019, time.October, 31, 12, 0, 0, 0, time.UTC); return &t }(),
+		},
+		{
+			payload:      `{"name": "ci", "scopes": ["notes"]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			payload:      `{"name": "ci", "scopes": []}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			payload:      `{"name": " ", "scopes": ["sync"]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			payload:      `{"name": "ci", "scopes": ["sync"], "expires_in": -1}`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			c := clock.NewMock()
+			c.SetNow(time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC))
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			accessTokensC := NewAccessTokens(cfg, models.TestServices.AccessToken, c)
+
+			// Execute
+			req := newReq(t, "POST", "/api/v1/tokens", tc.payload)
+			w := httpDo(t, accessTokensC.V1Create, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+
+			var tokenCount int
+			models.MustExec(t, models.TestServices.DB.Model(&models.AccessToken{}).Count(&tokenCount), "counting access tokens")
+
+			if tc.expectedCode != http.StatusCreated {
+				assert.Equal(t, tokenCount, 0, "token count mismatch")
+				return
+			}
+
+			var payload CreateAccessTokenResp
+			if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload"))
+			}
+
+			var tokenRecord models.AccessToken
+			models.MustExec(t, models.TestServices.DB.First(&tokenRecord), "finding access token")
+
+			assert.Equal(t, tokenCount, 1, "token count mismatch")
+			assert.Equal(t, tokenRecord.UserID, user.ID, "token user_id mismatch")
+			assert.Equal(t, tokenRecord.Name, "ci", "token name mismatch")
+			assert.Equal(t, tokenRecord.Scopes, tc.expectedScopes, "token scopes mismatch")
+			assert.Equal(t, strings.HasPrefix(payload.Key, models.AccessTokenPrefix), true, "key prefix mismatch")
+			assert.NotEqual(t, tokenRecord.KeyHash, payload.Key, "key should not be stored")
+
+			if tc.expectedExpiresAt == nil {
+				assert.Equal(t, tokenRecord.ExpiresAt == nil, true, "token expires_at mismatch")
+			} else {
+				assert.Equal(t, tokenRecord.ExpiresAt.Equal(*tc.expectedExpiresAt), true, "token expires_at mismatch")
+			}
+
+			found, err := models.TestServices.AccessToken.ByKey(payload.Key)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "finding access token by key"))
+			}
+			assert.Equal(t, found.ID, tokenRecord.ID, "found token mismatch")
+		})
+	}
+}
+
+func TestAccessTokensV1Index(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+	t1 := models.AccessToken{UserID: user.ID, Name: "ci", Scopes: "sync"}
+	if _, err := models.TestServices.AccessToken.Generate(&t1); err != nil {
+		t.Fatal(errors.Wrap(err, "generating t1"))
+	}
+	t2 := models.AccessToken{UserID: anotherUser.ID, Name: "backup", Scopes: "notes:read"}
+	if _, err := models.TestServices.AccessToken.Generate(&t2); err != nil {
+		t.Fatal(errors.Wrap(err, "generating t2"))
+	}
+
+	accessTokensC := NewAccessTokens(cfg, models.TestServices.AccessToken, clock.NewMock())
+
+	// Execute
+	req := newReq(t, "GET", "/api/v1/tokens", "")
+	w := httpDo(t, accessTokensC.V1Index, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	var payload []struct {
+		ID     uint     `json:"id"`
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding payload"))
+	}
+
+	assert.Equal(t, len(payload), 1, "token count mismatch")
+	assert.Equal(t, payload[0].ID, t1.ID, "token id mismatch")
+	assert.DeepEqual(t, payload[0].Scopes, []string{"sync"}, "token scopes mismatch")
+}
+
+func TestAccessTokensV1Delete(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+	t1 := models.AccessToken{UserID: user.ID, Name: "ci", Scopes: "sync"}
+	if _, err := models.TestServices.AccessToken.Generate(&t1); err != nil {
+		t.Fatal(errors.Wrap(err, "generating t1"))
+	}
+	t2 := models.AccessToken{UserID: anotherUser.ID, Name: "backup", Scopes: "notes:read"}
+	if _, err := models.TestServices.AccessToken.Generate(&t2); err != nil {
+		t.Fatal(errors.Wrap(err, "generating t2"))
+	}
+
+	accessTokensC := NewAccessTokens(cfg, models.TestServices.AccessToken, clock.NewMock())
+
+	t.Run("another user's token", func(t *testing.T) {
+		req := newReq(t, "DELETE", fmt.Sprintf("/api/v1/tokens/%d", t2.ID), "")
+		req = mux.SetURLVars(req, map[string]string{"tokenID": fmt.Sprintf("%d", t2.ID)})
+		w := httpDo(t, accessTokensC.V1Delete, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusNotFound, "status code mismatch")
+
+		var tokenCount int
+		models.MustExec(t, models.TestServices.DB.Model(&models.AccessToken{}).Count(&tokenCount), "counting access tokens")
+		assert.Equal(t, tokenCount, 2, "token count mismatch")
+	})
+
+	t.Run("own token", func(t *testing.T) {
+		req := newReq(t, "DELETE", fmt.Sprintf("/api/v1/tokens/%d", t1.ID), "")
+		req = mux.SetURLVars(req, map[string]string{"tokenID": fmt.Sprintf("%d", t1.ID)})
+		w := httpDo(t, accessTokensC.V1Delete, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusNoContent, "status code mismatch")
+
+		var tokenCount int
+		models.MustExec(t, models.TestServices.DB.Model(&models.AccessToken{}).Where("user_id = ?", user.ID).Count(&tokenCount), "counting access tokens")
+		assert.Equal(t, tokenCount, 0, "token count mismatch")
+	})
+}
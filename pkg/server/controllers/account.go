@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/views"
+	"github.com/pkg/errors"
+)
+
+// ChangePasswordForm is the form data for changing the password
+type ChangePasswordForm struct {
+	CurrentPassword      string `schema:"current_password" json:"current_password"`
+	Password             string `schema:"password" json:"password"`
+	PasswordConfirmation string `schema:"password_confirmation" json:"password_confirmation"`
+}
+
+// ChangeEmailForm is the form data for changing the email
+type ChangeEmailForm struct {
+	Email    string `schema:"email" json:"email"`
+	Password string `schema:"password" json:"password"`
+}
+
+// DeleteAccountForm is the form data for deleting the account
+type DeleteAccountForm struct {
+	Password string `schema:"password" json:"password"`
+}
+
+// settingsData is the data for the account settings page
+type settingsData struct {
+	Email         string
+	EmailVerified bool
+	// OIDCEnabled is set if users can sign in with an identity provider, in
+	// which case they might not know the password of the account
+	OIDCEnabled bool
+}
+
+// changePassword sets the new password for the given user if the current
+// password is correct, and revokes all sessions other than the one making the
+// request along with all personal access tokens.
+func (u *Users) changePassword(user *models.User, form ChangePasswordForm, r *http.Request) error {
+	if err := u.us.VerifyPassword(user, form.CurrentPassword); err != nil {
+		return err
+	}
+	if form.Password == "" {
+		return models.ErrPasswordRequired
+	}
+	if form.Password != form.PasswordConfirmation {
+		return models.ErrPasswordConfirmationMismatch
+	}
+
+	key, err := GetCredential(r)
+	if err != nil {
+		return errors.Wrap(err, "getting credential")
+	}
+
+	tx := u.db.Begin()
+
+	user.Password = form.Password
+	if err := u.us.Update(user, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// A reset link requested before the change should not be able to override it
+	if err := u.ts.DeleteUnused(user.ID, models.TokenTypeResetPassword, tx); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "deleting password reset tokens")
+	}
+	if err := u.ats.DeleteByUserID(user.ID, tx); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "deleting access tokens")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	if _, err := u.ss.DeleteOthers(user.ID, key); err != nil {
+		return errors.Wrap(err, "deleting sessions")
+	}
+
+	// The password has already been changed, so a failure to notify should not fail the request
+	if err := u.mailer.SendPasswordResetAlertEmail(user.Email); err != nil {
+		logError(err, "sending password change alert email")
+	}
+
+	return nil
+}
+
+// changeEmail sets the new email for the given user if the password is correct.
+// The new email needs to be verified again, and the previous email is notified.
+func (u *Users) changeEmail(user *models.User, form ChangeEmailForm) error {
+	if err := u.us.VerifyPassword(user, form.Password); err != nil {
+		return err
+	}
+
+	if strings.ToLower(strings.TrimSpace(form.Email)) == user.Email {
+		return models.ErrEmailUnchanged
+	}
+
+	prevEmail := user.Email
+
+	tx := u.db.Begin()
+
+	user.Email = form.Email
+	user.EmailVerified = false
+	if err := u.us.Update(user, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// The links sent to the previous email should not verify the new one
+	if err := u.ts.DeleteUnused(user.ID, models.TokenTypeEmailVerification, tx); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "deleting email verification tokens")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	// The email has already been changed, so failures to send emails should not fail the request
+	if err := u.sendEmailVerification(user); err != nil {
+		logError(err, "sending email verification")
+	}
+	if err := u.mailer.SendEmailChangeAlertEmail(prevEmail, user.Email); err != nil {
+		logError(err, "sending email change alert email")
+	}
+
+	return nil
+}
+
+// deleteAccount deletes the given user along with all the notes, books,
+// sessions and tokens of the user, if the password is correct.
+func (u *Users) deleteAccount(user *models.User, form DeleteAccountForm) error {
+	if err := u.us.VerifyPassword(user, form.Password); err != nil {
+		return err
+	}
+
+	if err := u.us.Delete(user); err != nil {
+		return errors.Wrap(err, "deleting user")
+	}
+
+	return nil
+}
+
+// Settings handles GET /settings
+func (u *Users) Settings(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var vd views.Data
+	vd.Yield = settingsData{
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		OIDCEnabled:   u.oidcEnabled,
+	}
+	u.SettingsView.Render(w, r, vd)
+}
+
+// redirectSettingsError redirects to the settings page with an alert for the given error
+func redirectSettingsError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	logError(err, msg)
+
+	var vd views.Data
+	vd.SetAlert(err)
+	views.RedirectAlert(w, r, "/settings", http.StatusFound, *vd.Alert)
+}
+
+// ChangePassword handles POST /settings/password
+func (u *Users) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form ChangePasswordForm
+	err := parseForm(r, &form)
+	if err == nil {
+		err = u.changePassword(user, form, r)
+	}
+	if err != nil {
+		redirectSettingsError(w, r, err, "changing password")
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Your password has been changed. You have been signed out of the other devices, and your personal access tokens have been revoked.",
+	}
+	views.RedirectAlert(w, r, "/settings", http.StatusFound, alert)
+}
+
+// ChangeEmail handles POST /settings/email
+func (u *Users) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form ChangeEmailForm
+	err := parseForm(r, &form)
+	if err == nil {
+		err = u.changeEmail(user, form)
+	}
+	if err != nil {
+		redirectSettingsError(w, r, err, "changing email")
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Your email has been changed. Please verify the new email with the link that has been sent to it.",
+	}
+	views.RedirectAlert(w, r, "/settings", http.StatusFound, alert)
+}
+
+// DeleteAccount handles POST /settings/delete
+func (u *Users) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form DeleteAccountForm
+	err := parseForm(r, &form)
+	if err == nil {
+		err = u.deleteAccount(user, form)
+	}
+	if err != nil {
+		redirectSettingsError(w, r, err, "deleting account")
+		return
+	}
+
+	unsetSessionCookie(w)
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Your account and all of its data have been deleted.",
+	}
+	views.RedirectAlert(w, r, "/login", http.StatusFound, alert)
+}
+
+// AccountResp is the response containing the account of a user
+type AccountResp struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// V1ChangePassword handles PATCH /api/v1/account/password
+func (u *Users) V1ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form ChangePasswordForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	if err := u.changePassword(user, form, r); err != nil {
+		handleJSONError(w, err, "changing password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// V1ChangeEmail handles PATCH /api/v1/account/email
+func (u *Users) V1ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form ChangeEmailForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	if err := u.changeEmail(user, form); err != nil {
+		handleJSONError(w, err, "changing email")
+		return
+	}
+
+	resp := AccountResp{
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// V1DeleteAccount handles DELETE /api/v1/account
+func (u *Users) V1DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form DeleteAccountForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	if err := u.deleteAccount(user, form); err != nil {
+		handleJSONError(w, err, "deleting account")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
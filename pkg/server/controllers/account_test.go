@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/pkg/errors"
+)
+
+func TestUsersSettings(t *testing.T) {
+	testCases := []struct {
+		oidcIssuer   string
+		expectedNote bool
+	}{
+		{
+			oidcIssuer:   "",
+			expectedNote: false,
+		},
+		{
+			oidcIssuer:   "https://idp.example.com",
+			expectedNote: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("oidc issuer %q", tc.oidcIssuer), func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			cfg.OIDC.Issuer = tc.oidcIssuer
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, nil, clock.NewMock(), models.TestServices.DB)
+
+			// Execute
+			w := httpDo(t, usersC.Settings, newReq(t, "GET", "/settings", ""), &user)
+
+			// Test
+			assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+			assert.Equal(t, strings.Contains(w.Body.String(), `href="/password-reset"`), tc.expectedNote, "password reset note mismatch")
+		})
+	}
+}
+
+func TestUsersV1ChangePassword(t *testing.T) {
+	testCases := []struct {
+		name            string
+		currentPassword string
+		confirmation    string
+		expectedCode    int
+		expectedPass    bool
+	}{
+		{
+			name:            "valid",
+			currentPassword: "pass1234",
+			confirmation:    "newpass1234",
+			expectedCode:    http.StatusNoContent,
+			expectedPass:    true,
+		},
+		{
+			name:            "wrong current password",
+			currentPassword: "wrongpass1234",
+			confirmation:    "newpass1234",
+			expectedCode:    http.StatusBadRequest,
+		},
+		{
+			name:            "confirmation mismatch",
+			currentPassword: "pass1234",
+			confirmation:    "otherpass1234",
+			expectedCode:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			c := clock.NewMock()
+			now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+			c.SetNow(now)
+
+			user, session := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			models.SetupSession(t, models.TestServices.Session, user.ID)
+			resetToken := models.Token{
+				UserID:    user.ID,
+				Type:      models.TokenTypeResetPassword,
+				ExpiresAt: now.Add(time.Hour),
+			}
+			if err := models.TestServices.Token.Create(&resetToken); err != nil {
+				t.Fatal(errors.Wrap(err, "creating token"))
+			}
+			accessToken := models.AccessToken{UserID: user.ID, Name: "ci", Scopes: "sync"}
+			if _, err := models.TestServices.AccessToken.Generate(&accessToken); err != nil {
+				t.Fatal(errors.Wrap(err, "generating access token"))
+			}
+
+			m, backend := newTestMailer(cfg)
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, c, models.TestServices.DB)
+
+			// Execute
+			body := fmt.Sprintf(`{"current_password": "%s", "password": "newpass1234", "password_confirmation": "%s"}`, tc.currentPassword, tc.confirmation)
+			req := newReq(t, "PATCH", "/api/v1/account/password", body)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", session.Key))
+			w := httpDo(t, usersC.V1ChangePassword, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+
+			_, err := models.TestServices.User.Authenticate("alice@example.com", "newpass1234")
+			assert.Equal(t, err == nil, tc.expectedPass, "new password mismatch")
+
+			var sessions []models.Session
+			models.MustExec(t, models.TestServices.DB.Where("user_id = ?", user.ID).Find(&sessions), "finding sessions")
+			var tokenCount int
+			models.MustExec(t, models.TestServices.DB.Model(&models.Token{}).Where("id = ?", resetToken.ID).Count(&tokenCount), "counting tokens")
+			var accessTokenCount int
+			models.MustExec(t, models.TestServices.DB.Model(&models.AccessToken{}).Where("user_id = ?", user.ID).Count(&accessTokenCount), "counting access tokens")
+
+			if tc.expectedPass {
+				assert.Equal(t, len(sessions), 1, "session count mismatch")
+				assert.Equal(t, sessions[0].ID, session.ID, "remaining session mismatch")
+				assert.Equal(t, tokenCount, 0, "reset token count mismatch")
+				assert.Equal(t, accessTokenCount, 0, "access token count mismatch")
+				assert.Equal(t, len(backend.Emails), 1, "email count mismatch")
+			} else {
+				assert.Equal(t, len(sessions), 2, "session count mismatch")
+				assert.Equal(t, tokenCount, 1, "reset token count mismatch")
+				assert.Equal(t, accessTokenCount, 1, "access token count mismatch")
+				assert.Equal(t, len(backend.Emails), 0, "email count mismatch")
+			}
+		})
+	}
+}
+
+func TestUsersV1ChangeEmail(t *testing.T) {
+	testCases := []struct {
+		name          string
+		email         string
+		password      string
+		expectedCode  int
+		expectedEmail string
+	}{
+		{
+			name:          "valid",
+			email:         "alice@example.org",
+			password:      "pass1234",
+			expectedCode:  http.StatusOK,
+			expectedEmail: "alice@example.org",
+		},
+		{
+			name:          "wrong password",
+			email:         "alice@example.org",
+			password:      "wrongpass1234",
+			expectedCode:  http.StatusBadRequest,
+			expectedEmail: "alice@example.com",
+		},
+		{
+			name:          "unchanged",
+			email:         "Alice@example.com",
+			password:      "pass1234",
+			expectedCode:  http.StatusBadRequest,
+			expectedEmail: "alice@example.com",
+		},
+		{
+			name:          "taken",
+			email:         "bob@example.com",
+			password:      "pass1234",
+			expectedCode:  http.StatusConflict,
+			expectedEmail: "alice@example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			c := clock.NewMock()
+			now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+			c.SetNow(now)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			models.MustExec(t, models.TestServices.DB.Model(&user).Update("email_verified", true), "verifying email")
+			models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+			m, backend := newTestMailer(cfg)
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, c, models.TestServices.DB)
+
+			// Execute
+			body := fmt.Sprintf(`{"email": "%s", "password": "%s"}`, tc.email, tc.password)
+			req := newReq(t, "PATCH", "/api/v1/account/email", body)
+			w := httpDo(t, usersC.V1ChangeEmail, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+
+			var userRecord models.User
+			models.MustExec(t, models.TestServices.DB.Where("id = ?", user.ID).First(&userRecord), "finding user")
+			assert.Equal(t, userRecord.Email, tc.expectedEmail, "email mismatch")
+
+			if tc.expectedCode == http.StatusOK {
+				var payload AccountResp
+				if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+					t.Fatal(errors.Wrap(err, "decoding payload"))
+				}
+				assert.Equal(t, payload.Email, tc.expectedEmail, "payload email mismatch")
+				assert.Equal(t, userRecord.EmailVerified, false, "email_verified mismatch")
+
+				// A verification email to the new address and an alert to the previous one
+				assert.Equal(t, len(backend.Emails), 2, "email count mismatch")
+				assert.DeepEqual(t, backend.Emails[0].To, []string{"alice@example.org"}, "verification email recipient mismatch")
+				assert.DeepEqual(t, backend.Emails[1].To, []string{"alice@example.com"}, "alert email recipient mismatch")
+			} else {
+				assert.Equal(t, userRecord.EmailVerified, true, "email_verified mismatch")
+				assert.Equal(t, len(backend.Emails), 0, "email count mismatch")
+			}
+		})
+	}
+}
+
+func TestUsersV1DeleteAccount(t *testing.T) {
+	testCases := []struct {
+		name            string
+		password        string
+		expectedCode    int
+		expectedDeleted bool
+	}{
+		{
+			name:            "valid",
+			password:        "pass1234",
+			expectedCode:    http.StatusNoContent,
+			expectedDeleted: true,
+		},
+		{
+			name:         "wrong password",
+			password:     "wrongpass1234",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+			for _, u := range []models.User{user, anotherUser} {
+				b := models.Book{
+					UserID: u.ID,
+					Name:   "js",
+				}
+				models.MustExec(t, models.TestServices.DB.Save(&b), "preparing book")
+				n := models.Note{
+					UserID:   u.ID,
+					BookUUID: b.UUID,
+					Body:     "n1 content",
+					AddedOn:  1,
+				}
+				models.MustExec(t, models.TestServices.DB.Save(&n), "preparing note")
+			}
+
+			m, _ := newTestMailer(cfg)
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, clock.NewMock(), models.TestServices.DB)
+
+			// Execute
+			req := newReq(t, "DELETE", "/api/v1/account", fmt.Sprintf(`{"password": "%s"}`, tc.password))
+			w := httpDo(t, usersC.V1DeleteAccount, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+
+			var userCount, noteCount, bookCount, sessionCount int
+			models.MustExec(t, models.TestServices.DB.Model(&models.User{}).Where("id = ?", user.ID).Count(&userCount), "counting users")
+			models.MustExec(t, models.TestServices.DB.Model(&models.Note{}).Where("user_id = ?", user.ID).Count(&noteCount), "counting notes")
+			models.MustExec(t, models.TestServices.DB.Model(&models.Book{}).Where("user_id = ?", user.ID).Count(&bookCount), "counting books")
+			models.MustExec(t, models.TestServices.DB.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&sessionCount), "counting sessions")
+
+			if tc.expectedDeleted {
+				assert.Equal(t, userCount, 0, "user count mismatch")
+				assert.Equal(t, noteCount, 0, "note count mismatch")
+				assert.Equal(t, bookCount, 0, "book count mismatch")
+				assert.Equal(t, sessionCount, 0, "session count mismatch")
+			} else {
+				assert.Equal(t, userCount, 1, "user count mismatch")
+				assert.Equal(t, noteCount, 1, "note count mismatch")
+				assert.Equal(t, bookCount, 1, "book count mismatch")
+				assert.Equal(t, sessionCount, 1, "session count mismatch")
+			}
+
+			var anotherNoteCount int
+			models.MustExec(t, models.TestServices.DB.Model(&models.Note{}).Where("user_id = ?", anotherUser.ID).Count(&anotherNoteCount), "counting notes")
+			assert.Equal(t, anotherNoteCount, 1, "another user's note count mismatch")
+		})
+	}
+}
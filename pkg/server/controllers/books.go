@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
@@ -17,12 +21,14 @@ import (
 )
 
 // NewBooks creates a new Books controller.
-func NewBooks(cfg config.Config, bs models.BookService, us models.UserService, ns models.NoteService, c clock.Clock, db *gorm.DB) *Books {
+func NewBooks(cfg config.Config, bs models.BookService, us models.UserService, ns models.NoteService, nrs models.NoteRevisionService, c clock.Clock, db *gorm.DB) *Books {
 	return &Books{
-		IndexView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "", Layout: "base", HeaderTemplate: "navbar"}, "books/index"),
+		IndexView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "Books", Layout: "base", HeaderTemplate: "navbar"}, "books/index"),
+		ShowView:  views.NewView(cfg.PageTemplateDir, views.Config{Title: "Book", Layout: "base", HeaderTemplate: "navbar"}, "books/show", "notes/list"),
 		c:         c,
 		bs:        bs,
 		ns:        ns,
+		nrs:       nrs,
 		us:        us,
 		db:        db,
 	}
@@ -31,37 +37,301 @@ func NewBooks(cfg config.Config, bs models.BookService, us models.UserService, n
 // Books is a static controller
 type Books struct {
 	IndexView *views.View
+	ShowView  *views.View
 	c         clock.Clock
 	bs        models.BookService
 	ns        models.NoteService
+	nrs       models.NoteRevisionService
 	us        models.UserService
 	db        *gorm.DB
 }
 
-// Index handles GET /
+// encryptedBookLabel is the label of an encrypted book, whose name the server cannot read
+const encryptedBookLabel = "Encrypted book"
+
+// getBookLabels returns the labels of the given books by their uuids. The label
+// of a nested book is the path of the names from its root book, separated by '/'.
+func getBookLabels(books []models.Book) map[string]string {
+	byUUID := map[string]models.Book{}
+	for _, b := range books {
+		byUUID[b.UUID] = b
+	}
+
+	ret := map[string]string{}
+	for _, b := range books {
+		var names []string
+
+		// The depth is bounded in case the parents form a cycle
+		cur, ok := b, true
+		for i := 0; ok && i < len(books); i++ {
+			name := cur.Name
+			if cur.Encrypted {
+				name = encryptedBookLabel
+			}
+			names = append([]string{name}, names...)
+
+			cur, ok = byUUID[cur.ParentUUID]
+		}
+
+		ret[b.UUID] = strings.Join(names, "/")
+	}
+
+	return ret
+}
+
+// bookOption is a book that can be chosen in a form
+type bookOption struct {
+	UUID  string
+	Label string
+}
+
+// getBookOptions returns the books of the user with the given id that can be chosen
+// in a form on the web, sorted by their labels. Encrypted books are excluded, because
+// plaintext notes and books should not be added to them.
+func getBookOptions(bs models.BookService, userID uint) ([]bookOption, error) {
+	books, err := bs.Search(models.BookSearchParams{UserID: userID})
+	if err != nil {
+		return nil, errors.Wrap(err, "getting books")
+	}
+
+	labels := getBookLabels(books)
+
+	var ret []bookOption
+	for _, b := range books {
+		if b.Encrypted {
+			continue
+		}
+
+		ret = append(ret, bookOption{UUID: b.UUID, Label: labels[b.UUID]})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Label < ret[j].Label
+	})
+
+	return ret, nil
+}
+
+// bookItem is a book in the page listing the books
+type bookItem struct {
+	UUID      string
+	Name      string
+	Label     string
+	Encrypted bool
+}
+
+// booksIndexData is the data for the page listing the books
+type booksIndexData struct {
+	Books   []bookItem
+	Parents []bookOption
+}
+
+func (b *Books) getIndexData(userID uint) (booksIndexData, error) {
+	books, err := b.bs.Search(models.BookSearchParams{UserID: userID})
+	if err != nil {
+		return booksIndexData{}, errors.Wrap(err, "getting books")
+	}
+
+	labels := getBookLabels(books)
+
+	var ret booksIndexData
+	for _, book := range books {
+		ret.Books = append(ret.Books, bookItem{
+			UUID:      book.UUID,
+			Name:      book.Name,
+			Label:     labels[book.UUID],
+			Encrypted: book.Encrypted,
+		})
+	}
+	sort.Slice(ret.Books, func(i, j int) bool {
+		return ret.Books[i].Label < ret.Books[j].Label
+	})
+
+	parents, err := getBookOptions(b.bs, userID)
+	if err != nil {
+		return booksIndexData{}, err
+	}
+	ret.Parents = parents
+
+	return ret, nil
+}
+
+// Index handles GET /books
 func (b *Books) Index(w http.ResponseWriter, r *http.Request) {
-	// user := context.User(r.Context())
-	books, err := b.bs.Search(models.BookSearchParams{})
+	user := context.User(r.Context())
 
 	var vd views.Data
-	vd.Yield = struct {
-		Books []models.Book
-	}{
-		Books: books,
+	data, err := b.getIndexData(user.ID)
+	vd.Yield = data
+	if err != nil {
+		handleHTMLError(w, err, "getting books", &vd)
+	}
+
+	b.IndexView.Render(w, r, vd)
+}
+
+// bookShowData is the data for the page of a book
+type bookShowData struct {
+	UUID      string
+	Label     string
+	Encrypted bool
+	Children  []bookOption
+	Notes     []noteItem
+	// NextURL is the URL of the next page of the notes, if any
+	NextURL string
+}
+
+func (b *Books) getShowData(r *http.Request, userID uint) (bookShowData, error) {
+	book, err := b.bs.ByUUID(mux.Vars(r)["bookUUID"])
+	if err != nil {
+		return bookShowData{}, errors.Wrap(err, "getting book")
+	}
+	if ok := permissions.ViewBook(userID, *book); !ok {
+		return bookShowData{}, models.ErrNotFound
 	}
 
+	books, err := b.bs.Search(models.BookSearchParams{UserID: userID})
 	if err != nil {
-		handleHTMLError(w, err, "getting books", &vd)
-		b.IndexView.Render(w, r, vd)
+		return bookShowData{}, errors.Wrap(err, "getting books")
+	}
+	labels := getBookLabels(books)
+
+	ret := bookShowData{
+		UUID:      book.UUID,
+		Label:     labels[book.UUID],
+		Encrypted: book.Encrypted,
+	}
+	for _, child := range books {
+		if child.ParentUUID == book.UUID {
+			ret.Children = append(ret.Children, bookOption{UUID: child.UUID, Label: labels[child.UUID]})
+		}
+	}
+	sort.Slice(ret.Children, func(i, j int) bool {
+		return ret.Children[i].Label < ret.Children[j].Label
+	})
+
+	q := r.URL.Query()
+	q.Set("book", book.UUID)
+	resp, err := listNotes(b.ns, userID, q)
+	if err != nil {
+		return bookShowData{}, err
+	}
+	ret.Notes = newNoteItems(resp.Notes, labels)
+	ret.NextURL = getNextPageURL(fmt.Sprintf("/books/%s", book.UUID), r.URL.Query(), resp)
+
+	return ret, nil
+}
+
+// Show handles GET /books/:uuid
+func (b *Books) Show(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	data, err := b.getShowData(r, user.ID)
+	if err != nil {
+		redirectBooksError(w, r, err, "getting book")
 		return
 	}
 
-	b.IndexView.Render(w, r, vd)
+	b.ShowView.Render(w, r, data)
+}
+
+// redirectBooksAlert redirects to the page listing the books with the given alert
+func redirectBooksAlert(w http.ResponseWriter, r *http.Request, alert views.Alert) {
+	views.RedirectAlert(w, r, "/books", http.StatusFound, alert)
+}
+
+// redirectBooksError redirects to the page listing the books with an alert for the given error
+func redirectBooksError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	logError(err, msg)
+
+	var vd views.Data
+	vd.SetAlert(err)
+	redirectBooksAlert(w, r, *vd.Alert)
+}
+
+// Create handles POST /books
+func (b *Books) Create(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		redirectBooksError(w, r, err, "parsing form")
+		return
+	}
+	if r.PostForm.Get("name") == "" {
+		redirectBooksError(w, r, models.ErrBookNameRequired, "creating book")
+		return
+	}
+
+	if _, err := b.create(r); err != nil {
+		redirectBooksError(w, r, err, "creating book")
+		return
+	}
+
+	redirectBooksAlert(w, r, views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The book has been created.",
+	})
+}
+
+// rename renames a book with the name in the form submitted on the web
+func (b *Books) rename(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return errors.Wrap(err, "parsing form")
+	}
+	if r.PostForm.Get("name") == "" {
+		return models.ErrBookNameRequired
+	}
+
+	user := context.User(r.Context())
+	book, err := b.bs.ByUUID(mux.Vars(r)["bookUUID"])
+	if err != nil {
+		return errors.Wrap(err, "getting book")
+	}
+	if ok := permissions.UpdateBook(user.ID, *book); !ok {
+		return models.ErrNotFound
+	}
+	if book.Encrypted {
+		return models.ErrEncryptedWebEdit
+	}
+
+	// Only the name is changed, since the form has no other fields
+	r.PostForm = url.Values{"name": r.PostForm["name"]}
+	if _, err := b.update(r); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Update handles POST /books/:uuid
+func (b *Books) Update(w http.ResponseWriter, r *http.Request) {
+	if err := b.rename(r); err != nil {
+		redirectBooksError(w, r, err, "renaming book")
+		return
+	}
+
+	redirectBooksAlert(w, r, views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The book has been renamed.",
+	})
+}
+
+// Delete handles POST /books/:uuid/delete
+func (b *Books) Delete(w http.ResponseWriter, r *http.Request) {
+	if _, err := b.remove(r); err != nil {
+		redirectBooksError(w, r, err, "deleting book")
+		return
+	}
+
+	redirectBooksAlert(w, r, views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The book, its notes and its nested books have been deleted.",
+	})
 }
 
 // BookForm is the form data for a book
 type BookForm struct {
-	Name *string `schema:"name" json:"name"`
+	Name       *string `schema:"name" json:"name"`
+	ParentUUID *string `schema:"parent_uuid" json:"parent_uuid"`
+	Encrypted  *bool   `schema:"encrypted" json:"encrypted"`
 }
 
 // GetName gets the name from the BookForm
@@ -73,6 +343,15 @@ func (r BookForm) GetName() string {
 	return *r.Name
 }
 
+// GetParentUUID gets the parent_uuid from the BookForm
+func (r BookForm) GetParentUUID() string {
+	if r.ParentUUID == nil {
+		return ""
+	}
+
+	return *r.ParentUUID
+}
+
 func (b *Books) create(r *http.Request) (models.Book, error) {
 	var form BookForm
 	if err := parseRequestData(r, &form); err != nil {
@@ -91,11 +370,12 @@ func (b *Books) create(r *http.Request) (models.Book, error) {
 	}
 
 	book := models.Book{
-		UserID:    user.ID,
-		Name:      form.GetName(),
-		AddedOn:   b.c.Now().UnixNano(),
-		USN:       nextUSN,
-		Encrypted: false,
+		UserID:     user.ID,
+		Name:       form.GetName(),
+		ParentUUID: form.GetParentUUID(),
+		AddedOn:    b.c.Now().UnixNano(),
+		USN:        nextUSN,
+		Encrypted:  form.Encrypted != nil && *form.Encrypted,
 	}
 	if err := b.bs.Create(&book, tx); err != nil {
 		tx.Rollback()
@@ -133,11 +413,13 @@ func (b *Books) update(r *http.Request) (models.Book, error) {
 
 	book, err := b.bs.ByUUID(bookUUID)
 	if err != nil {
+		tx.Rollback()
 		return models.Book{}, errors.Wrap(err, "getting book")
 	}
 
 	// Check for permission. If not allowed, respond with not found.
 	if ok := permissions.UpdateBook(user.ID, *book); !ok {
+		tx.Rollback()
 		return models.Book{}, models.ErrNotFound
 	}
 
@@ -150,18 +432,25 @@ func (b *Books) update(r *http.Request) (models.Book, error) {
 	if form.Name != nil {
 		book.Name = form.GetName()
 	}
+	if form.ParentUUID != nil {
+		book.ParentUUID = form.GetParentUUID()
+	}
+	if form.Encrypted != nil {
+		book.Encrypted = *form.Encrypted
+	}
 
 	book.USN = nextUSN
 	book.EditedOn = b.c.Now().UnixNano()
 	book.Deleted = false
 
 	if err := b.bs.Update(book, tx); err != nil {
+		tx.Rollback()
 		return *book, errors.Wrap(err, "updating the book")
 	}
 
 	tx.Commit()
 
-	return models.Book{}, nil
+	return *book, nil
 }
 
 // V1Update handles PATCH /api/v1/books/:uuid
@@ -194,38 +483,54 @@ func (b *Books) remove(r *http.Request) (models.Book, error) {
 		return models.Book{}, models.ErrNotFound
 	}
 
-	notes, err := b.ns.ActiveByBookUUID(book.UUID)
-	if err != nil {
+	if err := removeBook(tx, user.ID, book, b.bs, b.ns, b.nrs, b.us); err != nil {
 		tx.Rollback()
-		return models.Book{}, errors.Wrap(err, "getting notes for the book")
+		return models.Book{}, errors.Wrapf(err, "deleting book %s", book.UUID)
+	}
+
+	tx.Commit()
+
+	return models.Book{}, nil
+}
+
+// removeBook deletes the given book along with its notes and its descendant books.
+func removeBook(tx *gorm.DB, userID uint, book *models.Book, bs models.BookService, ns models.NoteService, nrs models.NoteRevisionService, us models.UserService) error {
+	children, err := bs.ActiveByParentUUID(book.UUID)
+	if err != nil {
+		return errors.Wrap(err, "getting child books")
+	}
+
+	for i := range children {
+		if err := removeBook(tx, userID, &children[i], bs, ns, nrs, us); err != nil {
+			return errors.Wrapf(err, "deleting child book %s", children[i].UUID)
+		}
+	}
+
+	notes, err := ns.ActiveByBookUUID(book.UUID)
+	if err != nil {
+		return errors.Wrap(err, "getting notes for the book")
 	}
 
 	for _, note := range notes {
-		if err := removeNote(tx, user.ID, note.UUID, b.ns, b.us); err != nil {
-			tx.Rollback()
-			return models.Book{}, errors.Wrapf(err, "deleting note %s", note.UUID)
+		if err := removeNote(tx, userID, note.UUID, ns, nrs, us); err != nil {
+			return errors.Wrapf(err, "deleting note %s", note.UUID)
 		}
 	}
 
-	nextUSN, err := b.us.IncrementUSN(tx, user.ID)
+	nextUSN, err := us.IncrementUSN(tx, userID)
 	if err != nil {
-		tx.Rollback()
-		return models.Book{}, errors.Wrap(err, "incrementing user max_usn")
+		return errors.Wrap(err, "incrementing user max_usn")
 	}
 
 	book.USN = nextUSN
 	book.Deleted = true
 	book.Name = ""
 
-	err = b.bs.Update(book, tx)
-	if err != nil {
-		tx.Rollback()
-		return models.Book{}, errors.Wrap(err, "updating")
+	if err := bs.Update(book, tx); err != nil {
+		return errors.Wrap(err, "updating")
 	}
 
-	tx.Commit()
-
-	return models.Book{}, nil
+	return nil
 }
 
 // V1Delete handles DELETE /api/v1/books/:uuid
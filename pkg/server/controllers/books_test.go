@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -25,7 +27,7 @@ func TestBooksV1Create(t *testing.T) {
 	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
 
 	// Test
-	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, clock.NewMock(), models.TestServices.DB)
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
 	req := newReq(t, "POST", "/v1/api/books", `{"name": "js"}`)
 	w := httpDo(t, booksC.V1Create, req, &user)
 	assert.Equal(t, w.Code, http.StatusCreated, "status code mismatch")
@@ -81,7 +83,7 @@ func TestBooksV1CreateDuplicate(t *testing.T) {
 	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing book data")
 
 	// Test
-	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, clock.NewMock(), models.TestServices.DB)
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
 	req := newReq(t, "POST", "/v1/api/books", `{"name": "js"}`)
 	w := httpDo(t, booksC.V1Create, req, &user)
 	assert.Equal(t, w.Code, http.StatusConflict, "status code mismatch")
@@ -104,6 +106,71 @@ func TestBooksV1CreateDuplicate(t *testing.T) {
 	assert.Equal(t, userRecord.MaxUSN, 101, "user max_usn mismatch")
 }
 
+func TestBooksV1Create_parent(t *testing.T) {
+	testCases := []struct {
+		parentUUID     string
+		expectedStatus int
+		expectedCount  int
+	}{
+		// a book can share its name with a book under another parent
+		{
+			parentUUID:     "ead8790f-aff9-4bdf-8eec-f734ccd29202",
+			expectedStatus: http.StatusCreated,
+			expectedCount:  3,
+		},
+		{
+			parentUUID:     "e8ba3c85-c25c-4ae5-a7a2-7fb9f2e02a0b",
+			expectedStatus: http.StatusBadRequest,
+			expectedCount:  2,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
+
+			b1 := models.Book{
+				UUID:   "ead8790f-aff9-4bdf-8eec-f734ccd29202",
+				UserID: user.ID,
+				Name:   "work",
+				USN:    1,
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+			b2 := models.Book{
+				UUID:   "0ecaac96-8d72-4e04-8925-5a21b79a16da",
+				UserID: user.ID,
+				Name:   "infra",
+				USN:    2,
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+
+			// Execute
+			booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
+			req := newReq(t, "POST", "/v1/api/books", fmt.Sprintf(`{"name": "infra", "parent_uuid": "%s"}`, tc.parentUUID))
+			w := httpDo(t, booksC.V1Create, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedStatus, "status code mismatch")
+
+			var bookCount int
+			models.MustExec(t, models.TestServices.DB.Model(models.Book{}).Count(&bookCount), "counting books")
+			assert.Equalf(t, bookCount, tc.expectedCount, "book count mismatch")
+
+			if tc.expectedStatus == http.StatusCreated {
+				var bookRecord models.Book
+				models.MustExec(t, models.TestServices.DB.Where("name = ? AND parent_uuid = ?", "infra", tc.parentUUID).First(&bookRecord), "finding book")
+				assert.Equal(t, bookRecord.UserID, user.ID, "book user_id mismatch")
+			}
+		})
+	}
+}
+
 func TestBooksV1Delete(t *testing.T) {
 	testCases := []struct {
 		label          string
@@ -220,7 +287,7 @@ func TestBooksV1Delete(t *testing.T) {
 			}
 			models.MustExec(t, models.TestServices.DB.Save(&n5), "preparing book data")
 
-			booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, clock.NewMock(), models.TestServices.DB)
+			booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
 			req := newReq(t, "DELETE", fmt.Sprintf("/v1/api/books/%s", b2.UUID), "")
 			req = mux.SetURLVars(req, map[string]string{"bookUUID": b2.UUID})
 			w := httpDo(t, booksC.V1Delete, req, &user)
@@ -284,6 +351,65 @@ func TestBooksV1Delete(t *testing.T) {
 	}
 }
 
+func TestBooksV1Delete_children(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 58), "preparing user max_usn")
+
+	b1 := models.Book{
+		UUID:   "ead8790f-aff9-4bdf-8eec-f734ccd29202",
+		UserID: user.ID,
+		Name:   "work",
+		USN:    1,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{
+		UUID:       "0ecaac96-8d72-4e04-8925-5a21b79a16da",
+		UserID:     user.ID,
+		Name:       "infra",
+		ParentUUID: b1.UUID,
+		USN:        2,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	n1 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b2.UUID,
+		Body:     "n1 content",
+		USN:      3,
+		AddedOn:  1542058875,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+
+	// Execute
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
+	req := newReq(t, "DELETE", fmt.Sprintf("/v1/api/books/%s", b1.UUID), "")
+	req = mux.SetURLVars(req, map[string]string{"bookUUID": b1.UUID})
+	w := httpDo(t, booksC.V1Delete, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	var b1Record, b2Record models.Book
+	var n1Record models.Note
+	var userRecord models.User
+	models.MustExec(t, models.TestServices.DB.Where("id = ?", b1.ID).First(&b1Record), "finding b1")
+	models.MustExec(t, models.TestServices.DB.Where("id = ?", b2.ID).First(&b2Record), "finding b2")
+	models.MustExec(t, models.TestServices.DB.Where("id = ?", n1.ID).First(&n1Record), "finding n1")
+	models.MustExec(t, models.TestServices.DB.Where("id = ?", user.ID).First(&userRecord), "finding user record")
+
+	assert.Equal(t, b1Record.Deleted, true, "b1 deleted mismatch")
+	assert.Equal(t, b2Record.Deleted, true, "b2 deleted mismatch")
+	assert.Equal(t, n1Record.Deleted, true, "n1 deleted mismatch")
+	assert.Equal(t, n1Record.USN, 59, "n1 usn mismatch")
+	assert.Equal(t, b2Record.USN, 60, "b2 usn mismatch")
+	assert.Equal(t, b1Record.USN, 61, "b1 usn mismatch")
+	assert.Equal(t, userRecord.MaxUSN, 61, "user max_usn mismatch")
+}
+
 func TestBooksV1Update(t *testing.T) {
 	updatedLabel := "updated-label"
 
@@ -343,7 +469,7 @@ func TestBooksV1Update(t *testing.T) {
 			models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
 
 			// Executdb,e
-			booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, clock.NewMock(), models.TestServices.DB)
+			booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
 			req := newReq(t, "PATCH", fmt.Sprintf("/v1/api/books/%s", b2.UUID), tc.payload)
 			req = mux.SetURLVars(req, map[string]string{"bookUUID": tc.bookUUID})
 			w := httpDo(t, booksC.V1Update, req, &user)
@@ -372,6 +498,90 @@ func TestBooksV1Update(t *testing.T) {
 	}
 }
 
+func TestBooksV1Update_parent(t *testing.T) {
+	b1UUID := "ead8790f-aff9-4bdf-8eec-f734ccd29202"
+	b2UUID := "0ecaac96-8d72-4e04-8925-5a21b79a16da"
+	b3UUID := "e8ba3c85-c25c-4ae5-a7a2-7fb9f2e02a0b"
+
+	testCases := []struct {
+		bookUUID           string
+		parentUUID         string
+		expectedStatus     int
+		expectedParentUUID string
+	}{
+		{
+			bookUUID:           b3UUID,
+			parentUUID:         b1UUID,
+			expectedStatus:     http.StatusOK,
+			expectedParentUUID: b1UUID,
+		},
+		{
+			bookUUID:           b2UUID,
+			parentUUID:         "",
+			expectedStatus:     http.StatusOK,
+			expectedParentUUID: "",
+		},
+		// a book cannot be moved under itself or its descendant
+		{
+			bookUUID:           b1UUID,
+			parentUUID:         b1UUID,
+			expectedStatus:     http.StatusBadRequest,
+			expectedParentUUID: "",
+		},
+		{
+			bookUUID:           b1UUID,
+			parentUUID:         b2UUID,
+			expectedStatus:     http.StatusBadRequest,
+			expectedParentUUID: "",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			// Setup
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
+
+			b1 := models.Book{
+				UUID:   b1UUID,
+				UserID: user.ID,
+				Name:   "work",
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+			b2 := models.Book{
+				UUID:       b2UUID,
+				UserID:     user.ID,
+				Name:       "infra",
+				ParentUUID: b1UUID,
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+			b3 := models.Book{
+				UUID:   b3UUID,
+				UserID: user.ID,
+				Name:   "k8s",
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+
+			// Execute
+			booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
+			req := newReq(t, "PATCH", fmt.Sprintf("/v1/api/books/%s", tc.bookUUID), fmt.Sprintf(`{"parent_uuid": "%s"}`, tc.parentUUID))
+			req = mux.SetURLVars(req, map[string]string{"bookUUID": tc.bookUUID})
+			w := httpDo(t, booksC.V1Update, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedStatus, "status code mismatch")
+
+			var bookRecord models.Book
+			models.MustExec(t, models.TestServices.DB.Where("uuid = ?", tc.bookUUID).First(&bookRecord), "finding book")
+			assert.Equal(t, bookRecord.ParentUUID, tc.expectedParentUUID, "parent_uuid mismatch")
+		})
+	}
+}
+
 func TestBooksV1Get(t *testing.T) {
 	// Set up
 	cfg := config.Load()
@@ -412,7 +622,7 @@ func TestBooksV1Get(t *testing.T) {
 
 	// Execute
 	req := newReq(t, "GET", fmt.Sprintf("/v1/api/books/%s", b2.UUID), "")
-	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, clock.NewMock(), models.TestServices.DB)
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
 	w := httpDo(t, booksC.V1Index, req, &user)
 
 	// Test
@@ -475,7 +685,7 @@ func TestBooksV1Get_Name(t *testing.T) {
 
 	// Execute
 	req := newReq(t, "GET", "/api/v1/books?name=js", "")
-	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, clock.NewMock(), models.TestServices.DB)
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
 	w := httpDo(t, booksC.V1Index, req, &user)
 
 	// Test
@@ -501,3 +711,218 @@ func TestBooksV1Get_Name(t *testing.T) {
 
 	assert.DeepEqual(t, payload, expected, "payload mismatch")
 }
+
+func TestGetBookLabels(t *testing.T) {
+	books := []models.Book{
+		{UUID: "b1", Name: "lang"},
+		{UUID: "b2", Name: "go", ParentUUID: "b1"},
+		{UUID: "b3", Name: "testing", ParentUUID: "b2"},
+		{UUID: "b4", Name: "ciphertext", Encrypted: true},
+		{UUID: "b5", Name: "work", ParentUUID: "b4"},
+		// The parents of b6 and b7 form a cycle
+		{UUID: "b6", Name: "a", ParentUUID: "b7"},
+		{UUID: "b7", Name: "b", ParentUUID: "b6"},
+	}
+
+	got := getBookLabels(books)
+
+	assert.Equal(t, got["b1"], "lang", "b1 label mismatch")
+	assert.Equal(t, got["b2"], "lang/go", "b2 label mismatch")
+	assert.Equal(t, got["b3"], "lang/go/testing", "b3 label mismatch")
+	assert.Equal(t, got["b4"], "Encrypted book", "b4 label mismatch")
+	assert.Equal(t, got["b5"], "Encrypted book/work", "b5 label mismatch")
+	assert.Equal(t, strings.HasSuffix(got["b6"], "b/a"), true, "b6 label mismatch")
+}
+
+func TestBooksIndex(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+	b1 := models.Book{UserID: user.ID, Name: "lang", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{UserID: user.ID, Name: "go", ParentUUID: b1.UUID, USN: 2}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	b3 := models.Book{UserID: anotherUser.ID, Name: "css", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	req := newReq(t, "GET", "/books", "")
+	w := httpDo(t, booksC.Index, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	body := w.Body.String()
+	assert.Equal(t, strings.Contains(body, "lang/go"), true, "b2 label mismatch")
+	assert.Equal(t, strings.Contains(body, fmt.Sprintf(`action="/books/%s"`, b2.UUID)), true, "b2 rename form mismatch")
+	assert.Equal(t, strings.Contains(body, b3.UUID), false, "another user's book should not be shown")
+}
+
+func TestBooksShow(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+	b1 := models.Book{UserID: user.ID, Name: "lang", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{UserID: user.ID, Name: "go", ParentUUID: b1.UUID, USN: 2}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	b3 := models.Book{UserID: anotherUser.ID, Name: "css", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "Grammars", USN: 3, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+	n2 := models.Note{UserID: user.ID, BookUUID: b2.UUID, Body: "Goroutines", USN: 4, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
+
+	t.Run("another user's book", func(t *testing.T) {
+		req := newReq(t, "GET", fmt.Sprintf("/books/%s", b3.UUID), "")
+		req = mux.SetURLVars(req, map[string]string{"bookUUID": b3.UUID})
+		w := httpDo(t, booksC.Show, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+		assert.Equal(t, w.Header().Get("Location"), "/books", "location mismatch")
+	})
+
+	t.Run("own book", func(t *testing.T) {
+		req := newReq(t, "GET", fmt.Sprintf("/books/%s", b1.UUID), "")
+		req = mux.SetURLVars(req, map[string]string{"bookUUID": b1.UUID})
+		w := httpDo(t, booksC.Show, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		body := w.Body.String()
+		assert.Equal(t, strings.Contains(body, fmt.Sprintf(`<a href="/books/%s">lang/go</a>`, b2.UUID)), true, "nested book mismatch")
+		assert.Equal(t, strings.Contains(body, fmt.Sprintf("/notes/%s", n1.UUID)), true, "n1 mismatch")
+		assert.Equal(t, strings.Contains(body, fmt.Sprintf("/notes/%s", n2.UUID)), false, "n2 mismatch")
+		assert.Equal(t, strings.Contains(body, `<div class="note-content"><p>Grammars</p>`), true, "preview mismatch")
+	})
+}
+
+func TestBooksCreate(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
+	b1 := models.Book{UserID: user.ID, Name: "lang", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
+
+	t.Run("without name", func(t *testing.T) {
+		req := newFormReq(t, "POST", "/books", url.Values{"name": {""}})
+		w := httpDo(t, booksC.Create, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+		assert.Equal(t, w.Header().Get("Location"), "/books", "location mismatch")
+
+		var bookCount int
+		models.MustExec(t, models.TestServices.DB.Model(&models.Book{}).Count(&bookCount), "counting books")
+		assert.Equal(t, bookCount, 1, "book count mismatch")
+	})
+
+	t.Run("with parent", func(t *testing.T) {
+		req := newFormReq(t, "POST", "/books", url.Values{"name": {"go"}, "parent_uuid": {b1.UUID}})
+		w := httpDo(t, booksC.Create, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+		assert.Equal(t, w.Header().Get("Location"), "/books", "location mismatch")
+
+		var bookRecord models.Book
+		models.MustExec(t, models.TestServices.DB.Where("name = ?", "go").First(&bookRecord), "finding book")
+		assert.Equal(t, bookRecord.UserID, user.ID, "book user_id mismatch")
+		assert.Equal(t, bookRecord.ParentUUID, b1.UUID, "book parent_uuid mismatch")
+		assert.Equal(t, bookRecord.USN, 102, "book usn mismatch")
+	})
+}
+
+func TestBooksUpdate(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
+	b1 := models.Book{UserID: user.ID, Name: "lang", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{UserID: user.ID, Name: "js", USN: 2}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	b3 := models.Book{UserID: user.ID, Name: "ciphertext", USN: 3, Encrypted: true}
+	models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
+
+	t.Run("encrypted book", func(t *testing.T) {
+		req := newFormReq(t, "POST", fmt.Sprintf("/books/%s", b3.UUID), url.Values{"name": {"work"}})
+		req = mux.SetURLVars(req, map[string]string{"bookUUID": b3.UUID})
+		w := httpDo(t, booksC.Update, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+
+		var bookRecord models.Book
+		models.MustExec(t, models.TestServices.DB.Where("id = ?", b3.ID).First(&bookRecord), "finding b3")
+		assert.Equal(t, bookRecord.Name, "ciphertext", "book name mismatch")
+		assert.Equal(t, bookRecord.USN, 3, "book usn mismatch")
+	})
+
+	t.Run("own book", func(t *testing.T) {
+		// Only the name is changed even if other fields are submitted
+		form := url.Values{"name": {"javascript"}, "parent_uuid": {b1.UUID}}
+		req := newFormReq(t, "POST", fmt.Sprintf("/books/%s", b2.UUID), form)
+		req = mux.SetURLVars(req, map[string]string{"bookUUID": b2.UUID})
+		w := httpDo(t, booksC.Update, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+
+		var bookRecord models.Book
+		models.MustExec(t, models.TestServices.DB.Where("id = ?", b2.ID).First(&bookRecord), "finding b2")
+		assert.Equal(t, bookRecord.Name, "javascript", "book name mismatch")
+		assert.Equal(t, bookRecord.ParentUUID, "", "book parent_uuid mismatch")
+		assert.Equal(t, bookRecord.USN, 102, "book usn mismatch")
+	})
+}
+
+func TestBooksDelete(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	b1 := models.Book{UserID: user.ID, Name: "js", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "n1 content", USN: 2, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+
+	booksC := NewBooks(cfg, models.TestServices.Book, models.TestServices.User, models.TestServices.Note, models.TestServices.NoteRevision, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	req := newFormReq(t, "POST", fmt.Sprintf("/books/%s/delete", b1.UUID), url.Values{})
+	req = mux.SetURLVars(req, map[string]string{"bookUUID": b1.UUID})
+	w := httpDo(t, booksC.Delete, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+	assert.Equal(t, w.Header().Get("Location"), "/books", "location mismatch")
+
+	var bookRecord models.Book
+	var noteRecord models.Note
+	models.MustExec(t, models.TestServices.DB.Where("id = ?", b1.ID).First(&bookRecord), "finding b1")
+	models.MustExec(t, models.TestServices.DB.Where("id = ?", n1.ID).First(&noteRecord), "finding n1")
+	assert.Equal(t, bookRecord.Deleted, true, "book deleted mismatch")
+	assert.Equal(t, noteRecord.Deleted, true, "note deleted mismatch")
+}
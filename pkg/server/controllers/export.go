@@ -0,0 +1,427 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// exportPageSize is the number of notes loaded at a time while writing an export
+	exportPageSize = 100
+	// exportManifestName is the name of the JSON manifest in an export archive
+	exportManifestName = "manifest.json"
+	// exportNotesDir is the directory of the Markdown files in an export archive
+	exportNotesDir = "notes"
+)
+
+// NewExports creates a new Exports controller.
+func NewExports(ns models.NoteService, bs models.BookService, c clock.Clock) *Exports {
+	return &Exports{
+		ns: ns,
+		bs: bs,
+		c:  c,
+	}
+}
+
+// Exports is a controller for the data exports of users
+type Exports struct {
+	ns models.NoteService
+	bs models.BookService
+	c  clock.Clock
+}
+
+// exportBook is a book in the manifest of an export
+type exportBook struct {
+	UUID       string `json:"uuid"`
+	Name       string `json:"name"`
+	ParentUUID string `json:"parent_uuid"`
+	Encrypted  bool   `json:"encrypted"`
+	AddedOn    int64  `json:"added_on"`
+	EditedOn   int64  `json:"edited_on"`
+	// Path is the directory of the notes of the book in the archive
+	Path string `json:"path"`
+}
+
+// exportNote is a note in the manifest of an export
+type exportNote struct {
+	UUID      string   `json:"uuid"`
+	BookUUID  string   `json:"book_uuid"`
+	AddedOn   int64    `json:"added_on"`
+	EditedOn  int64    `json:"edited_on"`
+	Public    bool     `json:"public"`
+	Encrypted bool     `json:"encrypted"`
+	Tags      []string `json:"tags"`
+	// Path is the Markdown file of the note in the archive
+	Path string `json:"path"`
+}
+
+// exportUser is the user in the manifest of an export
+type exportUser struct {
+	UUID  string `json:"uuid"`
+	Email string `json:"email"`
+}
+
+// exportFrontMatter is the metadata of a note written at the top of its Markdown
+// file. It has the same fields as the one written by the CLI, so that the
+// notes can be imported with `nad import`.
+type exportFrontMatter struct {
+	UUID      string   `yaml:"uuid"`
+	AddedOn   string   `yaml:"added_on"`
+	EditedOn  string   `yaml:"edited_on,omitempty"`
+	Public    bool     `yaml:"public"`
+	Encrypted bool     `yaml:"encrypted,omitempty"`
+	Tags      []string `yaml:"tags,omitempty"`
+}
+
+// formatExportTimestamp formats the given unix timestamp in nanoseconds. It
+// returns an empty string for zero so that an unset timestamp is omitted.
+func formatExportTimestamp(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+
+	return time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+}
+
+// exportDirName returns the name of the directory for the given book. Encrypted
+// books are named by their uuids, as the server cannot read their names.
+func exportDirName(b models.Book) string {
+	if b.Encrypted || b.Name == "" || b.Name == "." || b.Name == ".." {
+		return b.UUID
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '-'
+		}
+
+		return r
+	}, b.Name)
+}
+
+// getExportBookPaths returns the directories of the given books by their uuids.
+// The directory of a nested book is nested in the directory of its parent.
+func getExportBookPaths(books []models.Book) map[string]string {
+	byUUID := map[string]models.Book{}
+	for _, b := range books {
+		byUUID[b.UUID] = b
+	}
+
+	ret := map[string]string{}
+	for _, b := range books {
+		var names []string
+
+		// The depth is bounded in case the parents form a cycle
+		cur, ok := b, true
+		for i := 0; ok && i < len(books); i++ {
+			names = append([]string{exportDirName(cur)}, names...)
+
+			cur, ok = byUUID[cur.ParentUUID]
+		}
+
+		ret[b.UUID] = path.Join(names...)
+	}
+
+	return ret
+}
+
+// slugify returns a string that can be used as a part of a file name
+func slugify(s string, maxLen int) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(s) {
+		if b.Len() >= maxLen {
+			break
+		}
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// exportNotePath returns the path of the Markdown file of the given note in the
+// archive, made of the first line of the content and the beginning of the uuid
+func exportNotePath(n models.Note, bookPaths map[string]string) string {
+	dir, ok := bookPaths[n.BookUUID]
+	if !ok {
+		dir = n.BookUUID
+	}
+
+	slug := "note"
+	if !n.Encrypted {
+		firstLine := strings.SplitN(strings.TrimSpace(n.Body), "\n", 2)[0]
+		if s := slugify(firstLine, 50); s != "" {
+			slug = s
+		}
+	}
+
+	shortUUID := n.UUID
+	if len(shortUUID) > 8 {
+		shortUUID = shortUUID[:8]
+	}
+
+	return path.Join(exportNotesDir, dir, fmt.Sprintf("%s-%s.md", slug, shortUUID))
+}
+
+// renderExportMarkdown returns the content of the Markdown file for the given note
+func renderExportMarkdown(n models.Note) ([]byte, error) {
+	fm := exportFrontMatter{
+		UUID:      n.UUID,
+		AddedOn:   formatExportTimestamp(n.AddedOn),
+		EditedOn:  formatExportTimestamp(n.EditedOn),
+		Public:    n.Public,
+		Encrypted: n.Encrypted,
+		Tags:      models.TagNames(n.Tags),
+	}
+
+	meta, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling the front matter")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(meta)
+	buf.WriteString("---\n\n")
+	buf.WriteString(n.Body)
+	if len(n.Body) > 0 && n.Body[len(n.Body)-1] != '\n' {
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// eachNote calls the given function with every note of the given user, loading
+// a page of notes at a time so that all notes are never held in memory at once.
+func (e *Exports) eachNote(userID uint, fn func(models.Note) error) error {
+	var cursor *models.NoteCursor
+
+	for {
+		notes, err := e.ns.List(models.NoteListParams{
+			UserID: userID,
+			SortBy: models.NoteSortAddedOn,
+			Cursor: cursor,
+			Limit:  exportPageSize,
+		})
+		if err != nil {
+			return errors.Wrap(err, "listing notes")
+		}
+
+		for _, n := range notes {
+			if err := fn(n); err != nil {
+				return err
+			}
+		}
+
+		if len(notes) < exportPageSize {
+			return nil
+		}
+
+		last := notes[len(notes)-1]
+		cursor = &models.NoteCursor{Value: last.AddedOn, ID: last.ID}
+	}
+}
+
+// writeNotes writes a Markdown file for every note of the given user
+func (e *Exports) writeNotes(zw *zip.Writer, userID uint, bookPaths map[string]string) error {
+	return e.eachNote(userID, func(n models.Note) error {
+		content, err := renderExportMarkdown(n)
+		if err != nil {
+			return errors.Wrapf(err, "rendering the note %s", n.UUID)
+		}
+
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     exportNotePath(n, bookPaths),
+			Method:   zip.Deflate,
+			Modified: e.c.Now(),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "creating the file for the note %s", n.UUID)
+		}
+		if _, err := f.Write(content); err != nil {
+			return errors.Wrapf(err, "writing the note %s", n.UUID)
+		}
+
+		return nil
+	})
+}
+
+// writeManifest writes a JSON document describing the user, the books and the
+// notes. The notes are encoded one at a time as they are loaded.
+func (e *Exports) writeManifest(zw *zip.Writer, user *models.User, books []models.Book, bookPaths map[string]string) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     exportManifestName,
+		Method:   zip.Deflate,
+		Modified: e.c.Now(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "creating the manifest")
+	}
+
+	writeField := func(prefix string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return errors.Wrap(err, "marshalling")
+		}
+
+		if _, err := io.WriteString(f, prefix); err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	if err := writeField(`{"exported_at":`, e.c.Now().UTC()); err != nil {
+		return errors.Wrap(err, "writing the export time")
+	}
+	if err := writeField(`,"user":`, exportUser{UUID: user.UUID, Email: user.Email}); err != nil {
+		return errors.Wrap(err, "writing the user")
+	}
+
+	manifestBooks := []exportBook{}
+	for _, b := range books {
+		manifestBooks = append(manifestBooks, exportBook{
+			UUID:       b.UUID,
+			Name:       b.Name,
+			ParentUUID: b.ParentUUID,
+			Encrypted:  b.Encrypted,
+			AddedOn:    b.AddedOn,
+			EditedOn:   b.EditedOn,
+			Path:       path.Join(exportNotesDir, bookPaths[b.UUID]),
+		})
+	}
+	if err := writeField(`,"books":`, manifestBooks); err != nil {
+		return errors.Wrap(err, "writing the books")
+	}
+
+	prefix := `,"notes":[`
+	err = e.eachNote(user.ID, func(n models.Note) error {
+		note := exportNote{
+			UUID:      n.UUID,
+			BookUUID:  n.BookUUID,
+			AddedOn:   n.AddedOn,
+			EditedOn:  n.EditedOn,
+			Public:    n.Public,
+			Encrypted: n.Encrypted,
+			Tags:      models.TagNames(n.Tags),
+			Path:      exportNotePath(n, bookPaths),
+		}
+		if err := writeField(prefix, note); err != nil {
+			return errors.Wrapf(err, "writing the note %s", n.UUID)
+		}
+
+		prefix = ","
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if prefix != "," {
+		if _, err := io.WriteString(f, prefix); err != nil {
+			return errors.Wrap(err, "writing the notes")
+		}
+	}
+
+	if _, err := io.WriteString(f, "]}\n"); err != nil {
+		return errors.Wrap(err, "writing the manifest")
+	}
+
+	return nil
+}
+
+// export sends a zip archive of all the books and notes of the user. The notes
+// are written as Markdown files in the directories of their books, along with a
+// JSON manifest of the books, the notes and their metadata. The archive is built
+// in a temporary file and sent only once it is complete, so that an error is
+// reported in the status code rather than by a truncated archive.
+func (e *Exports) export(w http.ResponseWriter, r *http.Request) error {
+	user := context.User(r.Context())
+
+	books, err := e.bs.Search(models.BookSearchParams{UserID: user.ID})
+	if err != nil {
+		return errors.Wrap(err, "getting books")
+	}
+	bookPaths := getExportBookPaths(books)
+
+	f, err := ioutil.TempFile("", "nad-export-*.zip")
+	if err != nil {
+		return errors.Wrap(err, "creating a temporary file")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	if err := e.writeNotes(zw, user.ID, bookPaths); err != nil {
+		return errors.Wrap(err, "writing the notes")
+	}
+	if err := e.writeManifest(zw, user, books, bookPaths); err != nil {
+		return errors.Wrap(err, "writing the manifest")
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "closing the archive")
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "getting the size of the archive")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "rewinding the archive")
+	}
+
+	filename := fmt.Sprintf("nad-export-%s.zip", e.c.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	// The response has already started, so errors cannot be reported in the
+	// status code. The client detects the short body from the Content-Length.
+	if _, err := io.Copy(w, f); err != nil {
+		logError(err, "sending the export")
+	}
+
+	return nil
+}
+
+// Export handles GET /export
+func (e *Exports) Export(w http.ResponseWriter, r *http.Request) {
+	if err := e.export(w, r); err != nil {
+		redirectSettingsError(w, r, err, "exporting data")
+	}
+}
+
+// V1Export handles GET /api/v1/export
+func (e *Exports) V1Export(w http.ResponseWriter, r *http.Request) {
+	if err := e.export(w, r); err != nil {
+		handleJSONError(w, err, "exporting data")
+	}
+}
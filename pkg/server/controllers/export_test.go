@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/pkg/errors"
+)
+
+// exportManifest is the manifest of an export as decoded in tests
+type exportManifest struct {
+	User  exportUser   `json:"user"`
+	Books []exportBook `json:"books"`
+	Notes []exportNote `json:"notes"`
+}
+
+// failingNoteService is a note service that fails to list the notes after the first page
+type failingNoteService struct {
+	models.NoteService
+}
+
+func (s failingNoteService) List(p models.NoteListParams) ([]models.Note, error) {
+	if p.Cursor != nil {
+		return nil, errors.New("connection lost")
+	}
+
+	return s.NoteService.List(p)
+}
+
+func readExport(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the archive"))
+	}
+
+	ret := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(errors.Wrapf(err, "opening %s", f.Name))
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(errors.Wrapf(err, "reading %s", f.Name))
+		}
+
+		ret[f.Name] = string(content)
+	}
+
+	return ret
+}
+
+func TestExportsV1Export(t *testing.T) {
+	t.Run("with notes", func(t *testing.T) {
+		// Set up
+		defer models.ClearTestData(t, models.TestServices.DB)
+
+		user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+		anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+		b1 := models.Book{
+			UserID: user.ID,
+			Name:   "work",
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+		b2 := models.Book{
+			UserID:     user.ID,
+			Name:       "infra",
+			ParentUUID: b1.UUID,
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+		b3 := models.Book{
+			UserID:    user.ID,
+			Name:      "b3 ciphertext",
+			Encrypted: true,
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+		b4 := models.Book{
+			UserID: anotherUser.ID,
+			Name:   "bob",
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&b4), "preparing b4")
+
+		tag := models.Tag{
+			UserID: user.ID,
+			Name:   "go",
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&tag), "preparing tag")
+
+		n1 := models.Note{
+			UserID:   user.ID,
+			BookUUID: b1.UUID,
+			Body:     "Meeting notes\n\n- item",
+			AddedOn:  1,
+			Public:   true,
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+		if err := models.TestServices.Note.SetTags(&n1, []models.Tag{tag}, nil); err != nil {
+			t.Fatal(errors.Wrap(err, "tagging n1"))
+		}
+		n2 := models.Note{
+			UserID:   user.ID,
+			BookUUID: b2.UUID,
+			Body:     "deploy with terraform",
+			AddedOn:  2,
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+		n3 := models.Note{
+			UserID:    user.ID,
+			BookUUID:  b3.UUID,
+			Body:      "n3 ciphertext",
+			AddedOn:   3,
+			Encrypted: true,
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&n3), "preparing n3")
+		n4 := models.Note{
+			UserID:   user.ID,
+			BookUUID: b1.UUID,
+			Body:     "deleted",
+			AddedOn:  4,
+			Deleted:  true,
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&n4), "preparing n4")
+		n5 := models.Note{
+			UserID:   anotherUser.ID,
+			BookUUID: b4.UUID,
+			Body:     "bob's note",
+			AddedOn:  5,
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&n5), "preparing n5")
+
+		exportsC := NewExports(models.TestServices.Note, models.TestServices.Book, clock.NewMock())
+
+		// Execute
+		req := newReq(t, "GET", "/api/v1/export", "")
+		w := httpDo(t, exportsC.V1Export, req, &user)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+		assert.Equal(t, w.Header().Get("Content-Type"), "application/zip", "content type mismatch")
+
+		files := readExport(t, w.Body.Bytes())
+
+		n1Path := "notes/work/meeting-notes-" + n1.UUID[:8] + ".md"
+		n2Path := "notes/work/infra/deploy-with-terraform-" + n2.UUID[:8] + ".md"
+		n3Path := "notes/" + b3.UUID + "/note-" + n3.UUID[:8] + ".md"
+
+		var paths []string
+		for name := range files {
+			paths = append(paths, name)
+		}
+		sort.Strings(paths)
+		expectedPaths := []string{exportManifestName, n1Path, n2Path, n3Path}
+		sort.Strings(expectedPaths)
+		assert.DeepEqual(t, paths, expectedPaths, "file paths mismatch")
+
+		assert.Equal(t, strings.HasPrefix(files[n1Path], "---\nuuid: "+n1.UUID+"\n"), true, "n1 front matter mismatch")
+		assert.Equal(t, strings.Contains(files[n1Path], "tags:\n- go\n"), true, "n1 tags mismatch")
+		assert.Equal(t, strings.HasSuffix(files[n1Path], "---\n\nMeeting notes\n\n- item\n"), true, "n1 body mismatch")
+		assert.Equal(t, strings.Contains(files[n3Path], "encrypted: true\n"), true, "n3 encrypted mismatch")
+
+		var manifest exportManifest
+		if err := json.Unmarshal([]byte(files[exportManifestName]), &manifest); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding the manifest"))
+		}
+
+		assert.Equal(t, manifest.User.Email, "alice@example.com", "user email mismatch")
+		assert.Equal(t, len(manifest.Books), 3, "book count mismatch")
+		assert.Equal(t, len(manifest.Notes), 3, "note count mismatch")
+
+		assert.Equal(t, manifest.Notes[0].UUID, n1.UUID, "n1 uuid mismatch")
+		assert.Equal(t, manifest.Notes[0].Path, n1Path, "n1 path mismatch")
+		assert.Equal(t, manifest.Notes[0].Public, true, "n1 public mismatch")
+		assert.DeepEqual(t, manifest.Notes[0].Tags, []string{"go"}, "n1 tags mismatch")
+		assert.Equal(t, manifest.Notes[1].UUID, n2.UUID, "n2 uuid mismatch")
+		assert.Equal(t, manifest.Notes[1].BookUUID, b2.UUID, "n2 book_uuid mismatch")
+		assert.Equal(t, manifest.Notes[2].UUID, n3.UUID, "n3 uuid mismatch")
+		assert.Equal(t, manifest.Notes[2].Encrypted, true, "n3 encrypted mismatch")
+	})
+
+	t.Run("more notes than a page", func(t *testing.T) {
+		// Set up
+		defer models.ClearTestData(t, models.TestServices.DB)
+
+		user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+
+		b1 := models.Book{
+			UserID: user.ID,
+			Name:   "js",
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+
+		// Notes with the same added_on are paginated by their ids
+		noteCount := exportPageSize + 1
+		for i := 0; i < noteCount; i++ {
+			n := models.Note{
+				UserID:   user.ID,
+				BookUUID: b1.UUID,
+				Body:     "note",
+				AddedOn:  1,
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&n), "preparing note")
+		}
+
+		exportsC := NewExports(models.TestServices.Note, models.TestServices.Book, clock.NewMock())
+
+		// Execute
+		req := newReq(t, "GET", "/api/v1/export", "")
+		w := httpDo(t, exportsC.V1Export, req, &user)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+		assert.Equal(t, w.Header().Get("Content-Length"), strconv.Itoa(w.Body.Len()), "content length mismatch")
+
+		files := readExport(t, w.Body.Bytes())
+		assert.Equal(t, len(files), noteCount+1, "file count mismatch")
+
+		var manifest exportManifest
+		if err := json.Unmarshal([]byte(files[exportManifestName]), &manifest); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding the manifest"))
+		}
+		assert.Equal(t, len(manifest.Notes), noteCount, "note count mismatch")
+	})
+
+	t.Run("failure after the first page", func(t *testing.T) {
+		// Set up
+		defer models.ClearTestData(t, models.TestServices.DB)
+
+		user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+
+		b1 := models.Book{
+			UserID: user.ID,
+			Name:   "js",
+		}
+		models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+
+		for i := 0; i < exportPageSize+1; i++ {
+			n := models.Note{
+				UserID:   user.ID,
+				BookUUID: b1.UUID,
+				Body:     "note",
+				AddedOn:  1,
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&n), "preparing note")
+		}
+
+		exportsC := NewExports(failingNoteService{models.TestServices.Note}, models.TestServices.Book, clock.NewMock())
+
+		// Execute
+		req := newReq(t, "GET", "/api/v1/export", "")
+		w := httpDo(t, exportsC.V1Export, req, &user)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusInternalServerError, "status code mismatch")
+		assert.NotEqual(t, w.Header().Get("Content-Type"), "application/zip", "content type mismatch")
+		assert.Equal(t, w.Header().Get("Content-Disposition"), "", "content disposition mismatch")
+	})
+
+	t.Run("without notes", func(t *testing.T) {
+		// Set up
+		defer models.ClearTestData(t, models.TestServices.DB)
+
+		user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+
+		exportsC := NewExports(models.TestServices.Note, models.TestServices.Book, clock.NewMock())
+
+		// Execute
+		req := newReq(t, "GET", "/api/v1/export", "")
+		w := httpDo(t, exportsC.V1Export, req, &user)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		files := readExport(t, w.Body.Bytes())
+		assert.Equal(t, len(files), 1, "file count mismatch")
+
+		var manifest exportManifest
+		if err := json.Unmarshal([]byte(files[exportManifestName]), &manifest); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding the manifest"))
+		}
+		assert.Equal(t, len(manifest.Books), 0, "book count mismatch")
+		assert.Equal(t, len(manifest.Notes), 0, "note count mismatch")
+	})
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// readyTimeout is how long to wait for the database to respond in the readiness check
+const readyTimeout = 2 * time.Second
+
+// NewHealth creates a new Health controller.
+func NewHealth(db *gorm.DB) *Health {
+	return &Health{
+		db: db,
+	}
+}
+
+// Health is a controller for the health checks
+type Health struct {
+	db *gorm.DB
+}
+
+// HealthResp is the response of a health check
+type HealthResp struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Healthz handles GET /healthz. It responds with OK as long as the server is
+// running, for a liveness probe.
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, HealthResp{Status: "ok"})
+}
+
+// Readyz handles GET /readyz. It responds with OK if the database is
+// reachable, for a readiness probe.
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	if err := h.db.DB().PingContext(ctx); err != nil {
+		logError(err, "pinging database")
+		respondJSON(w, http.StatusServiceUnavailable, HealthResp{Status: "unavailable", Error: "database is unreachable"})
+		return
+	}
+
+	respondJSON(w, http.StatusOK, HealthResp{Status: "ok"})
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/pkg/errors"
+)
+
+func TestHealthz(t *testing.T) {
+	healthC := NewHealth(models.TestServices.DB)
+
+	req := newReq(t, "GET", "/healthz", "")
+	w := httpDo(t, healthC.Healthz, req, nil)
+
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+}
+
+func TestReadyz(t *testing.T) {
+	healthC := NewHealth(models.TestServices.DB)
+
+	req := newReq(t, "GET", "/readyz", "")
+	w := httpDo(t, healthC.Readyz, req, nil)
+
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	var payload HealthResp
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding payload"))
+	}
+	assert.Equal(t, payload.Status, "ok", "status mismatch")
+}
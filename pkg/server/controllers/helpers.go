@@ -2,12 +2,15 @@ package controllers
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/schema"
+	"github.com/nadproject/nad/pkg/server/context"
 	"github.com/nadproject/nad/pkg/server/log"
 	"github.com/nadproject/nad/pkg/server/models"
 	"github.com/nadproject/nad/pkg/server/views"
@@ -65,6 +68,64 @@ func parseValues(values url.Values, dst interface{}) error {
 	return nil
 }
 
+// isChecked checks if the checkbox with the given name is checked in the
+// submitted form. A checkbox is paired with a hidden input of "false", which is
+// submitted alone if the checkbox is unchecked.
+func isChecked(r *http.Request, name string) bool {
+	if err := r.ParseForm(); err != nil {
+		return false
+	}
+
+	for _, v := range r.PostForm[name] {
+		if v == "true" {
+			return true
+		}
+	}
+
+	return false
+}
+
+const (
+	defaultPerPage = 30
+	maxPerPage     = 100
+)
+
+// parsePagination parses the 1-based page number and the number of items per page
+// from the given query params, falling back to the defaults if absent.
+func parsePagination(q url.Values) (page, perPage int, err error) {
+	page = 1
+
+	if s := q.Get("page"); s != "" {
+		page, err = strconv.Atoi(s)
+		if err != nil || page < 1 {
+			return 0, 0, models.ErrPageInvalid
+		}
+	}
+
+	perPage, err = parsePerPage(q)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return page, perPage, nil
+}
+
+// parsePerPage parses the number of items per page from the given query params,
+// falling back to the default if absent.
+func parsePerPage(q url.Values) (int, error) {
+	s := q.Get("per_page")
+	if s == "" {
+		return defaultPerPage, nil
+	}
+
+	perPage, err := strconv.Atoi(s)
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		return 0, models.ErrPerPageInvalid
+	}
+
+	return perPage, nil
+}
+
 func parseJSON(r *http.Request, dst interface{}) error {
 	dec := json.NewDecoder(r.Body)
 
@@ -95,6 +156,72 @@ func GetCredential(r *http.Request) (string, error) {
 	return ret, nil
 }
 
+// remoteIP returns the IP address of the peer that made the request
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func isTrustedProxy(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, n := range trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResolveIP returns the IP address of the client that made the request. The
+// X-Forwarded-For and X-Real-IP headers are only used if the request was made
+// by one of the trusted proxies, or through a Unix socket, because anyone else
+// can set them. In X-Forwarded-For, the rightmost address that is not a trusted
+// proxy is the client, since the addresses on its left are not verified by any proxy.
+func ResolveIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	ip := remoteIP(r)
+	viaSocket := net.ParseIP(ip) == nil
+	if !viaSocket && !isTrustedProxy(ip, trustedProxies) {
+		return ip
+	}
+
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		parts := strings.Split(forwardedFor, ",")
+		for i := len(parts) - 1; i >= 0; i-- {
+			ip = strings.TrimSpace(parts[i])
+			if !isTrustedProxy(ip, trustedProxies) {
+				break
+			}
+		}
+
+		return ip
+	}
+
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+
+	return ip
+}
+
+// LookupIP returns the request's IP, which is resolved by the middleware from
+// the trusted proxies. If it has not been resolved, it returns the IP of the peer.
+func LookupIP(r *http.Request) string {
+	if ip := context.ClientIP(r.Context()); ip != "" {
+		return ip
+	}
+
+	return remoteIP(r)
+}
+
 // getSessionKeyFromCookie reads and returns a session key from the cookie sent by the
 // request. If no session key is found, it returns an empty string
 func getSessionKeyFromCookie(r *http.Request) (string, error) {
@@ -192,6 +319,10 @@ func getErrStatusCode(err error) int {
 		return http.StatusBadRequest
 	case views.ConflictError:
 		return http.StatusConflict
+	case views.NotFoundError:
+		return http.StatusNotFound
+	case views.TooManyRequestsError:
+		return http.StatusTooManyRequests
 	default:
 		return http.StatusInternalServerError
 	}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestResolveIP(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	trustedProxies := []*net.IPNet{loopback, private}
+
+	testCases := []struct {
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		expectedIP   string
+	}{
+		{
+			remoteAddr: "203.0.113.1:5000",
+			expectedIP: "203.0.113.1",
+		},
+		// the headers from an untrusted peer are ignored
+		{
+			remoteAddr:   "203.0.113.1:5000",
+			forwardedFor: "198.51.100.1",
+			realIP:       "198.51.100.2",
+			expectedIP:   "203.0.113.1",
+		},
+		{
+			remoteAddr:   "127.0.0.1:5000",
+			forwardedFor: "198.51.100.1",
+			expectedIP:   "198.51.100.1",
+		},
+		{
+			remoteAddr: "127.0.0.1:5000",
+			realIP:     "198.51.100.2",
+			expectedIP: "198.51.100.2",
+		},
+		// the addresses set by the client before the trusted proxies are ignored
+		{
+			remoteAddr:   "127.0.0.1:5000",
+			forwardedFor: "192.0.2.1, 198.51.100.1, 10.0.0.2",
+			expectedIP:   "198.51.100.1",
+		},
+		// requests through a Unix socket come from a proxy on the same machine
+		{
+			remoteAddr:   "@",
+			forwardedFor: "198.51.100.1",
+			expectedIP:   "198.51.100.1",
+		},
+		// all proxies are trusted
+		{
+			remoteAddr:   "127.0.0.1:5000",
+			forwardedFor: "10.0.0.3, 10.0.0.2",
+			expectedIP:   "10.0.0.3",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			if tc.realIP != "" {
+				req.Header.Set("X-Real-IP", tc.realIP)
+			}
+
+			assert.Equal(t, ResolveIP(req, trustedProxies), tc.expectedIP, "ip mismatch")
+		})
+	}
+}
+
+func TestIsChecked(t *testing.T) {
+	testCases := []struct {
+		values   []string
+		expected bool
+	}{
+		{
+			values:   nil,
+			expected: false,
+		},
+		{
+			values:   []string{"false"},
+			expected: false,
+		},
+		{
+			values:   []string{"false", "true"},
+			expected: true,
+		},
+		{
+			values:   []string{"true"},
+			expected: true,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			req := newFormReq(t, "POST", "/", url.Values{"public": tc.values})
+
+			assert.Equal(t, isChecked(req, "public"), tc.expected, "checked mismatch")
+		})
+	}
+}
@@ -1,7 +1,14 @@
 package controllers
 
 import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
@@ -16,52 +23,705 @@ import (
 )
 
 // NewNotes creates a new Notes controller.
-func NewNotes(cfg config.Config, ns models.NoteService, us models.UserService, c clock.Clock, db *gorm.DB) *Notes {
+func NewNotes(cfg config.Config, ns models.NoteService, nrs models.NoteRevisionService, ts models.TagService, bs models.BookService, us models.UserService, c clock.Clock, db *gorm.DB) *Notes {
 	return &Notes{
-		IndexView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "", Layout: "base", HeaderTemplate: "navbar"}, "notes/index"),
-		c:         c,
-		ns:        ns,
-		us:        us,
-		db:        db,
+		IndexView:  views.NewView(cfg.PageTemplateDir, views.Config{Title: "", Layout: "base", HeaderTemplate: "navbar"}, "notes/index", "notes/list"),
+		SearchView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "Search", Layout: "base", HeaderTemplate: "navbar"}, "notes/search"),
+		ShowView:   views.NewView(cfg.PageTemplateDir, views.Config{Title: "Note", Layout: "base", HeaderTemplate: "navbar"}, "notes/show"),
+		NewView:    views.NewView(cfg.PageTemplateDir, views.Config{Title: "New note", Layout: "base", HeaderTemplate: "navbar"}, "notes/new", "notes/form"),
+		EditView:   views.NewView(cfg.PageTemplateDir, views.Config{Title: "Edit note", Layout: "base", HeaderTemplate: "navbar"}, "notes/edit", "notes/form"),
+		c:          c,
+		ns:         ns,
+		nrs:        nrs,
+		ts:         ts,
+		bs:         bs,
+		us:         us,
+		db:         db,
+		webURL:     cfg.WebURL,
 	}
 }
 
 // Notes is a static controller
 type Notes struct {
-	IndexView *views.View
-	c         clock.Clock
-	ns        models.NoteService
-	us        models.UserService
-	db        *gorm.DB
+	IndexView  *views.View
+	SearchView *views.View
+	ShowView   *views.View
+	NewView    *views.View
+	EditView   *views.View
+	c          clock.Clock
+	ns         models.NoteService
+	nrs        models.NoteRevisionService
+	ts         models.TagService
+	bs         models.BookService
+	us         models.UserService
+	db         *gorm.DB
+	webURL     string
+}
+
+// noteItem is a note in a list of notes on the web
+type noteItem struct {
+	UUID      string
+	Title     string
+	BookLabel string
+	EditedOn  string
+	Public    bool
+	Encrypted bool
+	// Body is the Markdown content of the note, which is empty if it is encrypted
+	Body string
+}
+
+// newNoteItems returns the items for the given notes, using the given book labels
+func newNoteItems(notes []presenters.Note, bookLabels map[string]string) []noteItem {
+	var ret []noteItem
+	for _, note := range notes {
+		item := noteItem{
+			UUID:      note.UUID,
+			Title:     getNoteTitle(note.Body),
+			BookLabel: bookLabels[note.Book.UUID],
+			EditedOn:  time.Unix(0, note.EditedOn).UTC().Format("Jan 2, 2006"),
+			Public:    note.Public,
+			Encrypted: note.Encrypted,
+		}
+		if note.Encrypted {
+			item.Title = "Encrypted note"
+		} else {
+			item.Body = note.Body
+		}
+
+		ret = append(ret, item)
+	}
+
+	return ret
+}
+
+// getNextPageURL returns the URL of the page after the given list of notes, if any,
+// by setting the cursor in the query params of the current page
+func getNextPageURL(path string, q url.Values, resp ListNotesResp) string {
+	if resp.NextCursor == "" {
+		return ""
+	}
+
+	next := url.Values{}
+	for k, v := range q {
+		next[k] = v
+	}
+	next.Set("cursor", resp.NextCursor)
+
+	return path + "?" + next.Encode()
+}
+
+// notesIndexData is the data for the page listing the notes
+type notesIndexData struct {
+	Notes []noteItem
+	// NextURL is the URL of the next page, if any
+	NextURL string
+}
+
+func (n *Notes) getIndexData(r *http.Request, userID uint) (notesIndexData, error) {
+	resp, err := n.list(r)
+	if err != nil {
+		return notesIndexData{}, err
+	}
+
+	books, err := n.bs.Search(models.BookSearchParams{UserID: userID})
+	if err != nil {
+		return notesIndexData{}, errors.Wrap(err, "getting books")
+	}
+
+	ret := notesIndexData{
+		Notes:   newNoteItems(resp.Notes, getBookLabels(books)),
+		NextURL: getNextPageURL("/", r.URL.Query(), resp),
+	}
+
+	return ret, nil
 }
 
 // Index handles GET /
 func (n *Notes) Index(w http.ResponseWriter, r *http.Request) {
 	user := context.User(r.Context())
-	notes, err := n.ns.Search(user.ID)
 
 	var vd views.Data
-	vd.Yield = struct {
-		Notes []models.Note
-	}{
-		Notes: notes,
+	data, err := n.getIndexData(r, user.ID)
+	vd.Yield = data
+	if err != nil {
+		handleHTMLError(w, err, "getting notes", &vd)
+	}
+
+	n.IndexView.Render(w, r, vd)
+}
+
+// highlightHeadline returns the HTML of the given headline of a search result,
+// with the matching terms marked
+func highlightHeadline(headline string) template.HTML {
+	s := template.HTMLEscapeString(headline)
+	s = strings.Replace(s, template.HTMLEscapeString(models.HeadlineStartSel), "<mark>", -1)
+	s = strings.Replace(s, template.HTMLEscapeString(models.HeadlineStopSel), "</mark>", -1)
+
+	return template.HTML(s)
+}
+
+// noteSearchItem is a result in the page of the note search
+type noteSearchItem struct {
+	UUID      string
+	Title     string
+	BookLabel string
+	Headline  template.HTML
+}
+
+// noteSearchData is the data for the page of the note search
+type noteSearchData struct {
+	Query    string
+	BookUUID string
+	Books    []bookOption
+	Results  []noteSearchItem
+	Total    int
+	// PrevURL and NextURL are the URLs of the previous and the next pages, if any
+	PrevURL string
+	NextURL string
+}
+
+// getSearchPageURL returns the URL of the given page of the note search with the given query params
+func getSearchPageURL(q url.Values, page int) string {
+	ret := url.Values{}
+	for k, v := range q {
+		ret[k] = v
+	}
+	ret.Set("page", strconv.Itoa(page))
+
+	return "/search?" + ret.Encode()
+}
+
+func (n *Notes) getSearchData(r *http.Request, userID uint) (noteSearchData, error) {
+	q := r.URL.Query()
+	// The form submits an empty book to search all books
+	if q.Get("book") == "" {
+		q.Del("book")
+	}
+
+	ret := noteSearchData{
+		Query:    q.Get("q"),
+		BookUUID: q.Get("book"),
+	}
+
+	books, err := n.bs.Search(models.BookSearchParams{UserID: userID})
+	if err != nil {
+		return ret, errors.Wrap(err, "getting books")
+	}
+	labels := getBookLabels(books)
+
+	if ret.Books, err = getBookOptions(n.bs, userID); err != nil {
+		return ret, err
+	}
+
+	if strings.TrimSpace(ret.Query) == "" {
+		return ret, nil
+	}
+
+	resp, err := searchNotes(n.ns, userID, q)
+	if err != nil {
+		return ret, err
+	}
+
+	for _, result := range resp.Notes {
+		ret.Results = append(ret.Results, noteSearchItem{
+			UUID:      result.UUID,
+			Title:     getNoteTitle(result.Body),
+			BookLabel: labels[result.Book.UUID],
+			Headline:  highlightHeadline(result.Headline),
+		})
+	}
+	ret.Total = resp.Total
+
+	if resp.Page > 1 {
+		ret.PrevURL = getSearchPageURL(q, resp.Page-1)
+	}
+	if resp.Page*resp.PerPage < resp.Total {
+		ret.NextURL = getSearchPageURL(q, resp.Page+1)
+	}
+
+	return ret, nil
+}
+
+// Search handles GET /search. It searches the notes with the full-text search
+// if a query is given.
+func (n *Notes) Search(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var vd views.Data
+	data, err := n.getSearchData(r, user.ID)
+	vd.Yield = data
+	if err != nil {
+		handleHTMLError(w, err, "searching notes", &vd)
 	}
 
+	n.SearchView.Render(w, r, vd)
+}
+
+// noteFormData is the data for the form to create or edit a note
+type noteFormData struct {
+	// UUID is the uuid of the note being edited, and is empty for a new note
+	UUID     string
+	BookUUID string
+	Content  string
+	Public   bool
+	Books    []bookOption
+}
+
+// renderForm renders the given view of the note form for the given user
+func (n *Notes) renderForm(w http.ResponseWriter, r *http.Request, v *views.View, userID uint, vd views.Data, data noteFormData) {
+	books, err := getBookOptions(n.bs, userID)
 	if err != nil {
-		handleHTMLError(w, err, "getting notes", &vd)
-		n.IndexView.Render(w, r, vd)
+		handleHTMLError(w, err, "getting books", &vd)
+	}
+	data.Books = books
+
+	vd.Yield = data
+	v.Render(w, r, vd)
+}
+
+// getEditableNote returns the note with the given uuid if the user can edit it on the web
+func (n *Notes) getEditableNote(userID uint, noteUUID string) (*models.Note, error) {
+	note, err := n.ns.ActiveByUUID(noteUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting note")
+	}
+
+	if ok := permissions.UpdateNote(userID, *note); !ok {
+		return nil, models.ErrNotFound
+	}
+	if note.Encrypted {
+		return nil, models.ErrEncryptedWebEdit
+	}
+
+	return note, nil
+}
+
+// redirectNotesAlert redirects to the page listing the notes with an alert for the given error
+func redirectNotesAlert(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	logError(err, msg)
+
+	var vd views.Data
+	vd.SetAlert(err)
+	views.RedirectAlert(w, r, "/", http.StatusFound, *vd.Alert)
+}
+
+// New handles GET /notes/new
+func (n *Notes) New(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	data := noteFormData{
+		BookUUID: r.URL.Query().Get("book"),
+	}
+	n.renderForm(w, r, n.NewView, user.ID, views.Data{}, data)
+}
+
+// Create handles POST /notes
+func (n *Notes) Create(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	note, err := n.create(r)
+	if err != nil {
+		var vd views.Data
+		handleHTMLError(w, err, "creating note", &vd)
+
+		data := noteFormData{
+			BookUUID: r.PostFormValue("book_uuid"),
+			Content:  r.PostFormValue("content"),
+			Public:   isChecked(r, "public"),
+		}
+		n.renderForm(w, r, n.NewView, user.ID, vd, data)
 		return
 	}
 
-	n.IndexView.Render(w, r, vd)
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The note has been created.",
+	}
+	views.RedirectAlert(w, r, fmt.Sprintf("/notes/%s", note.UUID), http.StatusFound, alert)
+}
+
+// Edit handles GET /notes/:uuid/edit
+func (n *Notes) Edit(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	note, err := n.getEditableNote(user.ID, mux.Vars(r)["noteUUID"])
+	if err != nil {
+		redirectNotesAlert(w, r, err, "getting note")
+		return
+	}
+
+	data := noteFormData{
+		UUID:     note.UUID,
+		BookUUID: note.BookUUID,
+		Content:  note.Body,
+		Public:   note.Public,
+	}
+	n.renderForm(w, r, n.EditView, user.ID, views.Data{}, data)
+}
+
+// Update handles POST /notes/:uuid
+func (n *Notes) Update(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	noteUUID := mux.Vars(r)["noteUUID"]
+
+	if _, err := n.getEditableNote(user.ID, noteUUID); err != nil {
+		redirectNotesAlert(w, r, err, "getting note")
+		return
+	}
+
+	if _, err := n.update(r); err != nil {
+		var vd views.Data
+		handleHTMLError(w, err, "updating note", &vd)
+
+		data := noteFormData{
+			UUID:     noteUUID,
+			BookUUID: r.PostFormValue("book_uuid"),
+			Content:  r.PostFormValue("content"),
+			Public:   isChecked(r, "public"),
+		}
+		n.renderForm(w, r, n.EditView, user.ID, vd, data)
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The note has been saved.",
+	}
+	views.RedirectAlert(w, r, fmt.Sprintf("/notes/%s", noteUUID), http.StatusFound, alert)
+}
+
+// Delete handles POST /notes/:uuid/delete
+func (n *Notes) Delete(w http.ResponseWriter, r *http.Request) {
+	if _, err := n.remove(r); err != nil {
+		redirectNotesAlert(w, r, err, "deleting note")
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The note has been deleted.",
+	}
+	views.RedirectAlert(w, r, "/", http.StatusFound, alert)
+}
+
+const (
+	// noteTitleMaxLen is the maximum number of characters in the title of a shared note
+	noteTitleMaxLen = 80
+	// noteDescriptionMaxLen is the maximum number of characters in the description of a shared note
+	noteDescriptionMaxLen = 200
+)
+
+// truncate shortens the given string to the given number of characters
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+
+	return strings.TrimSpace(string(r[:max-1])) + "…"
+}
+
+// getNoteTitle returns the title of a note for the metadata, which is its first
+// non-empty line without the heading markers.
+func getNoteTitle(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "# "))
+		if line != "" {
+			return truncate(line, noteTitleMaxLen)
+		}
+	}
+
+	return "Note"
+}
+
+// getNoteDescription returns the description of a note for the metadata
+func getNoteDescription(body string) string {
+	return truncate(strings.Join(strings.Fields(body), " "), noteDescriptionMaxLen)
+}
+
+// noteShowData is the data for the page showing a note
+type noteShowData struct {
+	UUID        string
+	Title       string
+	Description string
+	URL         string
+	AddedOn     string
+	Body        string
+	// Editable is whether the viewer owns the note and can edit it
+	Editable bool
+}
+
+// Show handles GET /notes/:uuid. Anyone can view a public note, while only the
+// owner can view a private one.
+func (n *Notes) Show(w http.ResponseWriter, r *http.Request) {
+	var vd views.Data
+
+	var userID uint
+	if user := context.User(r.Context()); user != nil {
+		userID = user.ID
+	}
+
+	noteUUID := mux.Vars(r)["noteUUID"]
+	note, err := n.ns.ActiveByUUID(noteUUID)
+	if err != nil {
+		handleHTMLError(w, err, "getting note", &vd)
+		n.ShowView.Render(w, r, vd)
+		return
+	}
+
+	// Respond with not found if not allowed, so as not to reveal the existence of the note.
+	// Encrypted notes cannot be rendered because the server does not know the content.
+	if ok := permissions.ViewNote(userID, *note); !ok || note.Encrypted {
+		handleHTMLError(w, models.ErrNotFound, "checking permission", &vd)
+		n.ShowView.Render(w, r, vd)
+		return
+	}
+
+	vd.Yield = noteShowData{
+		UUID:        note.UUID,
+		Title:       getNoteTitle(note.Body),
+		Description: getNoteDescription(note.Body),
+		URL:         fmt.Sprintf("%s/notes/%s", n.webURL, note.UUID),
+		AddedOn:     time.Unix(0, note.AddedOn).UTC().Format("Jan 2, 2006"),
+		Body:        note.Body,
+		Editable:    permissions.UpdateNote(userID, *note),
+	}
+
+	n.ShowView.Render(w, r, vd)
+}
+
+// SearchNotesResp is a response from the note search endpoint
+type SearchNotesResp struct {
+	Notes   []presenters.NoteSearchResult `json:"notes"`
+	Total   int                           `json:"total"`
+	Page    int                           `json:"page"`
+	PerPage int                           `json:"per_page"`
+}
+
+func (n *Notes) search(r *http.Request) (SearchNotesResp, error) {
+	user := context.User(r.Context())
+
+	return searchNotes(n.ns, user.ID, r.URL.Query())
+}
+
+// searchNotes searches the notes of the user with the given id, using the query,
+// the filters and the pagination in the given query params
+func searchNotes(ns models.NoteService, userID uint, q url.Values) (SearchNotesResp, error) {
+	page, perPage, err := parsePagination(q)
+	if err != nil {
+		return SearchNotesResp{}, errors.Wrap(err, "parsing pagination")
+	}
+
+	p := models.NoteSearchParams{
+		UserID:    userID,
+		Query:     q.Get("q"),
+		BookUUIDs: q["book"],
+		Tags:      q["tag"],
+		Offset:    (page - 1) * perPage,
+		Limit:     perPage,
+	}
+	results, total, err := ns.FullTextSearch(p)
+	if err != nil {
+		return SearchNotesResp{}, errors.Wrap(err, "searching notes")
+	}
+
+	resp := SearchNotesResp{
+		Notes:   presenters.PresentNoteSearchResults(results),
+		Total:   total,
+		Page:    page,
+		PerPage: perPage,
+	}
+
+	return resp, nil
+}
+
+// ListNotesResp is a response from the note listing endpoint
+type ListNotesResp struct {
+	Notes      []presenters.Note `json:"notes"`
+	NextCursor string            `json:"next_cursor"`
+}
+
+// encodeNoteCursor encodes the given cursor into an opaque string
+func encodeNoteCursor(c models.NoteCursor) string {
+	s := fmt.Sprintf("%d:%d", c.Value, c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// decodeNoteCursor decodes the cursor encoded by encodeNoteCursor
+func decodeNoteCursor(s string) (models.NoteCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return models.NoteCursor{}, models.ErrCursorInvalid
+	}
+
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 2 {
+		return models.NoteCursor{}, models.ErrCursorInvalid
+	}
+
+	val, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return models.NoteCursor{}, models.ErrCursorInvalid
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return models.NoteCursor{}, models.ErrCursorInvalid
+	}
+
+	return models.NoteCursor{Value: val, ID: uint(id)}, nil
+}
+
+// parseTimeParam parses a time from the query param with the given key and
+// returns it in unix nanoseconds, which is the unit of added_on and edited_on.
+// It accepts either an RFC 3339 timestamp or an integer in unix nanoseconds.
+func parseTimeParam(q url.Values, key string) (int64, error) {
+	s := q.Get(key)
+	if s == "" {
+		return 0, nil
+	}
+
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ts, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, errors.Wrapf(models.ErrTimeInvalid, "parsing %s", key)
+	}
+
+	return t.UnixNano(), nil
+}
+
+func parseListNotesQuery(q url.Values) (models.NoteListParams, error) {
+	var p models.NoteListParams
+	var err error
+
+	p.BookUUIDs = q["book"]
+	p.Tags = q["tag"]
+
+	if p.AddedAfter, err = parseTimeParam(q, "added_after"); err != nil {
+		return p, err
+	}
+	if p.AddedBefore, err = parseTimeParam(q, "added_before"); err != nil {
+		return p, err
+	}
+	if p.EditedAfter, err = parseTimeParam(q, "edited_after"); err != nil {
+		return p, err
+	}
+	if p.EditedBefore, err = parseTimeParam(q, "edited_before"); err != nil {
+		return p, err
+	}
+
+	if s := q.Get("public"); s != "" {
+		public, err := strconv.ParseBool(s)
+		if err != nil {
+			return p, models.ErrPublicInvalid
+		}
+
+		p.Public = &public
+	}
+
+	// The sort field can be prefixed with '-' to sort in descending order
+	sort := q.Get("sort")
+	if sort == "" {
+		sort = "-" + models.NoteSortAddedOn
+	}
+	if strings.HasPrefix(sort, "-") {
+		p.Descending = true
+		sort = strings.TrimPrefix(sort, "-")
+	}
+	p.SortBy = sort
+
+	if s := q.Get("cursor"); s != "" {
+		c, err := decodeNoteCursor(s)
+		if err != nil {
+			return p, err
+		}
+
+		p.Cursor = &c
+	}
+
+	return p, nil
+}
+
+func (n *Notes) list(r *http.Request) (ListNotesResp, error) {
+	user := context.User(r.Context())
+
+	return listNotes(n.ns, user.ID, r.URL.Query())
+}
+
+// listNotes lists a page of the notes of the user with the given id, using the
+// filters and the pagination in the given query params
+func listNotes(ns models.NoteService, userID uint, q url.Values) (ListNotesResp, error) {
+	perPage, err := parsePerPage(q)
+	if err != nil {
+		return ListNotesResp{}, errors.Wrap(err, "parsing per_page")
+	}
+
+	p, err := parseListNotesQuery(q)
+	if err != nil {
+		return ListNotesResp{}, errors.Wrap(err, "parsing query params")
+	}
+	p.UserID = userID
+	// Fetch one more note than requested to know if there is a next page
+	p.Limit = perPage + 1
+
+	notes, err := ns.List(p)
+	if err != nil {
+		return ListNotesResp{}, errors.Wrap(err, "listing notes")
+	}
+
+	var nextCursor string
+	if len(notes) > perPage {
+		notes = notes[:perPage]
+
+		last := notes[len(notes)-1]
+		nextCursor = encodeNoteCursor(models.NoteCursor{
+			Value: last.SortValue(p.SortBy),
+			ID:    last.ID,
+		})
+	}
+
+	resp := ListNotesResp{
+		Notes:      presenters.PresentNotes(notes),
+		NextCursor: nextCursor,
+	}
+
+	return resp, nil
+}
+
+// V1Index handles GET /api/v1/notes. If a search query is given, it responds with
+// the full-text search results. Otherwise it lists the notes.
+func (n *Notes) V1Index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("q") != "" {
+		resp, err := n.search(r)
+		if err != nil {
+			handleJSONError(w, err, "searching notes")
+			return
+		}
+
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp, err := n.list(r)
+	if err != nil {
+		handleJSONError(w, err, "listing notes")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
 }
 
 // NoteForm is the form data for a note
 type NoteForm struct {
-	BookUUID *string `schema:"book_uuid" json:"book_uuid"`
-	Content  *string `schema:"content" json:"content"`
-	AddedOn  *int64  `schema:"added_on" json:"added_on"`
-	EditedOn *int64  `schema:"edited_on" json:"edited_on"`
+	BookUUID  *string   `schema:"book_uuid" json:"book_uuid"`
+	Content   *string   `schema:"content" json:"content"`
+	AddedOn   *int64    `schema:"added_on" json:"added_on"`
+	EditedOn  *int64    `schema:"edited_on" json:"edited_on"`
+	Public    *bool     `schema:"public" json:"public"`
+	Encrypted *bool     `schema:"encrypted" json:"encrypted"`
+	Tags      *[]string `schema:"tags" json:"tags"`
 }
 
 // GetBookUUID gets the bookUUID from the NoteForm
@@ -100,6 +760,20 @@ func (r NoteForm) GetEditedOn() int64 {
 	return *r.EditedOn
 }
 
+// setTags replaces the tags of the given note with the tags of the given names
+func (n *Notes) setTags(tx *gorm.DB, note *models.Note, names []string) error {
+	tags, err := n.ts.FindOrCreate(note.UserID, names, tx)
+	if err != nil {
+		return errors.Wrap(err, "finding tags")
+	}
+
+	if err := n.ns.SetTags(note, tags, tx); err != nil {
+		return errors.Wrap(err, "setting tags")
+	}
+
+	return nil
+}
+
 func (n *Notes) create(r *http.Request) (models.Note, error) {
 	var form NoteForm
 	if err := parseRequestData(r, &form); err != nil {
@@ -124,17 +798,24 @@ func (n *Notes) create(r *http.Request) (models.Note, error) {
 	}
 
 	note := models.Note{
-		UserID:   user.ID,
-		USN:      nextUSN,
-		BookUUID: form.GetBookUUID(),
-		AddedOn:  form.GetAddedOn(),
-		EditedOn: form.GetEditedOn(),
-		Body:     form.GetContent(),
+		UserID:    user.ID,
+		USN:       nextUSN,
+		BookUUID:  form.GetBookUUID(),
+		AddedOn:   form.GetAddedOn(),
+		EditedOn:  form.GetEditedOn(),
+		Body:      form.GetContent(),
+		Encrypted: form.Encrypted != nil && *form.Encrypted,
 	}
 	if err := n.ns.Create(&note, tx); err != nil {
 		tx.Rollback()
 		return note, errors.Wrap(err, "inserting note")
 	}
+	if form.Tags != nil {
+		if err := n.setTags(tx, &note, *form.Tags); err != nil {
+			tx.Rollback()
+			return note, err
+		}
+	}
 
 	tx.Commit()
 
@@ -167,11 +848,13 @@ func (n *Notes) update(r *http.Request) (models.Note, error) {
 
 	note, err := n.ns.ByUUID(noteUUID)
 	if err != nil {
+		tx.Rollback()
 		return models.Note{}, errors.Wrap(err, "getting note")
 	}
 
 	// Check for permission. If not allowed, respond with not found.
 	if ok := permissions.UpdateNote(user.ID, *note); !ok {
+		tx.Rollback()
 		return models.Note{}, models.ErrNotFound
 	}
 
@@ -181,12 +864,34 @@ func (n *Notes) update(r *http.Request) (models.Note, error) {
 		return models.Note{}, errors.Wrap(err, "incrementing user max_usn")
 	}
 
+	// Once a note becomes encrypted, drop the plaintext revisions instead of keeping
+	// the content being overwritten.
+	if form.Encrypted != nil && *form.Encrypted && !note.Encrypted {
+		if err := n.nrs.DeleteByNoteID(note.ID, tx); err != nil {
+			tx.Rollback()
+			return models.Note{}, errors.Wrap(err, "deleting note revisions")
+		}
+	} else if form.Content != nil && form.GetContent() != note.Body {
+		// Keep the content being overwritten so that it can be restored later
+		revision := models.NewNoteRevision(*note)
+		if err := n.nrs.Create(&revision, tx); err != nil {
+			tx.Rollback()
+			return models.Note{}, errors.Wrap(err, "creating note revision")
+		}
+	}
+
 	if form.BookUUID != nil {
 		note.BookUUID = form.GetBookUUID()
 	}
 	if form.Content != nil {
 		note.Body = form.GetContent()
 	}
+	if form.Public != nil {
+		note.Public = *form.Public
+	}
+	if form.Encrypted != nil {
+		note.Encrypted = *form.Encrypted
+	}
 	note.USN = nextUSN
 	note.EditedOn = n.c.Now().UnixNano()
 	note.Deleted = false
@@ -196,6 +901,12 @@ func (n *Notes) update(r *http.Request) (models.Note, error) {
 		tx.Rollback()
 		return models.Note{}, errors.Wrap(err, "updating")
 	}
+	if form.Tags != nil {
+		if err := n.setTags(tx, note, *form.Tags); err != nil {
+			tx.Rollback()
+			return models.Note{}, err
+		}
+	}
 
 	tx.Commit()
 
@@ -214,7 +925,9 @@ func (n *Notes) V1Update(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, resp)
 }
 
-func removeNote(tx *gorm.DB, userID uint, noteUUID string, ns models.NoteService, us models.UserService) error {
+// removeNote deletes the note with the given uuid. The content and the revisions
+// are dropped so that they cannot be read after the deletion.
+func removeNote(tx *gorm.DB, userID uint, noteUUID string, ns models.NoteService, nrs models.NoteRevisionService, us models.UserService) error {
 	note, err := ns.ByUUID(noteUUID)
 	if err != nil {
 		return errors.Wrap(err, "getting note")
@@ -230,6 +943,10 @@ func removeNote(tx *gorm.DB, userID uint, noteUUID string, ns models.NoteService
 		return errors.Wrap(err, "incrementing user max_usn")
 	}
 
+	if err := nrs.DeleteByNoteID(note.ID, tx); err != nil {
+		return errors.Wrap(err, "deleting note revisions")
+	}
+
 	note.USN = nextUSN
 	note.Deleted = true
 	note.Body = ""
@@ -249,7 +966,7 @@ func (n *Notes) remove(r *http.Request) (models.Note, error) {
 	user := context.User(r.Context())
 	tx := n.db.Begin()
 
-	if err := removeNote(tx, user.ID, noteUUID, n.ns, n.us); err != nil {
+	if err := removeNote(tx, user.ID, noteUUID, n.ns, n.nrs, n.us); err != nil {
 
 		tx.Rollback()
 		return models.Note{}, errors.Wrap(err, "removing note")
@@ -301,3 +1018,38 @@ func (n *Notes) V1Get(w http.ResponseWriter, r *http.Request) {
 	resp := presenters.PresentNote(note)
 	respondJSON(w, http.StatusOK, resp)
 }
+
+func (n *Notes) getRevisions(r *http.Request) ([]models.NoteRevision, error) {
+	user := context.User(r.Context())
+
+	vars := mux.Vars(r)
+	noteUUID := vars["noteUUID"]
+
+	note, err := n.ns.ActiveByUUID(noteUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting note")
+	}
+
+	if ok := permissions.ViewNoteRevisions(user.ID, *note); !ok {
+		return nil, models.ErrNotFound
+	}
+
+	revisions, err := n.nrs.ByNoteID(note.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting revisions")
+	}
+
+	return revisions, nil
+}
+
+// V1Revisions handles GET /api/v1/notes/:uuid/revisions
+func (n *Notes) V1Revisions(w http.ResponseWriter, r *http.Request) {
+	revisions, err := n.getRevisions(r)
+	if err != nil {
+		handleJSONError(w, err, "getting note revisions")
+		return
+	}
+
+	resp := presenters.PresentNoteRevisions(revisions)
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -10,6 +13,8 @@ import (
 	"github.com/nadproject/nad/pkg/clock"
 	"github.com/nadproject/nad/pkg/server/config"
 	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/presenters"
+	"github.com/pkg/errors"
 )
 
 func TestNotesV1Create(t *testing.T) {
@@ -22,7 +27,7 @@ func TestNotesV1Create(t *testing.T) {
 	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
 
 	// Test
-	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
 
 	b1 := models.Book{
 		UserID: user.ID,
@@ -61,6 +66,217 @@ func TestNotesV1Create(t *testing.T) {
 	assert.Equal(t, noteRecord.USN, 102, "note usn mismatch")
 }
 
+func TestNotesV1Create_tags(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	b1 := models.Book{
+		UserID: user.ID,
+		Name:   "js",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	existing := models.Tag{
+		UserID: user.ID,
+		Name:   "closure",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&existing), "preparing existing tag")
+
+	// Execute
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	dat := fmt.Sprintf(`{"book_uuid": "%s", "content": "note content", "tags": ["closure", "scope", "closure"]}`, b1.UUID)
+	req := newReq(t, "POST", "/v1/api/notes", dat)
+	w := httpDo(t, notesC.V1Create, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusCreated, "status code mismatch")
+
+	var payload presenters.Note
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding payload"))
+	}
+	assert.DeepEqual(t, payload.Tags, []string{"closure", "scope"}, "payload tags mismatch")
+
+	var tagCount int
+	var noteRecord models.Note
+	models.MustExec(t, models.TestServices.DB.Model(&models.Tag{}).Count(&tagCount), "counting tags")
+	models.MustExec(t, models.TestServices.DB.Preload("Tags").First(&noteRecord), "finding note")
+
+	assert.Equalf(t, tagCount, 2, "tag count mismatch")
+	assert.Equal(t, len(noteRecord.Tags), 2, "note tag count mismatch")
+
+	t.Run("invalid tag", func(t *testing.T) {
+		dat := fmt.Sprintf(`{"book_uuid": "%s", "content": "note content", "tags": ["full text"]}`, b1.UUID)
+		req := newReq(t, "POST", "/v1/api/notes", dat)
+		w := httpDo(t, notesC.V1Create, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+	})
+}
+
+func TestNotesV1Create_encrypted(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	b1 := models.Book{
+		UserID:    user.ID,
+		Name:      "b1 ciphertext",
+		Encrypted: true,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+
+	// Execute
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	dat := fmt.Sprintf(`{"book_uuid": "%s", "content": "n1 ciphertext", "encrypted": true}`, b1.UUID)
+	req := newReq(t, "POST", "/v1/api/notes", dat)
+	w := httpDo(t, notesC.V1Create, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusCreated, "status code mismatch")
+
+	var payload presenters.Note
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding payload"))
+	}
+	assert.Equal(t, payload.Encrypted, true, "payload encrypted mismatch")
+
+	var noteRecord models.Note
+	models.MustExec(t, models.TestServices.DB.First(&noteRecord), "finding note")
+	assert.Equal(t, noteRecord.Body, "n1 ciphertext", "note content mismatch")
+	assert.Equal(t, noteRecord.Encrypted, true, "note encrypted mismatch")
+
+	t.Run("public", func(t *testing.T) {
+		endpoint := fmt.Sprintf("/api/v1/notes/%s", noteRecord.UUID)
+		req := newReq(t, "PATCH", endpoint, `{"public": true}`)
+		req = mux.SetURLVars(req, map[string]string{"noteUUID": noteRecord.UUID})
+		w := httpDo(t, notesC.V1Update, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+
+		var record models.Note
+		models.MustExec(t, models.TestServices.DB.Where("uuid = ?", noteRecord.UUID).First(&record), "finding note")
+		assert.Equal(t, record.Public, false, "note public mismatch")
+	})
+}
+
+func TestNotesV1Update_encrypt(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	b1 := models.Book{
+		UserID: user.ID,
+		Name:   "js",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	note := models.Note{
+		UserID:   user.ID,
+		BookUUID: b1.UUID,
+		Body:     "plaintext content",
+		USN:      2,
+		AddedOn:  1542058875,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&note), "preparing note")
+	revision := models.NewNoteRevision(note)
+	revision.Body = "older plaintext content"
+	models.MustExec(t, models.TestServices.DB.Save(&revision), "preparing revision")
+
+	// Execute
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	endpoint := fmt.Sprintf("/api/v1/notes/%s", note.UUID)
+	req := newReq(t, "PATCH", endpoint, `{"content": "ciphertext", "encrypted": true}`)
+	req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
+	w := httpDo(t, notesC.V1Update, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	var noteRecord models.Note
+	models.MustExec(t, models.TestServices.DB.Where("uuid = ?", note.UUID).First(&noteRecord), "finding note")
+	assert.Equal(t, noteRecord.Body, "ciphertext", "note content mismatch")
+	assert.Equal(t, noteRecord.Encrypted, true, "note encrypted mismatch")
+
+	var revisionCount int
+	models.MustExec(t, models.TestServices.DB.Model(&models.NoteRevision{}).Count(&revisionCount), "counting revisions")
+	assert.Equal(t, revisionCount, 0, "plaintext revisions should be deleted")
+}
+
+func TestNotesV1Update_tags(t *testing.T) {
+	testCases := []struct {
+		payload      string
+		expectedTags []string
+	}{
+		{
+			payload:      `{"content": "updated content"}`,
+			expectedTags: []string{"closure", "scope"},
+		},
+		{
+			payload:      `{"tags": ["scope", "hoisting"]}`,
+			expectedTags: []string{"hoisting", "scope"},
+		},
+		{
+			payload:      `{"tags": []}`,
+			expectedTags: []string{},
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			b1 := models.Book{
+				UserID: user.ID,
+				Name:   "js",
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+			note := models.Note{
+				UserID:   user.ID,
+				BookUUID: b1.UUID,
+				Body:     "original content",
+				USN:      1,
+				AddedOn:  1579818739000000,
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&note), "preparing note")
+			tags, err := models.TestServices.Tag.FindOrCreate(user.ID, []string{"closure", "scope"}, nil)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "preparing tags"))
+			}
+			if err := models.TestServices.Note.SetTags(&note, tags, nil); err != nil {
+				t.Fatal(errors.Wrap(err, "preparing note tags"))
+			}
+
+			// Execute
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+			endpoint := fmt.Sprintf("/api/v1/notes/%s", note.UUID)
+			req := newReq(t, "PATCH", endpoint, tc.payload)
+			req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
+			w := httpDo(t, notesC.V1Update, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+			var tagRecords []models.Tag
+			models.MustExec(t, models.TestServices.DB.Model(&note).Order("name ASC").Related(&tagRecords, "Tags"), "finding note tags")
+			assert.DeepEqual(t, models.TagNames(tagRecords), tc.expectedTags, "tags mismatch")
+		})
+	}
+}
+
 func TestNotesV1Update(t *testing.T) {
 	updatedBody := "some updated content"
 
@@ -247,7 +463,7 @@ func TestNotesV1Update(t *testing.T) {
 			models.MustExec(t, models.TestServices.DB.Save(&note), "preparing note")
 
 			// Execute
-			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
 			endpoint := fmt.Sprintf("/v3/notes/%s", note.UUID)
 			req := newReq(t, "PATCH", endpoint, tc.payload)
 			req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
@@ -273,10 +489,21 @@ func TestNotesV1Update(t *testing.T) {
 			assert.Equal(t, noteRecord.UUID, tc.noteUUID, "note uuid mismatch for test case")
 			assert.Equal(t, noteRecord.Body, tc.expectedNoteBody, "note content mismatch for test case")
 			assert.Equal(t, noteRecord.BookUUID, tc.expectedNoteBookUUID, "note book_uuid mismatch for test case")
-			// TODO: implement public notes
-			// assert.Equal(t, noteRecord.Public, tc.expectedNotePublic, "note public mismatch for test case")
+			assert.Equal(t, noteRecord.Public, tc.expectedNotePublic, "note public mismatch for test case")
 			assert.Equal(t, noteRecord.USN, 102, "note usn mismatch for test case")
 
+			// A revision is kept only if the content is overwritten
+			var revisions []models.NoteRevision
+			models.MustExec(t, models.TestServices.DB.Where("note_id = ?", note.ID).Find(&revisions), "finding revisions")
+			if tc.expectedNoteBody != tc.noteBody {
+				assert.Equal(t, len(revisions), 1, "revision count mismatch")
+				assert.Equal(t, revisions[0].Body, tc.noteBody, "revision content mismatch")
+				assert.Equal(t, revisions[0].BookUUID, tc.noteBookUUID, "revision book_uuid mismatch")
+				assert.Equal(t, revisions[0].UserID, user.ID, "revision user_id mismatch")
+			} else {
+				assert.Equal(t, len(revisions), 0, "revision count mismatch")
+			}
+
 			assert.Equal(t, userRecord.MaxUSN, 102, "user max_usn mismatch for test case")
 		})
 	}
@@ -335,7 +562,7 @@ func TestNotesV1Delete(t *testing.T) {
 			models.MustExec(t, models.TestServices.DB.Save(&note), "preparing note")
 
 			// Execute
-			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
 
 			endpoint := fmt.Sprintf("/api/v1/notes/%s", note.UUID)
 			req := newReq(t, "POST", endpoint, "")
@@ -369,3 +596,980 @@ func TestNotesV1Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestNotesV1Index_search(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+	b1 := models.Book{
+		UserID: user.ID,
+		Name:   "postgres",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{
+		UserID: user.ID,
+		Name:   "go",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	b3 := models.Book{
+		UserID: anotherUser.ID,
+		Name:   "postgres",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+
+	n1 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b1.UUID,
+		Body:     "create a gin index for full text search",
+		AddedOn:  1,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+	n2 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b2.UUID,
+		Body:     "full text search in the standard library",
+		AddedOn:  2,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+	n3 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b1.UUID,
+		Body:     "search the text in full",
+		AddedOn:  3,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n3), "preparing n3")
+	n4 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b1.UUID,
+		Body:     "",
+		AddedOn:  4,
+		Deleted:  true,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n4), "preparing n4")
+	n5 := models.Note{
+		UserID:   anotherUser.ID,
+		BookUUID: b3.UUID,
+		Body:     "full text search with a gin index",
+		AddedOn:  5,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n5), "preparing n5")
+
+	testCases := []struct {
+		query         string
+		expectedUUIDs []string
+		expectedTotal int
+	}{
+		{
+			query:         "q=search",
+			expectedUUIDs: []string{n1.UUID, n2.UUID, n3.UUID},
+			expectedTotal: 3,
+		},
+		{
+			query:         "q=%22full+text+search%22",
+			expectedUUIDs: []string{n1.UUID, n2.UUID},
+			expectedTotal: 2,
+		},
+		{
+			query:         "q=ind*",
+			expectedUUIDs: []string{n1.UUID},
+			expectedTotal: 1,
+		},
+		{
+			query:         fmt.Sprintf("q=search&book=%s", b2.UUID),
+			expectedUUIDs: []string{n2.UUID},
+			expectedTotal: 1,
+		},
+		{
+			query:         "q=search&per_page=2&page=2",
+			expectedUUIDs: []string{n1.UUID},
+			expectedTotal: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			// Execute
+			req := newReq(t, "GET", fmt.Sprintf("/api/v1/notes?%s", tc.query), "")
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+			w := httpDo(t, notesC.V1Index, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+			var payload SearchNotesResp
+			if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload"))
+			}
+
+			assert.Equal(t, payload.Total, tc.expectedTotal, "total mismatch")
+
+			assert.Equal(t, len(payload.Notes), len(tc.expectedUUIDs), "result count mismatch")
+			for _, uuid := range tc.expectedUUIDs {
+				var found bool
+				for _, note := range payload.Notes {
+					if note.UUID == uuid {
+						found = true
+						assert.NotEqual(t, note.Headline, "", "headline should be present")
+					}
+				}
+
+				assert.Equal(t, found, true, fmt.Sprintf("note %s not found in the results", uuid))
+			}
+		})
+	}
+}
+
+func TestNotesV1Index_search_invalid(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+
+	testCases := []string{
+		"q=%26%7C",
+		"q=search&page=0",
+		"q=search&per_page=101",
+	}
+
+	for _, query := range testCases {
+		t.Run(query, func(t *testing.T) {
+			req := newReq(t, "GET", fmt.Sprintf("/api/v1/notes?%s", query), "")
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+			w := httpDo(t, notesC.V1Index, req, &user)
+
+			assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+		})
+	}
+}
+
+func TestNotesV1Index_list(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+	b1 := models.Book{
+		UserID: user.ID,
+		Name:   "js",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{
+		UserID: user.ID,
+		Name:   "css",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	b3 := models.Book{
+		UserID: anotherUser.ID,
+		Name:   "js",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+
+	n1 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b1.UUID,
+		Body:     "n1 body",
+		AddedOn:  1000,
+		EditedOn: 5000,
+		USN:      3,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+	n2 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b2.UUID,
+		Body:     "n2 body",
+		AddedOn:  2000,
+		EditedOn: 4000,
+		USN:      1,
+		Public:   true,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+	n3 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b1.UUID,
+		Body:     "n3 body",
+		AddedOn:  3000,
+		USN:      2,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n3), "preparing n3")
+	n4 := models.Note{
+		UserID:   user.ID,
+		BookUUID: b1.UUID,
+		Body:     "",
+		AddedOn:  4000,
+		Deleted:  true,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n4), "preparing n4")
+	n5 := models.Note{
+		UserID:   anotherUser.ID,
+		BookUUID: b3.UUID,
+		Body:     "n5 body",
+		AddedOn:  5000,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&n5), "preparing n5")
+
+	testCases := []struct {
+		query         string
+		expectedUUIDs []string
+	}{
+		{
+			query:         "",
+			expectedUUIDs: []string{n3.UUID, n2.UUID, n1.UUID},
+		},
+		{
+			query:         "sort=added_on",
+			expectedUUIDs: []string{n1.UUID, n2.UUID, n3.UUID},
+		},
+		{
+			query:         "sort=-edited_on",
+			expectedUUIDs: []string{n1.UUID, n2.UUID, n3.UUID},
+		},
+		{
+			query:         "sort=usn",
+			expectedUUIDs: []string{n2.UUID, n3.UUID, n1.UUID},
+		},
+		{
+			query:         fmt.Sprintf("book=%s", b1.UUID),
+			expectedUUIDs: []string{n3.UUID, n1.UUID},
+		},
+		{
+			query:         fmt.Sprintf("book=%s&book=%s", b1.UUID, b2.UUID),
+			expectedUUIDs: []string{n3.UUID, n2.UUID, n1.UUID},
+		},
+		{
+			query:         "added_after=2000&added_before=3001",
+			expectedUUIDs: []string{n3.UUID, n2.UUID},
+		},
+		{
+			query:         "edited_after=4500",
+			expectedUUIDs: []string{n1.UUID},
+		},
+		{
+			query:         "public=true",
+			expectedUUIDs: []string{n2.UUID},
+		},
+		{
+			query:         "public=false",
+			expectedUUIDs: []string{n3.UUID, n1.UUID},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			// Execute
+			req := newReq(t, "GET", fmt.Sprintf("/api/v1/notes?%s", tc.query), "")
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+			w := httpDo(t, notesC.V1Index, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+			var payload ListNotesResp
+			if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload"))
+			}
+
+			assert.Equal(t, len(payload.Notes), len(tc.expectedUUIDs), "result count mismatch")
+			for idx, uuid := range tc.expectedUUIDs {
+				assert.Equal(t, payload.Notes[idx].UUID, uuid, fmt.Sprintf("note uuid mismatch at %d", idx))
+			}
+			assert.Equal(t, payload.NextCursor, "", "next_cursor mismatch")
+		})
+	}
+}
+
+func TestNotesV1Index_list_tag(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	b1 := models.Book{
+		UserID: user.ID,
+		Name:   "js",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+
+	t1 := models.Tag{UserID: user.ID, Name: "closure"}
+	models.MustExec(t, models.TestServices.DB.Save(&t1), "preparing t1")
+	t2 := models.Tag{UserID: user.ID, Name: "scope"}
+	models.MustExec(t, models.TestServices.DB.Save(&t2), "preparing t2")
+
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "n1", AddedOn: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+	if err := models.TestServices.Note.SetTags(&n1, []models.Tag{t1}, nil); err != nil {
+		t.Fatal(errors.Wrap(err, "preparing n1 tags"))
+	}
+	n2 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "n2", AddedOn: 2}
+	models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+	if err := models.TestServices.Note.SetTags(&n2, []models.Tag{t1, t2}, nil); err != nil {
+		t.Fatal(errors.Wrap(err, "preparing n2 tags"))
+	}
+	n3 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "n3", AddedOn: 3}
+	models.MustExec(t, models.TestServices.DB.Save(&n3), "preparing n3")
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{
+			query:    "tag=closure",
+			expected: []string{n2.UUID, n1.UUID},
+		},
+		{
+			query:    "tag=closure&tag=scope",
+			expected: []string{n2.UUID},
+		},
+		{
+			query:    "tag=hoisting",
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			req := newReq(t, "GET", fmt.Sprintf("/api/v1/notes?%s", tc.query), "")
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+			w := httpDo(t, notesC.V1Index, req, &user)
+
+			assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+			var payload ListNotesResp
+			if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+				t.Fatal(errors.Wrap(err, "decoding payload"))
+			}
+
+			got := []string{}
+			for _, note := range payload.Notes {
+				got = append(got, note.UUID)
+			}
+			assert.DeepEqual(t, got, tc.expected, "note uuids mismatch")
+		})
+	}
+}
+
+func TestNotesV1Index_list_cursor(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+
+	b1 := models.Book{
+		UserID: user.ID,
+		Name:   "js",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+
+	// n2 and n3 share the same added_on to ensure ties are broken by id
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, AddedOn: 1000}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+	n2 := models.Note{UserID: user.ID, BookUUID: b1.UUID, AddedOn: 2000}
+	models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+	n3 := models.Note{UserID: user.ID, BookUUID: b1.UUID, AddedOn: 2000}
+	models.MustExec(t, models.TestServices.DB.Save(&n3), "preparing n3")
+	n4 := models.Note{UserID: user.ID, BookUUID: b1.UUID, AddedOn: 3000}
+	models.MustExec(t, models.TestServices.DB.Save(&n4), "preparing n4")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	var uuids []string
+	var pages int
+	cursor := ""
+	for {
+		req := newReq(t, "GET", fmt.Sprintf("/api/v1/notes?per_page=2&cursor=%s", cursor), "")
+		w := httpDo(t, notesC.V1Index, req, &user)
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var payload ListNotesResp
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+
+		for _, note := range payload.Notes {
+			uuids = append(uuids, note.UUID)
+		}
+		pages++
+
+		if payload.NextCursor == "" {
+			break
+		}
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+
+		cursor = payload.NextCursor
+	}
+
+	assert.Equal(t, pages, 2, "page count mismatch")
+	assert.DeepEqual(t, uuids, []string{n4.UUID, n3.UUID, n2.UUID, n1.UUID}, "uuids mismatch")
+}
+
+func TestNotesV1Index_list_invalid(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+
+	testCases := []string{
+		"sort=body",
+		"cursor=invalid",
+		"added_after=yesterday",
+		"public=maybe",
+		"per_page=0",
+	}
+
+	for _, query := range testCases {
+		t.Run(query, func(t *testing.T) {
+			req := newReq(t, "GET", fmt.Sprintf("/api/v1/notes?%s", query), "")
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+			w := httpDo(t, notesC.V1Index, req, &user)
+
+			assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+		})
+	}
+}
+
+func TestNotesShow(t *testing.T) {
+	testCases := []struct {
+		name           string
+		public         bool
+		deleted        bool
+		encrypted      bool
+		viewAsOwner    bool
+		viewAsOther    bool
+		expectedStatus int
+	}{
+		{
+			name:           "public note viewed anonymously",
+			public:         true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "public note viewed by another user",
+			public:         true,
+			viewAsOther:    true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "private note viewed anonymously",
+			public:         false,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "private note viewed by another user",
+			public:         false,
+			viewAsOther:    true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "private note viewed by owner",
+			public:         false,
+			viewAsOwner:    true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "deleted public note",
+			public:         true,
+			deleted:        true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "encrypted public note",
+			public:         true,
+			encrypted:      true,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			cfg.WebURL = "https://example.com"
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+			b1 := models.Book{
+				UserID: user.ID,
+				Name:   "js",
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+			note := models.Note{
+				UserID:    user.ID,
+				BookUUID:  b1.UUID,
+				Body:      "# Closures\n\nA **closure** <script>alert(1)</script>",
+				Public:    tc.public,
+				Deleted:   tc.deleted,
+				Encrypted: tc.encrypted,
+			}
+			models.MustExec(t, models.TestServices.DB.Save(&note), "preparing note")
+
+			var viewer *models.User
+			if tc.viewAsOwner {
+				viewer = &user
+			} else if tc.viewAsOther {
+				viewer = &anotherUser
+			}
+
+			// Execute
+			notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+			req := newReq(t, "GET", fmt.Sprintf("/notes/%s", note.UUID), "")
+			req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
+			w := httpDo(t, notesC.Show, req, viewer)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedStatus, "status code mismatch")
+
+			body := w.Body.String()
+			if tc.expectedStatus == http.StatusOK {
+				assert.Equal(t, strings.Contains(body, "<strong>closure</strong>"), true, "rendered content not found")
+				assert.Equal(t, strings.Contains(body, "<script>alert(1)</script>"), false, "unsafe content rendered")
+				assert.Equal(t, strings.Contains(body, `<meta property="og:title" content="Closures">`), true, "og:title not found")
+				assert.Equal(t, strings.Contains(body, fmt.Sprintf(`<meta property="og:url" content="https://example.com/notes/%s">`, note.UUID)), true, "og:url not found")
+			} else {
+				assert.Equal(t, strings.Contains(body, "closure"), false, "note content leaked")
+			}
+		})
+	}
+}
+
+func TestNotesV1Revisions(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
+
+	b1 := models.Book{
+		UserID: user.ID,
+		Name:   "js",
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	note := models.Note{
+		UserID:   user.ID,
+		BookUUID: b1.UUID,
+		Body:     "v1",
+		AddedOn:  1579818739000000,
+		USN:      100,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&note), "preparing note")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+	for _, body := range []string{"v2", "v3"} {
+		req := newReq(t, "PATCH", fmt.Sprintf("/api/v1/notes/%s", note.UUID), fmt.Sprintf(`{"content": "%s"}`, body))
+		req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
+		w := httpDo(t, notesC.V1Update, req, &user)
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch for update")
+	}
+
+	t.Run("owner", func(t *testing.T) {
+		// Execute
+		req := newReq(t, "GET", fmt.Sprintf("/api/v1/notes/%s/revisions", note.UUID), "")
+		req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
+		w := httpDo(t, notesC.V1Revisions, req, &user)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var payload []presenters.NoteRevision
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+
+		assert.Equal(t, len(payload), 2, "revision count mismatch")
+		assert.Equal(t, payload[0].Body, "v2", "revision 0 content mismatch")
+		assert.Equal(t, payload[0].USN, 102, "revision 0 usn mismatch")
+		assert.Equal(t, payload[1].Body, "v1", "revision 1 content mismatch")
+		assert.Equal(t, payload[1].USN, 100, "revision 1 usn mismatch")
+	})
+
+	t.Run("non-owner", func(t *testing.T) {
+		// Execute
+		req := newReq(t, "GET", fmt.Sprintf("/api/v1/notes/%s/revisions", note.UUID), "")
+		req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
+		w := httpDo(t, notesC.V1Revisions, req, &anotherUser)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusNotFound, "status code mismatch")
+	})
+
+	t.Run("deleted note", func(t *testing.T) {
+		// Execute
+		req := newReq(t, "DELETE", fmt.Sprintf("/api/v1/notes/%s", note.UUID), "")
+		req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
+		w := httpDo(t, notesC.V1Delete, req, &user)
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch for delete")
+
+		req = newReq(t, "GET", fmt.Sprintf("/api/v1/notes/%s/revisions", note.UUID), "")
+		req = mux.SetURLVars(req, map[string]string{"noteUUID": note.UUID})
+		w = httpDo(t, notesC.V1Revisions, req, &user)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusNotFound, "status code mismatch")
+
+		var revisionCount int
+		models.MustExec(t, models.TestServices.DB.Model(&models.NoteRevision{}).Where("note_id = ?", note.ID).Count(&revisionCount), "counting revisions")
+		assert.Equal(t, revisionCount, 0, "revision count mismatch")
+	})
+}
+
+func TestNotesCreate(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
+	b1 := models.Book{
+		UserID: user.ID,
+		Name:   "js",
+		USN:    58,
+	}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	t.Run("without book", func(t *testing.T) {
+		req := newFormReq(t, "POST", "/notes", url.Values{"content": {"note content"}})
+		w := httpDo(t, notesC.Create, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+
+		var noteCount int
+		models.MustExec(t, models.TestServices.DB.Model(&models.Note{}).Count(&noteCount), "counting notes")
+		assert.Equal(t, noteCount, 0, "note count mismatch")
+	})
+
+	t.Run("with book", func(t *testing.T) {
+		req := newFormReq(t, "POST", "/notes", url.Values{"book_uuid": {b1.UUID}, "content": {"note content"}})
+		w := httpDo(t, notesC.Create, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+
+		var noteRecord models.Note
+		models.MustExec(t, models.TestServices.DB.First(&noteRecord), "finding note")
+
+		assert.Equal(t, w.Header().Get("Location"), fmt.Sprintf("/notes/%s", noteRecord.UUID), "location mismatch")
+		assert.Equal(t, noteRecord.UserID, user.ID, "note user_id mismatch")
+		assert.Equal(t, noteRecord.BookUUID, b1.UUID, "note book_uuid mismatch")
+		assert.Equal(t, noteRecord.Body, "note content", "note content mismatch")
+		assert.Equal(t, noteRecord.USN, 102, "note usn mismatch")
+	})
+}
+
+func TestNotesUpdate(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
+
+	b1 := models.Book{UserID: user.ID, Name: "js", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{UserID: user.ID, Name: "css", USN: 2}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "n1 content", USN: 3, AddedOn: 1542058875, Public: true}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+	n2 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "n2 ciphertext", USN: 4, AddedOn: 1542058875, Encrypted: true}
+	models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	testCases := []struct {
+		name     string
+		user     models.User
+		noteUUID string
+	}{
+		{
+			name:     "another user's note",
+			user:     anotherUser,
+			noteUUID: n1.UUID,
+		},
+		{
+			name:     "encrypted note",
+			user:     user,
+			noteUUID: n2.UUID,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{"book_uuid": {b2.UUID}, "content": {"new content"}, "public": {"false"}}
+			req := newFormReq(t, "POST", fmt.Sprintf("/notes/%s", tc.noteUUID), form)
+			req = mux.SetURLVars(req, map[string]string{"noteUUID": tc.noteUUID})
+			w := httpDo(t, notesC.Update, req, &tc.user)
+
+			assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+			assert.Equal(t, w.Header().Get("Location"), "/", "location mismatch")
+
+			var noteRecord models.Note
+			models.MustExec(t, models.TestServices.DB.Where("uuid = ?", tc.noteUUID).First(&noteRecord), "finding note")
+			assert.Equal(t, noteRecord.BookUUID, b1.UUID, "note book_uuid mismatch")
+			assert.Equal(t, noteRecord.USN < 5, true, "note usn mismatch")
+		})
+	}
+
+	t.Run("own note", func(t *testing.T) {
+		// The unchecked checkbox for public is not submitted, leaving the hidden input
+		form := url.Values{"book_uuid": {b2.UUID}, "content": {"new content"}, "public": {"false"}}
+		req := newFormReq(t, "POST", fmt.Sprintf("/notes/%s", n1.UUID), form)
+		req = mux.SetURLVars(req, map[string]string{"noteUUID": n1.UUID})
+		w := httpDo(t, notesC.Update, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+		assert.Equal(t, w.Header().Get("Location"), fmt.Sprintf("/notes/%s", n1.UUID), "location mismatch")
+
+		var noteRecord models.Note
+		var revisionCount int
+		models.MustExec(t, models.TestServices.DB.Where("id = ?", n1.ID).First(&noteRecord), "finding n1")
+		models.MustExec(t, models.TestServices.DB.Model(&models.NoteRevision{}).Where("note_id = ?", n1.ID).Count(&revisionCount), "counting revisions")
+
+		assert.Equal(t, noteRecord.BookUUID, b2.UUID, "note book_uuid mismatch")
+		assert.Equal(t, noteRecord.Body, "new content", "note content mismatch")
+		assert.Equal(t, noteRecord.Public, false, "note public mismatch")
+		assert.Equal(t, noteRecord.USN, 102, "note usn mismatch")
+		assert.Equal(t, revisionCount, 1, "revision count mismatch")
+	})
+
+	t.Run("invalid form", func(t *testing.T) {
+		// The checked checkbox for public is submitted after the hidden input
+		form := url.Values{"book_uuid": {""}, "content": {"newer content"}, "public": {"false", "true"}}
+		req := newFormReq(t, "POST", fmt.Sprintf("/notes/%s", n1.UUID), form)
+		req = mux.SetURLVars(req, map[string]string{"noteUUID": n1.UUID})
+		w := httpDo(t, notesC.Update, req, &user)
+
+		assert.NotEqual(t, w.Code, http.StatusFound, "status code mismatch")
+		assert.Equal(t, strings.Contains(w.Body.String(), "newer content"), true, "content mismatch")
+		assert.Equal(t, strings.Contains(w.Body.String(), `value="true" checked`), true, "public mismatch")
+
+		var noteRecord models.Note
+		models.MustExec(t, models.TestServices.DB.Where("id = ?", n1.ID).First(&noteRecord), "finding n1")
+		assert.Equal(t, noteRecord.Body, "new content", "note content mismatch")
+	})
+}
+
+func TestNotesIndex(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+	b1 := models.Book{UserID: user.ID, Name: "lang", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{UserID: user.ID, Name: "go", ParentUUID: b1.UUID, USN: 2}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	b3 := models.Book{UserID: anotherUser.ID, Name: "css", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+	n1 := models.Note{UserID: user.ID, BookUUID: b2.UUID, Body: "# Goroutines\n\nn1 content", USN: 3, AddedOn: 1542058875, EditedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+	n2 := models.Note{UserID: user.ID, BookUUID: b2.UUID, Body: "ciphertext", USN: 4, AddedOn: 1542058875, Encrypted: true}
+	models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+	n3 := models.Note{UserID: anotherUser.ID, BookUUID: b3.UUID, Body: "n3 content", USN: 2, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n3), "preparing n3")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	req := newReq(t, "GET", "/", "")
+	w := httpDo(t, notesC.Index, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	body := w.Body.String()
+	assert.Equal(t, strings.Contains(body, "Goroutines"), true, "n1 title mismatch")
+	assert.Equal(t, strings.Contains(body, "lang/go"), true, "n1 book label mismatch")
+	assert.Equal(t, strings.Contains(body, fmt.Sprintf("/notes/%s/edit", n1.UUID)), true, "n1 edit link mismatch")
+	assert.Equal(t, strings.Contains(body, "Encrypted note"), true, "n2 title mismatch")
+	assert.Equal(t, strings.Contains(body, "ciphertext"), false, "n2 content should not be shown")
+	assert.Equal(t, strings.Contains(body, fmt.Sprintf("/notes/%s/edit", n2.UUID)), false, "n2 edit link mismatch")
+	assert.Equal(t, strings.Contains(body, n3.UUID), false, "another user's note should not be shown")
+}
+
+func TestHighlightHeadline(t *testing.T) {
+	headline := "use <nadhl>goroutines</nadhl> in <b>go</b>"
+
+	got := highlightHeadline(headline)
+
+	assert.Equal(t, string(got), "use <mark>goroutines</mark> in &lt;b&gt;go&lt;/b&gt;", "result mismatch")
+}
+
+func TestNotesSearch(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+	b1 := models.Book{UserID: user.ID, Name: "go", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	b2 := models.Book{UserID: user.ID, Name: "js", USN: 2}
+	models.MustExec(t, models.TestServices.DB.Save(&b2), "preparing b2")
+	b3 := models.Book{UserID: anotherUser.ID, Name: "go", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b3), "preparing b3")
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "Goroutines\n\nstart goroutines with the go statement", USN: 3, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+	n2 := models.Note{UserID: user.ID, BookUUID: b2.UUID, Body: "Web workers\n\nweb workers are not goroutines", USN: 4, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n2), "preparing n2")
+	n3 := models.Note{UserID: anotherUser.ID, BookUUID: b3.UUID, Body: "Channels\n\ngoroutines communicate over channels", USN: 2, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n3), "preparing n3")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	search := func(t *testing.T, path string) string {
+		req := newReq(t, "GET", path, "")
+		w := httpDo(t, notesC.Search, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		return w.Body.String()
+	}
+
+	t.Run("all books", func(t *testing.T) {
+		body := search(t, "/search?q=goroutines&book=")
+
+		assert.Equal(t, strings.Contains(body, "2 notes found"), true, "total mismatch")
+		assert.Equal(t, strings.Contains(body, fmt.Sprintf("/notes/%s", n1.UUID)), true, "n1 mismatch")
+		assert.Equal(t, strings.Contains(body, fmt.Sprintf("/notes/%s", n2.UUID)), true, "n2 mismatch")
+		assert.Equal(t, strings.Contains(body, "<mark>goroutines</mark>"), true, "headline mismatch")
+		assert.Equal(t, strings.Contains(body, n3.UUID), false, "another user's note should not be found")
+	})
+
+	t.Run("book", func(t *testing.T) {
+		body := search(t, fmt.Sprintf("/search?q=goroutines&book=%s", b2.UUID))
+
+		assert.Equal(t, strings.Contains(body, "1 note found"), true, "total mismatch")
+		assert.Equal(t, strings.Contains(body, fmt.Sprintf("/notes/%s", n1.UUID)), false, "n1 mismatch")
+		assert.Equal(t, strings.Contains(body, fmt.Sprintf("/notes/%s", n2.UUID)), true, "n2 mismatch")
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		body := search(t, "/search?q=goroutines&per_page=1")
+
+		assert.Equal(t, strings.Contains(body, "2 notes found"), true, "total mismatch")
+		assert.Equal(t, strings.Contains(body, "page=2"), true, "next page mismatch")
+		assert.Equal(t, strings.Contains(body, "Previous"), false, "previous page mismatch")
+
+		body = search(t, "/search?q=goroutines&per_page=1&page=2")
+
+		assert.Equal(t, strings.Contains(body, "page=1"), true, "previous page mismatch")
+		assert.Equal(t, strings.Contains(body, "Next"), false, "next page mismatch")
+	})
+
+	t.Run("no query", func(t *testing.T) {
+		body := search(t, "/search")
+
+		assert.Equal(t, strings.Contains(body, "found"), false, "results mismatch")
+	})
+}
+
+func TestNotesEdit(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	b1 := models.Book{UserID: user.ID, Name: "js", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "<script>n1 content</script>", USN: 2, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	req := newReq(t, "GET", fmt.Sprintf("/notes/%s/edit", n1.UUID), "")
+	req = mux.SetURLVars(req, map[string]string{"noteUUID": n1.UUID})
+	w := httpDo(t, notesC.Edit, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	body := w.Body.String()
+	assert.Equal(t, strings.Contains(body, fmt.Sprintf(`action="/notes/%s"`, n1.UUID)), true, "form action mismatch")
+	assert.Equal(t, strings.Contains(body, "&lt;script&gt;n1 content&lt;/script&gt;"), true, "content should be escaped")
+	assert.Equal(t, strings.Contains(body, fmt.Sprintf(`<option value="%s" selected>`, b1.UUID)), true, "book option mismatch")
+}
+
+func TestNotesEdit_encrypted(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	b1 := models.Book{UserID: user.ID, Name: "js", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "ciphertext", USN: 2, AddedOn: 1542058875, Encrypted: true}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	req := newReq(t, "GET", fmt.Sprintf("/notes/%s/edit", n1.UUID), "")
+	req = mux.SetURLVars(req, map[string]string{"noteUUID": n1.UUID})
+	w := httpDo(t, notesC.Edit, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+	assert.Equal(t, w.Header().Get("Location"), "/", "location mismatch")
+	assert.Equal(t, strings.Contains(w.Body.String(), "ciphertext"), false, "body should not include the note")
+}
+
+func TestNotesDelete(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	models.MustExec(t, models.TestServices.DB.Model(&user).Update("max_usn", 101), "preparing user max_usn")
+	b1 := models.Book{UserID: user.ID, Name: "js", USN: 1}
+	models.MustExec(t, models.TestServices.DB.Save(&b1), "preparing b1")
+	n1 := models.Note{UserID: user.ID, BookUUID: b1.UUID, Body: "n1 content", USN: 2, AddedOn: 1542058875}
+	models.MustExec(t, models.TestServices.DB.Save(&n1), "preparing n1")
+
+	notesC := NewNotes(cfg, models.TestServices.Note, models.TestServices.NoteRevision, models.TestServices.Tag, models.TestServices.Book, models.TestServices.User, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	req := newFormReq(t, "POST", fmt.Sprintf("/notes/%s/delete", n1.UUID), url.Values{})
+	req = mux.SetURLVars(req, map[string]string{"noteUUID": n1.UUID})
+	w := httpDo(t, notesC.Delete, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+	assert.Equal(t, w.Header().Get("Location"), "/", "location mismatch")
+
+	var noteRecord models.Note
+	models.MustExec(t, models.TestServices.DB.Where("id = ?", n1.ID).First(&noteRecord), "finding n1")
+	assert.Equal(t, noteRecord.Deleted, true, "note deleted mismatch")
+	assert.Equal(t, noteRecord.Body, "", "note content mismatch")
+	assert.Equal(t, noteRecord.USN, 102, "note usn mismatch")
+}
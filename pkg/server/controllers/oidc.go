@@ -0,0 +1,358 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/crypt"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/oidc"
+	"github.com/nadproject/nad/pkg/server/views"
+	"github.com/pkg/errors"
+)
+
+const (
+	oidcStateCookieName = "oidc_state"
+	oidcStateCookiePath = "/oidc"
+	// oidcStateTTL is how long a user has to sign in at the identity provider
+	oidcStateTTL = 10 * time.Minute
+	// oidcCLITokenTTL is how long the CLI has to exchange the code it received for a session
+	oidcCLITokenTTL = time.Minute
+)
+
+// NewOIDC creates a new OIDC controller.
+func NewOIDC(cfg config.Config, p *oidc.Provider, us models.UserService, ss models.SessionService, ts models.TokenService, cl clock.Clock) *OIDC {
+	return &OIDC{
+		p:         p,
+		us:        us,
+		ss:        ss,
+		ts:        ts,
+		c:         cl,
+		onPremise: cfg.OnPremise,
+
+		LoginTwoFactorView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "Two-factor authentication", Layout: "base"}, "users/login_two_factor"),
+	}
+}
+
+// OIDC is a controller for signing in with an OpenID Connect provider
+type OIDC struct {
+	p         *oidc.Provider
+	us        models.UserService
+	ss        models.SessionService
+	ts        models.TokenService
+	c         clock.Clock
+	onPremise bool
+
+	LoginTwoFactorView *views.View
+}
+
+// OIDCLoginForm is the query of a request to start signing in with the identity provider
+type OIDCLoginForm struct {
+	// CLIPort and CLIState are set by the CLI, which listens on the port on
+	// the loopback interface to receive the result of the sign in.
+	CLIPort  int    `schema:"cli_port"`
+	CLIState string `schema:"cli_state"`
+}
+
+// oidcState is kept in a cookie from the redirect to the identity provider until the callback
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	CLIPort  int    `json:"cli_port,omitempty"`
+	CLIState string `json:"cli_state,omitempty"`
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, s oidcState, expires time.Time) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "marshalling state")
+	}
+
+	cookie := http.Cookie{
+		Name:    oidcStateCookieName,
+		Value:   base64.RawURLEncoding.EncodeToString(b),
+		Expires: expires,
+		Path:    oidcStateCookiePath,
+		// The cookie needs to be sent when the identity provider redirects back
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+	}
+	http.SetCookie(w, &cookie)
+
+	return nil
+}
+
+func getOIDCStateCookie(r *http.Request) (oidcState, error) {
+	var ret oidcState
+
+	c, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		return ret, models.ErrOIDCLoginInvalid
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return ret, models.ErrOIDCLoginInvalid
+	}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return ret, models.ErrOIDCLoginInvalid
+	}
+
+	return ret, nil
+}
+
+func unsetOIDCStateCookie(w http.ResponseWriter) {
+	cookie := http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Expires:  time.Now().Add(time.Hour * -24),
+		Path:     oidcStateCookiePath,
+		HttpOnly: true,
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// start prepares the state for signing in with the identity provider and
+// returns the URL of the identity provider.
+func (o *OIDC) start(r *http.Request) (string, oidcState, error) {
+	var form OIDCLoginForm
+	if err := parseURLParams(r, &form); err != nil {
+		return "", oidcState{}, models.ErrOIDCCLIParamsInvalid
+	}
+	if form.CLIPort != 0 && (form.CLIPort < 1024 || form.CLIPort > 65535 || form.CLIState == "") {
+		return "", oidcState{}, models.ErrOIDCCLIParamsInvalid
+	}
+
+	s := oidcState{
+		CLIPort:  form.CLIPort,
+		CLIState: form.CLIState,
+	}
+
+	var err error
+	if s.State, err = oidc.RandomString(); err != nil {
+		return "", s, errors.Wrap(err, "generating state")
+	}
+	if s.Nonce, err = oidc.RandomString(); err != nil {
+		return "", s, errors.Wrap(err, "generating nonce")
+	}
+	if s.Verifier, err = oidc.RandomString(); err != nil {
+		return "", s, errors.Wrap(err, "generating code verifier")
+	}
+
+	u, err := o.p.AuthCodeURL(s.State, s.Nonce, s.Verifier)
+	if err != nil {
+		return "", s, errors.Wrap(err, "getting authorization url")
+	}
+
+	return u, s, nil
+}
+
+// findOrCreateUser returns the user with the email in the given claims. If
+// there is no such user, it creates one.
+func (o *OIDC) findOrCreateUser(claims *oidc.Claims) (*models.User, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, models.ErrOIDCEmailUnverified
+	}
+
+	user, err := o.us.ByEmail(claims.Email)
+	if err == nil {
+		if !user.EmailVerified {
+			user.EmailVerified = true
+			if err := o.us.Update(user, nil); err != nil {
+				return nil, errors.Wrap(err, "updating user")
+			}
+		}
+
+		return user, nil
+	} else if err != models.ErrNotFound {
+		return nil, errors.Wrap(err, "finding user")
+	}
+
+	// The user signs in with the identity provider, so the password is random
+	// and only usable after a password reset.
+	password, err := crypt.GetRandomStr(32)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating password")
+	}
+
+	user = &models.User{
+		Email:         claims.Email,
+		Password:      password,
+		EmailVerified: true,
+		Pro:           o.onPremise,
+	}
+	if err := o.us.Create(user); err != nil {
+		return nil, errors.Wrap(err, "creating user")
+	}
+
+	return user, nil
+}
+
+// callback completes signing in with the identity provider and returns the user.
+func (o *OIDC) callback(r *http.Request, s oidcState) (*models.User, error) {
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		return nil, errors.Wrapf(models.ErrOIDCLoginInvalid, "identity provider responded with %s", q.Get("error"))
+	}
+
+	if s.State == "" || subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(s.State)) != 1 {
+		return nil, errors.Wrap(models.ErrOIDCLoginInvalid, "state mismatch")
+	}
+
+	idToken, err := o.p.Exchange(q.Get("code"), s.Verifier)
+	if err != nil {
+		return nil, errors.Wrap(err, "exchanging authorization code")
+	}
+
+	claims, err := o.p.Verify(idToken, s.Nonce, o.c.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "verifying id token")
+	}
+
+	return o.findOrCreateUser(claims)
+}
+
+// redirectLoginError redirects to the login page with the given error
+func redirectLoginError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	logError(err, msg)
+
+	var vd views.Data
+	if errors.Cause(err) == oidc.ErrIDTokenInvalid {
+		err = models.ErrOIDCLoginInvalid
+	}
+	vd.SetAlert(err)
+	views.RedirectAlert(w, r, "/login", http.StatusFound, *vd.Alert)
+}
+
+// Login handles GET /login/oidc
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	u, s, err := o.start(r)
+	if err != nil {
+		redirectLoginError(w, r, err, "starting oidc login")
+		return
+	}
+
+	if err := setOIDCStateCookie(w, s, o.c.Now().Add(oidcStateTTL)); err != nil {
+		redirectLoginError(w, r, err, "setting oidc state")
+		return
+	}
+
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// Callback handles GET /oidc/callback
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	s, err := getOIDCStateCookie(r)
+	unsetOIDCStateCookie(w)
+	if err != nil {
+		redirectLoginError(w, r, err, "getting oidc state")
+		return
+	}
+
+	user, err := o.callback(r, s)
+	if err != nil {
+		redirectLoginError(w, r, err, "completing oidc login")
+		return
+	}
+
+	if s.CLIPort != 0 {
+		token := models.Token{
+			UserID:    user.ID,
+			Type:      models.TokenTypeOIDCLogin,
+			ExpiresAt: o.c.Now().Add(oidcCLITokenTTL),
+		}
+		if err := o.ts.Create(&token); err != nil {
+			redirectLoginError(w, r, err, "creating token")
+			return
+		}
+
+		q := url.Values{}
+		q.Set("code", token.Value)
+		q.Set("state", s.CLIState)
+		http.Redirect(w, r, fmt.Sprintf("http://127.0.0.1:%d/callback?%s", s.CLIPort, q.Encode()), http.StatusFound)
+		return
+	}
+
+	// The identity provider replaces the password, but not the two-factor
+	// code, which is entered and verified the same way as after a password.
+	if user.TOTPEnabled {
+		token, err := createTwoFactorLoginToken(o.ts, o.c, user)
+		if err != nil {
+			redirectLoginError(w, r, err, "creating two-factor token")
+			return
+		}
+
+		vd := views.Data{Yield: TwoFactorLoginForm{Token: token}}
+		o.LoginTwoFactorView.Render(w, r, vd)
+		return
+	}
+
+	session, err := createSession(o.us, o.ss, user, r)
+	if err != nil {
+		redirectLoginError(w, r, err, "creating session")
+		return
+	}
+
+	setSessionCookie(w, session.Key, session.ExpiresAt)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// OIDCCodeForm is the form data for exchanging the code received by the CLI for a session
+type OIDCCodeForm struct {
+	Code string `json:"code"`
+}
+
+// V1Login handles POST /api/v1/login/oidc
+func (o *OIDC) V1Login(w http.ResponseWriter, r *http.Request) {
+	var form OIDCCodeForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	token, err := o.ts.Redeem(form.Code, models.TokenTypeOIDCLogin, o.c.Now(), nil)
+	if err == models.ErrTokenInvalid {
+		handleJSONError(w, models.ErrOIDCLoginInvalid, "redeeming token")
+		return
+	} else if err != nil {
+		handleJSONError(w, err, "redeeming token")
+		return
+	}
+
+	user, err := o.us.ByID(token.UserID)
+	if err != nil {
+		handleJSONError(w, err, "finding user")
+		return
+	}
+
+	if user.TOTPEnabled {
+		twoFactorToken, err := createTwoFactorLoginToken(o.ts, o.c, user)
+		if err != nil {
+			handleJSONError(w, err, "creating two-factor token")
+			return
+		}
+
+		resp := TwoFactorLoginResp{
+			TwoFactorRequired: true,
+			TwoFactorToken:    twoFactorToken,
+		}
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	session, err := createSession(o.us, o.ss, user, r)
+	if err != nil {
+		handleJSONError(w, err, "creating session")
+		return
+	}
+
+	respondWithSession(w, http.StatusOK, *session)
+}
@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/oidc"
+	"github.com/pkg/errors"
+)
+
+// startOIDCLogin starts signing in with the identity provider and returns the
+// authorization URL and the state cookie
+func startOIDCLogin(t *testing.T, oidcC *OIDC, path string) (*url.URL, *http.Cookie) {
+	w := httpDo(t, oidcC.Login, newReq(t, "GET", path, ""), nil)
+	assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "parsing location"))
+	}
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("state cookie is not set")
+	}
+
+	return u, cookie
+}
+
+func completeOIDCLogin(t *testing.T, oidcC *OIDC, cookie *http.Cookie, code, state string) *httptest.ResponseRecorder {
+	q := url.Values{}
+	q.Set("code", code)
+	q.Set("state", state)
+
+	req := newReq(t, "GET", "/oidc/callback?"+q.Encode(), "")
+	req.AddCookie(cookie)
+
+	return httpDo(t, oidcC.Callback, req, nil)
+}
+
+func TestOIDCCallback(t *testing.T) {
+	mp := oidc.NewMockProvider(t)
+	defer mp.Server.Close()
+
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		existingEmail    string
+		claims           map[string]interface{}
+		stateMismatch    bool
+		expectedLocation string
+		expectedSession  bool
+		expectedUsers    int
+	}{
+		{
+			claims:           map[string]interface{}{"sub": "1", "email": "alice@example.com", "email_verified": true},
+			expectedLocation: "/",
+			expectedSession:  true,
+			expectedUsers:    1,
+		},
+		{
+			existingEmail:    "alice@example.com",
+			claims:           map[string]interface{}{"sub": "1", "email": "alice@example.com", "email_verified": true},
+			expectedLocation: "/",
+			expectedSession:  true,
+			expectedUsers:    1,
+		},
+		{
+			existingEmail:    "alice@example.com",
+			claims:           map[string]interface{}{"sub": "1", "email": "alice@example.com", "email_verified": false},
+			expectedLocation: "/login",
+			expectedUsers:    1,
+		},
+		{
+			claims:           map[string]interface{}{"sub": "1", "email": "alice@example.com"},
+			expectedLocation: "/login",
+			expectedUsers:    0,
+		},
+		{
+			claims:           map[string]interface{}{"sub": "1", "email": "alice@example.com", "email_verified": true},
+			stateMismatch:    true,
+			expectedLocation: "/login",
+			expectedUsers:    0,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			c := clock.NewMock()
+			c.SetNow(now)
+
+			if tc.existingEmail != "" {
+				models.SetupUser(t, models.TestServices.User, models.TestServices.Session, tc.existingEmail, "pass1234")
+			}
+
+			p := oidc.NewProvider(mp.Config("http://localhost:3000/oidc/callback"), nil)
+			oidcC := NewOIDC(cfg, p, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, c)
+
+			authURL, cookie := startOIDCLogin(t, oidcC, "/login/oidc")
+
+			claims := map[string]interface{}{"exp": now.Add(time.Hour).Unix()}
+			for k, v := range tc.claims {
+				claims[k] = v
+			}
+			code := mp.Authorize(t, authURL.String(), claims)
+
+			state := authURL.Query().Get("state")
+			if tc.stateMismatch {
+				state = "another-state"
+			}
+
+			// Execute
+			w := completeOIDCLogin(t, oidcC, cookie, code, state)
+
+			// Test
+			assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+			assert.Equal(t, w.Header().Get("Location"), tc.expectedLocation, "location mismatch")
+
+			var sessionCookie *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == sessionCookieName {
+					sessionCookie = c
+				}
+			}
+			assert.Equal(t, sessionCookie != nil, tc.expectedSession, "session cookie mismatch")
+
+			var userCount int
+			models.MustExec(t, models.TestServices.DB.Model(&models.User{}).Count(&userCount), "counting users")
+			assert.Equal(t, userCount, tc.expectedUsers, "user count mismatch")
+
+			if tc.expectedSession {
+				var userRecord models.User
+				models.MustExec(t, models.TestServices.DB.Where("email = ?", "alice@example.com").First(&userRecord), "finding user")
+				assert.Equal(t, userRecord.EmailVerified, true, "email_verified mismatch")
+			}
+		})
+	}
+}
+
+func TestOIDCCLILogin(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	mp := oidc.NewMockProvider(t)
+	defer mp.Server.Close()
+
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	c := clock.NewMock()
+	c.SetNow(now)
+
+	p := oidc.NewProvider(mp.Config("http://localhost:3000/oidc/callback"), nil)
+	oidcC := NewOIDC(cfg, p, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, c)
+
+	t.Run("invalid port", func(t *testing.T) {
+		w := httpDo(t, oidcC.Login, newReq(t, "GET", "/login/oidc?cli_port=80&cli_state=abc", ""), nil)
+
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+		assert.Equal(t, w.Header().Get("Location"), "/login", "location mismatch")
+	})
+
+	authURL, cookie := startOIDCLogin(t, oidcC, "/login/oidc?cli_port=53682&cli_state=cli-state")
+	claims := map[string]interface{}{"sub": "1", "email": "alice@example.com", "email_verified": true, "exp": now.Add(time.Hour).Unix()}
+	code := mp.Authorize(t, authURL.String(), claims)
+
+	w := completeOIDCLogin(t, oidcC, cookie, code, authURL.Query().Get("state"))
+	assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "parsing location"))
+	}
+	assert.Equal(t, location.Host, "127.0.0.1:53682", "host mismatch")
+	assert.Equal(t, location.Path, "/callback", "path mismatch")
+	assert.Equal(t, location.Query().Get("state"), "cli-state", "state mismatch")
+
+	var sessionCount int
+	models.MustExec(t, models.TestServices.DB.Model(&models.Session{}).Count(&sessionCount), "counting sessions")
+	assert.Equal(t, sessionCount, 0, "session count mismatch")
+
+	t.Run("exchange code", func(t *testing.T) {
+		req := newReq(t, "POST", "/api/v1/login/oidc", fmt.Sprintf(`{"code": "%s"}`, location.Query().Get("code")))
+		w := httpDo(t, oidcC.V1Login, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var payload SessionResponse
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+		assert.NotEqual(t, payload.Key, "", "session key mismatch")
+	})
+
+	t.Run("exchange code again", func(t *testing.T) {
+		req := newReq(t, "POST", "/api/v1/login/oidc", fmt.Sprintf(`{"code": "%s"}`, location.Query().Get("code")))
+		w := httpDo(t, oidcC.V1Login, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+		assert.Equal(t, strings.Contains(w.Body.String(), "Single Sign-On"), true, "error message mismatch")
+	})
+}
+
+func TestOIDCTwoFactor(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	mp := oidc.NewMockProvider(t)
+	defer mp.Server.Close()
+
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	c := clock.NewMock()
+	c.SetNow(now)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	setupTwoFactorUser(t, &user, "JBSWY3DPEHPK3PXP")
+
+	p := oidc.NewProvider(mp.Config("http://localhost:3000/oidc/callback"), nil)
+	oidcC := NewOIDC(cfg, p, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, c)
+
+	claims := map[string]interface{}{"sub": "1", "email": "alice@example.com", "email_verified": true, "exp": now.Add(time.Hour).Unix()}
+
+	countSessions := func(t *testing.T) int {
+		var sessionCount int
+		models.MustExec(t, models.TestServices.DB.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&sessionCount), "counting sessions")
+		return sessionCount
+	}
+	sessionCount := countSessions(t)
+
+	t.Run("web", func(t *testing.T) {
+		authURL, cookie := startOIDCLogin(t, oidcC, "/login/oidc")
+		code := mp.Authorize(t, authURL.String(), claims)
+
+		// Execute
+		w := completeOIDCLogin(t, oidcC, cookie, code, authURL.Query().Get("state"))
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+		for _, c := range w.Result().Cookies() {
+			assert.NotEqual(t, c.Name, sessionCookieName, "session cookie is set")
+		}
+		assert.Equal(t, countSessions(t), sessionCount, "session count mismatch")
+
+		var token models.Token
+		models.MustExec(t, models.TestServices.DB.Where("user_id = ? AND type = ?", user.ID, models.TokenTypeTwoFactorLogin).First(&token), "finding token")
+		assert.Equal(t, getInputValue(w.Body.String(), "token"), token.Value, "form token mismatch")
+	})
+
+	t.Run("cli", func(t *testing.T) {
+		authURL, cookie := startOIDCLogin(t, oidcC, "/login/oidc?cli_port=53682&cli_state=cli-state")
+		code := mp.Authorize(t, authURL.String(), claims)
+
+		w := completeOIDCLogin(t, oidcC, cookie, code, authURL.Query().Get("state"))
+		assert.Equal(t, w.Code, http.StatusFound, "status code mismatch")
+
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "parsing location"))
+		}
+
+		// Execute
+		req := newReq(t, "POST", "/api/v1/login/oidc", fmt.Sprintf(`{"code": "%s"}`, location.Query().Get("code")))
+		w = httpDo(t, oidcC.V1Login, req, nil)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var payload TwoFactorLoginResp
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+		assert.Equal(t, payload.TwoFactorRequired, true, "two_factor_required mismatch")
+		assert.NotEqual(t, payload.TwoFactorToken, "", "two_factor_token mismatch")
+		assert.Equal(t, countSessions(t), sessionCount, "session count mismatch")
+	})
+}
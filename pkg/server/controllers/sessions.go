@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/presenters"
+	"github.com/nadproject/nad/pkg/server/views"
+	"github.com/pkg/errors"
+)
+
+// NewSessions creates a new Sessions controller.
+// It panics if the necessary templates are not parsed.
+func NewSessions(cfg config.Config, ss models.SessionService) *Sessions {
+	return &Sessions{
+		IndexView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "Sessions", Layout: "base", HeaderTemplate: "navbar"}, "sessions/index"),
+		ss:        ss,
+	}
+}
+
+// Sessions is a controller for the sessions of a user on different devices
+type Sessions struct {
+	IndexView *views.View
+	ss        models.SessionService
+}
+
+func (s *Sessions) list(r *http.Request) ([]presenters.Session, error) {
+	user := context.User(r.Context())
+
+	key, err := GetCredential(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting credential")
+	}
+
+	sessions, err := s.ss.ByUserID(user.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding sessions")
+	}
+
+	return presenters.PresentSessions(sessions, key), nil
+}
+
+func (s *Sessions) delete(r *http.Request) error {
+	user := context.User(r.Context())
+
+	id, err := strconv.ParseUint(mux.Vars(r)["sessionID"], 10, 64)
+	if err != nil {
+		return models.ErrNotFound
+	}
+
+	return s.ss.DeleteByID(user.ID, uint(id))
+}
+
+// Index handles GET /sessions
+func (s *Sessions) Index(w http.ResponseWriter, r *http.Request) {
+	var vd views.Data
+
+	sessions, err := s.list(r)
+	vd.Yield = sessions
+	if err != nil {
+		handleHTMLError(w, err, "listing sessions", &vd)
+	}
+
+	s.IndexView.Render(w, r, vd)
+}
+
+// Delete handles POST /sessions/:sessionID/delete
+func (s *Sessions) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := s.delete(r); err != nil {
+		logError(err, "deleting session")
+
+		var vd views.Data
+		vd.SetAlert(err)
+		views.RedirectAlert(w, r, "/sessions", http.StatusFound, *vd.Alert)
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "The session has been revoked.",
+	}
+	views.RedirectAlert(w, r, "/sessions", http.StatusFound, alert)
+}
+
+// V1Index handles GET /api/v1/sessions
+func (s *Sessions) V1Index(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.list(r)
+	if err != nil {
+		handleJSONError(w, err, "listing sessions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sessions)
+}
+
+// V1Delete handles DELETE /api/v1/sessions/:sessionID
+func (s *Sessions) V1Delete(w http.ResponseWriter, r *http.Request) {
+	if err := s.delete(r); err != nil {
+		handleJSONError(w, err, "deleting session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteSessionsResp is the response from revoking sessions
+type DeleteSessionsResp struct {
+	Count int64 `json:"count"`
+}
+
+// V1DeleteOthers handles DELETE /api/v1/sessions. It revokes all sessions of
+// the user except the one making the request.
+func (s *Sessions) V1DeleteOthers(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	key, err := GetCredential(r)
+	if err != nil {
+		handleJSONError(w, err, "getting credential")
+		return
+	}
+
+	count, err := s.ss.DeleteOthers(user.ID, key)
+	if err != nil {
+		handleJSONError(w, err, "deleting sessions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, DeleteSessionsResp{Count: count})
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/presenters"
+	"github.com/pkg/errors"
+)
+
+func TestSessionsV1Index(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, session := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	otherSession := models.SetupSession(t, models.TestServices.Session, user.ID)
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+	models.SetupSession(t, models.TestServices.Session, anotherUser.ID)
+
+	sessionsC := NewSessions(cfg, models.TestServices.Session)
+
+	// Execute
+	req := newReq(t, "GET", "/api/v1/sessions", "")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", session.Key))
+	w := httpDo(t, sessionsC.V1Index, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	var payload []presenters.Session
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding payload"))
+	}
+
+	assert.Equal(t, len(payload), 2, "session count mismatch")
+
+	current := map[uint]bool{}
+	for _, s := range payload {
+		current[s.ID] = s.Current
+	}
+	assert.Equal(t, current[session.ID], true, "current session mismatch")
+	assert.Equal(t, current[otherSession.ID], false, "other session mismatch")
+}
+
+func TestSessionsV1Delete(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, session := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	otherSession := models.SetupSession(t, models.TestServices.Session, user.ID)
+	anotherUser, anotherSession := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+	sessionsC := NewSessions(cfg, models.TestServices.Session)
+
+	t.Run("another user's session", func(t *testing.T) {
+		req := newReq(t, "DELETE", fmt.Sprintf("/api/v1/sessions/%d", anotherSession.ID), "")
+		req = mux.SetURLVars(req, map[string]string{"sessionID": fmt.Sprintf("%d", anotherSession.ID)})
+		w := httpDo(t, sessionsC.V1Delete, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusNotFound, "status code mismatch")
+
+		var count int
+		models.MustExec(t, models.TestServices.DB.Model(&models.Session{}).Where("user_id = ?", anotherUser.ID).Count(&count), "counting sessions")
+		assert.Equal(t, count, 1, "session count mismatch")
+	})
+
+	t.Run("own session", func(t *testing.T) {
+		req := newReq(t, "DELETE", fmt.Sprintf("/api/v1/sessions/%d", otherSession.ID), "")
+		req = mux.SetURLVars(req, map[string]string{"sessionID": fmt.Sprintf("%d", otherSession.ID)})
+		w := httpDo(t, sessionsC.V1Delete, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusNoContent, "status code mismatch")
+
+		var sessions []models.Session
+		models.MustExec(t, models.TestServices.DB.Where("user_id = ?", user.ID).Find(&sessions), "finding sessions")
+		assert.Equal(t, len(sessions), 1, "session count mismatch")
+		assert.Equal(t, sessions[0].ID, session.ID, "remaining session mismatch")
+	})
+}
+
+func TestSessionsV1DeleteOthers(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, session := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	models.SetupSession(t, models.TestServices.Session, user.ID)
+	models.SetupSession(t, models.TestServices.Session, user.ID)
+	anotherUser, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "bob@example.com", "pass1234")
+
+	sessionsC := NewSessions(cfg, models.TestServices.Session)
+
+	// Execute
+	req := newReq(t, "DELETE", "/api/v1/sessions", "")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", session.Key))
+	w := httpDo(t, sessionsC.V1DeleteOthers, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	var payload DeleteSessionsResp
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding payload"))
+	}
+	assert.Equal(t, payload.Count, int64(2), "deleted count mismatch")
+
+	var sessions []models.Session
+	models.MustExec(t, models.TestServices.DB.Where("user_id = ?", user.ID).Find(&sessions), "finding sessions")
+	assert.Equal(t, len(sessions), 1, "session count mismatch")
+	assert.Equal(t, sessions[0].ID, session.ID, "remaining session mismatch")
+
+	var anotherCount int
+	models.MustExec(t, models.TestServices.DB.Model(&models.Session{}).Where("user_id = ?", anotherUser.ID).Count(&anotherCount), "counting sessions")
+	assert.Equal(t, anotherCount, 1, "another user's session count mismatch")
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/nadproject/nad/pkg/clock"
 	"github.com/nadproject/nad/pkg/server/context"
 	"github.com/nadproject/nad/pkg/server/log"
+	"github.com/nadproject/nad/pkg/server/metrics"
 	"github.com/nadproject/nad/pkg/server/models"
 	"github.com/pkg/errors"
 )
@@ -19,6 +20,12 @@ import (
 // before which clients must perform a full-sync rather than incremental sync.
 const fullSyncBefore = 0
 
+var syncFragmentItems = metrics.NewHistogramVec(
+	"nad_sync_fragment_items",
+	"Number of notes and books, including the expunged ones, in the sync fragments sent to clients.",
+	[]float64{0, 1, 5, 10, 25, 50, 100},
+)
+
 // SyncFragment contains a piece of information about the server's state.
 // It is used to transfer the server's state to the client gradually without having to
 // transfer the whole state at once.
@@ -45,6 +52,8 @@ type SyncFragNote struct {
 	Body      string    `json:"content"`
 	Public    bool      `json:"public"`
 	Deleted   bool      `json:"deleted"`
+	Encrypted bool      `json:"encrypted"`
+	Tags      []string  `json:"tags"`
 }
 
 // NewFragNote presents the given note as a SyncFragNote
@@ -59,32 +68,38 @@ func NewFragNote(note models.Note) SyncFragNote {
 		Body:      note.Body,
 		Public:    note.Public,
 		Deleted:   note.Deleted,
+		Encrypted: note.Encrypted,
 		BookUUID:  note.BookUUID,
+		Tags:      models.TagNames(note.Tags),
 	}
 }
 
 // SyncFragBook represents a book in a sync fragment and contains only the necessary information
 // for the client to sync the note locally
 type SyncFragBook struct {
-	UUID      string    `json:"uuid"`
-	USN       int       `json:"usn"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	AddedOn   int64     `json:"added_on"`
-	Name      string    `json:"name"`
-	Deleted   bool      `json:"deleted"`
+	UUID       string    `json:"uuid"`
+	USN        int       `json:"usn"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	AddedOn    int64     `json:"added_on"`
+	Name       string    `json:"name"`
+	ParentUUID string    `json:"parent_uuid"`
+	Deleted    bool      `json:"deleted"`
+	Encrypted  bool      `json:"encrypted"`
 }
 
 // NewFragBook presents the given book as a SyncFragBook
 func NewFragBook(book models.Book) SyncFragBook {
 	return SyncFragBook{
-		UUID:      book.UUID,
-		USN:       book.USN,
-		CreatedAt: book.CreatedAt,
-		UpdatedAt: book.UpdatedAt,
-		AddedOn:   book.AddedOn,
-		Name:      book.Name,
-		Deleted:   book.Deleted,
+		UUID:       book.UUID,
+		USN:        book.USN,
+		CreatedAt:  book.CreatedAt,
+		UpdatedAt:  book.UpdatedAt,
+		AddedOn:    book.AddedOn,
+		Name:       book.Name,
+		ParentUUID: book.ParentUUID,
+		Deleted:    book.Deleted,
+		Encrypted:  book.Encrypted,
 	}
 }
 
@@ -288,6 +303,8 @@ func (n *Sync) GetFragment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	syncFragmentItems.Observe(float64(len(fragment.Notes) + len(fragment.Books) + len(fragment.ExpungedNotes) + len(fragment.ExpungedBooks)))
+
 	response := GetSyncFragmentResp{
 		Fragment: fragment,
 	}
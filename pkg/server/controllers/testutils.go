@@ -1,19 +1,57 @@
 package controllers
 
 import (
+	"fmt"
+	"html"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/nadproject/nad/pkg/server/config"
 	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/mailer"
 	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/testutils"
 )
 
+// testEmailTemplateDir is the path to the email templates relative to this package
+var testEmailTemplateDir = "../mailer/templates/src"
+
+func newTestMailer(cfg config.Config) (*mailer.Mailer, *testutils.MockEmailbackendImplementation) {
+	backend := testutils.MockEmailbackendImplementation{}
+	m := mailer.New(cfg, &backend, mailer.NewTemplates(&testEmailTemplateDir))
+
+	return m, &backend
+}
+
 func newReq(t *testing.T, method, path, data string) *http.Request {
 	return httptest.NewRequest(method, path, strings.NewReader(data))
 }
 
+// getInputValue returns the value of the hidden input with the given name in
+// the given page, or an empty string if there is no such input
+func getInputValue(body, name string) string {
+	re := regexp.MustCompile(fmt.Sprintf(`<input type="hidden" name="%s" value="([^"]*)"`, regexp.QuoteMeta(name)))
+
+	m := re.FindStringSubmatch(body)
+	if m == nil {
+		return ""
+	}
+
+	return html.UnescapeString(m[1])
+}
+
+// newFormReq returns a new request submitting the given form, as a browser does
+func newFormReq(t *testing.T, method, path string, form url.Values) *http.Request {
+	req := newReq(t, method, path, form.Encode())
+	req.Header.Set("Content-Type", contentTypeForm)
+
+	return req
+}
+
 func httpDo(t *testing.T, handler http.HandlerFunc, r *http.Request, user *models.User) *httptest.ResponseRecorder {
 	// If a user is provided, set the user in the request context
 	if user != nil {
@@ -0,0 +1,521 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/totp"
+	"github.com/nadproject/nad/pkg/server/views"
+	"github.com/pkg/errors"
+)
+
+const (
+	// totpIssuer is the name under which authenticator apps list the account
+	totpIssuer = "NAD"
+	// totpQRCodeSize is the width and height in pixels of the QR code for setting up
+	totpQRCodeSize = 256
+)
+
+// TwoFactorLoginForm is the form data for completing a sign in with a two-factor code
+type TwoFactorLoginForm struct {
+	Token string `schema:"token" json:"token"`
+	// Code is either a code from the authenticator app or a recovery code
+	Code string `schema:"code" json:"code"`
+}
+
+// TwoFactorForm is the form data for managing two-factor authentication
+type TwoFactorForm struct {
+	Code string `schema:"code" json:"code"`
+}
+
+// twoFactorData is the data for the two-factor authentication settings page
+type twoFactorData struct {
+	Enabled           bool
+	RecoveryCodesLeft int
+	// Secret, ProvisioningURI and QRCode are set while the user is setting up.
+	// QRCode is a data URI of a PNG image of the provisioning URI.
+	Secret          string
+	ProvisioningURI string
+	QRCode          template.URL
+	// RecoveryCodes are the codes that have just been generated
+	RecoveryCodes []string
+}
+
+// isTOTPCode checks if the given code looks like a code from an authenticator
+// app rather than a recovery code
+func isTOTPCode(code string) bool {
+	code = strings.Replace(strings.TrimSpace(code), " ", "", -1)
+	if len(code) != totp.Digits {
+		return false
+	}
+
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// verifyTwoFactorCode verifies the given code from the authenticator app, or
+// uses up the given recovery code, of the given user.
+func (u *Users) verifyTwoFactorCode(user *models.User, code string) error {
+	if isTOTPCode(code) {
+		return u.us.VerifyTOTP(user, code, u.c.Now())
+	}
+
+	return u.rcs.Use(user.ID, code, u.c.Now())
+}
+
+// createTwoFactorLoginToken creates a token with which the given user, who
+// has passed the first step of signing in, completes it with a two-factor code.
+func createTwoFactorLoginToken(ts models.TokenService, c clock.Clock, user *models.User) (string, error) {
+	token := models.Token{
+		UserID:    user.ID,
+		Type:      models.TokenTypeTwoFactorLogin,
+		ExpiresAt: c.Now().Add(twoFactorLoginTokenTTL),
+	}
+	if err := ts.Create(&token); err != nil {
+		return "", errors.Wrap(err, "creating token")
+	}
+
+	return token.Value, nil
+}
+
+// completeTwoFactorLogin creates a session for the user who entered the password
+// if the given code is valid. The sign in can be retried with another code until
+// it expires or runs out of attempts.
+func (u *Users) completeTwoFactorLogin(form TwoFactorLoginForm, r *http.Request) (*models.Session, error) {
+	token, err := u.ts.ByValue(form.Token, models.TokenTypeTwoFactorLogin)
+	if err == models.ErrNotFound {
+		return nil, models.ErrTwoFactorLoginInvalid
+	} else if err != nil {
+		return nil, errors.Wrap(err, "finding token")
+	}
+	if token.UsedAt != nil || !u.c.Now().Before(token.ExpiresAt) {
+		return nil, models.ErrTwoFactorLoginInvalid
+	}
+
+	if err := u.ts.AddAttempt(token, twoFactorLoginMaxAttempts); err != nil {
+		if err == models.ErrTokenInvalid {
+			return nil, models.ErrTwoFactorLoginInvalid
+		}
+
+		return nil, err
+	}
+
+	user, err := u.us.ByID(token.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding user")
+	}
+
+	if err := u.verifyTwoFactorCode(user, form.Code); err != nil {
+		return nil, err
+	}
+
+	if err := u.ts.Use(token, u.c.Now(), nil); err != nil {
+		if err == models.ErrTokenInvalid {
+			return nil, models.ErrTwoFactorLoginInvalid
+		}
+
+		return nil, err
+	}
+
+	return u.signIn(user, r)
+}
+
+// LoginTwoFactor handles POST /login/2fa
+func (u *Users) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	vd := views.Data{}
+
+	var form TwoFactorLoginForm
+	if err := parseForm(r, &form); err != nil {
+		vd.SetAlert(err)
+		u.renderLogin(w, r, vd)
+		return
+	}
+
+	s, err := u.completeTwoFactorLogin(form, r)
+	if err == models.ErrTwoFactorLoginInvalid {
+		vd.SetAlert(err)
+		u.renderLogin(w, r, vd)
+		return
+	}
+	if err != nil {
+		handleHTMLError(w, err, "completing two-factor login", &vd)
+		vd.Yield = TwoFactorLoginForm{Token: form.Token}
+		u.LoginTwoFactorView.Render(w, r, vd)
+		return
+	}
+
+	setSessionCookie(w, s.Key, s.ExpiresAt)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// V1LoginTwoFactor handles POST /api/v1/login/2fa
+func (u *Users) V1LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var form TwoFactorLoginForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	s, err := u.completeTwoFactorLogin(form, r)
+	if err != nil {
+		handleJSONError(w, err, "completing two-factor login")
+		return
+	}
+
+	respondWithSession(w, http.StatusOK, *s)
+}
+
+// setupTwoFactor generates a new TOTP secret for the given user. Two-factor
+// authentication is not enabled until the user enters a code generated from it.
+func (u *Users) setupTwoFactor(user *models.User) (string, error) {
+	if user.TOTPEnabled {
+		return "", models.ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", errors.Wrap(err, "generating secret")
+	}
+
+	user.TOTPSecret = secret
+	if err := u.us.UpdateTOTP(user); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// enableTwoFactor enables two-factor authentication for the given user if the
+// given code is valid, and returns new recovery codes.
+func (u *Users) enableTwoFactor(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, models.ErrTwoFactorEnabled
+	}
+
+	if err := u.us.VerifyTOTP(user, code, u.c.Now()); err != nil {
+		return nil, err
+	}
+
+	codes, err := u.rcs.Generate(user.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating recovery codes")
+	}
+
+	user.TOTPEnabled = true
+	if err := u.us.UpdateTOTP(user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// disableTwoFactor disables two-factor authentication for the given user if
+// the given code is valid, and removes the secret and the recovery codes.
+func (u *Users) disableTwoFactor(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return models.ErrTwoFactorNotEnabled
+	}
+
+	if err := u.verifyTwoFactorCode(user, code); err != nil {
+		return err
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	if err := u.us.UpdateTOTP(user); err != nil {
+		return err
+	}
+
+	if err := u.rcs.Replace(user.ID, nil); err != nil {
+		return errors.Wrap(err, "deleting recovery codes")
+	}
+
+	return nil
+}
+
+// regenerateRecoveryCodes replaces the recovery codes of the given user if
+// the given code is valid.
+func (u *Users) regenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, models.ErrTwoFactorNotEnabled
+	}
+
+	if err := u.verifyTwoFactorCode(user, code); err != nil {
+		return nil, err
+	}
+
+	return u.rcs.Generate(user.ID)
+}
+
+func (u *Users) getTwoFactorData(user *models.User) (twoFactorData, error) {
+	ret := twoFactorData{
+		Enabled: user.TOTPEnabled,
+	}
+
+	if user.TOTPEnabled {
+		count, err := u.rcs.CountUnused(user.ID)
+		if err != nil {
+			return ret, errors.Wrap(err, "counting recovery codes")
+		}
+
+		ret.RecoveryCodesLeft = count
+	}
+
+	return ret, nil
+}
+
+// renderTwoFactor renders the two-factor authentication settings page of the given user
+func (u *Users) renderTwoFactor(w http.ResponseWriter, r *http.Request, user *models.User, vd views.Data, update func(*twoFactorData)) {
+	data, err := u.getTwoFactorData(user)
+	if err != nil {
+		handleHTMLError(w, err, "getting two-factor settings", &vd)
+	}
+	if update != nil {
+		update(&data)
+	}
+
+	vd.Yield = data
+	u.TwoFactorView.Render(w, r, vd)
+}
+
+// withSetup displays the secret of the given user for setting up an authenticator app
+func withSetup(user *models.User) func(*twoFactorData) {
+	return func(d *twoFactorData) {
+		d.Secret = user.TOTPSecret
+		d.ProvisioningURI = totp.ProvisioningURI(totpIssuer, user.Email, user.TOTPSecret)
+
+		// The secret can still be entered manually without the image.
+		png, err := totp.QRCode(d.ProvisioningURI, totpQRCodeSize)
+		if err != nil {
+			logError(err, "generating the QR code")
+			return
+		}
+		d.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+}
+
+// withRecoveryCodes displays the given recovery codes that have just been generated
+func withRecoveryCodes(codes []string) func(*twoFactorData) {
+	return func(d *twoFactorData) {
+		d.RecoveryCodes = codes
+	}
+}
+
+// TwoFactor handles GET /settings/2fa
+func (u *Users) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	u.renderTwoFactor(w, r, user, views.Data{}, nil)
+}
+
+// SetupTwoFactor handles POST /settings/2fa
+func (u *Users) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var vd views.Data
+	if _, err := u.setupTwoFactor(user); err != nil {
+		handleHTMLError(w, err, "setting up two-factor authentication", &vd)
+		u.renderTwoFactor(w, r, user, vd, nil)
+		return
+	}
+
+	u.renderTwoFactor(w, r, user, vd, withSetup(user))
+}
+
+// EnableTwoFactor handles POST /settings/2fa/enable
+func (u *Users) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var vd views.Data
+	var form TwoFactorForm
+	if err := parseForm(r, &form); err != nil {
+		vd.SetAlert(err)
+		u.renderTwoFactor(w, r, user, vd, withSetup(user))
+		return
+	}
+
+	codes, err := u.enableTwoFactor(user, form.Code)
+	if err != nil {
+		handleHTMLError(w, err, "enabling two-factor authentication", &vd)
+		if user.TOTPEnabled || user.TOTPSecret == "" {
+			u.renderTwoFactor(w, r, user, vd, nil)
+		} else {
+			u.renderTwoFactor(w, r, user, vd, withSetup(user))
+		}
+		return
+	}
+
+	vd.Alert = &views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Two-factor authentication has been enabled. Save the recovery codes now, as they will not be shown again.",
+	}
+	u.renderTwoFactor(w, r, user, vd, withRecoveryCodes(codes))
+}
+
+// DisableTwoFactor handles POST /settings/2fa/disable
+func (u *Users) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form TwoFactorForm
+	err := parseForm(r, &form)
+	if err == nil {
+		err = u.disableTwoFactor(user, form.Code)
+	}
+	if err != nil {
+		logError(err, "disabling two-factor authentication")
+
+		var vd views.Data
+		vd.SetAlert(err)
+		views.RedirectAlert(w, r, "/settings/2fa", http.StatusFound, *vd.Alert)
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Two-factor authentication has been disabled.",
+	}
+	views.RedirectAlert(w, r, "/settings/2fa", http.StatusFound, alert)
+}
+
+// RegenerateRecoveryCodes handles POST /settings/2fa/recovery-codes
+func (u *Users) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var vd views.Data
+	var form TwoFactorForm
+	if err := parseForm(r, &form); err != nil {
+		vd.SetAlert(err)
+		u.renderTwoFactor(w, r, user, vd, nil)
+		return
+	}
+
+	codes, err := u.regenerateRecoveryCodes(user, form.Code)
+	if err != nil {
+		handleHTMLError(w, err, "regenerating recovery codes", &vd)
+		u.renderTwoFactor(w, r, user, vd, nil)
+		return
+	}
+
+	vd.Alert = &views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "New recovery codes have been generated. Save them now, as they will not be shown again.",
+	}
+	u.renderTwoFactor(w, r, user, vd, withRecoveryCodes(codes))
+}
+
+// TwoFactorStatusResp is the response containing the two-factor authentication settings of a user
+type TwoFactorStatusResp struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorSetupResp is the response from setting up two-factor authentication
+type TwoFactorSetupResp struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodesResp is the response containing recovery codes that have just been generated
+type RecoveryCodesResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// V1GetTwoFactor handles GET /api/v1/2fa
+func (u *Users) V1GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	data, err := u.getTwoFactorData(user)
+	if err != nil {
+		handleJSONError(w, err, "getting two-factor settings")
+		return
+	}
+
+	resp := TwoFactorStatusResp{
+		Enabled:           data.Enabled,
+		RecoveryCodesLeft: data.RecoveryCodesLeft,
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// V1SetupTwoFactor handles POST /api/v1/2fa
+func (u *Users) V1SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	secret, err := u.setupTwoFactor(user)
+	if err != nil {
+		handleJSONError(w, err, "setting up two-factor authentication")
+		return
+	}
+
+	resp := TwoFactorSetupResp{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, user.Email, secret),
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// V1EnableTwoFactor handles POST /api/v1/2fa/enable
+func (u *Users) V1EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form TwoFactorForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	codes, err := u.enableTwoFactor(user, form.Code)
+	if err != nil {
+		handleJSONError(w, err, "enabling two-factor authentication")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, RecoveryCodesResp{RecoveryCodes: codes})
+}
+
+// V1DisableTwoFactor handles DELETE /api/v1/2fa
+func (u *Users) V1DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form TwoFactorForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	if err := u.disableTwoFactor(user, form.Code); err != nil {
+		handleJSONError(w, err, "disabling two-factor authentication")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// V1RegenerateRecoveryCodes handles POST /api/v1/2fa/recovery-codes
+func (u *Users) V1RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	var form TwoFactorForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	codes, err := u.regenerateRecoveryCodes(user, form.Code)
+	if err != nil {
+		handleJSONError(w, err, "regenerating recovery codes")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, RecoveryCodesResp{RecoveryCodes: codes})
+}
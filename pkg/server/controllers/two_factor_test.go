@@ -0,0 +1,322 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/totp"
+	"github.com/pkg/errors"
+)
+
+// setupTwoFactorUser enables two-factor authentication for the given user
+// and returns the recovery codes.
+func setupTwoFactorUser(t *testing.T, user *models.User, secret string) []string {
+	user.TOTPSecret = secret
+	user.TOTPEnabled = true
+	if err := models.TestServices.User.UpdateTOTP(user); err != nil {
+		t.Fatal(errors.Wrap(err, "updating totp"))
+	}
+
+	codes, err := models.TestServices.RecoveryCode.Generate(user.ID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generating recovery codes"))
+	}
+
+	return codes
+}
+
+func mustTOTPCode(t *testing.T, secret string, now time.Time) string {
+	code, err := totp.Code(secret, now)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generating code"))
+	}
+
+	return code
+}
+
+func TestUsersLoginTwoFactor(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	setupTwoFactorUser(t, &user, "JBSWY3DPEHPK3PXP")
+
+	m, _ := newTestMailer(cfg)
+	usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	form := url.Values{}
+	form.Set("email", "alice@example.com")
+	form.Set("password", "pass1234")
+	w := httpDo(t, usersC.Login, newFormReq(t, "POST", "/login", form), nil)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	var token models.Token
+	models.MustExec(t, models.TestServices.DB.Where("user_id = ? AND type = ?", user.ID, models.TokenTypeTwoFactorLogin).First(&token), "finding token")
+	assert.Equal(t, getInputValue(w.Body.String(), "token"), token.Value, "form token mismatch")
+}
+
+func TestUsersV1LoginTwoFactor(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	c := clock.NewMock()
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	c.SetNow(now)
+
+	secret := "JBSWY3DPEHPK3PXP"
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	recoveryCodes := setupTwoFactorUser(t, &user, secret)
+
+	m, _ := newTestMailer(cfg)
+	usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, c, models.TestServices.DB)
+
+	login := func(t *testing.T) string {
+		req := newReq(t, "POST", "/api/v1/login", `{"email": "alice@example.com", "password": "pass1234"}`)
+		w := httpDo(t, usersC.V1Login, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var payload TwoFactorLoginResp
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+		assert.Equal(t, payload.TwoFactorRequired, true, "two_factor_required mismatch")
+		assert.NotEqual(t, payload.TwoFactorToken, "", "two_factor_token mismatch")
+
+		return payload.TwoFactorToken
+	}
+
+	countSessions := func(t *testing.T) int {
+		var count int
+		models.MustExec(t, models.TestServices.DB.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&count), "counting sessions")
+		return count
+	}
+
+	t.Run("password only", func(t *testing.T) {
+		sessionCount := countSessions(t)
+		login(t)
+
+		assert.Equal(t, countSessions(t), sessionCount, "session count mismatch")
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		token := login(t)
+
+		req := newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "000000"}`, token))
+		w := httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+	})
+
+	t.Run("totp code", func(t *testing.T) {
+		token := login(t)
+		sessionCount := countSessions(t)
+
+		req := newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "%s"}`, token, mustTOTPCode(t, secret, now)))
+		w := httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+		assert.Equal(t, countSessions(t), sessionCount+1, "session count mismatch")
+
+		// The token cannot be used again
+		req = newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "%s"}`, token, recoveryCodes[1]))
+		w = httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+	})
+
+	t.Run("replayed totp code", func(t *testing.T) {
+		token := login(t)
+
+		req := newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "%s"}`, token, mustTOTPCode(t, secret, now)))
+		w := httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		token := login(t)
+		sessionCount := countSessions(t)
+
+		req := newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "%s"}`, token, recoveryCodes[0]))
+		w := httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+		assert.Equal(t, countSessions(t), sessionCount+1, "session count mismatch")
+
+		// The recovery code cannot be used again
+		token = login(t)
+		req = newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "%s"}`, token, recoveryCodes[0]))
+		w = httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		token := login(t)
+		sessionCount := countSessions(t)
+
+		for i := 0; i < twoFactorLoginMaxAttempts; i++ {
+			req := newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "000000"}`, token))
+			w := httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+			assert.Equal(t, w.Code, http.StatusBadRequest, fmt.Sprintf("status code mismatch for attempt %d", i))
+		}
+
+		// A valid code is rejected once the attempts run out
+		req := newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "%s"}`, token, recoveryCodes[3]))
+		w := httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+		assert.Equal(t, strings.TrimSpace(w.Body.String()), models.ErrTwoFactorLoginInvalid.Public(), "error mismatch")
+		assert.Equal(t, countSessions(t), sessionCount, "session count mismatch")
+
+		// The recovery code has not been used up
+		token = login(t)
+		req = newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "%s"}`, token, recoveryCodes[3]))
+		w = httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		token := login(t)
+		c.SetNow(now.Add(twoFactorLoginTokenTTL))
+		defer c.SetNow(now)
+
+		req := newReq(t, "POST", "/api/v1/login/2fa", fmt.Sprintf(`{"token": "%s", "code": "%s"}`, token, recoveryCodes[2]))
+		w := httpDo(t, usersC.V1LoginTwoFactor, req, nil)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+	})
+}
+
+func TestUsersSetupTwoFactor(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+
+	m, _ := newTestMailer(cfg)
+	usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	req := newFormReq(t, "POST", "/settings/2fa", url.Values{})
+	w := httpDo(t, usersC.SetupTwoFactor, req, &user)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+	body := w.Body.String()
+	assert.Equal(t, strings.Contains(body, `<img src="data:image/png;base64,`), true, "QR code mismatch")
+	assert.Equal(t, strings.Contains(body, user.TOTPSecret), true, "secret mismatch")
+}
+
+func TestUsersV1EnableTwoFactor(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	c := clock.NewMock()
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	c.SetNow(now)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	m, _ := newTestMailer(cfg)
+	usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, c, models.TestServices.DB)
+
+	findUser := func(t *testing.T) models.User {
+		var ret models.User
+		models.MustExec(t, models.TestServices.DB.Where("id = ?", user.ID).First(&ret), "finding user")
+		return ret
+	}
+
+	t.Run("enable before set up", func(t *testing.T) {
+		req := newReq(t, "POST", "/api/v1/2fa/enable", `{"code": "123456"}`)
+		w := httpDo(t, usersC.V1EnableTwoFactor, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+	})
+
+	var secret string
+	t.Run("set up", func(t *testing.T) {
+		req := newReq(t, "POST", "/api/v1/2fa", "")
+		w := httpDo(t, usersC.V1SetupTwoFactor, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var payload TwoFactorSetupResp
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+		secret = payload.Secret
+
+		userRecord := findUser(t)
+		assert.Equal(t, userRecord.TOTPSecret, secret, "secret mismatch")
+		assert.Equal(t, userRecord.TOTPEnabled, false, "enabled mismatch")
+		assert.Equal(t, payload.ProvisioningURI, totp.ProvisioningURI(totpIssuer, "alice@example.com", secret), "provisioning uri mismatch")
+	})
+
+	t.Run("enable with wrong code", func(t *testing.T) {
+		u := findUser(t)
+		req := newReq(t, "POST", "/api/v1/2fa/enable", `{"code": "000000"}`)
+		w := httpDo(t, usersC.V1EnableTwoFactor, req, &u)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+		assert.Equal(t, findUser(t).TOTPEnabled, false, "enabled mismatch")
+	})
+
+	t.Run("enable", func(t *testing.T) {
+		u := findUser(t)
+		req := newReq(t, "POST", "/api/v1/2fa/enable", fmt.Sprintf(`{"code": "%s"}`, mustTOTPCode(t, secret, now)))
+		w := httpDo(t, usersC.V1EnableTwoFactor, req, &u)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var payload RecoveryCodesResp
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+		assert.Equal(t, len(payload.RecoveryCodes), models.RecoveryCodeCount, "recovery code count mismatch")
+		assert.Equal(t, findUser(t).TOTPEnabled, true, "enabled mismatch")
+
+		var codeRecord models.RecoveryCode
+		models.MustExec(t, models.TestServices.DB.Where("user_id = ?", user.ID).First(&codeRecord), "finding recovery code")
+		assert.NotEqual(t, codeRecord.CodeHash, payload.RecoveryCodes[0], "recovery code should not be stored")
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		u := findUser(t)
+		req := newReq(t, "DELETE", "/api/v1/2fa", fmt.Sprintf(`{"code": "%s"}`, mustTOTPCode(t, secret, now.Add(totp.Period*time.Second))))
+		w := httpDo(t, usersC.V1DisableTwoFactor, req, &u)
+
+		assert.Equal(t, w.Code, http.StatusNoContent, "status code mismatch")
+
+		userRecord := findUser(t)
+		assert.Equal(t, userRecord.TOTPEnabled, false, "enabled mismatch")
+		assert.Equal(t, userRecord.TOTPSecret, "", "secret mismatch")
+
+		var codeCount int
+		models.MustExec(t, models.TestServices.DB.Model(&models.RecoveryCode{}).Where("user_id = ?", user.ID).Count(&codeCount), "counting recovery codes")
+		assert.Equal(t, codeCount, 0, "recovery code count mismatch")
+	})
+}
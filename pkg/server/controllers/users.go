@@ -4,33 +4,73 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/nadproject/nad/pkg/clock"
 	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/mailer"
 	"github.com/nadproject/nad/pkg/server/models"
 	"github.com/nadproject/nad/pkg/server/views"
 	"github.com/pkg/errors"
 )
 
+const (
+	// passwordResetTokenTTL is how long a password reset link stays valid
+	passwordResetTokenTTL = time.Hour
+	// emailVerificationTokenTTL is how long an email verification link stays valid
+	emailVerificationTokenTTL = 24 * time.Hour
+	// emailVerificationInterval is the minimum interval between verification emails for a user
+	emailVerificationInterval = time.Minute
+	// twoFactorLoginTokenTTL is how long a user has to enter a two-factor code after entering the password
+	twoFactorLoginTokenTTL = 5 * time.Minute
+	// twoFactorLoginMaxAttempts is how many codes a user can enter before having to enter the password again
+	twoFactorLoginMaxAttempts = 5
+)
+
 // NewUsers creates a new Users controller.
 // It panics if the necessary templates are not parsed.
-func NewUsers(cfg config.Config, us models.UserService, ss models.SessionService) *Users {
+func NewUsers(cfg config.Config, us models.UserService, ss models.SessionService, ts models.TokenService, rcs models.RecoveryCodeService, ats models.AccessTokenService, m *mailer.Mailer, cl clock.Clock, db *gorm.DB) *Users {
 	return &Users{
-		NewView:   views.NewView(cfg.PageTemplateDir, views.Config{Title: "Join", Layout: "base"}, "users/new"),
-		LoginView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "Sign in", Layout: "base"}, "users/login"),
-		us:        us,
-		ss:        ss,
-		onPremise: cfg.OnPremise,
+		NewView:            views.NewView(cfg.PageTemplateDir, views.Config{Title: "Join", Layout: "base"}, "users/new"),
+		LoginView:          views.NewView(cfg.PageTemplateDir, views.Config{Title: "Sign in", Layout: "base"}, "users/login"),
+		LoginTwoFactorView: views.NewView(cfg.PageTemplateDir, views.Config{Title: "Two-factor authentication", Layout: "base"}, "users/login_two_factor"),
+		ForgotPwView:       views.NewView(cfg.PageTemplateDir, views.Config{Title: "Reset password", Layout: "base"}, "users/forgot_password"),
+		ResetPwView:        views.NewView(cfg.PageTemplateDir, views.Config{Title: "Reset password", Layout: "base"}, "users/reset_password"),
+		TwoFactorView:      views.NewView(cfg.PageTemplateDir, views.Config{Title: "Two-factor authentication", Layout: "base", HeaderTemplate: "navbar"}, "users/two_factor"),
+		SettingsView:       views.NewView(cfg.PageTemplateDir, views.Config{Title: "Settings", Layout: "base", HeaderTemplate: "navbar"}, "users/settings"),
+		us:                 us,
+		ss:                 ss,
+		ts:                 ts,
+		rcs:                rcs,
+		ats:                ats,
+		mailer:             m,
+		c:                  cl,
+		db:                 db,
+		onPremise:          cfg.OnPremise,
+		oidcEnabled:        cfg.OIDC.Enabled(),
 	}
 }
 
 // Users is a user controller.
 type Users struct {
-	NewView      *views.View
-	LoginView    *views.View
-	ForgotPwView *views.View
-	ResetPwView  *views.View
-	us           models.UserService
-	ss           models.SessionService
-	onPremise    bool
+	NewView            *views.View
+	LoginView          *views.View
+	LoginTwoFactorView *views.View
+	ForgotPwView       *views.View
+	ResetPwView        *views.View
+	TwoFactorView      *views.View
+	SettingsView       *views.View
+	us                 models.UserService
+	ss                 models.SessionService
+	ts                 models.TokenService
+	rcs                models.RecoveryCodeService
+	ats                models.AccessTokenService
+	mailer             *mailer.Mailer
+	c                  clock.Clock
+	db                 *gorm.DB
+	onPremise          bool
+	oidcEnabled        bool
 }
 
 // New handles GET /register
@@ -75,7 +115,12 @@ func (u *Users) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s, err := u.signIn(&user)
+	// The account has already been created, so a failure to send the email should not fail the registration
+	if err := u.sendEmailVerification(&user); err != nil {
+		logError(err, "sending email verification")
+	}
+
+	s, err := u.signIn(&user, r)
 	if err != nil {
 		http.Redirect(w, r, "/login", http.StatusFound)
 		return
@@ -96,54 +141,109 @@ type LoginForm struct {
 	Password string `schema:"password" json:"password"`
 }
 
-func (u *Users) login(r *http.Request) (*models.Session, error) {
+// loginResult is the outcome of signing in with a password. If the user has
+// enabled two-factor authentication, TwoFactorToken is set instead of Session
+// and the sign in needs to be completed with a two-factor code.
+type loginResult struct {
+	Session        *models.Session
+	TwoFactorToken string
+}
+
+func (u *Users) login(r *http.Request) (loginResult, error) {
 	var form LoginForm
 	if err := parseRequestData(r, &form); err != nil {
-		return nil, err
+		return loginResult{}, err
 	}
 
 	user, err := u.us.Authenticate(form.Email, form.Password)
 	if err != nil {
 		// If the user is not found, treat it as invalid login
 		if err == models.ErrNotFound {
-			return nil, models.ErrLoginInvalid
+			return loginResult{}, models.ErrLoginInvalid
 		}
 
-		return nil, err
+		return loginResult{}, err
 	}
 
-	s, err := u.signIn(user)
+	if user.TOTPEnabled {
+		token, err := createTwoFactorLoginToken(u.ts, u.c, user)
+		if err != nil {
+			return loginResult{}, err
+		}
+
+		return loginResult{TwoFactorToken: token}, nil
+	}
+
+	s, err := u.signIn(user, r)
 	if err != nil {
-		return nil, err
+		return loginResult{}, err
 	}
 
-	return s, nil
+	return loginResult{Session: s}, nil
+}
+
+// loginData is the data for the login page
+type loginData struct {
+	OIDCEnabled bool
+}
+
+// renderLogin renders the login page
+func (u *Users) renderLogin(w http.ResponseWriter, r *http.Request, vd views.Data) {
+	vd.Yield = loginData{OIDCEnabled: u.oidcEnabled}
+	u.LoginView.Render(w, r, vd)
+}
+
+// LoginPage handles GET /login
+func (u *Users) LoginPage(w http.ResponseWriter, r *http.Request) {
+	u.renderLogin(w, r, views.Data{})
 }
 
 // Login handles POST: /login
 func (u *Users) Login(w http.ResponseWriter, r *http.Request) {
 	vd := views.Data{}
 
-	s, err := u.login(r)
+	res, err := u.login(r)
 	if err != nil {
 		handleHTMLError(w, err, "logging in user", &vd)
-		u.LoginView.Render(w, r, vd)
+		u.renderLogin(w, r, vd)
 		return
 	}
 
-	setSessionCookie(w, s.Key, s.ExpiresAt)
+	if res.Session == nil {
+		vd.Yield = TwoFactorLoginForm{Token: res.TwoFactorToken}
+		u.LoginTwoFactorView.Render(w, r, vd)
+		return
+	}
+
+	setSessionCookie(w, res.Session.Key, res.Session.ExpiresAt)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// TwoFactorLoginResp is the response from signing in with a password when the
+// user has enabled two-factor authentication
+type TwoFactorLoginResp struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	TwoFactorToken    string `json:"two_factor_token"`
+}
+
 // V1Login handles POST /api/v1/login
 func (u *Users) V1Login(w http.ResponseWriter, r *http.Request) {
-	s, err := u.login(r)
+	res, err := u.login(r)
 	if err != nil {
 		handleJSONError(w, err, "logging in user")
 		return
 	}
 
-	respondWithSession(w, http.StatusOK, *s)
+	if res.Session == nil {
+		resp := TwoFactorLoginResp{
+			TwoFactorRequired: true,
+			TwoFactorToken:    res.TwoFactorToken,
+		}
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	respondWithSession(w, http.StatusOK, *res.Session)
 }
 
 // logout deletes a user session.
@@ -185,39 +285,413 @@ func (u *Users) V1Logout(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// EncryptionForm is the form data for setting up the end-to-end encryption
+type EncryptionForm struct {
+	Salt     string `schema:"salt" json:"salt"`
+	KeyCheck string `schema:"key_check" json:"key_check"`
+}
+
+// EncryptionResp is a response containing the encryption settings of a user.
+// Both fields are empty if the encryption has not been set up.
+type EncryptionResp struct {
+	Salt     string `json:"salt"`
+	KeyCheck string `json:"key_check"`
+}
+
+// V1GetEncryption handles GET /api/v1/encryption
+func (u *Users) V1GetEncryption(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	resp := EncryptionResp{
+		Salt:     user.EncryptionSalt,
+		KeyCheck: user.EncryptionKeyCheck,
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (u *Users) setEncryption(r *http.Request) (*models.User, error) {
+	var form EncryptionForm
+	if err := parseRequestData(r, &form); err != nil {
+		return nil, err
+	}
+
+	if form.Salt == "" {
+		return nil, models.ErrEncryptionSaltRequired
+	}
+	if form.KeyCheck == "" {
+		return nil, models.ErrEncryptionKeyCheckRequired
+	}
+
+	// The salt cannot be replaced because the data encrypted with the key
+	// derived from it would become unreadable for the other clients.
+	user := context.User(r.Context())
+	if user.EncryptionSalt != "" {
+		return nil, models.ErrEncryptionConfigured
+	}
+
+	user.EncryptionSalt = form.Salt
+	user.EncryptionKeyCheck = form.KeyCheck
+	if err := u.us.Update(user, nil); err != nil {
+		return nil, errors.Wrap(err, "updating the user")
+	}
+
+	return user, nil
+}
+
+// V1SetEncryption handles PUT /api/v1/encryption
+func (u *Users) V1SetEncryption(w http.ResponseWriter, r *http.Request) {
+	user, err := u.setEncryption(r)
+	if err != nil {
+		handleJSONError(w, err, "setting up encryption")
+		return
+	}
+
+	resp := EncryptionResp{
+		Salt:     user.EncryptionSalt,
+		KeyCheck: user.EncryptionKeyCheck,
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
 // ResetPwForm is used to process the forgot password form
 // and the reset password form.
 type ResetPwForm struct {
-	Email    string `schema:"email"`
-	Token    string `schema:"token"`
-	Password string `schema:"password"`
+	Email                string `schema:"email" json:"email"`
+	Token                string `schema:"token" json:"token"`
+	Password             string `schema:"password" json:"password"`
+	PasswordConfirmation string `schema:"password_confirmation" json:"password_confirmation"`
+}
+
+// requestPwReset emails a password reset link to the user with the given email.
+// It does not tell if the user exists, so that the form cannot be used to find
+// out which email addresses have an account.
+func (u *Users) requestPwReset(form ResetPwForm) error {
+	if form.Email == "" {
+		return models.ErrEmailRequired
+	}
+
+	user, err := u.us.ByEmail(form.Email)
+	if err == models.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "finding user")
+	}
+
+	token := models.Token{
+		UserID:    user.ID,
+		Type:      models.TokenTypeResetPassword,
+		ExpiresAt: u.c.Now().Add(passwordResetTokenTTL),
+	}
+	if err := u.ts.Create(&token); err != nil {
+		return errors.Wrap(err, "creating token")
+	}
+
+	if err := u.mailer.SendPasswordResetEmail(user.Email, token.Value); err != nil {
+		return errors.Wrap(err, "sending password reset email")
+	}
+
+	return nil
+}
+
+// completePwReset sets the new password for the user who owns the token in the
+// given form, signs the user out of all sessions and revokes the access tokens.
+func (u *Users) completePwReset(form ResetPwForm) error {
+	if form.Password == "" {
+		return models.ErrPasswordRequired
+	}
+	if form.Password != form.PasswordConfirmation {
+		return models.ErrPasswordConfirmationMismatch
+	}
+
+	tx := u.db.Begin()
+
+	token, err := u.ts.Redeem(form.Token, models.TokenTypeResetPassword, u.c.Now(), tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	user, err := u.us.ByID(token.UserID)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "finding user")
+	}
+
+	user.Password = form.Password
+	if err := u.us.Update(user, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := u.ats.DeleteByUserID(user.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	if _, err := u.ss.DeleteByUserID(user.ID); err != nil {
+		return errors.Wrap(err, "deleting sessions")
+	}
+
+	// The password has already been changed, so a failure to notify should not fail the request
+	if err := u.mailer.SendPasswordResetAlertEmail(user.Email); err != nil {
+		logError(err, "sending password reset alert email")
+	}
+
+	return nil
+}
+
+// RequestPwReset handles POST /password-reset
+func (u *Users) RequestPwReset(w http.ResponseWriter, r *http.Request) {
+	var vd views.Data
+	var form ResetPwForm
+	if err := parseForm(r, &form); err != nil {
+		vd.SetAlert(err)
+		u.ForgotPwView.Render(w, r, vd)
+		return
+	}
+
+	if err := u.requestPwReset(form); err != nil {
+		handleHTMLError(w, err, "requesting password reset", &vd)
+		u.ForgotPwView.Render(w, r, vd)
+		return
+	}
+
+	vd.Alert = &views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "If the email address has an account, a link to reset the password has been sent to it.",
+	}
+	u.ForgotPwView.Render(w, r, vd)
 }
 
-// ResetPw displays the reset password form and has a method
-// so that we can prefill the form data with a token provided
-// via the URL query params.
+// ResetPw displays the reset password form for the token in the URL.
 //
-// GET /reset
+// GET /password-reset/:token
 func (u *Users) ResetPw(w http.ResponseWriter, r *http.Request) {
 	var vd views.Data
-	var form ResetPwForm
+	form := ResetPwForm{
+		Token: mux.Vars(r)["token"],
+	}
+	vd.Yield = &form
+	u.ResetPwView.Render(w, r, vd)
+}
+
+// CompletePwReset handles POST /password-reset/:token
+func (u *Users) CompletePwReset(w http.ResponseWriter, r *http.Request) {
+	var vd views.Data
+	form := ResetPwForm{
+		Token: mux.Vars(r)["token"],
+	}
 	vd.Yield = &form
-	if err := parseURLParams(r, &form); err != nil {
+	if err := parseForm(r, &form); err != nil {
 		vd.SetAlert(err)
+		u.ResetPwView.Render(w, r, vd)
+		return
 	}
-	u.ResetPwView.Render(w, r, vd)
+
+	if err := u.completePwReset(form); err != nil {
+		handleHTMLError(w, err, "resetting password", &vd)
+		u.ResetPwView.Render(w, r, vd)
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Your password has been updated, and your personal access tokens have been revoked. Please sign in with the new password.",
+	}
+	views.RedirectAlert(w, r, "/login", http.StatusFound, alert)
+}
+
+// V1RequestPwReset handles POST /api/v1/password-reset
+func (u *Users) V1RequestPwReset(w http.ResponseWriter, r *http.Request) {
+	var form ResetPwForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	if err := u.requestPwReset(form); err != nil {
+		handleJSONError(w, err, "requesting password reset")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// V1CompletePwReset handles PATCH /api/v1/password-reset
+func (u *Users) V1CompletePwReset(w http.ResponseWriter, r *http.Request) {
+	var form ResetPwForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	if err := u.completePwReset(form); err != nil {
+		handleJSONError(w, err, "resetting password")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendEmailVerification emails a link to verify the email address of the given user.
+func (u *Users) sendEmailVerification(user *models.User) error {
+	token := models.Token{
+		UserID:    user.ID,
+		Type:      models.TokenTypeEmailVerification,
+		ExpiresAt: u.c.Now().Add(emailVerificationTokenTTL),
+	}
+	if err := u.ts.Create(&token); err != nil {
+		return errors.Wrap(err, "creating token")
+	}
+
+	if err := u.mailer.SendEmailVerificationEmail(user.Email, token.Value); err != nil {
+		return errors.Wrap(err, "sending email verification email")
+	}
+
+	return nil
+}
+
+// resendEmailVerification sends another verification email to the given user,
+// unless the email is already verified or an email has been sent too recently.
+func (u *Users) resendEmailVerification(user *models.User) error {
+	if user.EmailVerified {
+		return models.ErrEmailAlreadyVerified
+	}
+
+	latest, err := u.ts.LatestByUserID(user.ID, models.TokenTypeEmailVerification)
+	if err != nil && err != models.ErrNotFound {
+		return errors.Wrap(err, "finding the latest token")
+	}
+	// Derive the issue time from the expiry so that it is measured with the same clock
+	if err == nil && u.c.Now().Sub(latest.ExpiresAt.Add(-emailVerificationTokenTTL)) < emailVerificationInterval {
+		return models.ErrVerificationTooFrequent
+	}
+
+	return u.sendEmailVerification(user)
+}
+
+// verifyEmail marks the email of the user who owns the given token as verified.
+func (u *Users) verifyEmail(tokenValue string) error {
+	tx := u.db.Begin()
+
+	token, err := u.ts.Redeem(tokenValue, models.TokenTypeEmailVerification, u.c.Now(), tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	user, err := u.us.ByID(token.UserID)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "finding user")
+	}
+
+	user.EmailVerified = true
+	if err := u.us.Update(user, tx); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "updating user")
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+// VerifyEmail handles GET /verify-email/:token
+func (u *Users) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if err := u.verifyEmail(mux.Vars(r)["token"]); err != nil {
+		logError(err, "verifying email")
+
+		alert := views.Alert{
+			Level:   views.AlertLvlError,
+			Message: "The verification link is invalid or has expired.",
+		}
+		views.RedirectAlert(w, r, "/", http.StatusFound, alert)
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Your email has been verified.",
+	}
+	views.RedirectAlert(w, r, "/", http.StatusFound, alert)
+}
+
+// ResendEmailVerification handles POST /verify-email
+func (u *Users) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	if err := u.resendEmailVerification(user); err != nil {
+		logError(err, "resending email verification")
+
+		var vd views.Data
+		vd.SetAlert(err)
+		views.RedirectAlert(w, r, "/", http.StatusFound, *vd.Alert)
+		return
+	}
+
+	alert := views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "A verification email has been sent.",
+	}
+	views.RedirectAlert(w, r, "/", http.StatusFound, alert)
+}
+
+// VerifyEmailForm is the form data for verifying an email
+type VerifyEmailForm struct {
+	Token string `json:"token"`
+}
+
+// V1VerifyEmail handles PATCH /api/v1/verify-email
+func (u *Users) V1VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var form VerifyEmailForm
+	if err := parseRequestData(r, &form); err != nil {
+		handleJSONError(w, err, "parsing request")
+		return
+	}
+
+	if err := u.verifyEmail(form.Token); err != nil {
+		handleJSONError(w, err, "verifying email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// V1ResendEmailVerification handles POST /api/v1/verification-token
+func (u *Users) V1ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+
+	if err := u.resendEmailVerification(user); err != nil {
+		handleJSONError(w, err, "resending email verification")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // signIn is used to sign the given user by creating a session
-func (u *Users) signIn(user *models.User) (*models.Session, error) {
+func (u *Users) signIn(user *models.User, r *http.Request) (*models.Session, error) {
+	return createSession(u.us, u.ss, user, r)
+}
+
+// createSession records the login of the given user and creates a session
+// for the device that made the request
+func createSession(us models.UserService, ss models.SessionService, user *models.User, r *http.Request) (*models.Session, error) {
 	t := time.Now()
 
 	user.LastLoginAt = &t
-	if err := u.us.Update(user); err != nil {
+	if err := us.Update(user, nil); err != nil {
 		return nil, errors.Wrap(err, "updating last_login_at")
 	}
 
-	s, err := u.ss.Login(user.ID)
+	s, err := ss.Login(user.ID, r.UserAgent(), LookupIP(r))
 	if err != nil {
 		return nil, errors.Wrap(err, "logging in")
 	}
@@ -1,14 +1,20 @@
 package controllers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/clock"
 	"github.com/nadproject/nad/pkg/server/config"
 	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/pkg/errors"
 )
 
 func TestRegister(t *testing.T) {
@@ -33,7 +39,8 @@ func TestRegister(t *testing.T) {
 			cfg.SetPageTemplateDir(testPageDir)
 			defer models.ClearTestData(t, models.TestServices.DB)
 
-			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session)
+			m, backend := newTestMailer(cfg)
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, clock.NewMock(), models.TestServices.DB)
 
 			form := url.Values{}
 			form.Add("email", "alice@example.com")
@@ -52,6 +59,407 @@ func TestRegister(t *testing.T) {
 
 			assert.Equal(t, userCount, 1, "book count mismatch")
 			assert.Equal(t, userRecord.Pro, tc.expectedPro, "user pro mismatch")
+			assert.Equal(t, userRecord.EmailVerified, false, "user email_verified mismatch")
+
+			var tokenRecord models.Token
+			models.MustExec(t, models.TestServices.DB.Where("user_id = ?", userRecord.ID).First(&tokenRecord), "finding token")
+			assert.Equal(t, tokenRecord.Type, models.TokenTypeEmailVerification, "token type mismatch")
+			assert.Equal(t, len(backend.Emails), 1, "email count mismatch")
+			assert.Equal(t, strings.Contains(backend.Emails[0].Body, tokenRecord.Value), true, "verification link mismatch")
+		})
+	}
+}
+
+func TestUsersV1Encryption(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+	m, _ := newTestMailer(cfg)
+	usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, clock.NewMock(), models.TestServices.DB)
+
+	t.Run("get before set up", func(t *testing.T) {
+		req := newReq(t, "GET", "/api/v1/encryption", "")
+		w := httpDo(t, usersC.V1GetEncryption, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var payload EncryptionResp
+		if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+			t.Fatal(errors.Wrap(err, "decoding payload"))
+		}
+		assert.Equal(t, payload.Salt, "", "salt mismatch")
+		assert.Equal(t, payload.KeyCheck, "", "key_check mismatch")
+	})
+
+	t.Run("missing key_check", func(t *testing.T) {
+		req := newReq(t, "PUT", "/api/v1/encryption", `{"salt": "c2FsdA=="}`)
+		w := httpDo(t, usersC.V1SetEncryption, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusBadRequest, "status code mismatch")
+	})
+
+	t.Run("set up", func(t *testing.T) {
+		req := newReq(t, "PUT", "/api/v1/encryption", `{"salt": "c2FsdA==", "key_check": "Y2hlY2s="}`)
+		w := httpDo(t, usersC.V1SetEncryption, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+
+		var userRecord models.User
+		models.MustExec(t, models.TestServices.DB.Where("id = ?", user.ID).First(&userRecord), "finding user")
+		assert.Equal(t, userRecord.EncryptionSalt, "c2FsdA==", "salt mismatch")
+		assert.Equal(t, userRecord.EncryptionKeyCheck, "Y2hlY2s=", "key_check mismatch")
+	})
+
+	t.Run("set up again", func(t *testing.T) {
+		req := newReq(t, "PUT", "/api/v1/encryption", `{"salt": "b3RoZXI=", "key_check": "b3RoZXI="}`)
+		w := httpDo(t, usersC.V1SetEncryption, req, &user)
+
+		assert.Equal(t, w.Code, http.StatusConflict, "status code mismatch")
+
+		var userRecord models.User
+		models.MustExec(t, models.TestServices.DB.Where("id = ?", user.ID).First(&userRecord), "finding user")
+		assert.Equal(t, userRecord.EncryptionSalt, "c2FsdA==", "salt mismatch")
+	})
+}
+
+func TestUsersLoginPage(t *testing.T) {
+	testCases := []struct {
+		oidcIssuer  string
+		expectedSSO bool
+	}{
+		{
+			oidcIssuer:  "",
+			expectedSSO: false,
+		},
+		{
+			oidcIssuer:  "https://idp.example.com",
+			expectedSSO: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("oidc issuer %q", tc.oidcIssuer), func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			cfg.OIDC.Issuer = tc.oidcIssuer
+
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, nil, clock.NewMock(), models.TestServices.DB)
+
+			// Execute
+			w := httpDo(t, usersC.LoginPage, newReq(t, "GET", "/login", ""), nil)
+
+			// Test
+			assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+			assert.Equal(t, strings.Contains(w.Body.String(), `href="/login/oidc"`), tc.expectedSSO, "sso link mismatch")
+		})
+	}
+}
+
+func TestUsersV1RequestPwReset(t *testing.T) {
+	t.Run("existing user", func(t *testing.T) {
+		// Set up
+		cfg := config.Load()
+		cfg.SetPageTemplateDir(testPageDir)
+		defer models.ClearTestData(t, models.TestServices.DB)
+
+		user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+		m, backend := newTestMailer(cfg)
+		usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, clock.NewMock(), models.TestServices.DB)
+
+		// Execute
+		req := newReq(t, "POST", "/api/v1/password-reset", `{"email": "alice@example.com"}`)
+		w := httpDo(t, usersC.V1RequestPwReset, req, nil)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusNoContent, "status code mismatch")
+
+		var token models.Token
+		models.MustExec(t, models.TestServices.DB.Where("user_id = ?", user.ID).First(&token), "finding token")
+		assert.Equal(t, token.Type, models.TokenTypeResetPassword, "token type mismatch")
+		assert.Equal(t, len(backend.Emails), 1, "email count mismatch")
+		assert.DeepEqual(t, backend.Emails[0].To, []string{"alice@example.com"}, "email to mismatch")
+	})
+
+	t.Run("nonexistent user", func(t *testing.T) {
+		// Set up
+		cfg := config.Load()
+		cfg.SetPageTemplateDir(testPageDir)
+		defer models.ClearTestData(t, models.TestServices.DB)
+
+		m, backend := newTestMailer(cfg)
+		usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, clock.NewMock(), models.TestServices.DB)
+
+		// Execute
+		req := newReq(t, "POST", "/api/v1/password-reset", `{"email": "bob@example.com"}`)
+		w := httpDo(t, usersC.V1RequestPwReset, req, nil)
+
+		// Test
+		assert.Equal(t, w.Code, http.StatusNoContent, "status code mismatch")
+
+		var tokenCount int
+		models.MustExec(t, models.TestServices.DB.Model(&models.Token{}).Count(&tokenCount), "counting tokens")
+		assert.Equal(t, tokenCount, 0, "token count mismatch")
+		assert.Equal(t, len(backend.Emails), 0, "email count mismatch")
+	})
+}
+
+func TestUsersResetPw(t *testing.T) {
+	// Set up
+	cfg := config.Load()
+	cfg.SetPageTemplateDir(testPageDir)
+	defer models.ClearTestData(t, models.TestServices.DB)
+
+	usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, nil, clock.NewMock(), models.TestServices.DB)
+
+	// Execute
+	req := mux.SetURLVars(newReq(t, "GET", "/password-reset/some-token", ""), map[string]string{"token": "some-token"})
+	w := httpDo(t, usersC.ResetPw, req, nil)
+
+	// Test
+	assert.Equal(t, w.Code, http.StatusOK, "status code mismatch")
+	assert.Equal(t, strings.Contains(w.Body.String(), `action="/password-reset/some-token"`), true, "form action mismatch")
+}
+
+func TestUsersV1CompletePwReset(t *testing.T) {
+	testCases := []struct {
+		name         string
+		expiresIn    time.Duration
+		used         bool
+		confirmation string
+		expectedCode int
+		expectedPass bool
+	}{
+		{
+			name:         "valid",
+			expiresIn:    time.Hour,
+			confirmation: "newpass1234",
+			expectedCode: http.StatusNoContent,
+			expectedPass: true,
+		},
+		{
+			name:         "expired",
+			expiresIn:    -time.Minute,
+			confirmation: "newpass1234",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "used",
+			expiresIn:    time.Hour,
+			used:         true,
+			confirmation: "newpass1234",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "confirmation mismatch",
+			expiresIn:    time.Hour,
+			confirmation: "otherpass1234",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			c := clock.NewMock()
+			now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+			c.SetNow(now)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			token := models.Token{
+				UserID:    user.ID,
+				Type:      models.TokenTypeResetPassword,
+				ExpiresAt: now.Add(tc.expiresIn),
+			}
+			if tc.used {
+				usedAt := now.Add(-time.Minute)
+				token.UsedAt = &usedAt
+			}
+			if err := models.TestServices.Token.Create(&token); err != nil {
+				t.Fatal(errors.Wrap(err, "creating token"))
+			}
+			accessToken := models.AccessToken{UserID: user.ID, Name: "ci", Scopes: "sync"}
+			if _, err := models.TestServices.AccessToken.Generate(&accessToken); err != nil {
+				t.Fatal(errors.Wrap(err, "generating access token"))
+			}
+
+			m, backend := newTestMailer(cfg)
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, c, models.TestServices.DB)
+
+			// Execute
+			body := fmt.Sprintf(`{"token": "%s", "password": "newpass1234", "password_confirmation": "%s"}`, token.Value, tc.confirmation)
+			req := newReq(t, "PATCH", "/api/v1/password-reset", body)
+			w := httpDo(t, usersC.V1CompletePwReset, req, nil)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+
+			_, err := models.TestServices.User.Authenticate("alice@example.com", "newpass1234")
+			assert.Equal(t, err == nil, tc.expectedPass, "new password mismatch")
+
+			var sessionCount, accessTokenCount int
+			models.MustExec(t, models.TestServices.DB.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&sessionCount), "counting sessions")
+			models.MustExec(t, models.TestServices.DB.Model(&models.AccessToken{}).Where("user_id = ?", user.ID).Count(&accessTokenCount), "counting access tokens")
+
+			if tc.expectedPass {
+				var tokenRecord models.Token
+				models.MustExec(t, models.TestServices.DB.Where("id = ?", token.ID).First(&tokenRecord), "finding token")
+				assert.Equal(t, tokenRecord.UsedAt != nil, true, "token used mismatch")
+				assert.Equal(t, sessionCount, 0, "session count mismatch")
+				assert.Equal(t, accessTokenCount, 0, "access token count mismatch")
+				assert.Equal(t, len(backend.Emails), 1, "email count mismatch")
+			} else {
+				assert.Equal(t, sessionCount, 1, "session count mismatch")
+				assert.Equal(t, accessTokenCount, 1, "access token count mismatch")
+				assert.Equal(t, len(backend.Emails), 0, "email count mismatch")
+			}
+		})
+	}
+}
+
+func TestUsersV1VerifyEmail(t *testing.T) {
+	testCases := []struct {
+		name             string
+		expiresIn        time.Duration
+		used             bool
+		expectedCode     int
+		expectedVerified bool
+	}{
+		{
+			name:             "valid",
+			expiresIn:        time.Hour,
+			expectedCode:     http.StatusNoContent,
+			expectedVerified: true,
+		},
+		{
+			name:         "expired",
+			expiresIn:    -time.Minute,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "used",
+			expiresIn:    time.Hour,
+			used:         true,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			c := clock.NewMock()
+			now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+			c.SetNow(now)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			token := models.Token{
+				UserID:    user.ID,
+				Type:      models.TokenTypeEmailVerification,
+				ExpiresAt: now.Add(tc.expiresIn),
+			}
+			if tc.used {
+				usedAt := now.Add(-time.Minute)
+				token.UsedAt = &usedAt
+			}
+			if err := models.TestServices.Token.Create(&token); err != nil {
+				t.Fatal(errors.Wrap(err, "creating token"))
+			}
+
+			m, _ := newTestMailer(cfg)
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, c, models.TestServices.DB)
+
+			// Execute
+			req := newReq(t, "PATCH", "/api/v1/verify-email", fmt.Sprintf(`{"token": "%s"}`, token.Value))
+			w := httpDo(t, usersC.V1VerifyEmail, req, nil)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+
+			var userRecord models.User
+			models.MustExec(t, models.TestServices.DB.Where("id = ?", user.ID).First(&userRecord), "finding user")
+			assert.Equal(t, userRecord.EmailVerified, tc.expectedVerified, "email_verified mismatch")
+		})
+	}
+}
+
+func TestUsersV1ResendEmailVerification(t *testing.T) {
+	testCases := []struct {
+		name          string
+		verified      bool
+		lastSentAgo   time.Duration
+		expectedCode  int
+		expectedEmail bool
+	}{
+		{
+			name:          "no previous email",
+			expectedCode:  http.StatusNoContent,
+			expectedEmail: true,
+		},
+		{
+			name:          "previous email sent long ago",
+			lastSentAgo:   10 * time.Minute,
+			expectedCode:  http.StatusNoContent,
+			expectedEmail: true,
+		},
+		{
+			name:         "previous email sent recently",
+			lastSentAgo:  10 * time.Second,
+			expectedCode: http.StatusTooManyRequests,
+		},
+		{
+			name:         "already verified",
+			verified:     true,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up
+			cfg := config.Load()
+			cfg.SetPageTemplateDir(testPageDir)
+			defer models.ClearTestData(t, models.TestServices.DB)
+
+			c := clock.NewMock()
+			now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+			c.SetNow(now)
+
+			user, _ := models.SetupUser(t, models.TestServices.User, models.TestServices.Session, "alice@example.com", "pass1234")
+			if tc.verified {
+				models.MustExec(t, models.TestServices.DB.Model(&user).Update("email_verified", true), "verifying email")
+			}
+			if tc.lastSentAgo != 0 {
+				token := models.Token{
+					UserID:    user.ID,
+					Type:      models.TokenTypeEmailVerification,
+					ExpiresAt: now.Add(-tc.lastSentAgo).Add(emailVerificationTokenTTL),
+				}
+				if err := models.TestServices.Token.Create(&token); err != nil {
+					t.Fatal(errors.Wrap(err, "creating token"))
+				}
+			}
+
+			m, backend := newTestMailer(cfg)
+			usersC := NewUsers(cfg, models.TestServices.User, models.TestServices.Session, models.TestServices.Token, models.TestServices.RecoveryCode, models.TestServices.AccessToken, m, c, models.TestServices.DB)
+
+			// Execute
+			req := newReq(t, "POST", "/api/v1/verification-token", "")
+			w := httpDo(t, usersC.V1ResendEmailVerification, req, &user)
+
+			// Test
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+			assert.Equal(t, len(backend.Emails) == 1, tc.expectedEmail, "email count mismatch")
 		})
 	}
 }
@@ -28,6 +28,7 @@ import (
 
 	"github.com/aymerick/douceur/inliner"
 	"github.com/gobuffalo/packr/v2"
+	"github.com/nadproject/nad/pkg/server/markdown"
 	"github.com/pkg/errors"
 )
 
@@ -36,6 +37,8 @@ var (
 	EmailTypeResetPassword = "reset_password"
 	// EmailTypeResetPasswordAlert represents a password change notification email
 	EmailTypeResetPasswordAlert = "reset_password_alert"
+	// EmailTypeEmailChangeAlert represents an email change notification email
+	EmailTypeEmailChangeAlert = "email_change_alert"
 	// EmailTypeDigest represents a weekly digest email
 	EmailTypeDigest = "digest"
 	// EmailTypeEmailVerification represents an email verification email
@@ -97,6 +100,10 @@ func NewTemplates(srcDir *string) Templates {
 	if err != nil {
 		panic(errors.Wrap(err, "initializing welcome template"))
 	}
+	emailChangeAlertText, err := initTextTmpl(box, EmailTypeEmailChangeAlert)
+	if err != nil {
+		panic(errors.Wrap(err, "initializing email change alert template"))
+	}
 	verifyEmailText, err := initTextTmpl(box, EmailTypeEmailVerification)
 	if err != nil {
 		panic(errors.Wrap(err, "initializing email verification template"))
@@ -121,15 +128,21 @@ func NewTemplates(srcDir *string) Templates {
 	if err != nil {
 		panic(errors.Wrap(err, "initializing digest template"))
 	}
+	digestHTML, err := initHTMLTmpl(box, EmailTypeDigest)
+	if err != nil {
+		panic(errors.Wrap(err, "initializing digest html template"))
+	}
 
 	T := Templates{}
 	T.set(EmailTypeResetPassword, EmailKindText, passwordResetText)
 	T.set(EmailTypeResetPasswordAlert, EmailKindText, passwordResetAlertText)
 	T.set(EmailTypeEmailVerification, EmailKindText, verifyEmailText)
+	T.set(EmailTypeEmailChangeAlert, EmailKindText, emailChangeAlertText)
 	T.set(EmailTypeWelcome, EmailKindText, welcomeText)
 	T.set(EmailTypeInactiveReminder, EmailKindText, inactiveReminderText)
 	T.set(EmailTypeSubscriptionConfirmation, EmailKindText, subscriptionConfirmationText)
 	T.set(EmailTypeDigest, EmailKindText, digestText)
+	T.set(EmailTypeDigest, EmailKindHTML, digestHTML)
 
 	return T
 }
@@ -152,7 +165,9 @@ func initHTMLTmpl(box *packr.Box, templateName string) (template, error) {
 		return nil, errors.Wrap(err, "reading footer template")
 	}
 
-	t := htemplate.New(templateName)
+	t := htemplate.New(templateName).Funcs(htemplate.FuncMap{
+		"markdown": markdown.Render,
+	})
 	if _, err = t.Parse(content); err != nil {
 		return nil, errors.Wrap(err, "parsing template")
 	}
@@ -24,6 +24,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/nadproject/nad/pkg/server/models"
 	"github.com/pkg/errors"
 )
 
@@ -104,3 +105,52 @@ func TestResetPasswordEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestDigestEmail(t *testing.T) {
+	tmplPath := os.Getenv("DNOTE_TEST_EMAIL_TEMPLATE_DIR")
+	tmpl := NewTemplates(&tmplPath)
+
+	dat := DigestTmplData{
+		DigestUUID:    "some-digest-uuid",
+		DigestVersion: 3,
+		RuleUUID:      "some-rule-uuid",
+		RuleTitle:     "Weekly",
+		WebURL:        "http://localhost:3000",
+		Notes: []DigestNoteInfo{
+			{
+				UUID:      "some-note-uuid",
+				Content:   "**goroutines**\n\n```go\ngo f()\n```\n\n<script>alert(1)</script>",
+				BookLabel: "go",
+				TimeAgo:   "2 days ago",
+			},
+			NewNoteInfo(models.Note{
+				UUID:      "some-encrypted-note-uuid",
+				Body:      "**ciphertext**",
+				Encrypted: true,
+			}, 1),
+		},
+	}
+	body, err := tmpl.Execute(EmailTypeDigest, EmailKindHTML, dat)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "executing"))
+	}
+
+	expected := []string{
+		"http://localhost:3000/digests/some-digest-uuid",
+		"<strong>goroutines</strong>",
+		`<span class="hl-keyword" style="color: #d73a49;">go</span>`,
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"<em>Encrypted note</em>",
+	}
+	for _, s := range expected {
+		if ok := strings.Contains(body, s); !ok {
+			t.Errorf("email body did not contain %s", s)
+		}
+	}
+	if ok := strings.Contains(body, "<script>"); ok {
+		t.Error("email body contained an unescaped script")
+	}
+	if ok := strings.Contains(body, "ciphertext"); ok {
+		t.Error("email body contained the content of an encrypted note")
+	}
+}
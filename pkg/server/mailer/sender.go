@@ -0,0 +1,146 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mailer
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/metrics"
+	"github.com/pkg/errors"
+)
+
+var defaultSender = "sung@getdnote.com"
+
+var emailsSent = metrics.NewCounterVec("nad_emails_sent_total", "Total number of emails sent, by template and result.", "template", "result")
+
+// Mailer renders emails from the templates and queues them in the backend
+type Mailer struct {
+	backend   Backend
+	templates Templates
+	webURL    string
+	onPremise bool
+}
+
+// New returns a new Mailer
+func New(cfg config.Config, backend Backend, templates Templates) *Mailer {
+	return &Mailer{
+		backend:   backend,
+		templates: templates,
+		webURL:    cfg.WebURL,
+		onPremise: cfg.OnPremise,
+	}
+}
+
+func getDomainFromURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing url")
+	}
+
+	host := u.Hostname()
+	parts := strings.Split(host, ".")
+	if len(parts) < 2 {
+		return host, nil
+	}
+	domain := parts[len(parts)-2] + "." + parts[len(parts)-1]
+
+	return domain, nil
+}
+
+// getSender returns the sender email address. An on-premise installation
+// sends emails from the noreply address of its own domain.
+func (m *Mailer) getSender() (string, error) {
+	if !m.onPremise {
+		return defaultSender, nil
+	}
+
+	domain, err := getDomainFromURL(m.webURL)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing web url")
+	}
+
+	return fmt.Sprintf("noreply@%s", domain), nil
+}
+
+func (m *Mailer) send(subject, to, templateName string, data interface{}) error {
+	body, err := m.templates.Execute(templateName, EmailKindText, data)
+	if err != nil {
+		return errors.Wrapf(err, "executing %s template for %s", templateName, to)
+	}
+
+	from, err := m.getSender()
+	if err != nil {
+		return errors.Wrap(err, "getting the sender email")
+	}
+
+	if err := m.backend.Queue(subject, from, []string{to}, EmailKindText, body); err != nil {
+		emailsSent.Inc(templateName, "failure")
+		return errors.Wrapf(err, "queueing email for %s", to)
+	}
+
+	emailsSent.Inc(templateName, "success")
+
+	return nil
+}
+
+// SendPasswordResetEmail sends an email with a link to reset the password
+func (m *Mailer) SendPasswordResetEmail(email, tokenValue string) error {
+	data := EmailResetPasswordTmplData{
+		AccountEmail: email,
+		Token:        tokenValue,
+		WebURL:       m.webURL,
+	}
+
+	return m.send("Reset your password", email, EmailTypeResetPassword, data)
+}
+
+// SendEmailVerificationEmail sends an email with a link to verify the email address
+func (m *Mailer) SendEmailVerificationEmail(email, tokenValue string) error {
+	data := EmailVerificationTmplData{
+		Token:  tokenValue,
+		WebURL: m.webURL,
+	}
+
+	return m.send("Verify your nad email address", email, EmailTypeEmailVerification, data)
+}
+
+// SendPasswordResetAlertEmail sends an email that notifies users of a password change
+func (m *Mailer) SendPasswordResetAlertEmail(email string) error {
+	data := EmailResetPasswordAlertTmplData{
+		AccountEmail: email,
+		WebURL:       m.webURL,
+	}
+
+	return m.send("nad password changed", email, EmailTypeResetPasswordAlert, data)
+}
+
+// SendEmailChangeAlertEmail sends an email to the previous address of a user
+// that notifies the user of an email change
+func (m *Mailer) SendEmailChangeAlertEmail(email, newEmail string) error {
+	data := EmailChangeAlertTmplData{
+		AccountEmail: email,
+		NewEmail:     newEmail,
+		WebURL:       m.webURL,
+	}
+
+	return m.send("nad email address changed", email, EmailTypeEmailChangeAlert, data)
+}
@@ -0,0 +1,126 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/testutils"
+)
+
+func TestSendPasswordResetEmail(t *testing.T) {
+	testCases := []struct {
+		onPremise      bool
+		expectedSender string
+	}{
+		{
+			onPremise:      false,
+			expectedSender: "sung@getdnote.com",
+		},
+		{
+			onPremise:      true,
+			expectedSender: "noreply@example.com",
+		},
+	}
+
+	tmplPath := os.Getenv("DNOTE_TEST_EMAIL_TEMPLATE_DIR")
+	tmpl := NewTemplates(&tmplPath)
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("self hosted %t", tc.onPremise), func(t *testing.T) {
+			emailBackend := testutils.MockEmailbackendImplementation{}
+			cfg := config.Config{
+				OnPremise: tc.onPremise,
+				WebURL:    "http://example.com",
+			}
+			m := New(cfg, &emailBackend, tmpl)
+
+			if err := m.SendPasswordResetEmail("alice@example.com", "mockTokenValue"); err != nil {
+				t.Fatal(err, "failed to perform")
+			}
+
+			assert.Equalf(t, len(emailBackend.Emails), 1, "email queue count mismatch")
+			assert.Equal(t, emailBackend.Emails[0].From, tc.expectedSender, "email sender mismatch")
+			assert.DeepEqual(t, emailBackend.Emails[0].To, []string{"alice@example.com"}, "email recipient mismatch")
+			assert.Equal(t, strings.Contains(emailBackend.Emails[0].Body, "http://example.com/password-reset/mockTokenValue"), true, "reset link mismatch")
+		})
+	}
+}
+
+func TestSendPasswordResetAlertEmail(t *testing.T) {
+	tmplPath := os.Getenv("DNOTE_TEST_EMAIL_TEMPLATE_DIR")
+	tmpl := NewTemplates(&tmplPath)
+
+	emailBackend := testutils.MockEmailbackendImplementation{}
+	cfg := config.Config{
+		WebURL: "http://example.com",
+	}
+	m := New(cfg, &emailBackend, tmpl)
+
+	if err := m.SendPasswordResetAlertEmail("alice@example.com"); err != nil {
+		t.Fatal(err, "failed to perform")
+	}
+
+	assert.Equalf(t, len(emailBackend.Emails), 1, "email queue count mismatch")
+	assert.DeepEqual(t, emailBackend.Emails[0].To, []string{"alice@example.com"}, "email recipient mismatch")
+	assert.Equal(t, strings.Contains(emailBackend.Emails[0].Body, "alice@example.com"), true, "account email mismatch")
+}
+
+func TestSendEmailChangeAlertEmail(t *testing.T) {
+	tmplPath := os.Getenv("DNOTE_TEST_EMAIL_TEMPLATE_DIR")
+	tmpl := NewTemplates(&tmplPath)
+
+	emailBackend := testutils.MockEmailbackendImplementation{}
+	cfg := config.Config{
+		WebURL: "http://example.com",
+	}
+	m := New(cfg, &emailBackend, tmpl)
+
+	if err := m.SendEmailChangeAlertEmail("alice@example.com", "alice@example.org"); err != nil {
+		t.Fatal(err, "failed to perform")
+	}
+
+	assert.Equalf(t, len(emailBackend.Emails), 1, "email queue count mismatch")
+	assert.DeepEqual(t, emailBackend.Emails[0].To, []string{"alice@example.com"}, "email recipient mismatch")
+	assert.Equal(t, strings.Contains(emailBackend.Emails[0].Body, "alice@example.org"), true, "new email mismatch")
+}
+
+func TestSendEmailVerificationEmail(t *testing.T) {
+	tmplPath := os.Getenv("DNOTE_TEST_EMAIL_TEMPLATE_DIR")
+	tmpl := NewTemplates(&tmplPath)
+
+	emailBackend := testutils.MockEmailbackendImplementation{}
+	cfg := config.Config{
+		WebURL: "http://example.com",
+	}
+	m := New(cfg, &emailBackend, tmpl)
+
+	if err := m.SendEmailVerificationEmail("alice@example.com", "mockTokenValue"); err != nil {
+		t.Fatal(err, "failed to perform")
+	}
+
+	assert.Equalf(t, len(emailBackend.Emails), 1, "email queue count mismatch")
+	assert.DeepEqual(t, emailBackend.Emails[0].To, []string{"alice@example.com"}, "email recipient mismatch")
+	assert.Equal(t, strings.Contains(emailBackend.Emails[0].Body, "http://example.com/verify-email/mockTokenValue"), true, "verification link mismatch")
+}
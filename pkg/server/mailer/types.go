@@ -21,8 +21,8 @@ package mailer
 import (
 	"time"
 
-	"github.com/nadproject/nad/pkg/server/database"
 	"github.com/justincampbell/timeago"
+	"github.com/nadproject/nad/pkg/server/models"
 )
 
 // DigestNoteInfo contains note information for digest emails
@@ -32,19 +32,27 @@ type DigestNoteInfo struct {
 	BookLabel string
 	TimeAgo   string
 	Stage     int
+	// Encrypted is true if the content is encrypted, in which case Content is empty
+	Encrypted bool
 }
 
 // NewNoteInfo returns a new NoteInfo
-func NewNoteInfo(note database.Note, stage int) DigestNoteInfo {
+func NewNoteInfo(note models.Note, stage int) DigestNoteInfo {
 	tm := time.Unix(0, int64(note.AddedOn))
 
-	return DigestNoteInfo{
+	ret := DigestNoteInfo{
 		UUID:      note.UUID,
-		Content:   note.Body,
-		BookLabel: note.Book.Label,
+		BookLabel: note.Book.Name,
 		TimeAgo:   timeago.FromTime(tm),
 		Stage:     stage,
+		Encrypted: note.Encrypted,
 	}
+	// The server cannot render the ciphertext of an encrypted note.
+	if !note.Encrypted {
+		ret.Content = note.Body
+	}
+
+	return ret
 }
 
 // DigestTmplData is a template data for digest emails
@@ -55,6 +63,7 @@ type DigestTmplData struct {
 	RuleUUID          string
 	RuleTitle         string
 	WebURL            string
+	Notes             []DigestNoteInfo
 }
 
 // EmailVerificationTmplData is a template data for email verification emails
@@ -76,6 +85,13 @@ type EmailResetPasswordAlertTmplData struct {
 	WebURL       string
 }
 
+// EmailChangeAlertTmplData is a template data for email change notification emails
+type EmailChangeAlertTmplData struct {
+	AccountEmail string
+	NewEmail     string
+	WebURL       string
+}
+
 // WelcomeTmplData is a template data for welcome emails
 type WelcomeTmplData struct {
 	AccountEmail string
@@ -22,12 +22,14 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"time"
 
 	"github.com/nadproject/nad/pkg/clock"
 	"github.com/nadproject/nad/pkg/server/buildinfo"
 	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/metrics"
 	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/ratelimit"
 	"github.com/nadproject/nad/pkg/server/routes"
 )
 
@@ -35,19 +37,67 @@ var pageDir = flag.String("pageDir", "views", "the path to a directory containin
 
 var staticDir = flag.String("staticDir", "./static/", "the path to the static directory ")
 
+func initServices(cfg config.Config) (*models.Services, error) {
+	return models.NewServices(
+		models.WithGorm(cfg.DB.Dialect, cfg.DB.GetConnectionStr()),
+		models.WithUser(),
+		models.WithNote(),
+		models.WithNoteRevision(),
+		models.WithTag(),
+		models.WithBook(),
+		models.WithSession(),
+		models.WithToken(),
+		models.WithAccessToken(),
+		models.WithRecoveryCode(),
+	)
+}
+
+// sessionCleanupInterval is the interval between deleting expired sessions
+const sessionCleanupInterval = time.Hour
+
+// cleanupSessions periodically deletes the expired sessions
+func cleanupSessions(ss models.SessionService) {
+	for {
+		n, err := ss.DeleteExpired(time.Now())
+		if err != nil {
+			log.Printf("deleting expired sessions: %s", err.Error())
+		} else if n > 0 {
+			log.Printf("deleted %d expired sessions", n)
+		}
+
+		time.Sleep(sessionCleanupInterval)
+	}
+}
+
+func initRateLimitStore(cfg config.Config, s *models.Services) (ratelimit.Store, error) {
+	if cfg.RateLimit.Store == config.RateLimitStorePostgres {
+		return ratelimit.NewPostgresStore(s.DB)
+	}
+
+	return ratelimit.NewMemoryStore(), nil
+}
+
+// rateLimitCleanupInterval is the interval between deleting the expired rate limit counts
+const rateLimitCleanupInterval = time.Minute
+
+// cleanupRateLimits periodically deletes the counts of the rate limit windows that have ended
+func cleanupRateLimits(store ratelimit.Store) {
+	for {
+		time.Sleep(rateLimitCleanupInterval)
+
+		if _, err := store.DeleteExpired(time.Now()); err != nil {
+			log.Printf("deleting expired rate limits: %s", err.Error())
+		}
+	}
+}
+
 func startCmd() {
 	cfg := config.Load()
 	cfg.SetPageTemplateDir(*pageDir)
 
 	cfg.SetStaticDir(*staticDir)
 
-	services, err := models.NewServices(
-		models.WithGorm("postgres", cfg.DB.GetConnectionStr()),
-		models.WithUser(),
-		models.WithNote(),
-		models.WithBook(),
-		models.WithSession(),
-	)
+	services, err := initServices(cfg)
 	must(err)
 	defer services.Close()
 
@@ -57,10 +107,23 @@ func startCmd() {
 	err = services.MigrateDB()
 	must(err)
 
+	go cleanupSessions(services.Session)
+
+	metrics.DefaultRegistry.RegisterDBStats(services.DB.DB())
+
+	store, err := initRateLimitStore(cfg, services)
+	must(err)
+	go cleanupRateLimits(store)
+
 	cl := clock.New()
-	r := routes.New(cfg, services, cl)
-	log.Printf("nad version %s is running on port %s", buildinfo.Version, cfg.Port)
-	log.Fatalln(http.ListenAndServe(fmt.Sprintf(":%s", cfg.Port), r))
+	r := routes.New(cfg, services, store, cl)
+
+	ln, err := listen(cfg)
+	must(err)
+
+	log.Printf("nad version %s is running on %s", buildinfo.Version, ln.Addr())
+	must(serve(cfg, newServer(cfg, r), ln))
+	log.Println("nad stopped")
 }
 
 func versionCmd() {
@@ -76,6 +139,10 @@ Usage:
 Available commands:
   start: Start the server
   version: Print the version
+  user: Manage users (create, list, delete, reset-password, verify-email)
+  session: Manage sessions (revoke)
+  stats: Print the number of users, notes and books
+  db: Manage the database schema (migrate, status, rollback)
 `)
 }
 
@@ -90,6 +157,14 @@ func main() {
 		startCmd()
 	case "version":
 		versionCmd()
+	case "user":
+		userCmd(flag.Args()[1:])
+	case "session":
+		sessionCmd(flag.Args()[1:])
+	case "stats":
+		statsCmd()
+	case "db":
+		dbCmd(flag.Args()[1:])
 	default:
 		fmt.Printf("Unknown command %s", cmd)
 	}
@@ -0,0 +1,376 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package markdown
+
+import (
+	"strings"
+)
+
+// syntax describes the lexical rules of a language that are needed to
+// highlight its code
+type syntax struct {
+	keywords     []string
+	literals     []string
+	types        []string
+	lineComments []string
+	// blockComments are pairs of the start and the end of block comments
+	blockComments [][2]string
+	// quotes are the characters that start strings ending on the same line
+	quotes string
+	// rawQuotes are the delimiters of strings that can span multiple lines
+	// and do not have escape sequences
+	rawQuotes []string
+	// wordComments is true if a line comment needs to start a word, as in
+	// shells where '#' can appear inside words
+	wordComments bool
+	ignoreCase   bool
+}
+
+// lexer holds the keywords of a syntax as sets
+type lexer struct {
+	syntax
+	kinds map[string]string
+}
+
+func newLexer(s syntax) *lexer {
+	kinds := map[string]string{}
+	add := func(words []string, kind string) {
+		for _, w := range words {
+			if s.ignoreCase {
+				w = strings.ToLower(w)
+			}
+
+			kinds[w] = kind
+		}
+	}
+	add(s.types, "hl-type")
+	add(s.literals, "hl-literal")
+	add(s.keywords, "hl-keyword")
+
+	return &lexer{syntax: s, kinds: kinds}
+}
+
+var cLike = syntax{
+	keywords: []string{
+		"auto", "break", "case", "const", "continue", "default", "do", "else", "enum",
+		"extern", "for", "goto", "if", "inline", "register", "return", "sizeof",
+		"static", "struct", "switch", "typedef", "union", "volatile", "while",
+		"class", "delete", "namespace", "new", "private", "protected", "public",
+		"template", "this", "throw", "try", "catch", "using", "virtual",
+	},
+	literals:      []string{"NULL", "nullptr", "true", "false"},
+	types:         []string{"bool", "char", "double", "float", "int", "long", "short", "signed", "unsigned", "void", "size_t"},
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        `"'`,
+}
+
+var lexers = map[string]*lexer{
+	"go": newLexer(syntax{
+		keywords: []string{
+			"break", "case", "chan", "const", "continue", "default", "defer", "else",
+			"fallthrough", "for", "func", "go", "goto", "if", "import", "interface",
+			"map", "package", "range", "return", "select", "struct", "switch", "type", "var",
+		},
+		literals: []string{"true", "false", "nil", "iota"},
+		types: []string{
+			"bool", "byte", "complex64", "complex128", "error", "float32", "float64",
+			"int", "int8", "int16", "int32", "int64", "rune", "string",
+			"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		},
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		rawQuotes:     []string{"`"},
+	}),
+	"javascript": newLexer(syntax{
+		keywords: []string{
+			"async", "await", "break", "case", "catch", "class", "const", "continue",
+			"debugger", "default", "delete", "do", "else", "export", "extends", "finally",
+			"for", "from", "function", "if", "import", "in", "instanceof", "let", "new",
+			"of", "return", "static", "super", "switch", "this", "throw", "try", "typeof",
+			"var", "void", "while", "yield",
+			// TypeScript
+			"as", "declare", "enum", "implements", "interface", "keyof", "namespace",
+			"private", "protected", "public", "readonly", "type",
+		},
+		literals:      []string{"true", "false", "null", "undefined", "NaN", "Infinity"},
+		types:         []string{"any", "boolean", "never", "number", "object", "string", "symbol", "unknown"},
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+		rawQuotes:     []string{"`"},
+	}),
+	"python": newLexer(syntax{
+		keywords: []string{
+			"and", "as", "assert", "async", "await", "break", "class", "continue", "def",
+			"del", "elif", "else", "except", "finally", "for", "from", "global", "if",
+			"import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise",
+			"return", "try", "while", "with", "yield",
+		},
+		literals:     []string{"True", "False", "None"},
+		types:        []string{"bool", "bytes", "dict", "float", "int", "list", "set", "str", "tuple"},
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		rawQuotes:    []string{`"""`, `'''`},
+	}),
+	"ruby": newLexer(syntax{
+		keywords: []string{
+			"alias", "and", "begin", "break", "case", "class", "def", "do",
+			"else", "elsif", "end", "ensure", "for", "if", "in", "module", "next", "not",
+			"or", "redo", "require", "rescue", "retry", "return", "self", "super", "then",
+			"undef", "unless", "until", "when", "while", "yield",
+		},
+		literals:     []string{"true", "false", "nil"},
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	}),
+	"rust": newLexer(syntax{
+		keywords: []string{
+			"as", "async", "await", "break", "const", "continue", "crate", "dyn", "else",
+			"enum", "extern", "fn", "for", "if", "impl", "in", "let", "loop", "match",
+			"mod", "move", "mut", "pub", "ref", "return", "self", "Self", "static",
+			"struct", "super", "trait", "type", "unsafe", "use", "where", "while",
+		},
+		literals: []string{"true", "false", "None", "Some", "Ok", "Err"},
+		types: []string{
+			"bool", "char", "f32", "f64", "i8", "i16", "i32", "i64", "i128", "isize",
+			"str", "u8", "u16", "u32", "u64", "u128", "usize", "String", "Vec", "Option", "Result",
+		},
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		// Single quotes are not strings because they also start lifetimes
+		quotes: `"`,
+	}),
+	"c": newLexer(cLike),
+	"java": newLexer(syntax{
+		keywords: []string{
+			"abstract", "break", "case", "catch", "class", "continue", "default", "do",
+			"else", "enum", "extends", "final", "finally", "for", "if", "implements",
+			"import", "instanceof", "interface", "new", "package", "private", "protected",
+			"public", "return", "static", "super", "switch", "synchronized", "this",
+			"throw", "throws", "try", "var", "void", "while",
+		},
+		literals:      []string{"true", "false", "null"},
+		types:         []string{"boolean", "byte", "char", "double", "float", "int", "long", "short", "String"},
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `"'`,
+	}),
+	"sh": newLexer(syntax{
+		keywords: []string{
+			"case", "do", "done", "elif", "else", "esac", "export", "fi", "for", "function",
+			"if", "in", "local", "return", "then", "until", "while",
+			"cd", "echo", "exit", "read", "set", "shift", "source", "unset",
+		},
+		lineComments: []string{"#"},
+		wordComments: true,
+		quotes:       `"'`,
+	}),
+	"sql": newLexer(syntax{
+		keywords: []string{
+			"add", "all", "alter", "and", "as", "asc", "begin", "between", "by", "case",
+			"commit", "create", "delete", "desc", "distinct", "drop", "else", "end",
+			"exists", "from", "group", "having", "if", "in", "index", "inner", "insert",
+			"into", "is", "join", "key", "left", "like", "limit", "not", "offset", "on",
+			"or", "order", "outer", "primary", "references", "returning", "right",
+			"rollback", "select", "set", "table", "then", "union", "unique", "update",
+			"values", "when", "where", "with",
+		},
+		literals:      []string{"null", "true", "false"},
+		types:         []string{"bigint", "boolean", "char", "date", "integer", "int", "json", "jsonb", "serial", "text", "timestamp", "uuid", "varchar"},
+		lineComments:  []string{"--"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		quotes:        `'"`,
+		ignoreCase:    true,
+	}),
+	"json": newLexer(syntax{
+		literals: []string{"true", "false", "null"},
+		quotes:   `"`,
+	}),
+}
+
+// langAliases maps the other names of the languages to the names in lexers
+var langAliases = map[string]string{
+	"golang":     "go",
+	"js":         "javascript",
+	"jsx":        "javascript",
+	"ts":         "javascript",
+	"tsx":        "javascript",
+	"typescript": "javascript",
+	"py":         "python",
+	"rb":         "ruby",
+	"rs":         "rust",
+	"h":          "c",
+	"cpp":        "c",
+	"c++":        "c",
+	"cc":         "c",
+	"bash":       "sh",
+	"shell":      "sh",
+	"zsh":        "sh",
+	"console":    "sh",
+	"psql":       "sql",
+	"postgresql": "sql",
+	"sqlite":     "sql",
+}
+
+func getLexer(lang string) *lexer {
+	lang = strings.ToLower(lang)
+	if alias, ok := langAliases[lang]; ok {
+		lang = alias
+	}
+
+	return lexers[lang]
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// scanString returns the index following the string that starts with the quote
+// at the given index. An unterminated string ends at the end of the line.
+func scanString(s string, start int) int {
+	q := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\n':
+			return i
+		case q:
+			return i + 1
+		}
+	}
+
+	return len(s)
+}
+
+// scanUntil returns the index following the first occurrence of the given
+// delimiter after the given index, or the end of the string if there is none.
+func scanUntil(s string, from int, delim string) int {
+	end := strings.Index(s[from:], delim)
+	if end == -1 {
+		return len(s)
+	}
+
+	return from + end + len(delim)
+}
+
+// highlight returns the HTML of the given code with its tokens wrapped in spans
+// whose classes denote the kinds of the tokens. The text of the tokens is escaped.
+// It returns false if the language is not supported.
+func highlight(lang, code string) (string, bool) {
+	l := getLexer(lang)
+	if l == nil {
+		return "", false
+	}
+
+	var b strings.Builder
+	// plain is the start of the text that is not a part of any token
+	plain := 0
+
+	token := func(start, end int, kind string) {
+		b.WriteString(escape(code[plain:start]))
+		b.WriteString(`<span class="` + kind + `">` + escape(code[start:end]) + "</span>")
+		plain = end
+	}
+
+	for i := 0; i < len(code); {
+		if end, kind, ok := l.scanDelimited(code, i); ok {
+			token(i, end, kind)
+			i = end
+			continue
+		}
+
+		c := code[i]
+		switch {
+		case c >= '0' && c <= '9' && (i == 0 || !isIdent(code[i-1])):
+			j := i + 1
+			for j < len(code) && (isIdent(code[j]) || code[j] == '.') {
+				j++
+			}
+			token(i, j, "hl-number")
+			i = j
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(code) && isIdent(code[j]) {
+				j++
+			}
+
+			word := code[i:j]
+			if l.ignoreCase {
+				word = strings.ToLower(word)
+			}
+			if kind, ok := l.kinds[word]; ok {
+				token(i, j, kind)
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	b.WriteString(escape(code[plain:]))
+
+	return b.String(), true
+}
+
+// scanDelimited scans the comment or the string starting at the given index, if any,
+// and returns the index following it along with its kind.
+func (l *lexer) scanDelimited(s string, i int) (int, string, bool) {
+	rest := s[i:]
+
+	for _, prefix := range l.lineComments {
+		if !strings.HasPrefix(rest, prefix) {
+			continue
+		}
+		if l.wordComments && i > 0 && !isSpace(s[i-1]) {
+			continue
+		}
+
+		end := strings.IndexByte(rest, '\n')
+		if end == -1 {
+			return len(s), "hl-comment", true
+		}
+
+		return i + end, "hl-comment", true
+	}
+	for _, delims := range l.blockComments {
+		if strings.HasPrefix(rest, delims[0]) {
+			return scanUntil(s, i+len(delims[0]), delims[1]), "hl-comment", true
+		}
+	}
+	for _, q := range l.rawQuotes {
+		if strings.HasPrefix(rest, q) {
+			return scanUntil(s, i+len(q), q), "hl-string", true
+		}
+	}
+	if strings.IndexByte(l.quotes, s[i]) != -1 {
+		return scanString(s, i), "hl-string", true
+	}
+
+	return 0, "", false
+}
@@ -0,0 +1,259 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package markdown
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+var escape = template.HTMLEscapeString
+
+// specialChars are the characters that can start an inline element
+const specialChars = "\\\n`![<*_~"
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) != -1
+}
+
+func isAlnum(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// safeURL checks if the given destination is a relative URL or an absolute URL
+// with an allowed scheme. It is used to reject destinations such as 'javascript:'.
+func safeURL(dest string) bool {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	default:
+		return false
+	}
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+
+	return n
+}
+
+// parseLink parses the link whose text starts with the '[' at the given index
+// and returns the text, the destination and the index following the link.
+func parseLink(s string, start int) (text, dest string, end int, ok bool) {
+	depth := 0
+	i := start
+	for ; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == '[' {
+			depth++
+		} else if s[i] == ']' {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	if i >= len(s) || i+1 >= len(s) || s[i+1] != '(' {
+		return "", "", 0, false
+	}
+	text = s[start+1 : i]
+
+	depth = 0
+	j := i + 1
+	for ; j < len(s); j++ {
+		if s[j] == '(' {
+			depth++
+		} else if s[j] == ')' {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	if j >= len(s) {
+		return "", "", 0, false
+	}
+
+	// Ignore the title, if any
+	fields := strings.Fields(s[i+2 : j])
+	if len(fields) > 0 {
+		dest = strings.TrimSuffix(strings.TrimPrefix(fields[0], "<"), ">")
+	}
+
+	return text, dest, j + 1, true
+}
+
+// findCloser finds the index of the closing emphasis delimiter of the given
+// length, searching from the given index.
+func findCloser(s string, from int, c byte, n int) int {
+	// Start after the first character so that the enclosed text is not empty
+	for i := from + 1; i+n <= len(s); i++ {
+		if s[i] == '`' {
+			// Skip code spans
+			m := runLength(s, i, '`')
+			if end := strings.Index(s[i+m:], strings.Repeat("`", m)); end != -1 {
+				i += m + end + m - 1
+				continue
+			}
+		}
+
+		if s[i] != c || runLength(s, i, c) < n || s[i-1] == ' ' {
+			continue
+		}
+		if c == '_' && i+n < len(s) && isAlnum(s[i+n]) {
+			continue
+		}
+
+		return i
+	}
+
+	return -1
+}
+
+func renderInline(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(escape(s[i+1 : i+2]))
+			i += 2
+		case c == '\n':
+			b.WriteString("<br>\n")
+			i++
+		case c == '`':
+			n := runLength(s, i, '`')
+			end := strings.Index(s[i+n:], strings.Repeat("`", n))
+			if end == -1 {
+				b.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+
+			code := s[i+n : i+n+end]
+			if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+				code = code[1 : len(code)-1]
+			}
+			b.WriteString("<code>" + escape(code) + "</code>")
+			i += n + end + n
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			text, dest, end, ok := parseLink(s, i+1)
+			if !ok {
+				b.WriteString("!")
+				i++
+				continue
+			}
+
+			if safeURL(dest) {
+				fmt.Fprintf(&b, `<img src="%s" alt="%s">`, escape(dest), escape(text))
+			} else {
+				b.WriteString(escape(text))
+			}
+			i = end
+		case c == '[':
+			text, dest, end, ok := parseLink(s, i)
+			if !ok {
+				b.WriteString("[")
+				i++
+				continue
+			}
+
+			if safeURL(dest) {
+				fmt.Fprintf(&b, `<a href="%s" rel="nofollow noopener">%s</a>`, escape(dest), renderInline(text))
+			} else {
+				b.WriteString(renderInline(text))
+			}
+			i = end
+		case c == '<':
+			end := strings.IndexAny(s[i+1:], "> \n<")
+			if end != -1 && s[i+1+end] == '>' {
+				dest := s[i+1 : i+1+end]
+				if (strings.Contains(dest, "://") || strings.HasPrefix(dest, "mailto:")) && safeURL(dest) {
+					fmt.Fprintf(&b, `<a href="%s" rel="nofollow noopener">%s</a>`, escape(dest), escape(dest))
+					i += end + 2
+					continue
+				}
+			}
+
+			b.WriteString("&lt;")
+			i++
+		case c == '*' || c == '_':
+			n := runLength(s, i, c)
+
+			// An underscore inside a word, as in snake_case, is not a delimiter
+			if (c == '_' && i > 0 && isAlnum(s[i-1])) || i+n >= len(s) || s[i+n] == ' ' {
+				b.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+
+			if n >= 2 {
+				if end := findCloser(s, i+2, c, 2); end != -1 {
+					b.WriteString("<strong>" + renderInline(s[i+2:end]) + "</strong>")
+					i = end + 2
+					continue
+				}
+			}
+			if end := findCloser(s, i+1, c, 1); end != -1 {
+				b.WriteString("<em>" + renderInline(s[i+1:end]) + "</em>")
+				i = end + 1
+				continue
+			}
+
+			b.WriteString(s[i : i+n])
+			i += n
+		case c == '~' && runLength(s, i, '~') == 2:
+			if i+2 < len(s) && s[i+2] != ' ' {
+				if end := findCloser(s, i+2, '~', 2); end != -1 && runLength(s, end, '~') == 2 {
+					b.WriteString("<del>" + renderInline(s[i+2:end]) + "</del>")
+					i = end + 2
+					continue
+				}
+			}
+
+			b.WriteString("~~")
+			i += 2
+		default:
+			j := i + 1
+			for j < len(s) && strings.IndexByte(specialChars, s[j]) == -1 {
+				j++
+			}
+
+			b.WriteString(escape(s[i:j]))
+			i = j
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,498 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package markdown renders Markdown note bodies into HTML that is safe to
+// embed in the web pages.
+package markdown
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	fenceRe   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	headingRe = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	hrRe      = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	quoteRe   = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	ulItemRe  = regexp.MustCompile(`^( {0,3})([-*+])(?:[ \t]+(.*))?$`)
+	olItemRe  = regexp.MustCompile(`^( {0,3})(\d{1,9})[.)](?:[ \t]+(.*))?$`)
+	langRe    = regexp.MustCompile(`^[\w#+.-]+$`)
+	taskRe    = regexp.MustCompile(`^\[([ xX])\](?:[ \t]+|$)`)
+	delimRe   = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+)
+
+// block is a rendered block-level element
+type block struct {
+	html string
+	// para is true if the block is a paragraph, in which case inline holds
+	// its content without the enclosing tag
+	para   bool
+	inline string
+}
+
+// Render converts the given Markdown source into HTML, supporting the tables,
+// task lists and strikethrough of GitHub Flavored Markdown and highlighting the
+// fenced code in the known languages. Raw HTML in the source is escaped rather
+// than passed through, and only links with safe schemes are kept, so that the
+// result can be embedded in a page as it is.
+func Render(src string) template.HTML {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	lines := strings.Split(src, "\n")
+
+	blocks := renderBlocks(lines)
+
+	var b strings.Builder
+	for _, blk := range blocks {
+		b.WriteString(blk.html)
+		b.WriteString("\n")
+	}
+
+	return template.HTML(b.String())
+}
+
+// tabWidth is the number of columns a tab in the indentation counts as
+const tabWidth = 4
+
+// indentWidth returns the width of the indentation of the given line in columns
+func indentWidth(line string) int {
+	var w int
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			w++
+		case '\t':
+			w += tabWidth - w%tabWidth
+		default:
+			return w
+		}
+	}
+
+	return w
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// startsBlock checks if the given line starts a block that interrupts a paragraph
+func startsBlock(line string) bool {
+	return fenceRe.MatchString(line) ||
+		headingRe.MatchString(line) ||
+		hrRe.MatchString(line) ||
+		quoteRe.MatchString(line) ||
+		listItem(line) != nil
+}
+
+func renderBlocks(lines []string) []block {
+	var blocks []block
+	var para []string
+
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+
+		inline := renderInline(strings.Join(para, "\n"))
+		blocks = append(blocks, block{
+			html:   "<p>" + inline + "</p>",
+			para:   true,
+			inline: inline,
+		})
+		para = nil
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case isBlank(line):
+			flush()
+			i++
+		case fenceRe.MatchString(line):
+			flush()
+			var html string
+			html, i = renderFence(lines, i)
+			blocks = append(blocks, block{html: html})
+		case headingRe.MatchString(line):
+			flush()
+			m := headingRe.FindStringSubmatch(line)
+			level := len(m[1])
+			blocks = append(blocks, block{html: fmt.Sprintf("<h%d>%s</h%d>", level, renderInline(m[2]), level)})
+			i++
+		case hrRe.MatchString(line):
+			flush()
+			blocks = append(blocks, block{html: "<hr>"})
+			i++
+		case quoteRe.MatchString(line):
+			flush()
+			var html string
+			html, i = renderQuote(lines, i)
+			blocks = append(blocks, block{html: html})
+		case listItem(line) != nil:
+			flush()
+			var html string
+			html, i = renderList(lines, i)
+			blocks = append(blocks, block{html: html})
+		case isTable(lines, i):
+			flush()
+			var html string
+			html, i = renderTable(lines, i)
+			blocks = append(blocks, block{html: html})
+		default:
+			para = append(para, strings.TrimSpace(line))
+			i++
+		}
+	}
+	flush()
+
+	return blocks
+}
+
+// renderFence renders the fenced code block starting at the given line and
+// returns the index of the line following the block.
+func renderFence(lines []string, start int) (string, int) {
+	m := fenceRe.FindStringSubmatch(lines[start])
+	marker := m[1]
+	lang := m[2]
+
+	var code []string
+	i := start + 1
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, marker) && strings.Trim(trimmed, marker[:1]) == "" {
+			i++
+			break
+		}
+
+		code = append(code, lines[i])
+	}
+
+	var class string
+	body := template.HTMLEscapeString(strings.Join(code, "\n"))
+	if lang != "" && langRe.MatchString(lang) {
+		class = fmt.Sprintf(` class="language-%s"`, template.HTMLEscapeString(lang))
+
+		if html, ok := highlight(lang, strings.Join(code, "\n")); ok {
+			body = html
+		}
+	}
+
+	if len(code) > 0 {
+		body += "\n"
+	}
+
+	return fmt.Sprintf("<pre><code%s>%s</code></pre>", class, body), i
+}
+
+// renderQuote renders the block quote starting at the given line and returns
+// the index of the line following the block.
+func renderQuote(lines []string, start int) (string, int) {
+	var inner []string
+
+	i := start
+	for ; i < len(lines); i++ {
+		m := quoteRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+
+		inner = append(inner, m[1])
+	}
+
+	var b strings.Builder
+	b.WriteString("<blockquote>\n")
+	for _, blk := range renderBlocks(inner) {
+		b.WriteString(blk.html)
+		b.WriteString("\n")
+	}
+	b.WriteString("</blockquote>")
+
+	return b.String(), i
+}
+
+// item is a list item marker found at the start of a line
+type item struct {
+	ordered bool
+	start   int
+	// offset is the width of the indentation and the marker, which is the
+	// indentation of the content that belongs to the item
+	offset  int
+	content string
+}
+
+func listItem(line string) *item {
+	if hrRe.MatchString(line) {
+		return nil
+	}
+
+	if m := ulItemRe.FindStringSubmatch(line); m != nil {
+		return &item{
+			offset:  len(m[1]) + len(m[2]) + 1,
+			content: m[3],
+		}
+	}
+	if m := olItemRe.FindStringSubmatch(line); m != nil {
+		start, _ := strconv.Atoi(m[2])
+
+		return &item{
+			ordered: true,
+			start:   start,
+			offset:  len(m[1]) + len(m[2]) + 2,
+			content: m[3],
+		}
+	}
+
+	return nil
+}
+
+// dedent removes up to the given number of columns of indentation from the line
+func dedent(line string, n int) string {
+	var w int
+	for i := 0; i < len(line); i++ {
+		if w >= n {
+			return line[i:]
+		}
+
+		switch line[i] {
+		case ' ':
+			w++
+		case '\t':
+			w += tabWidth - w%tabWidth
+		default:
+			return line[i:]
+		}
+
+		// A tab can span past the columns to remove
+		if w > n {
+			return strings.Repeat(" ", w-n) + line[i+1:]
+		}
+	}
+
+	return ""
+}
+
+// renderList renders the list starting at the given line and returns the index
+// of the line following the list.
+func renderList(lines []string, start int) (string, int) {
+	first := listItem(lines[start])
+	offset := first.offset
+
+	items := [][]string{{first.content}}
+	var loose bool
+
+	i := start + 1
+	for i < len(lines) {
+		line := lines[i]
+		cur := len(items) - 1
+
+		if isBlank(line) {
+			// A blank line continues the list only if the following line
+			// belongs to it
+			next := i + 1
+			for next < len(lines) && isBlank(lines[next]) {
+				next++
+			}
+			if next == len(lines) {
+				break
+			}
+
+			nextItem := listItem(lines[next])
+			if indentWidth(lines[next]) >= offset {
+				items[cur] = append(items[cur], "")
+			} else if nextItem == nil || nextItem.ordered != first.ordered {
+				break
+			}
+
+			loose = true
+			i = next
+			continue
+		}
+
+		if indentWidth(line) >= offset {
+			items[cur] = append(items[cur], dedent(line, offset))
+			i++
+			continue
+		}
+
+		if it := listItem(line); it != nil {
+			if it.ordered != first.ordered {
+				break
+			}
+
+			items = append(items, []string{it.content})
+			offset = it.offset
+			i++
+			continue
+		}
+
+		// Lazily continue the paragraph of the current item
+		if startsBlock(line) || isBlank(items[cur][len(items[cur])-1]) {
+			break
+		}
+		items[cur] = append(items[cur], strings.TrimSpace(line))
+		i++
+	}
+
+	tag := "ul"
+	var attr string
+	if first.ordered {
+		tag = "ol"
+		if first.start != 1 {
+			attr = fmt.Sprintf(` start="%d"`, first.start)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%s%s>\n", tag, attr)
+	for _, itemLines := range items {
+		var checkbox string
+		if m := taskRe.FindStringSubmatch(itemLines[0]); m != nil {
+			checkbox = `<input type="checkbox" disabled>`
+			if m[1] != " " {
+				checkbox = `<input type="checkbox" checked disabled>`
+			}
+
+			itemLines[0] = itemLines[0][len(m[0]):]
+			b.WriteString(`<li class="task-list-item">`)
+		} else {
+			b.WriteString("<li>")
+		}
+
+		blocks := renderBlocks(itemLines)
+		if checkbox != "" {
+			// Put the checkbox in the paragraph of the item, if there is one
+			if len(blocks) > 0 && blocks[0].para {
+				blocks[0].inline = checkbox + " " + blocks[0].inline
+				blocks[0].html = "<p>" + blocks[0].inline + "</p>"
+			} else {
+				b.WriteString(checkbox)
+			}
+		}
+
+		for j, blk := range blocks {
+			if j > 0 {
+				b.WriteString("\n")
+			}
+
+			if blk.para && !loose {
+				b.WriteString(blk.inline)
+			} else {
+				b.WriteString(blk.html)
+			}
+		}
+
+		b.WriteString("</li>\n")
+	}
+	fmt.Fprintf(&b, "</%s>", tag)
+
+	return b.String(), i
+}
+
+// splitRow splits the given table row into its cells. A pipe can be a part of
+// a cell if it is escaped.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var start int
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '|':
+			cells = append(cells, line[start:i])
+			start = i + 1
+		}
+	}
+	cells = append(cells, line[start:])
+
+	for i, cell := range cells {
+		cells[i] = strings.Replace(strings.TrimSpace(cell), "\\|", "|", -1)
+	}
+
+	return cells
+}
+
+// isTable checks if a table starts at the given line, which requires a header row
+// followed by a delimiter row with the same number of cells.
+func isTable(lines []string, i int) bool {
+	if i+1 >= len(lines) || !strings.Contains(lines[i], "|") || !delimRe.MatchString(lines[i+1]) {
+		return false
+	}
+
+	return len(splitRow(lines[i])) == len(splitRow(lines[i+1]))
+}
+
+// renderTable renders the table starting at the given line and returns the
+// index of the line following the table.
+func renderTable(lines []string, start int) (string, int) {
+	header := splitRow(lines[start])
+
+	aligns := make([]string, len(header))
+	for j, delim := range splitRow(lines[start+1]) {
+		left := strings.HasPrefix(delim, ":")
+		right := strings.HasSuffix(delim, ":")
+
+		switch {
+		case left && right:
+			aligns[j] = ` align="center"`
+		case left:
+			aligns[j] = ` align="left"`
+		case right:
+			aligns[j] = ` align="right"`
+		}
+	}
+
+	writeRow := func(b *strings.Builder, cells []string, tag string) {
+		b.WriteString("<tr>\n")
+		for j := range header {
+			var cell string
+			if j < len(cells) {
+				cell = cells[j]
+			}
+
+			fmt.Fprintf(b, "<%s%s>%s</%s>\n", tag, aligns[j], renderInline(cell), tag)
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	var b strings.Builder
+	b.WriteString("<table>\n<thead>\n")
+	writeRow(&b, header, "th")
+	b.WriteString("</thead>\n")
+
+	i := start + 2
+	if i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]) {
+		b.WriteString("<tbody>\n")
+		for ; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+			writeRow(&b, splitRow(lines[i]), "td")
+		}
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>")
+
+	return b.String(), i
+}
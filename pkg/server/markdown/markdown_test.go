@@ -0,0 +1,244 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package markdown
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestRender(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "",
+			expected: "",
+		},
+		{
+			input:    "hello world",
+			expected: "<p>hello world</p>\n",
+		},
+		{
+			input:    "line 1\nline 2\n\nline 3",
+			expected: "<p>line 1<br>\nline 2</p>\n<p>line 3</p>\n",
+		},
+		{
+			input:    "# Title\n### Sub #",
+			expected: "<h1>Title</h1>\n<h3>Sub</h3>\n",
+		},
+		{
+			input:    "**bold**, *em*, _em_ and snake_case_name",
+			expected: "<p><strong>bold</strong>, <em>em</em>, <em>em</em> and snake_case_name</p>\n",
+		},
+		{
+			input:    "use `a < b` and `` ` ``",
+			expected: "<p>use <code>a &lt; b</code> and <code>`</code></p>\n",
+		},
+		{
+			input:    "```go\nfunc main() {\n\tfmt.Println(\"<hi>\")\n}\n```",
+			expected: "<pre><code class=\"language-go\"><span class=\"hl-keyword\">func</span> main() {\n\tfmt.Println(<span class=\"hl-string\">&#34;&lt;hi&gt;&#34;</span>)\n}\n</code></pre>\n",
+		},
+		{
+			input:    "```unknown\nfunc \"x\"\n```",
+			expected: "<pre><code class=\"language-unknown\">func &#34;x&#34;\n</code></pre>\n",
+		},
+		{
+			input:    "| a | b |\n|:--|--:|\n| `x \\| y` | **2** |\n| 3 |\n\nafter",
+			expected: "<table>\n<thead>\n<tr>\n<th align=\"left\">a</th>\n<th align=\"right\">b</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td align=\"left\"><code>x | y</code></td>\n<td align=\"right\"><strong>2</strong></td>\n</tr>\n<tr>\n<td align=\"left\">3</td>\n<td align=\"right\"></td>\n</tr>\n</tbody>\n</table>\n<p>after</p>\n",
+		},
+		{
+			input:    "a | b\n--- | ---",
+			expected: "<table>\n<thead>\n<tr>\n<th>a</th>\n<th>b</th>\n</tr>\n</thead>\n</table>\n",
+		},
+		{
+			input:    "a | b\n---",
+			expected: "<p>a | b</p>\n<hr>\n",
+		},
+		{
+			input:    "- [ ] todo\n- [x] done\n- [link](/a)",
+			expected: "<ul>\n<li class=\"task-list-item\"><input type=\"checkbox\" disabled> todo</li>\n<li class=\"task-list-item\"><input type=\"checkbox\" checked disabled> done</li>\n<li><a href=\"/a\" rel=\"nofollow noopener\">link</a></li>\n</ul>\n",
+		},
+		{
+			input:    "- [X] done\n\n- [ ] todo",
+			expected: "<ul>\n<li class=\"task-list-item\"><p><input type=\"checkbox\" checked disabled> done</p></li>\n<li class=\"task-list-item\"><p><input type=\"checkbox\" disabled> todo</p></li>\n</ul>\n",
+		},
+		{
+			input:    "~~gone~~ and ~~ not ~~",
+			expected: "<p><del>gone</del> and ~~ not ~~</p>\n",
+		},
+		{
+			input:    "```\nunclosed",
+			expected: "<pre><code>unclosed\n</code></pre>\n",
+		},
+		{
+			input:    "> quoted\n> text",
+			expected: "<blockquote>\n<p>quoted<br>\ntext</p>\n</blockquote>\n",
+		},
+		{
+			input:    "- a\n- b\n  - c\n- d",
+			expected: "<ul>\n<li>a</li>\n<li>b\n<ul>\n<li>c</li>\n</ul></li>\n<li>d</li>\n</ul>\n",
+		},
+		{
+			input:    "- a\n\t- b",
+			expected: "<ul>\n<li>a\n<ul>\n<li>b</li>\n</ul></li>\n</ul>\n",
+		},
+		{
+			input:    "3. a\n4. b",
+			expected: "<ol start=\"3\">\n<li>a</li>\n<li>b</li>\n</ol>\n",
+		},
+		{
+			input:    "- a\n\n- b",
+			expected: "<ul>\n<li><p>a</p></li>\n<li><p>b</p></li>\n</ul>\n",
+		},
+		{
+			input:    "---",
+			expected: "<hr>\n",
+		},
+		{
+			input:    "[nad](https://example.com/a?b=1&c=2 \"title\")",
+			expected: "<p><a href=\"https://example.com/a?b=1&amp;c=2\" rel=\"nofollow noopener\">nad</a></p>\n",
+		},
+		{
+			input:    "<https://example.com>",
+			expected: "<p><a href=\"https://example.com\" rel=\"nofollow noopener\">https://example.com</a></p>\n",
+		},
+		{
+			input:    "![logo](/static/logo.png)",
+			expected: "<p><img src=\"/static/logo.png\" alt=\"logo\"></p>\n",
+		},
+		{
+			input:    `\*not em\*`,
+			expected: "<p>*not em*</p>\n",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result := Render(tc.input)
+			assert.Equal(t, string(result), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestRender_sanitize(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "<script>alert(1)</script>",
+			expected: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n",
+		},
+		{
+			input:    "<img src=x onerror=alert(1)>",
+			expected: "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n",
+		},
+		{
+			input:    "[click](javascript:alert(1))",
+			expected: "<p>click</p>\n",
+		},
+		{
+			input:    "[click](JavaScript:alert(1))",
+			expected: "<p>click</p>\n",
+		},
+		{
+			input:    "![x](data:text/html;base64,PHNjcmlwdD4=)",
+			expected: "<p>x</p>\n",
+		},
+		{
+			input:    "[x](\"onmouseover=\"alert(1))",
+			expected: "<p><a href=\"&#34;onmouseover=&#34;alert(1)\" rel=\"nofollow noopener\">x</a></p>\n",
+		},
+		{
+			input:    "```js\n// </span><script>\nx = '<img onerror=alert(1)>'\n```",
+			expected: "<pre><code class=\"language-js\"><span class=\"hl-comment\">// &lt;/span&gt;&lt;script&gt;</span>\nx = <span class=\"hl-string\">&#39;&lt;img onerror=alert(1)&gt;&#39;</span>\n</code></pre>\n",
+		},
+		{
+			input:    "| <b>a</b> |\n| - |\n| [x](javascript:alert(1)) |",
+			expected: "<table>\n<thead>\n<tr>\n<th>&lt;b&gt;a&lt;/b&gt;</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>x</td>\n</tr>\n</tbody>\n</table>\n",
+		},
+		{
+			input:    "```\"><script>\n```",
+			expected: "<pre><code></code></pre>\n",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result := Render(tc.input)
+			assert.Equal(t, string(result), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	testCases := []struct {
+		lang     string
+		code     string
+		expected string
+	}{
+		{
+			lang:     "golang",
+			code:     "var n int = 0x1f // count\ns := `a\nb`",
+			expected: "<span class=\"hl-keyword\">var</span> n <span class=\"hl-type\">int</span> = <span class=\"hl-number\">0x1f</span> <span class=\"hl-comment\">// count</span>\ns := <span class=\"hl-string\">`a\nb`</span>",
+		},
+		{
+			lang:     "SQL",
+			code:     "SELECT id FROM notes WHERE body = 'it''s' -- all",
+			expected: "<span class=\"hl-keyword\">SELECT</span> id <span class=\"hl-keyword\">FROM</span> notes <span class=\"hl-keyword\">WHERE</span> body = <span class=\"hl-string\">&#39;it&#39;</span><span class=\"hl-string\">&#39;s&#39;</span> <span class=\"hl-comment\">-- all</span>",
+		},
+		{
+			lang:     "bash",
+			code:     "echo $# # args",
+			expected: "<span class=\"hl-keyword\">echo</span> $# <span class=\"hl-comment\"># args</span>",
+		},
+		{
+			lang:     "python",
+			code:     "def f(x2):\n    \"\"\"doc\n    \"\"\"\n    return None",
+			expected: "<span class=\"hl-keyword\">def</span> f(x2):\n    <span class=\"hl-string\">&#34;&#34;&#34;doc\n    &#34;&#34;&#34;</span>\n    <span class=\"hl-keyword\">return</span> <span class=\"hl-literal\">None</span>",
+		},
+		{
+			lang:     "rust",
+			code:     "fn f<'a>(s: &'a str) {}",
+			expected: "<span class=\"hl-keyword\">fn</span> f&lt;&#39;a&gt;(s: &amp;&#39;a <span class=\"hl-type\">str</span>) {}",
+		},
+		{
+			lang:     "js",
+			code:     "const s = \"unterminated\nlet",
+			expected: "<span class=\"hl-keyword\">const</span> s = <span class=\"hl-string\">&#34;unterminated</span>\n<span class=\"hl-keyword\">let</span>",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result, ok := highlight(tc.lang, tc.code)
+			assert.Equal(t, ok, true, "ok mismatch")
+			assert.Equal(t, result, tc.expected, "result mismatch")
+		})
+	}
+
+	t.Run("unsupported language", func(t *testing.T) {
+		_, ok := highlight("brainfuck", "+[]")
+		assert.Equal(t, ok, false, "ok mismatch")
+	})
+}
@@ -0,0 +1,45 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package metrics
+
+import (
+	"database/sql"
+)
+
+// RegisterDBStats registers the statistics of the connection pool of the given database
+func (r *Registry) RegisterDBStats(db *sql.DB) {
+	r.NewGaugeFunc("nad_db_max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+		return float64(db.Stats().MaxOpenConnections)
+	})
+	r.NewGaugeFunc("nad_db_open_connections", "Number of established connections to the database, both in use and idle.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	})
+	r.NewGaugeFunc("nad_db_in_use_connections", "Number of connections to the database currently in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	})
+	r.NewGaugeFunc("nad_db_idle_connections", "Number of idle connections to the database.", func() float64 {
+		return float64(db.Stats().Idle)
+	})
+	r.NewCounterFunc("nad_db_wait_count_total", "Total number of connections waited for.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	})
+	r.NewCounterFunc("nad_db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	})
+}
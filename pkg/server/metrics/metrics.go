@@ -0,0 +1,317 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package metrics provides counters, histograms and gauges that are exposed
+// in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets for latencies in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds the metrics to be exposed
+type Registry struct {
+	mtx        sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry returns a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// DefaultRegistry is the registry for the metrics of the server
+var DefaultRegistry = NewRegistry()
+
+// register adds the collector to the registry. It panics if a metric with the
+// same name has already been registered.
+func (r *Registry) register(c collector) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic(fmt.Sprintf("metric %s is already registered", c.name()))
+		}
+	}
+
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all the metrics in the registry in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mtx.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mtx.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+
+	var buf bytes.Buffer
+	for _, c := range collectors {
+		c.write(&buf)
+	}
+
+	return buf.WriteTo(w)
+}
+
+// Handler returns a handler that responds with the metrics in the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// desc describes a metric with labels
+type desc struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+func (d desc) writeHeader(w io.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, help, d.metricName, d.typ)
+}
+
+// key joins the label values into a key for the series
+func (d desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values but got %d", d.metricName, len(d.labels), len(labelValues)))
+	}
+
+	return strings.Join(labelValues, "\xff")
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// formatLabels formats the labels with the given values, followed by the extra label if not empty
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, n, labelValueReplacer.Replace(values[i])))
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extraName, labelValueReplacer.Replace(extraValue)))
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of the series in a stable order
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	desc
+	mtx         sync.Mutex
+	values      map[string]float64
+	labelValues map[string][]string
+}
+
+// NewCounterVec registers and returns a new counter with the given labels
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:        desc{metricName: name, help: help, typ: "counter", labels: labels},
+		values:      map[string]float64{},
+		labelValues: map[string][]string{},
+	}
+	r.register(c)
+
+	return c
+}
+
+// NewCounterVec registers and returns a new counter in the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labels...)
+}
+
+// Add adds the given value to the counter with the given label values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+
+	k := c.key(labelValues)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.labelValues[k]; !ok {
+		c.labelValues[k] = append([]string(nil), labelValues...)
+	}
+	c.values[k] += v
+}
+
+// Inc increments the counter with the given label values by 1
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.writeHeader(w)
+	for _, k := range sortedKeys(c.labelValues) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labels, c.labelValues[k], "", ""), formatFloat(c.values[k]))
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets     []float64
+	mtx         sync.Mutex
+	values      map[string]*histogram
+	labelValues map[string][]string
+}
+
+// NewHistogramVec registers and returns a new histogram with the given upper
+// bounds of the buckets and labels
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	h := &HistogramVec{
+		desc:        desc{metricName: name, help: help, typ: "histogram", labels: labels},
+		buckets:     b,
+		values:      map[string]*histogram{},
+		labelValues: map[string][]string{},
+	}
+	r.register(h)
+
+	return h
+}
+
+// NewHistogramVec registers and returns a new histogram in the default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// Observe adds an observation to the histogram with the given label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	hist, ok := h.values[k]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = hist
+		h.labelValues[k] = append([]string(nil), labelValues...)
+	}
+
+	for i, b := range h.buckets {
+		if v <= b {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.writeHeader(w)
+	for _, k := range sortedKeys(h.labelValues) {
+		hist := h.values[k]
+		lv := h.labelValues[k]
+
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labels, lv, "le", formatFloat(b)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labels, lv, "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, formatLabels(h.labels, lv, "", ""), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, formatLabels(h.labels, lv, "", ""), hist.count)
+	}
+}
+
+// valueFunc is a metric whose value is read when the metrics are written
+type valueFunc struct {
+	desc
+	f func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is returned by the given function
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(&valueFunc{desc: desc{metricName: name, help: help, typ: "gauge"}, f: f})
+}
+
+// NewCounterFunc registers a counter whose value is returned by the given function
+func (r *Registry) NewCounterFunc(name, help string, f func() float64) {
+	r.register(&valueFunc{desc: desc{metricName: name, help: help, typ: "counter"}, f: f})
+}
+
+func (v *valueFunc) write(w io.Writer) {
+	v.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", v.metricName, formatFloat(v.f()))
+}
@@ -0,0 +1,79 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.NewCounterVec("test_requests_total", "Total number of requests.", "method", "code")
+	c.Inc("POST", "201")
+	c.Inc("GET", "200")
+	c.Add(2, "GET", "200")
+
+	h := r.NewHistogramVec("test_duration_seconds", "Duration of requests.", []float64{1, 0.1}, "route")
+	h.Observe(0.05, `/notes/"x"`)
+	h.Observe(0.5, `/notes/"x"`)
+	h.Observe(3, `/notes/"x"`)
+
+	r.NewGaugeFunc("test_connections", "Number of\nconnections.", func() float64 {
+		return 4
+	})
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP test_connections Number of\nconnections.
+# TYPE test_connections gauge
+test_connections 4
+# HELP test_duration_seconds Duration of requests.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/notes/\"x\"",le="0.1"} 1
+test_duration_seconds_bucket{route="/notes/\"x\"",le="1"} 2
+test_duration_seconds_bucket{route="/notes/\"x\"",le="+Inf"} 3
+test_duration_seconds_sum{route="/notes/\"x\""} 3.55
+test_duration_seconds_count{route="/notes/\"x\""} 3
+# HELP test_requests_total Total number of requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 3
+test_requests_total{method="POST",code="201"} 1
+`
+	assert.Equal(t, buf.String(), expected, "output mismatch")
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	r.NewCounterVec("test_total", "Test.")
+}
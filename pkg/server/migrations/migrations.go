@@ -2,6 +2,7 @@ package migrations
 
 import (
 	"log"
+	"time"
 
 	"github.com/gobuffalo/packr/v2"
 	"github.com/jinzhu/gorm"
@@ -14,15 +15,41 @@ var (
 	MigrationTableName = "migrations"
 )
 
-// Run runs the migrations
-func Run(db *gorm.DB) error {
-	migrations := &migrate.PackrMigrationSource{
-		Box: packr.New("migrations", "./sql"),
-	}
+// Record is the state of a migration
+type Record struct {
+	ID        string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// box holds the migrations for Postgres, and sqliteBox holds the ones for SQLite
+var box = packr.New("migrations", "./sql")
+var sqliteBox = packr.New("migrations-sqlite", "./sqlite")
 
+// getDialect returns the sql-migrate dialect of the given database
+func getDialect(db *gorm.DB) string {
+	return db.Dialect().GetName()
+}
+
+func getSource(dialect string) migrate.MigrationSource {
 	migrate.SetTable(MigrationTableName)
 
-	n, err := migrate.Exec(db.DB(), "postgres", migrations, migrate.Up)
+	if dialect == "sqlite3" {
+		return &migrate.PackrMigrationSource{
+			Box: sqliteBox,
+		}
+	}
+
+	return &migrate.PackrMigrationSource{
+		Box: box,
+	}
+}
+
+// Run runs the migrations
+func Run(db *gorm.DB) error {
+	dialect := getDialect(db)
+
+	n, err := migrate.Exec(db.DB(), dialect, getSource(dialect), migrate.Up)
 	if err != nil {
 		return errors.Wrap(err, "running migrations")
 	}
@@ -31,3 +58,48 @@ func Run(db *gorm.DB) error {
 
 	return nil
 }
+
+// Rollback undoes the given number of the most recently applied migrations, and
+// returns the number of the migrations undone.
+func Rollback(db *gorm.DB, max int) (int, error) {
+	dialect := getDialect(db)
+
+	n, err := migrate.ExecMax(db.DB(), dialect, getSource(dialect), migrate.Down, max)
+	if err != nil {
+		return n, errors.Wrap(err, "rolling back migrations")
+	}
+
+	return n, nil
+}
+
+// Status returns the state of all known migrations, in the order they are applied.
+func Status(db *gorm.DB) ([]Record, error) {
+	dialect := getDialect(db)
+
+	migrations, err := getSource(dialect).FindMigrations()
+	if err != nil {
+		return nil, errors.Wrap(err, "finding migrations")
+	}
+
+	records, err := migrate.GetMigrationRecords(db.DB(), dialect)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting migration records")
+	}
+
+	applied := map[string]time.Time{}
+	for _, r := range records {
+		applied[r.Id] = r.AppliedAt
+	}
+
+	ret := []Record{}
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Id]
+		ret = append(ret, Record{
+			ID:        m.Id,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,22 @@
+
+-- +migrate Up
+
+-- Do not index the content of encrypted notes, which is meaningless to the server
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION note_tsv_trigger() RETURNS trigger AS $$
+begin
+  IF new.encrypted THEN
+    new.tsv := NULL;
+  ELSE
+    new.tsv := setweight(to_tsvector('english_nostop', new.body), 'A');
+  END IF;
+  return new;
+end
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+UPDATE notes
+SET tsv = NULL
+WHERE notes.encrypted = true;
+
+-- +migrate Down
@@ -0,0 +1,13 @@
+-- +migrate Up
+
+-- The full text search is set up by 20200122144653-full-text-search.sql and
+-- 20200301120000-skip-tsv-for-encrypted-notes.sql, which cannot be rolled back
+-- by themselves. This migration only removes it when rolling back.
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_notes_tsv;
+DROP TRIGGER IF EXISTS tsvectorupdate ON notes;
+DROP FUNCTION IF EXISTS note_tsv_trigger();
+DROP TEXT SEARCH CONFIGURATION IF EXISTS public.english_nostop;
+DROP TEXT SEARCH DICTIONARY IF EXISTS english_nostop;
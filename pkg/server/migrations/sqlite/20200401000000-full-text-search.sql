@@ -0,0 +1,46 @@
+
+-- +migrate Up
+
+-- Index the body of the notes that are not encrypted. The index reads the
+-- bodies from the notes table, and the triggers keep it in sync.
+CREATE VIRTUAL TABLE notes_fts USING fts5(
+  body,
+  content='notes',
+  content_rowid='id',
+  tokenize='porter unicode61'
+);
+
+-- +migrate StatementBegin
+CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes
+WHEN NOT new.encrypted
+BEGIN
+  INSERT INTO notes_fts(rowid, body) VALUES (new.id, new.body);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER notes_fts_delete AFTER DELETE ON notes
+WHEN NOT old.encrypted
+BEGIN
+  INSERT INTO notes_fts(notes_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+CREATE TRIGGER notes_fts_update AFTER UPDATE OF body, encrypted ON notes
+BEGIN
+  INSERT INTO notes_fts(notes_fts, rowid, body) SELECT 'delete', old.id, old.body WHERE NOT old.encrypted;
+  INSERT INTO notes_fts(rowid, body) SELECT new.id, new.body WHERE NOT new.encrypted;
+END;
+-- +migrate StatementEnd
+
+-- initialize the index
+INSERT INTO notes_fts(rowid, body)
+SELECT id, body FROM notes WHERE NOT encrypted;
+
+-- +migrate Down
+
+DROP TRIGGER IF EXISTS notes_fts_update;
+DROP TRIGGER IF EXISTS notes_fts_delete;
+DROP TRIGGER IF EXISTS notes_fts_insert;
+DROP TABLE IF EXISTS notes_fts;
@@ -0,0 +1,320 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/nadproject/nad/pkg/server/crypt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ScopeNotesRead is a scope for reading notes and books
+	ScopeNotesRead = "notes:read"
+	// ScopeNotesWrite is a scope for creating, updating and deleting notes and books
+	ScopeNotesWrite = "notes:write"
+	// ScopeSync is a scope for syncing with the CLI
+	ScopeSync = "sync"
+	// ScopeAdmin is a scope that grants every other scope, and managing access tokens
+	ScopeAdmin = "admin"
+
+	// AccessTokenPrefix is the prefix of the keys of access tokens. It tells
+	// access tokens apart from session keys.
+	AccessTokenPrefix = "nadpat_"
+)
+
+// Scopes is a list of all scopes of access tokens
+var Scopes = []string{ScopeNotesRead, ScopeNotesWrite, ScopeSync, ScopeAdmin}
+
+// AccessToken is a named credential with a limited set of scopes, used by
+// scripts and CI jobs instead of a login session.
+type AccessToken struct {
+	Model
+	UserID     uint `gorm:"index"`
+	Name       string
+	Scopes     string
+	KeyHash    string `gorm:"unique_index"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// ScopeList returns the scopes of the token
+func (t AccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope checks if the token has any of the given scopes
+func (t AccessToken) HasScope(scopes ...string) bool {
+	for _, s := range t.ScopeList() {
+		if s == ScopeAdmin {
+			return true
+		}
+
+		for _, scope := range scopes {
+			if s == scope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsExpired checks if the token has been expired at the given time
+func (t AccessToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// hashAccessTokenKey returns the digest of the given key to be stored in place of the key
+func hashAccessTokenKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeScopes validates the given scopes and removes duplicates
+func NormalizeScopes(scopes []string) ([]string, error) {
+	ret := []string{}
+	seen := map[string]bool{}
+
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+
+		valid := false
+		for _, scope := range Scopes {
+			if s == scope {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, ErrAccessTokenScopeInvalid
+		}
+
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// AccessTokenDB is an interface for database operations related to access tokens.
+type AccessTokenDB interface {
+	ByKey(key string) (*AccessToken, error)
+	ByUserID(userID uint) ([]AccessToken, error)
+
+	Create(t *AccessToken) error
+	Delete(userID, id uint) error
+	DeleteByUserID(userID uint, tx *gorm.DB) error
+	Touch(t *AccessToken, now time.Time) error
+}
+
+// accessTokenGorm encapsulates the actual implementations of
+// the database operations involving access tokens.
+type accessTokenGorm struct {
+	db *gorm.DB
+}
+
+// AccessTokenService is a set of methods for interacting with the access token model
+type AccessTokenService interface {
+	AccessTokenDB
+	// Generate creates a new access token and returns it along with its key.
+	// The key is not stored and cannot be retrieved again.
+	Generate(t *AccessToken) (string, error)
+}
+
+type accessTokenService struct {
+	AccessTokenDB
+}
+
+// NewAccessTokenService returns a new accessTokenService
+func NewAccessTokenService(db *gorm.DB) AccessTokenService {
+	ag := &accessTokenGorm{db}
+	av := newAccessTokenValidator(ag)
+
+	return &accessTokenService{
+		AccessTokenDB: av,
+	}
+}
+
+func (as *accessTokenService) Generate(t *AccessToken) (string, error) {
+	secret, err := crypt.GetRandomStr(32)
+	if err != nil {
+		return "", errors.Wrap(err, "generating key")
+	}
+
+	// Make the key safe to use in a URL and a shell without quoting
+	r := strings.NewReplacer("+", "-", "/", "_", "=", "")
+	key := AccessTokenPrefix + r.Replace(secret)
+
+	t.KeyHash = hashAccessTokenKey(key)
+	if err := as.Create(t); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+type accessTokenValidator struct {
+	AccessTokenDB
+}
+
+func newAccessTokenValidator(adb AccessTokenDB) *accessTokenValidator {
+	return &accessTokenValidator{
+		AccessTokenDB: adb,
+	}
+}
+
+type accessTokenValFunc func(*AccessToken) error
+
+func runAccessTokenValFuncs(t *AccessToken, fns ...accessTokenValFunc) error {
+	for _, fn := range fns {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ByKey validates the key for looking up an access token.
+func (av *accessTokenValidator) ByKey(key string) (*AccessToken, error) {
+	if !strings.HasPrefix(key, AccessTokenPrefix) {
+		return nil, ErrNotFound
+	}
+
+	return av.AccessTokenDB.ByKey(key)
+}
+
+// Create validates and normalizes the given access token for creation.
+func (av *accessTokenValidator) Create(t *AccessToken) error {
+	err := runAccessTokenValFuncs(t,
+		av.requireUserID,
+		av.normalizeName,
+		av.requireName,
+		av.normalizeScopes,
+		av.requireKeyHash)
+	if err != nil {
+		return err
+	}
+
+	return av.AccessTokenDB.Create(t)
+}
+
+func (av *accessTokenValidator) requireUserID(t *AccessToken) error {
+	if t.UserID == 0 {
+		return ErrAccessTokenUserIDRequired
+	}
+
+	return nil
+}
+
+func (av *accessTokenValidator) normalizeName(t *AccessToken) error {
+	t.Name = strings.TrimSpace(t.Name)
+
+	return nil
+}
+
+func (av *accessTokenValidator) requireName(t *AccessToken) error {
+	if t.Name == "" {
+		return ErrAccessTokenNameRequired
+	}
+
+	return nil
+}
+
+func (av *accessTokenValidator) normalizeScopes(t *AccessToken) error {
+	scopes, err := NormalizeScopes(t.ScopeList())
+	if err != nil {
+		return err
+	}
+	if len(scopes) == 0 {
+		return ErrAccessTokenScopeRequired
+	}
+
+	t.Scopes = strings.Join(scopes, ",")
+
+	return nil
+}
+
+func (av *accessTokenValidator) requireKeyHash(t *AccessToken) error {
+	if t.KeyHash == "" {
+		return ErrAccessTokenKeyRequired
+	}
+
+	return nil
+}
+
+// ByKey looks up an access token with the given key.
+func (ag *accessTokenGorm) ByKey(key string) (*AccessToken, error) {
+	var ret AccessToken
+	err := First(ag.db.Where("key_hash = ?", hashAccessTokenKey(key)), &ret)
+
+	return &ret, err
+}
+
+// ByUserID returns the access tokens of the user with the given id.
+func (ag *accessTokenGorm) ByUserID(userID uint) ([]AccessToken, error) {
+	ret := []AccessToken{}
+	if err := ag.db.Where("user_id = ?", userID).Order("id ASC").Find(&ret).Error; err != nil {
+		return nil, errors.Wrap(err, "finding access tokens")
+	}
+
+	return ret, nil
+}
+
+// Create creates the given access token.
+func (ag *accessTokenGorm) Create(t *AccessToken) error {
+	if err := ag.db.Create(t).Error; err != nil {
+		return errors.Wrap(err, "inserting access token")
+	}
+
+	return nil
+}
+
+// Delete deletes the access token with the given id owned by the user with the given id.
+func (ag *accessTokenGorm) Delete(userID, id uint) error {
+	conn := ag.db.Where("id = ? AND user_id = ?", id, userID).Delete(&AccessToken{})
+	if err := conn.Error; err != nil {
+		return errors.Wrap(err, "deleting access token")
+	}
+	if conn.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteByUserID deletes all access tokens of the user with the given id.
+func (ag *accessTokenGorm) DeleteByUserID(userID uint, tx *gorm.DB) error {
+	var conn *gorm.DB
+	if tx != nil {
+		conn = tx
+	} else {
+		conn = ag.db
+	}
+
+	if err := conn.Where("user_id = ?", userID).Delete(&AccessToken{}).Error; err != nil {
+		return errors.Wrap(err, "deleting access tokens")
+	}
+
+	return nil
+}
+
+// Touch records that the given access token was used at the given time.
+func (ag *accessTokenGorm) Touch(t *AccessToken, now time.Time) error {
+	if err := ag.db.Model(t).UpdateColumn("last_used_at", now).Error; err != nil {
+		return errors.Wrap(err, "updating last_used_at")
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	testCases := []struct {
+		input    []string
+		expected []string
+		err      error
+	}{
+		{
+			input:    []string{},
+			expected: []string{},
+		},
+		{
+			input:    []string{"notes:read", "sync"},
+			expected: []string{"notes:read", "sync"},
+		},
+		{
+			input:    []string{" notes:write ", "notes:write", "admin"},
+			expected: []string{"notes:write", "admin"},
+		},
+		{
+			input: []string{"notes:read", "notes"},
+			err:   ErrAccessTokenScopeInvalid,
+		},
+		{
+			input: []string{""},
+			err:   ErrAccessTokenScopeInvalid,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result, err := NormalizeScopes(tc.input)
+
+			assert.Equal(t, err, tc.err, "error mismatch")
+			assert.DeepEqual(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestAccessTokenHasScope(t *testing.T) {
+	testCases := []struct {
+		scopes   string
+		input    []string
+		expected bool
+	}{
+		{
+			scopes:   "notes:read",
+			input:    []string{"notes:read"},
+			expected: true,
+		},
+		{
+			scopes:   "notes:read,sync",
+			input:    []string{"notes:write", "sync"},
+			expected: true,
+		},
+		{
+			scopes:   "notes:read",
+			input:    []string{"notes:write"},
+			expected: false,
+		},
+		{
+			scopes:   "notes:read",
+			input:    []string{},
+			expected: false,
+		},
+		{
+			scopes:   "admin",
+			input:    []string{"notes:write"},
+			expected: true,
+		},
+		{
+			scopes:   "admin",
+			input:    []string{},
+			expected: true,
+		},
+		{
+			scopes:   "",
+			input:    []string{"notes:read"},
+			expected: false,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			tok := AccessToken{Scopes: tc.scopes}
+
+			assert.Equal(t, tok.HasScope(tc.input...), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestAccessTokenIsExpired(t *testing.T) {
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	testCases := []struct {
+		expiresAt *time.Time
+		expected  bool
+	}{
+		{
+			expiresAt: nil,
+			expected:  false,
+		},
+		{
+			expiresAt: &past,
+			expected:  true,
+		},
+		{
+			expiresAt: &now,
+			expected:  true,
+		},
+		{
+			expiresAt: &future,
+			expected:  false,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			tok := AccessToken{ExpiresAt: tc.expiresAt}
+
+			assert.Equal(t, tok.IsExpired(now), tc.expected, "result mismatch")
+		})
+	}
+}
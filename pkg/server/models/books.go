@@ -11,22 +11,29 @@ import (
 // Book is a model for a book
 type Book struct {
 	Model
-	UUID      string `gorm:"index;type:uuid;default:uuid_generate_v4()"`
-	UserID    uint   `gorm:"index"`
-	Name      string `gorm:"index"`
-	Notes     []Note `gorm:"foreignkey:book_uuid"`
-	USN       int    `gorm:"index"`
-	Deleted   bool   `gorm:"default:false"`
-	Encrypted bool   `gorm:"default:false"`
-	AddedOn   int64
-	EditedOn  int64
+	UUID       string `gorm:"index;type:uuid"`
+	UserID     uint   `gorm:"index"`
+	Name       string `gorm:"index"`
+	ParentUUID string `gorm:"index;not null;default:''"`
+	Notes      []Note `gorm:"foreignkey:book_uuid"`
+	USN        int    `gorm:"index"`
+	Deleted    bool   `gorm:"default:false"`
+	Encrypted  bool   `gorm:"default:false"`
+	AddedOn    int64
+	EditedOn   int64
+}
+
+// BeforeCreate generates the UUID of the book
+func (b *Book) BeforeCreate(scope *gorm.Scope) error {
+	return setUUID(scope, "UUID")
 }
 
 // BookDB is an interface for database operations related to bookb.
 type BookDB interface {
 	Search(p BookSearchParams) ([]Book, error)
 	ByUUID(uuid string) (*Book, error)
-	ByName(userID uint, name string) (*Book, error)
+	ByName(userID uint, parentUUID, name string) (*Book, error)
+	ActiveByParentUUID(parentUUID string) ([]Book, error)
 	ByUSNRange(userID uint, lb, ub, limit int) ([]Book, error)
 
 	Create(*Book, *gorm.DB) error
@@ -93,14 +100,22 @@ func (bg *bookGorm) Search(p BookSearchParams) ([]Book, error) {
 	return ret, err
 }
 
-// ByName looks up a book with the given name.
-func (bg *bookGorm) ByName(userID uint, name string) (*Book, error) {
+// ByName looks up a book with the given name under the given parent.
+func (bg *bookGorm) ByName(userID uint, parentUUID, name string) (*Book, error) {
 	var ret Book
-	err := First(bg.db.Where("user_id = ? AND name = ?", userID, name), &ret)
+	err := First(bg.db.Where("user_id = ? AND parent_uuid = ? AND name = ?", userID, parentUUID, name), &ret)
 
 	return &ret, err
 }
 
+// ActiveByParentUUID retrieves the undeleted children of the book with the given uuid.
+func (bg *bookGorm) ActiveByParentUUID(parentUUID string) ([]Book, error) {
+	var ret []Book
+	err := Find(bg.db.Where("parent_uuid = ? AND NOT deleted", parentUUID).Order("name ASC"), &ret)
+
+	return ret, err
+}
+
 func (bg *bookGorm) ByUSNRange(userID uint, lb, ub, limit int) ([]Book, error) {
 	var ret []Book
 	err := Find(bg.db.Where("user_id = ? AND usn > ? AND usn <= ?", userID, lb, ub).Order("usn ASC").Limit(limit), &ret)
@@ -161,6 +176,7 @@ func runBookValFuncs(book *Book, fns ...bookValFunc) error {
 func (bv *bookValidator) Create(b *Book, tx *gorm.DB) error {
 	if err := runBookValFuncs(b,
 		bv.ensureNameUnique,
+		bv.ensureParentValid,
 		bv.requireUserID,
 		bv.requireUSN,
 	); err != nil {
@@ -175,6 +191,7 @@ func (bv *bookValidator) Create(b *Book, tx *gorm.DB) error {
 func (bv *bookValidator) Update(b *Book, tx *gorm.DB) error {
 	if err := runBookValFuncs(b,
 		bv.ensureNameUnique,
+		bv.ensureParentValid,
 		bv.requireUserID,
 		bv.requireUSN,
 	); err != nil {
@@ -227,14 +244,49 @@ func (bv *bookValidator) ensureNameUnique(b *Book) error {
 		return nil
 	}
 
-	_, err := bv.BookDB.ByName(b.UserID, b.Name)
+	existing, err := bv.BookDB.ByName(b.UserID, b.ParentUUID, b.Name)
 	if err == ErrNotFound {
 		return nil
 	}
+	if err == nil && existing.ID == b.ID {
+		return nil
+	}
 
 	return ErrBookNameTaken
 }
 
+// ensureParentValid checks that the parent book exists, belongs to the same
+// user, and is not the book itself or one of its descendants.
+func (bv *bookValidator) ensureParentValid(b *Book) error {
+	// Deleted books keep their parent for reference only.
+	if b.ParentUUID == "" || b.Deleted {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	uuid := b.ParentUUID
+	for uuid != "" {
+		if (b.UUID != "" && uuid == b.UUID) || seen[uuid] {
+			return ErrBookParentInvalid
+		}
+		seen[uuid] = true
+
+		parent, err := bv.BookDB.ByUUID(uuid)
+		if err == ErrNotFound {
+			return ErrBookParentInvalid
+		} else if err != nil {
+			return errors.Wrap(err, "finding parent book")
+		}
+		if parent.UserID != b.UserID || parent.Deleted {
+			return ErrBookParentInvalid
+		}
+
+		uuid = parent.ParentUUID
+	}
+
+	return nil
+}
+
 func (bv *bookValidator) requireUSN(b *Book) error {
 	if b.USN == 0 {
 		return ErrBookUSNRequired
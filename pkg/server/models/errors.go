@@ -27,6 +27,16 @@ var (
 	ErrIDInvalid badRequestError = badRequestError{"invalid id"}
 	// ErrSessionUserIDRequired is an error for missing session key
 	ErrSessionUserIDRequired badRequestError = badRequestError{"user_id is required"}
+	// ErrPageInvalid is an error for an invalid page number
+	ErrPageInvalid badRequestError = badRequestError{"page is invalid"}
+	// ErrPerPageInvalid is an error for an invalid number of items per page
+	ErrPerPageInvalid badRequestError = badRequestError{"per_page is invalid"}
+	// ErrCursorInvalid is an error for a malformed pagination cursor
+	ErrCursorInvalid badRequestError = badRequestError{"cursor is invalid"}
+	// ErrTimeInvalid is an error for a malformed time in a query param
+	ErrTimeInvalid badRequestError = badRequestError{"time is invalid"}
+	// ErrPublicInvalid is an error for a malformed public flag in a query param
+	ErrPublicInvalid badRequestError = badRequestError{"public is invalid"}
 
 	// ErrNoteUUIDRequired is an error for missing session key
 	ErrNoteUUIDRequired badRequestError = badRequestError{"note uuid is required"}
@@ -40,6 +50,22 @@ var (
 	ErrNoteEditedOnRequired badRequestError = badRequestError{"note edited_on is required"}
 	// ErrNoteUSNRequired is an error for missing usn in note
 	ErrNoteUSNRequired badRequestError = badRequestError{"note usn is required"}
+	// ErrNoteSortInvalid is an error for an unsupported sort field for notes
+	ErrNoteSortInvalid badRequestError = badRequestError{"sort is invalid"}
+	// ErrNoteSearchQueryInvalid is an error for a search query without any searchable term
+	ErrNoteSearchQueryInvalid badRequestError = badRequestError{"search query is invalid"}
+	// ErrNoteEncryptedPublic is an error for an encrypted note being shared publicly
+	ErrNoteEncryptedPublic badRequestError = badRequestError{"encrypted note cannot be public"}
+
+	// ErrNoteRevisionNoteIDRequired is an error for missing note_id in note revision
+	ErrNoteRevisionNoteIDRequired badRequestError = badRequestError{"note revision note_id is required"}
+	// ErrNoteRevisionUserIDRequired is an error for missing user_id in note revision
+	ErrNoteRevisionUserIDRequired badRequestError = badRequestError{"note revision user_id is required"}
+
+	// ErrTagUserIDRequired is an error for missing user_id in tag
+	ErrTagUserIDRequired badRequestError = badRequestError{"tag user_id is required"}
+	// ErrTagNameInvalid is an error for a tag name that is empty or contains a comma or a whitespace
+	ErrTagNameInvalid badRequestError = badRequestError{"tag name is invalid"}
 
 	// ErrBookUUIDRequired is an error for missing session key
 	ErrBookUUIDRequired badRequestError = badRequestError{"book uuid is required"}
@@ -51,6 +77,72 @@ var (
 	ErrBookUSNRequired badRequestError = badRequestError{"book usn is required"}
 	// ErrBookNameTaken is an error for book name taken
 	ErrBookNameTaken conflictError = conflictError{"book name is taken"}
+	// ErrBookParentInvalid is an error for a parent book that does not exist or would create a cycle
+	ErrBookParentInvalid badRequestError = badRequestError{"book parent is invalid"}
+	// ErrBookNameRequired is an error for a missing name of a book created on the web
+	ErrBookNameRequired badRequestError = badRequestError{"book name is required"}
+
+	// ErrEncryptionSaltRequired is an error for missing salt in the encryption settings
+	ErrEncryptionSaltRequired badRequestError = badRequestError{"encryption salt is required"}
+	// ErrEncryptionKeyCheckRequired is an error for missing key_check in the encryption settings
+	ErrEncryptionKeyCheckRequired badRequestError = badRequestError{"encryption key_check is required"}
+	// ErrEncryptionConfigured is an error for setting up the encryption that is already set up
+	ErrEncryptionConfigured conflictError = conflictError{"encryption is already set up"}
+	// ErrEncryptedWebEdit is an error for editing an encrypted note or book on the web,
+	// which would store its content in plaintext
+	ErrEncryptedWebEdit badRequestError = badRequestError{"encrypted notes and books can only be edited in the CLI"}
+
+	// ErrTokenInvalid is an error for a token that does not exist, has been used, or has expired
+	ErrTokenInvalid badRequestError = badRequestError{"the link is invalid or has expired"}
+	// ErrTokenUserIDRequired is an error for missing user_id in token
+	ErrTokenUserIDRequired badRequestError = badRequestError{"token user_id is required"}
+	// ErrTokenTypeRequired is an error for missing type in token
+	ErrTokenTypeRequired badRequestError = badRequestError{"token type is required"}
+	// ErrTokenExpiresAtRequired is an error for missing expires_at in token
+	ErrTokenExpiresAtRequired badRequestError = badRequestError{"token expires_at is required"}
+	// ErrPasswordConfirmationMismatch is an error for a password confirmation that does not match the password
+	ErrPasswordConfirmationMismatch badRequestError = badRequestError{"password confirmation does not match"}
+	// ErrPasswordIncorrect is an error for a wrong current password given to change the account settings
+	ErrPasswordIncorrect badRequestError = badRequestError{"current password is incorrect"}
+	// ErrEmailUnchanged is an error for changing the email to the current email
+	ErrEmailUnchanged badRequestError = badRequestError{"the new email is the same as the current one"}
+
+	// ErrAccessTokenNameRequired is an error for missing name in access token
+	ErrAccessTokenNameRequired badRequestError = badRequestError{"token name is required"}
+	// ErrAccessTokenScopeRequired is an error for an access token without scopes
+	ErrAccessTokenScopeRequired badRequestError = badRequestError{"token needs at least one scope"}
+	// ErrAccessTokenScopeInvalid is an error for an unknown access token scope
+	ErrAccessTokenScopeInvalid badRequestError = badRequestError{"token scope is invalid. valid scopes are notes:read, notes:write, sync and admin"}
+	// ErrAccessTokenUserIDRequired is an error for missing user_id in access token
+	ErrAccessTokenUserIDRequired badRequestError = badRequestError{"token user_id is required"}
+	// ErrAccessTokenKeyRequired is an error for missing key in access token
+	ErrAccessTokenKeyRequired badRequestError = badRequestError{"token key is required"}
+	// ErrAccessTokenExpiryInvalid is an error for a negative access token expiry
+	ErrAccessTokenExpiryInvalid badRequestError = badRequestError{"token expiry must not be negative"}
+
+	// ErrEmailAlreadyVerified is an error for requesting verification of an email that is already verified
+	ErrEmailAlreadyVerified badRequestError = badRequestError{"email is already verified"}
+	// ErrVerificationTooFrequent is an error for requesting verification emails too frequently
+	ErrVerificationTooFrequent tooManyRequestsError = tooManyRequestsError{"please wait a minute before requesting another verification email"}
+
+	// ErrTwoFactorCodeInvalid is an error for a wrong, reused or malformed two-factor code
+	ErrTwoFactorCodeInvalid badRequestError = badRequestError{"two-factor code is invalid"}
+	// ErrTwoFactorEnabled is an error for setting up two-factor authentication that is already enabled
+	ErrTwoFactorEnabled conflictError = conflictError{"two-factor authentication is already enabled"}
+	// ErrTwoFactorNotEnabled is an error for an action that requires two-factor authentication to be enabled
+	ErrTwoFactorNotEnabled badRequestError = badRequestError{"two-factor authentication is not enabled"}
+	// ErrTwoFactorNotSetUp is an error for enabling two-factor authentication before generating a secret
+	ErrTwoFactorNotSetUp badRequestError = badRequestError{"two-factor authentication has not been set up"}
+	// ErrTwoFactorLoginInvalid is an error for a two-factor sign in that does not exist, has been completed, or has expired
+	ErrTwoFactorLoginInvalid badRequestError = badRequestError{"the sign in has expired. please sign in again"}
+	// ErrOIDCLoginInvalid is an error for a single sign-on that failed or has expired
+	ErrOIDCLoginInvalid badRequestError = badRequestError{"single sign-on failed. please try again"}
+	// ErrOIDCEmailUnverified is an error for an identity provider that did not provide a verified email
+	ErrOIDCEmailUnverified badRequestError = badRequestError{"the identity provider did not provide a verified email"}
+	// ErrOIDCCLIParamsInvalid is an error for a single sign-on started by the CLI with an invalid callback
+	ErrOIDCCLIParamsInvalid badRequestError = badRequestError{"cli_port or cli_state is invalid"}
+	// ErrRecoveryCodeUserIDRequired is an error for missing user_id in recovery code
+	ErrRecoveryCodeUserIDRequired badRequestError = badRequestError{"recovery code user_id is required"}
 )
 
 // Error returns a string repsentation of the error.
@@ -92,6 +184,15 @@ func (e notFoundError) IsNotFoundError() bool {
 	return true
 }
 
+type tooManyRequestsError struct {
+	modelError
+}
+
+// IsTooManyRequestsError indicates that the error should return http status code too many requests
+func (e tooManyRequestsError) IsTooManyRequestsError() bool {
+	return true
+}
+
 type privateError string
 
 // Error returns a string repsentation of the error.
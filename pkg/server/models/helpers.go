@@ -4,8 +4,29 @@ import (
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
 )
 
+// dialectSQLite is the name of the gorm dialect for SQLite
+const dialectSQLite = "sqlite3"
+
+// isSQLite checks if the given database is SQLite
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialect().GetName() == dialectSQLite
+}
+
+// setUUID generates a UUID for the column with the given name if it is blank.
+// UUIDs are generated here rather than by the database, because SQLite has no
+// function for it.
+func setUUID(scope *gorm.Scope, name string) error {
+	field, ok := scope.FieldByName(name)
+	if !ok || !field.IsBlank {
+		return nil
+	}
+
+	return field.Set(uuid.NewV4().String())
+}
+
 // First executes the given gorm.DB query and saves the first result
 // in the given destination.
 func First(db *gorm.DB, dst interface{}) error {
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// NoteRevision is a snapshot of a note taken before its content is overwritten
+type NoteRevision struct {
+	Model
+	UUID      string `json:"uuid" gorm:"index;type:uuid"`
+	NoteID    uint   `json:"note_id" gorm:"index"`
+	UserID    uint   `json:"user_id" gorm:"index"`
+	BookUUID  string `json:"book_uuid" gorm:"type:uuid"`
+	Body      string `json:"content"`
+	EditedOn  int64  `json:"edited_on"`
+	USN       int    `json:"usn"`
+	Encrypted bool   `json:"encrypted" gorm:"default:false"`
+}
+
+// BeforeCreate generates the UUID of the note revision
+func (n *NoteRevision) BeforeCreate(scope *gorm.Scope) error {
+	return setUUID(scope, "UUID")
+}
+
+// NoteRevisionDB is an interface for database operations related to note revisions.
+type NoteRevisionDB interface {
+	ByNoteID(noteID uint) ([]NoteRevision, error)
+
+	Create(*NoteRevision, *gorm.DB) error
+	DeleteByNoteID(noteID uint, tx *gorm.DB) error
+}
+
+// noteRevisionGorm encapsulates the actual implementations of
+// the database operations involving note revisions.
+type noteRevisionGorm struct {
+	db *gorm.DB
+}
+
+// NoteRevisionService is a set of methods for interacting with the note revision model
+type NoteRevisionService interface {
+	NoteRevisionDB
+}
+
+type noteRevisionService struct {
+	NoteRevisionDB
+}
+
+// NewNoteRevisionService returns a new noteRevisionService
+func NewNoteRevisionService(db *gorm.DB) NoteRevisionService {
+	nrg := &noteRevisionGorm{db}
+	nrv := newNoteRevisionValidator(nrg)
+
+	return &noteRevisionService{
+		NoteRevisionDB: nrv,
+	}
+}
+
+type noteRevisionValidator struct {
+	NoteRevisionDB
+}
+
+func newNoteRevisionValidator(nrdb NoteRevisionDB) *noteRevisionValidator {
+	return &noteRevisionValidator{
+		NoteRevisionDB: nrdb,
+	}
+}
+
+// NewNoteRevision returns a revision holding the current state of the given note
+func NewNoteRevision(note Note) NoteRevision {
+	return NoteRevision{
+		NoteID:    note.ID,
+		UserID:    note.UserID,
+		BookUUID:  note.BookUUID,
+		Body:      note.Body,
+		EditedOn:  note.EditedOn,
+		USN:       note.USN,
+		Encrypted: note.Encrypted,
+	}
+}
+
+// ByNoteID looks up the revisions of the note with the given id, the most recent first.
+func (nrg *noteRevisionGorm) ByNoteID(noteID uint) ([]NoteRevision, error) {
+	var ret []NoteRevision
+	err := Find(nrg.db.Where("note_id = ?", noteID).Order("id DESC"), &ret)
+
+	return ret, err
+}
+
+func (nrg *noteRevisionGorm) Create(nr *NoteRevision, tx *gorm.DB) error {
+	var conn *gorm.DB
+	if tx != nil {
+		conn = tx
+	} else {
+		conn = nrg.db
+	}
+
+	if err := conn.Create(nr).Error; err != nil {
+		return errors.Wrap(err, "inserting note revision")
+	}
+
+	return nil
+}
+
+// DeleteByNoteID deletes all revisions of the note with the given id.
+func (nrg *noteRevisionGorm) DeleteByNoteID(noteID uint, tx *gorm.DB) error {
+	var conn *gorm.DB
+	if tx != nil {
+		conn = tx
+	} else {
+		conn = nrg.db
+	}
+
+	if err := conn.Where("note_id = ?", noteID).Delete(NoteRevision{}).Error; err != nil {
+		return errors.Wrap(err, "deleting note revisions")
+	}
+
+	return nil
+}
+
+type noteRevisionValFunc func(*NoteRevision) error
+
+func runNoteRevisionValFuncs(nr *NoteRevision, fns ...noteRevisionValFunc) error {
+	for _, fn := range fns {
+		if err := fn(nr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create validates the parameters for creating a note revision.
+func (nrv *noteRevisionValidator) Create(nr *NoteRevision, tx *gorm.DB) error {
+	if err := runNoteRevisionValFuncs(nr,
+		nrv.requireNoteID,
+		nrv.requireUserID,
+	); err != nil {
+		return err
+	}
+
+	return nrv.NoteRevisionDB.Create(nr, tx)
+}
+
+// ByNoteID validates the parameters for looking up the revisions of a note.
+func (nrv *noteRevisionValidator) ByNoteID(noteID uint) ([]NoteRevision, error) {
+	nr := NoteRevision{
+		NoteID: noteID,
+	}
+	if err := runNoteRevisionValFuncs(&nr, nrv.requireNoteID); err != nil {
+		return nil, err
+	}
+
+	return nrv.NoteRevisionDB.ByNoteID(noteID)
+}
+
+func (nrv *noteRevisionValidator) requireNoteID(nr *NoteRevision) error {
+	if nr.NoteID == 0 {
+		return ErrNoteRevisionNoteIDRequired
+	}
+
+	return nil
+}
+
+func (nrv *noteRevisionValidator) requireUserID(nr *NoteRevision) error {
+	if nr.UserID == 0 {
+		return ErrNoteRevisionUserIDRequired
+	}
+
+	return nil
+}
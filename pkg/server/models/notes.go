@@ -1,14 +1,27 @@
 package models
 
 import (
+	"fmt"
+	"strings"
+	"unicode"
+
 	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 )
 
+const (
+	// HeadlineStartSel is the marker inserted before a matching term in the
+	// headline of a full-text search result
+	HeadlineStartSel = "<nadhl>"
+	// HeadlineStopSel is the marker inserted after a matching term in the
+	// headline of a full-text search result
+	HeadlineStopSel = "</nadhl>"
+)
+
 // Note is a model for a note
 type Note struct {
 	Model
-	UUID      string `json:"uuid" gorm:"index;type:uuid;default:uuid_generate_v4()"`
+	UUID      string `json:"uuid" gorm:"index;type:uuid"`
 	Book      Book   `json:"book" gorm:"foreignkey:BookUUID"`
 	User      User   `json:"user"`
 	UserID    uint   `json:"user_id" gorm:"index"`
@@ -21,11 +34,19 @@ type Note struct {
 	USN       int    `json:"-" gorm:"index"`
 	Deleted   bool   `json:"-" gorm:"default:false"`
 	Encrypted bool   `json:"-" gorm:"default:false"`
+	Tags      []Tag  `json:"tags" gorm:"many2many:note_tags;save_associations:false"`
+}
+
+// BeforeCreate generates the UUID of the note
+func (n *Note) BeforeCreate(scope *gorm.Scope) error {
+	return setUUID(scope, "UUID")
 }
 
 // NoteDB is an interface for database operations related to notes.
 type NoteDB interface {
 	Search(userID uint) ([]Note, error)
+	FullTextSearch(p NoteSearchParams) ([]NoteSearchResult, int, error)
+	List(p NoteListParams) ([]Note, error)
 	ByUUID(uuid string) (*Note, error)
 	ActiveByUUID(uuid string) (*Note, error)
 	ActiveByBookUUID(uuid string) ([]Note, error)
@@ -33,6 +54,7 @@ type NoteDB interface {
 
 	Create(*Note, *gorm.DB) error
 	Update(*Note, *gorm.DB) error
+	SetTags(*Note, []Tag, *gorm.DB) error
 }
 
 // noteGorm encapsulates the actual implementations of
@@ -73,15 +95,327 @@ func newNoteValidator(ndb NoteDB) *noteValidator {
 // Search looks up a note with the given key.
 func (ng *noteGorm) Search(userID uint) ([]Note, error) {
 	var ret []Note
-	err := Find(ng.db.Debug().Where("user_id = ?", userID), &ret)
+	err := Find(ng.db.Debug().Preload("Tags").Where("user_id = ?", userID), &ret)
+
+	return ret, err
+}
+
+// NoteSearchParams is a group of parameters for a full-text search of notes
+type NoteSearchParams struct {
+	UserID    uint
+	Query     string
+	BookUUIDs []string
+	Tags      []string
+	Offset    int
+	Limit     int
+}
+
+// NoteSearchResult is a note matching a full-text search, along with its rank
+// and the fragments of its body in which the matching terms are highlighted.
+type NoteSearchResult struct {
+	Note
+	Rank     float64
+	Headline string
+}
+
+var headlineOptions = strings.Join([]string{
+	"StartSel=" + HeadlineStartSel,
+	"StopSel=" + HeadlineStopSel,
+	"MaxFragments=3",
+	"MinWords=10",
+	"MaxWords=30",
+	"ShortWord=0",
+}, ", ")
+
+// tsQueryWords splits the given term into words that can be safely used in a
+// tsquery. Any character that is not a letter or a digit is treated as a separator.
+func tsQueryWords(term string) []string {
+	return strings.FieldsFunc(term, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tsQueryTerm converts a single search term into a tsquery expression. A term
+// that consists of several words is matched as a phrase, and a term ending
+// with '*' is matched by prefix.
+func tsQueryTerm(term string) string {
+	prefix := strings.HasSuffix(term, "*")
+
+	words := tsQueryWords(term)
+	if len(words) == 0 {
+		return ""
+	}
+	if prefix {
+		words[len(words)-1] = words[len(words)-1] + ":*"
+	}
+
+	return strings.Join(words, " <-> ")
+}
+
+// searchTerms splits a user-provided search query into terms. A double-quoted
+// term is kept as a single term.
+func searchTerms(q string) []string {
+	var terms []string
+
+	for i, part := range strings.Split(q, "\"") {
+		// Every odd part is enclosed by double quotes.
+		if i%2 == 1 {
+			terms = append(terms, part)
+			continue
+		}
+
+		terms = append(terms, strings.Fields(part)...)
+	}
+
+	return terms
+}
+
+// tsQuery converts a user-provided search query into a tsquery expression. Terms
+// are ANDed together, a double-quoted term is matched as a phrase, and a term
+// ending with '*' is matched by prefix. Characters that have a special meaning
+// in a tsquery are discarded so that no input can produce a syntax error.
+func tsQuery(q string) string {
+	var exprs []string
+	for _, term := range searchTerms(q) {
+		if expr := tsQueryTerm(term); expr != "" {
+			exprs = append(exprs, expr)
+		}
+	}
+
+	return strings.Join(exprs, " & ")
+}
+
+// ftsQueryTerm converts a single search term into an FTS5 phrase. A term ending
+// with '*' is matched by prefix.
+func ftsQueryTerm(term string) string {
+	words := tsQueryWords(term)
+	if len(words) == 0 {
+		return ""
+	}
+
+	expr := `"` + strings.Join(words, " ") + `"`
+	if strings.HasSuffix(term, "*") {
+		expr = expr + "*"
+	}
+
+	return expr
+}
+
+// ftsQuery converts a user-provided search query into an FTS5 query expression
+// for SQLite, following the same rules as tsQuery. Only letters and digits are
+// kept, and always inside double quotes, so that no input can produce a syntax error.
+func ftsQuery(q string) string {
+	var exprs []string
+	for _, term := range searchTerms(q) {
+		if expr := ftsQueryTerm(term); expr != "" {
+			exprs = append(exprs, expr)
+		}
+	}
+
+	return strings.Join(exprs, " AND ")
+}
+
+// tagCondition is a condition matching the notes that have the tag with the given name
+const tagCondition = `notes.id IN (SELECT note_tags.note_id FROM note_tags
+	INNER JOIN tags ON tags.id = note_tags.tag_id WHERE tags.name = ?)`
+
+// whereTags narrows down the query to the notes that have all of the given tags
+func whereTags(conn *gorm.DB, tags []string) *gorm.DB {
+	for _, tag := range tags {
+		conn = conn.Where(tagCondition, tag)
+	}
+
+	return conn
+}
+
+// loadTags loads the tags of the given notes
+func (ng *noteGorm) loadTags(notes []*Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+
+	ids := []uint{}
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+
+	var loaded []Note
+	if err := Find(ng.db.Preload("Tags").Select("id").Where("id IN (?)", ids), &loaded); err != nil {
+		return errors.Wrap(err, "finding tags")
+	}
+
+	tags := map[uint][]Tag{}
+	for _, note := range loaded {
+		tags[note.ID] = note.Tags
+	}
+	for _, note := range notes {
+		note.Tags = tags[note.ID]
+	}
+
+	return nil
+}
+
+// FullTextSearch looks up notes matching the given query using the full-text
+// search index. It returns a page of results ordered by rank, along with the
+// total number of matching notes.
+func (ng *noteGorm) FullTextSearch(p NoteSearchParams) ([]NoteSearchResult, int, error) {
+	var conn *gorm.DB
+	var selectQuery string
+	var selectArgs []interface{}
+
+	if isSQLite(ng.db) {
+		query := ftsQuery(p.Query)
+		if query == "" {
+			return nil, 0, nil
+		}
+
+		conn = ng.db.Table("notes").
+			Joins("INNER JOIN notes_fts ON notes_fts.rowid = notes.id").
+			Where("notes.user_id = ? AND NOT notes.deleted AND NOT notes.encrypted", p.UserID).
+			Where("notes_fts MATCH ?", query)
+
+		// bm25 is lower for a better match
+		selectQuery = `notes.*,
+			-bm25(notes_fts) AS rank,
+			snippet(notes_fts, 0, ?, ?, '...', 30) AS headline`
+		selectArgs = []interface{}{HeadlineStartSel, HeadlineStopSel}
+	} else {
+		query := tsQuery(p.Query)
+
+		conn = ng.db.Table("notes").
+			Where("notes.user_id = ? AND NOT notes.deleted AND NOT notes.encrypted", p.UserID).
+			Where("notes.tsv @@ to_tsquery('english_nostop', ?)", query)
+
+		selectQuery = `notes.*,
+			ts_rank(notes.tsv, to_tsquery('english_nostop', ?)) AS rank,
+			ts_headline('english_nostop', notes.body, to_tsquery('english_nostop', ?), ?) AS headline`
+		selectArgs = []interface{}{query, query, headlineOptions}
+	}
+
+	if len(p.BookUUIDs) > 0 {
+		conn = conn.Where("notes.book_uuid IN (?)", p.BookUUIDs)
+	}
+	conn = whereTags(conn, p.Tags)
+
+	var total int
+	if err := conn.Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "counting notes")
+	}
+
+	var ret []NoteSearchResult
+	err := conn.Select(selectQuery, selectArgs...).
+		Order("rank DESC, notes.id DESC").
+		Offset(p.Offset).
+		Limit(p.Limit).
+		Scan(&ret).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "searching notes")
+	}
+
+	notes := []*Note{}
+	for i := range ret {
+		notes = append(notes, &ret[i].Note)
+	}
+	if err := ng.loadTags(notes); err != nil {
+		return nil, 0, err
+	}
+
+	return ret, total, nil
+}
+
+const (
+	// NoteSortAddedOn sorts notes by the time they were added
+	NoteSortAddedOn = "added_on"
+	// NoteSortEditedOn sorts notes by the time they were last edited
+	NoteSortEditedOn = "edited_on"
+	// NoteSortUSN sorts notes by their update sequence number
+	NoteSortUSN = "usn"
+)
+
+// NoteCursor points to the position of a note in a sorted list of notes. It
+// holds the value of the sorted field and the id of the note, which breaks ties.
+type NoteCursor struct {
+	Value int64
+	ID    uint
+}
+
+// NoteListParams is a group of parameters for listing notes. A zero time bound
+// means that the range is unbounded on that side.
+type NoteListParams struct {
+	UserID       uint
+	BookUUIDs    []string
+	Tags         []string
+	AddedAfter   int64
+	AddedBefore  int64
+	EditedAfter  int64
+	EditedBefore int64
+	Public       *bool
+	SortBy       string
+	Descending   bool
+	Cursor       *NoteCursor
+	Limit        int
+}
+
+// List looks up notes with the given params, ordered by the given field. If
+// a cursor is given, only the notes positioned after the cursor are returned.
+func (ng *noteGorm) List(p NoteListParams) ([]Note, error) {
+	conn := ng.db.Preload("Tags").Where("user_id = ? AND NOT deleted", p.UserID)
+
+	if len(p.BookUUIDs) > 0 {
+		conn = conn.Where("book_uuid IN (?)", p.BookUUIDs)
+	}
+	conn = whereTags(conn, p.Tags)
+	if p.AddedAfter != 0 {
+		conn = conn.Where("added_on >= ?", p.AddedAfter)
+	}
+	if p.AddedBefore != 0 {
+		conn = conn.Where("added_on < ?", p.AddedBefore)
+	}
+	if p.EditedAfter != 0 {
+		conn = conn.Where("edited_on >= ?", p.EditedAfter)
+	}
+	if p.EditedBefore != 0 {
+		conn = conn.Where("edited_on < ?", p.EditedBefore)
+	}
+	if p.Public != nil {
+		conn = conn.Where("public = ?", *p.Public)
+	}
+
+	dir := "ASC"
+	op := ">"
+	if p.Descending {
+		dir = "DESC"
+		op = "<"
+	}
+
+	if p.Cursor != nil {
+		conn = conn.Where(fmt.Sprintf("(%s, id) %s (?, ?)", p.SortBy, op), p.Cursor.Value, p.Cursor.ID)
+	}
+
+	order := fmt.Sprintf("%s %s, id %s", p.SortBy, dir, dir)
+
+	var ret []Note
+	err := Find(conn.Order(order).Limit(p.Limit), &ret)
 
 	return ret, err
 }
 
+// SortValue returns the value of the given sort field of the note.
+func (n Note) SortValue(sortBy string) int64 {
+	switch sortBy {
+	case NoteSortEditedOn:
+		return n.EditedOn
+	case NoteSortUSN:
+		return int64(n.USN)
+	default:
+		return n.AddedOn
+	}
+}
+
 // ByUSNRange looks up a note with the given book_uuid.
 func (ng *noteGorm) ByUSNRange(userID uint, lb, ub, limit int) ([]Note, error) {
 	var ret []Note
-	err := Find(ng.db.Where("user_id = ? AND usn > ? AND usn <= ?", userID, lb, ub).Order("usn ASC").Limit(limit), &ret)
+	err := Find(ng.db.Preload("Tags").Where("user_id = ? AND usn > ? AND usn <= ?", userID, lb, ub).Order("usn ASC").Limit(limit), &ret)
 
 	return ret, err
 }
@@ -89,7 +423,7 @@ func (ng *noteGorm) ByUSNRange(userID uint, lb, ub, limit int) ([]Note, error) {
 // ActiveByBookUUID looks up a note with the given book_uuid.
 func (ng *noteGorm) ActiveByBookUUID(bookUUID string) ([]Note, error) {
 	var ret []Note
-	err := Find(ng.db.Debug().Where("book_uuid = ? AND NOT DELETED", bookUUID), &ret)
+	err := Find(ng.db.Debug().Preload("Tags").Where("book_uuid = ? AND NOT DELETED", bookUUID), &ret)
 
 	return ret, err
 }
@@ -97,7 +431,7 @@ func (ng *noteGorm) ActiveByBookUUID(bookUUID string) ([]Note, error) {
 // ByUUID looks up a note with the given uuid.
 func (ng *noteGorm) ByUUID(uuid string) (*Note, error) {
 	var ret Note
-	err := First(ng.db.Where("uuid = ?", uuid), &ret)
+	err := First(ng.db.Preload("Tags").Where("uuid = ?", uuid), &ret)
 
 	return &ret, err
 }
@@ -105,7 +439,7 @@ func (ng *noteGorm) ByUUID(uuid string) (*Note, error) {
 // ActiveByUUID looks up a note that has the given uuid and has not been deleted.
 func (ng *noteGorm) ActiveByUUID(uuid string) (*Note, error) {
 	var ret Note
-	err := First(ng.db.Where("uuid = ? AND deleted = ?", uuid, false), &ret)
+	err := First(ng.db.Preload("Tags").Where("uuid = ? AND deleted = ?", uuid, false), &ret)
 
 	return &ret, err
 }
@@ -140,6 +474,24 @@ func (ng *noteGorm) Create(n *Note, tx *gorm.DB) error {
 	return nil
 }
 
+// SetTags replaces the tags of the given note with the given tags.
+func (ng *noteGorm) SetTags(n *Note, tags []Tag, tx *gorm.DB) error {
+	var conn *gorm.DB
+	if tx != nil {
+		conn = tx
+	} else {
+		conn = ng.db
+	}
+
+	if err := conn.Model(n).Association("Tags").Replace(tags).Error; err != nil {
+		return errors.Wrap(err, "replacing note tags")
+	}
+
+	n.Tags = tags
+
+	return nil
+}
+
 type noteValFunc func(*Note) error
 
 func runNoteValFuncs(note *Note, fns ...noteValFunc) error {
@@ -158,6 +510,7 @@ func (nv *noteValidator) Create(s *Note, tx *gorm.DB) error {
 		nv.requireBookUUID,
 		nv.requireAddedOn,
 		nv.requireUSN,
+		nv.ensureEncryptedNotPublic,
 	); err != nil {
 		return err
 	}
@@ -172,6 +525,7 @@ func (nv *noteValidator) Update(s *Note, tx *gorm.DB) error {
 		nv.requireBookUUID,
 		nv.requireAddedOn,
 		nv.requireUSN,
+		nv.ensureEncryptedNotPublic,
 	); err != nil {
 		return err
 	}
@@ -191,6 +545,40 @@ func (nv *noteValidator) Search(userID uint) ([]Note, error) {
 	return nv.NoteDB.Search(userID)
 }
 
+// FullTextSearch validates the parameters for a full-text search.
+func (nv *noteValidator) FullTextSearch(p NoteSearchParams) ([]NoteSearchResult, int, error) {
+	s := Note{
+		UserID: p.UserID,
+	}
+	if err := runNoteValFuncs(&s, nv.requireUserID); err != nil {
+		return nil, 0, err
+	}
+
+	if tsQuery(p.Query) == "" {
+		return nil, 0, ErrNoteSearchQueryInvalid
+	}
+
+	return nv.NoteDB.FullTextSearch(p)
+}
+
+// List validates the parameters for listing notes.
+func (nv *noteValidator) List(p NoteListParams) ([]Note, error) {
+	s := Note{
+		UserID: p.UserID,
+	}
+	if err := runNoteValFuncs(&s, nv.requireUserID); err != nil {
+		return nil, err
+	}
+
+	switch p.SortBy {
+	case NoteSortAddedOn, NoteSortEditedOn, NoteSortUSN:
+	default:
+		return nil, ErrNoteSortInvalid
+	}
+
+	return nv.NoteDB.List(p)
+}
+
 // ByUUID validates the parameters for retreiving a sesison by key.
 func (nv *noteValidator) ByUUID(uuid string) (*Note, error) {
 	s := Note{
@@ -242,3 +630,13 @@ func (nv *noteValidator) requireUSN(s *Note) error {
 
 	return nil
 }
+
+// ensureEncryptedNotPublic makes sure that an encrypted note is not public,
+// because the server cannot render the content that it cannot read.
+func (nv *noteValidator) ensureEncryptedNotPublic(s *Note) error {
+	if s.Encrypted && s.Public {
+		return ErrNoteEncryptedPublic
+	}
+
+	return nil
+}
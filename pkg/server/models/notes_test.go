@@ -0,0 +1,108 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestTSQuery(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "",
+			expected: "",
+		},
+		{
+			input:    "postgres",
+			expected: "postgres",
+		},
+		{
+			input:    "postgres  index",
+			expected: "postgres & index",
+		},
+		{
+			input:    "post*",
+			expected: "post:*",
+		},
+		{
+			input:    `"full text search"`,
+			expected: "full <-> text <-> search",
+		},
+		{
+			input:    `"full text sea*" gin`,
+			expected: "full <-> text <-> sea:* & gin",
+		},
+		{
+			input:    "foo-bar",
+			expected: "foo <-> bar",
+		},
+		{
+			input:    "a & (b | !c) :*",
+			expected: "a & b & c",
+		},
+		{
+			input:    `unterminated "phrase query`,
+			expected: "unterminated & phrase <-> query",
+		},
+		{
+			input:    "' & |",
+			expected: "",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			assert.Equal(t, tsQuery(tc.input), tc.expected, "result mismatch")
+		})
+	}
+}
+
+func TestFTSQuery(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "",
+			expected: "",
+		},
+		{
+			input:    "sqlite",
+			expected: `"sqlite"`,
+		},
+		{
+			input:    "sqlite  index",
+			expected: `"sqlite" AND "index"`,
+		},
+		{
+			input:    "sql*",
+			expected: `"sql"*`,
+		},
+		{
+			input:    `"full text sea*" fts`,
+			expected: `"full text sea"* AND "fts"`,
+		},
+		{
+			input:    "foo-bar",
+			expected: `"foo bar"`,
+		},
+		{
+			input:    `a OR NOT b NEAR(c) ^d`,
+			expected: `"a" AND "OR" AND "NOT" AND "b" AND "NEAR c" AND "d"`,
+		},
+		{
+			input:    "' & |",
+			expected: "",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			assert.Equal(t, ftsQuery(tc.input), tc.expected, "result mismatch")
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/nadproject/nad/pkg/server/crypt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// RecoveryCodeCount is the number of recovery codes generated at a time
+	RecoveryCodeCount = 10
+
+	recoveryCodeSize = 8
+)
+
+// RecoveryCode is a single-use code that signs a user in with two-factor
+// authentication when the authenticator app is not available.
+type RecoveryCode struct {
+	Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"index"`
+	UsedAt   *time.Time
+}
+
+// normalizeRecoveryCode removes the formatting from the given code so that
+// codes typed with or without dashes match
+func normalizeRecoveryCode(code string) string {
+	r := strings.NewReplacer("-", "", " ", "")
+	return strings.ToLower(r.Replace(strings.TrimSpace(code)))
+}
+
+// hashRecoveryCode returns the digest of the given code to be stored in place of the code
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// formatRecoveryCode groups the given hex string into blocks of four
+// characters separated by dashes
+func formatRecoveryCode(s string) string {
+	var parts []string
+	for i := 0; i < len(s); i += 4 {
+		end := i + 4
+		if end > len(s) {
+			end = len(s)
+		}
+		parts = append(parts, s[i:end])
+	}
+
+	return strings.Join(parts, "-")
+}
+
+// RecoveryCodeDB is an interface for database operations related to recovery codes.
+type RecoveryCodeDB interface {
+	CountUnused(userID uint) (int, error)
+
+	Replace(userID uint, hashes []string) error
+	Use(userID uint, code string, now time.Time) error
+}
+
+// recoveryCodeGorm encapsulates the actual implementations of
+// the database operations involving recovery codes.
+type recoveryCodeGorm struct {
+	db *gorm.DB
+}
+
+// RecoveryCodeService is a set of methods for interacting with the recovery code model
+type RecoveryCodeService interface {
+	RecoveryCodeDB
+	// Generate replaces the recovery codes of the user with the given id with
+	// new ones, and returns them. The codes are not stored and cannot be
+	// retrieved again.
+	Generate(userID uint) ([]string, error)
+}
+
+type recoveryCodeService struct {
+	RecoveryCodeDB
+}
+
+// NewRecoveryCodeService returns a new recoveryCodeService
+func NewRecoveryCodeService(db *gorm.DB) RecoveryCodeService {
+	rg := &recoveryCodeGorm{db}
+	rv := newRecoveryCodeValidator(rg)
+
+	return &recoveryCodeService{
+		RecoveryCodeDB: rv,
+	}
+}
+
+func (rs *recoveryCodeService) Generate(userID uint) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+
+	for i := range codes {
+		b, err := crypt.RandomBytes(recoveryCodeSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "generating random bytes")
+		}
+
+		codes[i] = formatRecoveryCode(hex.EncodeToString(b))
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	if err := rs.Replace(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+type recoveryCodeValidator struct {
+	RecoveryCodeDB
+}
+
+func newRecoveryCodeValidator(rdb RecoveryCodeDB) *recoveryCodeValidator {
+	return &recoveryCodeValidator{
+		RecoveryCodeDB: rdb,
+	}
+}
+
+// Replace validates the params for Replace
+func (rv *recoveryCodeValidator) Replace(userID uint, hashes []string) error {
+	if userID == 0 {
+		return ErrRecoveryCodeUserIDRequired
+	}
+
+	return rv.RecoveryCodeDB.Replace(userID, hashes)
+}
+
+// Use refuses a code that is empty after normalization
+func (rv *recoveryCodeValidator) Use(userID uint, code string, now time.Time) error {
+	if normalizeRecoveryCode(code) == "" {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	return rv.RecoveryCodeDB.Use(userID, code, now)
+}
+
+// CountUnused returns the number of the recovery codes of the user with the
+// given id that have not been used.
+func (rg *recoveryCodeGorm) CountUnused(userID uint) (int, error) {
+	var count int
+	if err := rg.db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error; err != nil {
+		return 0, errors.Wrap(err, "counting recovery codes")
+	}
+
+	return count, nil
+}
+
+// Replace deletes the recovery codes of the user with the given id and
+// creates ones with the given hashes in a transaction.
+func (rg *recoveryCodeGorm) Replace(userID uint, hashes []string) error {
+	tx := rg.db.Begin()
+
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "deleting recovery codes")
+	}
+
+	for _, h := range hashes {
+		code := RecoveryCode{
+			UserID:   userID,
+			CodeHash: h,
+		}
+		if err := tx.Create(&code).Error; err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "inserting recovery code")
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
+}
+
+// Use marks the unused recovery code of the user with the given id as used.
+// The update is conditional so that the same code cannot be used twice
+// by concurrent requests.
+func (rg *recoveryCodeGorm) Use(userID uint, code string, now time.Time) error {
+	conn := rg.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		UpdateColumn("used_at", now)
+	if err := conn.Error; err != nil {
+		return errors.Wrap(err, "marking recovery code as used")
+	}
+	if conn.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestHashRecoveryCode(t *testing.T) {
+	testCases := []struct {
+		input string
+	}{
+		{input: "0a1b-2c3d-4e5f-6a7b"},
+		{input: "0a1b2c3d4e5f6a7b"},
+		{input: " 0A1B-2C3D-4E5F-6A7B "},
+		{input: "0a1b 2c3d 4e5f 6a7b"},
+	}
+
+	expected := hashRecoveryCode("0a1b-2c3d-4e5f-6a7b")
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			assert.Equal(t, hashRecoveryCode(tc.input), expected, "hash mismatch")
+		})
+	}
+}
+
+func TestFormatRecoveryCode(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "0a1b2c3d4e5f6a7b", expected: "0a1b-2c3d-4e5f-6a7b"},
+		{input: "0a1b2c", expected: "0a1b-2c"},
+		{input: "", expected: ""},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			assert.Equal(t, formatRecoveryCode(tc.input), tc.expected, "result mismatch")
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package models
 
 import (
+	"database/sql"
+
 	"github.com/jinzhu/gorm"
 
 	"github.com/nadproject/nad/pkg/server/migrations"
 	"github.com/pkg/errors"
 	// use postgres
 	_ "github.com/lib/pq"
+	// use sqlite
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
 // ServicesConfig configures the given service by mutating it.
@@ -16,7 +20,18 @@ type ServicesConfig func(*Services) error
 // a database connection and saves it into the given service.
 func WithGorm(dialect, connStr string) ServicesConfig {
 	return func(s *Services) error {
-		DB, err := gorm.Open(dialect, connStr)
+		// SQLite is opened with a driver that stores the times in UTC.
+		var source interface{} = connStr
+		if dialect == dialectSQLite {
+			conn, err := sql.Open(driverSQLiteUTC, connStr)
+			if err != nil {
+				return err
+			}
+
+			source = conn
+		}
+
+		DB, err := gorm.Open(dialect, source)
 		if err != nil {
 			return err
 		}
@@ -53,6 +68,24 @@ func WithNote() ServicesConfig {
 	}
 }
 
+// WithNoteRevision returns a service configuration procedure that configures
+// a note revision service.
+func WithNoteRevision() ServicesConfig {
+	return func(s *Services) error {
+		s.NoteRevision = NewNoteRevisionService(s.DB)
+		return nil
+	}
+}
+
+// WithTag returns a service configuration procedure that configures
+// a tag service.
+func WithTag() ServicesConfig {
+	return func(s *Services) error {
+		s.Tag = NewTagService(s.DB)
+		return nil
+	}
+}
+
 // WithBook returns a service configuration procedure that configures
 // a book service.
 func WithBook() ServicesConfig {
@@ -62,6 +95,33 @@ func WithBook() ServicesConfig {
 	}
 }
 
+// WithToken returns a service configuration procedure that configures
+// a token service.
+func WithToken() ServicesConfig {
+	return func(s *Services) error {
+		s.Token = NewTokenService(s.DB)
+		return nil
+	}
+}
+
+// WithAccessToken returns a service configuration procedure that configures
+// an access token service.
+func WithAccessToken() ServicesConfig {
+	return func(s *Services) error {
+		s.AccessToken = NewAccessTokenService(s.DB)
+		return nil
+	}
+}
+
+// WithRecoveryCode returns a service configuration procedure that configures
+// a two-factor recovery code service.
+func WithRecoveryCode() ServicesConfig {
+	return func(s *Services) error {
+		s.RecoveryCode = NewRecoveryCodeService(s.DB)
+		return nil
+	}
+}
+
 // NewServices instantiates a new Services by using the given slice of
 // service configuration procedures.
 func NewServices(cfgs ...ServicesConfig) (*Services, error) {
@@ -79,11 +139,16 @@ func NewServices(cfgs ...ServicesConfig) (*Services, error) {
 // Services encapsulates the services that are used to interact with the
 // database.
 type Services struct {
-	User    UserService
-	Session SessionService
-	Note    NoteService
-	Book    BookService
-	DB      *gorm.DB
+	User         UserService
+	Session      SessionService
+	Note         NoteService
+	NoteRevision NoteRevisionService
+	Tag          TagService
+	Book         BookService
+	Token        TokenService
+	AccessToken  AccessTokenService
+	RecoveryCode RecoveryCodeService
+	DB           *gorm.DB
 }
 
 // Close closes the database connection of the service.
@@ -94,11 +159,14 @@ func (s *Services) Close() error {
 // InitDB automatically migrates all tables using a set of model
 // definitions.
 func (s *Services) InitDB() error {
-	if err := s.DB.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`).Error; err != nil {
-		return errors.Wrap(err, "creating uuid extension")
+	// The extension is kept for the UUID column defaults of the existing databases
+	if !isSQLite(s.DB) {
+		if err := s.DB.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`).Error; err != nil {
+			return errors.Wrap(err, "creating uuid extension")
+		}
 	}
 
-	err := s.DB.AutoMigrate(&User{}, &Note{}, &Book{}, &Session{}).Error
+	err := s.DB.AutoMigrate(&User{}, &Note{}, &NoteRevision{}, &Tag{}, &Book{}, &Session{}, &Token{}, &AccessToken{}, &RecoveryCode{}).Error
 	if err != nil {
 		return errors.Wrap(err, "updating schema")
 	}
@@ -8,22 +8,38 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	// SessionTTL is how long a session stays valid after it was last used
+	SessionTTL = 24 * 100 * time.Hour
+	// sessionTouchInterval is the minimum interval between the updates of the
+	// last use of a session, so that every request does not write to the database
+	sessionTouchInterval = time.Minute
+)
+
 // Session represents a user session
 type Session struct {
 	Model
 	UserID     uint   `gorm:"index"`
 	Key        string `gorm:"index"`
+	UserAgent  string
+	IP         string
 	LastUsedAt time.Time
-	ExpiresAt  time.Time
+	ExpiresAt  time.Time `gorm:"index"`
 }
 
 // SessionDB is an interface for database operations
 // related to sessions.
 type SessionDB interface {
 	ByKey(key string) (*Session, error)
+	ByUserID(userID uint) ([]Session, error)
 
 	Create(*Session) error
 	Delete(key string) error
+	DeleteByID(userID, id uint) error
+	DeleteByUserID(userID uint) (int64, error)
+	DeleteOthers(userID uint, key string) (int64, error)
+	DeleteExpired(now time.Time) (int64, error)
+	Touch(s *Session, now time.Time) error
 }
 
 // sessionGorm encapsulates the actual implementations of
@@ -35,24 +51,31 @@ type sessionGorm struct {
 // SessionService is a set of methods for interacting with the session model
 type SessionService interface {
 	SessionDB
-	Login(userID uint) (*Session, error)
+	// Login creates a new session for the user with the given id, from the
+	// client with the given user agent and IP address.
+	Login(userID uint, userAgent, ip string) (*Session, error)
+	// Use extends the expiry of the given session, which is being used at the given time.
+	Use(s *Session, now time.Time) error
 }
 
 type sessionService struct {
 	SessionDB
 }
 
-func (ss sessionService) Login(userID uint) (*Session, error) {
+func (ss sessionService) Login(userID uint, userAgent, ip string) (*Session, error) {
 	key, err := crypt.GetRandomStr(32)
 	if err != nil {
 		return nil, errors.Wrap(err, "generating key")
 	}
 
+	now := time.Now()
 	session := Session{
 		UserID:     userID,
 		Key:        key,
-		LastUsedAt: time.Now(),
-		ExpiresAt:  time.Now().Add(24 * 100 * time.Hour),
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
 	}
 
 	if err := ss.SessionDB.Create(&session); err != nil {
@@ -62,6 +85,14 @@ func (ss sessionService) Login(userID uint) (*Session, error) {
 	return &session, nil
 }
 
+func (ss sessionService) Use(s *Session, now time.Time) error {
+	if now.Sub(s.LastUsedAt) < sessionTouchInterval {
+		return nil
+	}
+
+	return ss.Touch(s, now)
+}
+
 // NewSessionService returns a new sessionService
 func NewSessionService(db *gorm.DB) SessionService {
 	sg := &sessionGorm{db}
@@ -90,6 +121,16 @@ func (sg *sessionGorm) ByKey(key string) (*Session, error) {
 	return &ret, err
 }
 
+// ByUserID returns the sessions of the user with the given id, the most recently used first.
+func (sg *sessionGorm) ByUserID(userID uint) ([]Session, error) {
+	ret := []Session{}
+	if err := sg.db.Where("user_id = ?", userID).Order("last_used_at DESC").Find(&ret).Error; err != nil {
+		return nil, errors.Wrap(err, "finding sessions")
+	}
+
+	return ret, nil
+}
+
 func (sg *sessionGorm) Delete(key string) error {
 	if err := sg.db.Where("key = ?", key).Delete(&Session{}).Error; err != nil {
 		return err
@@ -98,6 +139,70 @@ func (sg *sessionGorm) Delete(key string) error {
 	return nil
 }
 
+// DeleteByUserID deletes all sessions of the user with the given id, and returns
+// the number of the deleted sessions.
+func (sg *sessionGorm) DeleteByUserID(userID uint) (int64, error) {
+	conn := sg.db.Where("user_id = ?", userID).Delete(&Session{})
+	if err := conn.Error; err != nil {
+		return 0, errors.Wrap(err, "deleting sessions")
+	}
+
+	return conn.RowsAffected, nil
+}
+
+// DeleteByID deletes the session with the given id owned by the user with the given id.
+func (sg *sessionGorm) DeleteByID(userID, id uint) error {
+	conn := sg.db.Where("id = ? AND user_id = ?", id, userID).Delete(&Session{})
+	if err := conn.Error; err != nil {
+		return errors.Wrap(err, "deleting session")
+	}
+	if conn.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteOthers deletes all sessions of the user with the given id except the one with
+// the given key, and returns the number of the deleted sessions.
+func (sg *sessionGorm) DeleteOthers(userID uint, key string) (int64, error) {
+	conn := sg.db.Where("user_id = ? AND key <> ?", userID, key).Delete(&Session{})
+	if err := conn.Error; err != nil {
+		return 0, errors.Wrap(err, "deleting sessions")
+	}
+
+	return conn.RowsAffected, nil
+}
+
+// DeleteExpired deletes the sessions that have been expired at the given time, and returns
+// the number of the deleted sessions.
+func (sg *sessionGorm) DeleteExpired(now time.Time) (int64, error) {
+	conn := sg.db.Where("expires_at <= ?", now).Delete(&Session{})
+	if err := conn.Error; err != nil {
+		return 0, errors.Wrap(err, "deleting expired sessions")
+	}
+
+	return conn.RowsAffected, nil
+}
+
+// Touch records that the given session was used at the given time and extends its expiry.
+func (sg *sessionGorm) Touch(s *Session, now time.Time) error {
+	expiresAt := now.Add(SessionTTL)
+
+	err := sg.db.Model(s).UpdateColumns(map[string]interface{}{
+		"last_used_at": now,
+		"expires_at":   expiresAt,
+	}).Error
+	if err != nil {
+		return errors.Wrap(err, "updating session")
+	}
+
+	s.LastUsedAt = now
+	s.ExpiresAt = expiresAt
+
+	return nil
+}
+
 func (sg *sessionGorm) Create(s *Session) error {
 	if err := sg.db.Save(s).Error; err != nil {
 		return errors.Wrap(err, "saving session")
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// driverSQLiteUTC is the name of the database/sql driver for SQLite that
+// stores times in UTC
+const driverSQLiteUTC = "sqlite3_utc"
+
+func init() {
+	sql.Register(driverSQLiteUTC, &utcDriver{})
+}
+
+// utcDriver is a SQLite driver that converts the times bound to statements to
+// UTC. SQLite stores times as text in the location of the given time, which is
+// only ordered correctly if all times are in the same location.
+type utcDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+// Open opens a connection to the database with the given DSN.
+func (d *utcDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := conn.(*sqlite3.SQLiteConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.Errorf("unexpected connection type %T", conn)
+	}
+
+	return &utcConn{c}, nil
+}
+
+// utcConn is a SQLite connection that converts the times bound to statements
+// to UTC.
+type utcConn struct {
+	*sqlite3.SQLiteConn
+}
+
+// CheckNamedValue converts the given argument to a driver value, with times in
+// UTC and rounded to the microsecond precision of the timestamps in PostgreSQL.
+func (c *utcConn) CheckNamedValue(nv *driver.NamedValue) error {
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+
+	if t, ok := v.(time.Time); ok {
+		v = t.UTC().Round(time.Microsecond)
+	}
+
+	nv.Value = v
+
+	return nil
+}
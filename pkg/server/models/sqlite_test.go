@@ -0,0 +1,55 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestUTCConnCheckNamedValue(t *testing.T) {
+	sydney := time.FixedZone("AEST", 10*60*60)
+	ts := time.Date(2019, time.October, 1, 9, 30, 0, 123456789, sydney)
+	expected := time.Date(2019, time.September, 30, 23, 30, 0, 123457000, time.UTC)
+
+	testCases := []struct {
+		input    interface{}
+		expected interface{}
+	}{
+		{
+			input:    ts,
+			expected: expected,
+		},
+		{
+			input:    &ts,
+			expected: expected,
+		},
+		{
+			input:    "foo",
+			expected: "foo",
+		},
+		{
+			input:    1,
+			expected: int64(1),
+		},
+		{
+			input:    nil,
+			expected: nil,
+		},
+	}
+
+	c := &utcConn{}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			nv := driver.NamedValue{Ordinal: 1, Value: tc.input}
+			if err := c.CheckNamedValue(&nv); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.DeepEqual(t, nv.Value, tc.expected, "value mismatch")
+		})
+	}
+}
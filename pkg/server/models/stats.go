@@ -0,0 +1,45 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Stats is a summary of the data in the database
+type Stats struct {
+	Users         int
+	ProUsers      int
+	Sessions      int
+	Books         int
+	Notes         int
+	NoteRevisions int
+	Tags          int
+}
+
+// GetStats counts the records in the database. Deleted books and notes are
+// excluded.
+func GetStats(db *gorm.DB) (Stats, error) {
+	var ret Stats
+
+	counts := []struct {
+		name  string
+		query *gorm.DB
+		dest  *int
+	}{
+		{"users", db.Model(&User{}), &ret.Users},
+		{"pro users", db.Model(&User{}).Where("pro"), &ret.ProUsers},
+		{"sessions", db.Model(&Session{}), &ret.Sessions},
+		{"books", db.Model(&Book{}).Where("NOT deleted"), &ret.Books},
+		{"notes", db.Model(&Note{}).Where("NOT deleted"), &ret.Notes},
+		{"note revisions", db.Model(&NoteRevision{}), &ret.NoteRevisions},
+		{"tags", db.Model(&Tag{}), &ret.Tags},
+	}
+
+	for _, c := range counts {
+		if err := c.query.Count(c.dest).Error; err != nil {
+			return ret, errors.Wrapf(err, "counting %s", c.name)
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Tag is a model for a tag. A tag belongs to a user and can be attached to
+// any number of the user's notes.
+type Tag struct {
+	Model
+	UUID   string `json:"uuid" gorm:"index;type:uuid"`
+	UserID uint   `json:"user_id" gorm:"unique_index:idx_tags_user_id_name"`
+	Name   string `json:"name" gorm:"unique_index:idx_tags_user_id_name"`
+}
+
+// BeforeCreate generates the UUID of the tag
+func (t *Tag) BeforeCreate(scope *gorm.Scope) error {
+	return setUUID(scope, "UUID")
+}
+
+// TagDB is an interface for database operations related to tags.
+type TagDB interface {
+	ByUserID(userID uint) ([]Tag, error)
+	FindOrCreate(userID uint, names []string, tx *gorm.DB) ([]Tag, error)
+}
+
+// tagGorm encapsulates the actual implementations of
+// the database operations involving tags.
+type tagGorm struct {
+	db *gorm.DB
+}
+
+// TagService is a set of methods for interacting with the tag model
+type TagService interface {
+	TagDB
+}
+
+type tagService struct {
+	TagDB
+}
+
+// NewTagService returns a new tagService
+func NewTagService(db *gorm.DB) TagService {
+	tg := &tagGorm{db}
+	tv := newTagValidator(tg)
+
+	return &tagService{
+		TagDB: tv,
+	}
+}
+
+type tagValidator struct {
+	TagDB
+}
+
+func newTagValidator(tdb TagDB) *tagValidator {
+	return &tagValidator{
+		TagDB: tdb,
+	}
+}
+
+// NormalizeTagNames trims the given tag names and removes the duplicates,
+// preserving the order. It returns ErrTagNameInvalid if any name is empty or
+// contains a comma or a whitespace.
+func NormalizeTagNames(names []string) ([]string, error) {
+	ret := []string{}
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsRune(name, ',') || strings.IndexFunc(name, unicode.IsSpace) != -1 {
+			return nil, ErrTagNameInvalid
+		}
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		ret = append(ret, name)
+	}
+
+	return ret, nil
+}
+
+// TagNames returns the names of the given tags
+func TagNames(tags []Tag) []string {
+	ret := []string{}
+	for _, tag := range tags {
+		ret = append(ret, tag.Name)
+	}
+
+	return ret
+}
+
+// ByUserID looks up the tags of the user with the given id, ordered by name.
+func (tg *tagGorm) ByUserID(userID uint) ([]Tag, error) {
+	var ret []Tag
+	err := Find(tg.db.Where("user_id = ?", userID).Order("name ASC"), &ret)
+
+	return ret, err
+}
+
+// FindOrCreate looks up the user's tags with the given names, creating the ones
+// that do not exist yet. The tags are returned in the order of the names.
+func (tg *tagGorm) FindOrCreate(userID uint, names []string, tx *gorm.DB) ([]Tag, error) {
+	var conn *gorm.DB
+	if tx != nil {
+		conn = tx
+	} else {
+		conn = tg.db
+	}
+
+	ret := []Tag{}
+	for _, name := range names {
+		var tag Tag
+		if err := conn.Where(Tag{UserID: userID, Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, errors.Wrapf(err, "finding or creating tag %s", name)
+		}
+
+		ret = append(ret, tag)
+	}
+
+	return ret, nil
+}
+
+type tagValFunc func(*Tag) error
+
+func runTagValFuncs(tag *Tag, fns ...tagValFunc) error {
+	for _, fn := range fns {
+		if err := fn(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ByUserID validates the parameters for looking up the tags of a user.
+func (tv *tagValidator) ByUserID(userID uint) ([]Tag, error) {
+	t := Tag{
+		UserID: userID,
+	}
+	if err := runTagValFuncs(&t, tv.requireUserID); err != nil {
+		return nil, err
+	}
+
+	return tv.TagDB.ByUserID(userID)
+}
+
+// FindOrCreate validates the parameters for finding or creating tags.
+func (tv *tagValidator) FindOrCreate(userID uint, names []string, tx *gorm.DB) ([]Tag, error) {
+	t := Tag{
+		UserID: userID,
+	}
+	if err := runTagValFuncs(&t, tv.requireUserID); err != nil {
+		return nil, err
+	}
+
+	normalized, err := NormalizeTagNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	return tv.TagDB.FindOrCreate(userID, normalized, tx)
+}
+
+func (tv *tagValidator) requireUserID(t *Tag) error {
+	if t.UserID == 0 {
+		return ErrTagUserIDRequired
+	}
+
+	return nil
+}
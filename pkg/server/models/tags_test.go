@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestNormalizeTagNames(t *testing.T) {
+	testCases := []struct {
+		input    []string
+		expected []string
+		err      error
+	}{
+		{
+			input:    []string{},
+			expected: []string{},
+		},
+		{
+			input:    []string{"go", "postgres"},
+			expected: []string{"go", "postgres"},
+		},
+		{
+			input:    []string{" go ", "postgres", "go"},
+			expected: []string{"go", "postgres"},
+		},
+		{
+			input: []string{"go", ""},
+			err:   ErrTagNameInvalid,
+		},
+		{
+			input: []string{"full text"},
+			err:   ErrTagNameInvalid,
+		},
+		{
+			input: []string{"go,postgres"},
+			err:   ErrTagNameInvalid,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result, err := NormalizeTagNames(tc.input)
+
+			assert.Equal(t, err, tc.err, "error mismatch")
+			assert.DeepEqual(t, result, tc.expected, "result mismatch")
+		})
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/nadproject/nad/pkg/server/config"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // SetupUser creates and returns a new user for testing purposes
@@ -21,12 +20,6 @@ func SetupUser(t *testing.T, us UserService, ss SessionService, email, password
 		Pro:      true,
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		t.Fatal(errors.Wrap(err, "hashing password"))
-	}
-	user.Password = string(hashedPassword)
-
 	if err := us.Create(&user); err != nil {
 		t.Fatal(errors.Wrap(err, "preparing user"))
 	}
@@ -63,9 +56,27 @@ func ClearTestData(t *testing.T, db *gorm.DB) {
 	if err := db.Delete(&Note{}).Error; err != nil {
 		t.Fatal(errors.Wrap(err, "Failed to clear notes"))
 	}
+	if err := db.Delete(&NoteRevision{}).Error; err != nil {
+		t.Fatal(errors.Wrap(err, "Failed to clear note revisions"))
+	}
+	if err := db.Exec("DELETE FROM note_tags").Error; err != nil {
+		t.Fatal(errors.Wrap(err, "Failed to clear note tags"))
+	}
+	if err := db.Delete(&Tag{}).Error; err != nil {
+		t.Fatal(errors.Wrap(err, "Failed to clear tags"))
+	}
 	if err := db.Delete(&User{}).Error; err != nil {
 		t.Fatal(errors.Wrap(err, "Failed to clear users"))
 	}
+	if err := db.Delete(&Token{}).Error; err != nil {
+		t.Fatal(errors.Wrap(err, "Failed to clear tokens"))
+	}
+	if err := db.Delete(&AccessToken{}).Error; err != nil {
+		t.Fatal(errors.Wrap(err, "Failed to clear access tokens"))
+	}
+	if err := db.Delete(&RecoveryCode{}).Error; err != nil {
+		t.Fatal(errors.Wrap(err, "Failed to clear recovery codes"))
+	}
 	if err := db.Delete(&Session{}).Error; err != nil {
 		t.Fatal(errors.Wrap(err, "Failed to clear sessions"))
 	}
@@ -84,11 +95,16 @@ var TestServices *Services
 // InitTestService initializes test service
 func InitTestService(cfg config.Config) error {
 	services, err := NewServices(
-		WithGorm("postgres", cfg.DB.GetConnectionStr()),
+		WithGorm(cfg.DB.Dialect, cfg.DB.GetConnectionStr()),
 		WithUser(),
 		WithNote(),
+		WithNoteRevision(),
+		WithTag(),
 		WithBook(),
 		WithSession(),
+		WithToken(),
+		WithAccessToken(),
+		WithRecoveryCode(),
 	)
 	if err != nil {
 		log.Println(err)
@@ -101,6 +117,12 @@ func InitTestService(cfg config.Config) error {
 		return err
 	}
 
+	err = services.MigrateDB()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
 	TestServices = services
 
 	return nil
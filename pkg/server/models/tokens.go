@@ -0,0 +1,268 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/nadproject/nad/pkg/server/crypt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// TokenTypeResetPassword is a type of a token for resetting a password
+	TokenTypeResetPassword = "reset_password"
+	// TokenTypeEmailVerification is a type of a token for verifying an email
+	TokenTypeEmailVerification = "email_verification"
+	// TokenTypeTwoFactorLogin is a type of a token for completing a sign in with a two-factor code
+	TokenTypeTwoFactorLogin = "two_factor_login"
+	// TokenTypeOIDCLogin is a type of a token handed to the CLI for completing a single sign-on
+	TokenTypeOIDCLogin = "oidc_login"
+)
+
+// Token is a single-use secret sent to a user to authorize an action,
+// such as resetting the password.
+type Token struct {
+	Model
+	UserID    uint   `gorm:"index"`
+	Type      string `gorm:"index"`
+	Value     string `gorm:"unique_index"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	// Attempts is the number of times a code has been entered for the token,
+	// such as a two-factor code for completing a sign in
+	Attempts int `gorm:"default:0"`
+}
+
+// TokenDB is an interface for database operations related to tokens.
+type TokenDB interface {
+	ByValue(value, kind string) (*Token, error)
+	LatestByUserID(userID uint, kind string) (*Token, error)
+
+	Create(t *Token) error
+	Use(t *Token, now time.Time, tx *gorm.DB) error
+	AddAttempt(t *Token, max int) error
+	DeleteUnused(userID uint, kind string, tx *gorm.DB) error
+}
+
+// tokenGorm encapsulates the actual implementations of
+// the database operations involving tokens.
+type tokenGorm struct {
+	db *gorm.DB
+}
+
+// TokenService is a set of methods for interacting with the token model
+type TokenService interface {
+	TokenDB
+	// Redeem marks the unused and unexpired token with the given value and type
+	// as used, and returns it.
+	Redeem(value, kind string, now time.Time, tx *gorm.DB) (*Token, error)
+}
+
+type tokenService struct {
+	TokenDB
+}
+
+// NewTokenService returns a new tokenService
+func NewTokenService(db *gorm.DB) TokenService {
+	tg := &tokenGorm{db}
+	tv := newTokenValidator(tg)
+
+	return &tokenService{
+		TokenDB: tv,
+	}
+}
+
+func (ts *tokenService) Redeem(value, kind string, now time.Time, tx *gorm.DB) (*Token, error) {
+	t, err := ts.ByValue(value, kind)
+	if err == ErrNotFound {
+		return nil, ErrTokenInvalid
+	} else if err != nil {
+		return nil, errors.Wrap(err, "finding token")
+	}
+
+	if t.UsedAt != nil || !now.Before(t.ExpiresAt) {
+		return nil, ErrTokenInvalid
+	}
+
+	if err := ts.Use(t, now, tx); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+type tokenValidator struct {
+	TokenDB
+}
+
+func newTokenValidator(tdb TokenDB) *tokenValidator {
+	return &tokenValidator{
+		TokenDB: tdb,
+	}
+}
+
+type tokenValFunc func(*Token) error
+
+func runTokenValFuncs(t *Token, fns ...tokenValFunc) error {
+	for _, fn := range fns {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ByValue validates the params for looking up a token.
+func (tv *tokenValidator) ByValue(value, kind string) (*Token, error) {
+	t := Token{
+		Value: value,
+		Type:  kind,
+	}
+	if err := runTokenValFuncs(&t, tv.requireValue, tv.requireType); err != nil {
+		return nil, err
+	}
+
+	return tv.TokenDB.ByValue(value, kind)
+}
+
+// Create generates the value of the given token and validates it for creation.
+func (tv *tokenValidator) Create(t *Token) error {
+	err := runTokenValFuncs(t,
+		tv.requireUserID,
+		tv.requireType,
+		tv.requireExpiresAt,
+		tv.generateValue)
+	if err != nil {
+		return err
+	}
+
+	return tv.TokenDB.Create(t)
+}
+
+func (tv *tokenValidator) requireUserID(t *Token) error {
+	if t.UserID == 0 {
+		return ErrTokenUserIDRequired
+	}
+
+	return nil
+}
+
+func (tv *tokenValidator) requireType(t *Token) error {
+	if t.Type == "" {
+		return ErrTokenTypeRequired
+	}
+
+	return nil
+}
+
+func (tv *tokenValidator) requireValue(t *Token) error {
+	if t.Value == "" {
+		return ErrTokenInvalid
+	}
+
+	return nil
+}
+
+func (tv *tokenValidator) requireExpiresAt(t *Token) error {
+	if t.ExpiresAt.IsZero() {
+		return ErrTokenExpiresAtRequired
+	}
+
+	return nil
+}
+
+func (tv *tokenValidator) generateValue(t *Token) error {
+	value, err := crypt.GetRandomStr(32)
+	if err != nil {
+		return errors.Wrap(err, "generating token value")
+	}
+
+	t.Value = value
+
+	return nil
+}
+
+// ByValue looks up a token with the given value and type.
+func (tg *tokenGorm) ByValue(value, kind string) (*Token, error) {
+	var ret Token
+	err := First(tg.db.Where("value = ? AND type = ?", value, kind), &ret)
+
+	return &ret, err
+}
+
+// LatestByUserID looks up the most recently created token of the given type
+// for the user with the given id.
+func (tg *tokenGorm) LatestByUserID(userID uint, kind string) (*Token, error) {
+	var ret Token
+	err := First(tg.db.Where("user_id = ? AND type = ?", userID, kind).Order("created_at DESC"), &ret)
+
+	return &ret, err
+}
+
+// Create creates the given token.
+func (tg *tokenGorm) Create(t *Token) error {
+	if err := tg.db.Create(t).Error; err != nil {
+		return errors.Wrap(err, "inserting token")
+	}
+
+	return nil
+}
+
+// Use marks the given token as used at the given time. It fails with ErrTokenInvalid
+// if the token has already been used, so that a token cannot be used twice even
+// by concurrent requests.
+func (tg *tokenGorm) Use(t *Token, now time.Time, tx *gorm.DB) error {
+	var conn *gorm.DB
+	if tx != nil {
+		conn = tx
+	} else {
+		conn = tg.db
+	}
+
+	res := conn.Model(&Token{}).Where("id = ? AND used_at IS NULL", t.ID).Update("used_at", now)
+	if err := res.Error; err != nil {
+		return errors.Wrap(err, "marking token used")
+	}
+	if res.RowsAffected == 0 {
+		return ErrTokenInvalid
+	}
+
+	t.UsedAt = &now
+
+	return nil
+}
+
+// AddAttempt counts an attempt for the given token. It fails with ErrTokenInvalid
+// if the token already has the given maximum number of attempts, so that the
+// limit holds even for concurrent requests.
+func (tg *tokenGorm) AddAttempt(t *Token, max int) error {
+	res := tg.db.Model(&Token{}).Where("id = ? AND attempts < ?", t.ID, max).UpdateColumn("attempts", gorm.Expr("attempts + ?", 1))
+	if err := res.Error; err != nil {
+		return errors.Wrap(err, "counting attempt")
+	}
+	if res.RowsAffected == 0 {
+		return ErrTokenInvalid
+	}
+
+	t.Attempts++
+
+	return nil
+}
+
+// DeleteUnused deletes the unused tokens of the given type for the user with the
+// given id, so that the links that have been sent can no longer be used.
+func (tg *tokenGorm) DeleteUnused(userID uint, kind string, tx *gorm.DB) error {
+	var conn *gorm.DB
+	if tx != nil {
+		conn = tx
+	} else {
+		conn = tg.db
+	}
+
+	if err := conn.Where("user_id = ? AND type = ? AND used_at IS NULL", userID, kind).Delete(&Token{}).Error; err != nil {
+		return errors.Wrap(err, "deleting tokens")
+	}
+
+	return nil
+}
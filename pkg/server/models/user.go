@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/nadproject/nad/pkg/server/metrics"
+	"github.com/nadproject/nad/pkg/server/totp"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -13,7 +15,7 @@ import (
 // User is a user model
 type User struct {
 	Model
-	UUID             string     `json:"uuid" gorm:"type:uuid;index;default:uuid_generate_v4()"`
+	UUID             string     `json:"uuid" gorm:"type:uuid;index"`
 	StripeCustomerID string     `json:"-"`
 	BillingCountry   string     `json:"-"`
 	LastLoginAt      *time.Time `json:"-"`
@@ -23,6 +25,24 @@ type User struct {
 	Password         string     `gorm:"-" json:"-"`
 	PasswordHash     string     `json:"-"`
 	EmailVerified    bool       `gorm:"default:false"`
+	// EncryptionSalt and EncryptionKeyCheck are set by the client that sets up
+	// the end-to-end encryption, so that other clients can derive the same key
+	// from the passphrase and verify it. The server cannot read either.
+	EncryptionSalt     string `json:"-"`
+	EncryptionKeyCheck string `json:"-"`
+	// TOTPSecret is the base32 secret shared with the authenticator app of the
+	// user. It is set when the user starts setting up two-factor authentication,
+	// and TOTPEnabled is set once the user proves possession with a valid code.
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"-" gorm:"default:false"`
+	// TOTPLastStep is the time step of the last accepted code. Codes of the
+	// same or earlier steps are refused so that a code cannot be replayed.
+	TOTPLastStep int64 `json:"-" gorm:"default:0"`
+}
+
+// BeforeCreate generates the UUID of the user
+func (u *User) BeforeCreate(scope *gorm.Scope) error {
+	return setUUID(scope, "UUID")
 }
 
 // UserDB is an interface for database operations
@@ -32,9 +52,13 @@ type UserDB interface {
 	ByUUID(uuid string) (*User, error)
 	ByEmail(email string) (*User, error)
 	BySession(token string) (*User, error)
+	List() ([]User, error)
 
 	Create(user *User) error
-	Update(user *User) error
+	Update(user *User, tx *gorm.DB) error
+	UpdateTOTP(user *User) error
+	UseTOTPStep(userID uint, step int64) error
+	Delete(user *User) error
 }
 
 // UserService is a set of methods for interacting with the user model
@@ -43,6 +67,12 @@ type UserService interface {
 	// matches a user.
 	Authenticate(email, password string) (*User, error)
 	IncrementUSN(tx *gorm.DB, userID uint) (int, error)
+	// VerifyTOTP verifies the given code against the TOTP secret of the given
+	// user, and refuses it if it has been used before.
+	VerifyTOTP(user *User, code string, now time.Time) error
+	// VerifyPassword verifies that the given password is the current password
+	// of the given user.
+	VerifyPassword(user *User, password string) error
 	UserDB
 }
 
@@ -60,6 +90,8 @@ type userService struct {
 	UserDB
 }
 
+var usnIncrements = metrics.NewCounterVec("nad_usn_increments_total", "Total number of increments of the max_usn of users.")
+
 // IncrementUSN increments the max_usn of the user with the given id max_usn by 1.
 // It returns the new, incremented max_usn.
 func (us *userService) IncrementUSN(tx *gorm.DB, userID uint) (int, error) {
@@ -72,9 +104,44 @@ func (us *userService) IncrementUSN(tx *gorm.DB, userID uint) (int, error) {
 		return 0, errors.Wrap(err, "getting the updated user max_usn")
 	}
 
+	usnIncrements.Inc()
+
 	return user.MaxUSN, nil
 }
 
+func (us *userService) VerifyTOTP(user *User, code string, now time.Time) error {
+	if user.TOTPSecret == "" {
+		return ErrTwoFactorNotSetUp
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, now)
+	if !ok || step <= user.TOTPLastStep {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	if err := us.UseTOTPStep(user.ID, step); err != nil {
+		return err
+	}
+	user.TOTPLastStep = step
+
+	return nil
+}
+
+func (us *userService) VerifyPassword(user *User, password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordIncorrect
+	} else if err != nil {
+		return errors.Wrap(err, "comparing password")
+	}
+
+	return nil
+}
+
 // Authenticate authenticates a user with the given email and password.
 func (us *userService) Authenticate(email, password string) (*User, error) {
 	foundUser, err := us.ByEmail(email)
@@ -161,9 +228,10 @@ func (uv *userValidator) Create(user *User) error {
 }
 
 // Update validates the given user for update.
-func (uv *userValidator) Update(user *User) error {
+func (uv *userValidator) Update(user *User, tx *gorm.DB) error {
 	err := runUserValFuncs(user,
 		uv.passwordMinLength,
+		uv.bcryptPassword,
 		uv.normalizeEmail,
 		uv.requireEmail,
 		uv.emailFormat,
@@ -172,7 +240,16 @@ func (uv *userValidator) Update(user *User) error {
 		return err
 	}
 
-	return uv.UserDB.Update(user)
+	return uv.UserDB.Update(user, tx)
+}
+
+// Delete validates the given user for deletion.
+func (uv *userValidator) Delete(user *User) error {
+	if err := runUserValFuncs(user, uv.idValid()); err != nil {
+		return err
+	}
+
+	return uv.UserDB.Delete(user)
 }
 
 func (uv *userValidator) normalizeEmail(user *User) error {
@@ -321,6 +398,84 @@ func (ug *userGorm) Create(user *User) error {
 }
 
 // Update will update the provided user with the provided data
-func (ug *userGorm) Update(user *User) error {
-	return ug.db.Save(&user).Error
+func (ug *userGorm) Update(user *User, tx *gorm.DB) error {
+	var conn *gorm.DB
+	if tx != nil {
+		conn = tx
+	} else {
+		conn = ug.db
+	}
+
+	return conn.Save(&user).Error
+}
+
+// UpdateTOTP updates the two-factor authentication settings of the given user.
+func (ug *userGorm) UpdateTOTP(user *User) error {
+	err := ug.db.Model(user).UpdateColumns(map[string]interface{}{
+		"totp_secret":    user.TOTPSecret,
+		"totp_enabled":   user.TOTPEnabled,
+		"totp_last_step": user.TOTPLastStep,
+	}).Error
+	if err != nil {
+		return errors.Wrap(err, "updating totp")
+	}
+
+	return nil
+}
+
+// UseTOTPStep records the given time step as the last one used by the user
+// with the given id. It fails if the same or a later step has already been used,
+// which guards against a concurrent replay of the same code.
+func (ug *userGorm) UseTOTPStep(userID uint, step int64) error {
+	conn := ug.db.Table("users").Where("id = ? AND totp_last_step < ?", userID, step).UpdateColumn("totp_last_step", step)
+	if err := conn.Error; err != nil {
+		return errors.Wrap(err, "updating totp_last_step")
+	}
+	if conn.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	return nil
+}
+
+// List returns all users, the oldest first.
+func (ug *userGorm) List() ([]User, error) {
+	var ret []User
+	err := Find(ug.db.Order("id ASC"), &ret)
+
+	return ret, err
+}
+
+// Delete deletes the provided user along with all the data the user owns.
+func (ug *userGorm) Delete(user *User) error {
+	tx := ug.db.Begin()
+
+	queries := []struct {
+		table string
+		query string
+	}{
+		{"note_tags", "DELETE FROM note_tags WHERE note_id IN (SELECT id FROM notes WHERE user_id = ?)"},
+		{"note_revisions", "DELETE FROM note_revisions WHERE user_id = ?"},
+		{"notes", "DELETE FROM notes WHERE user_id = ?"},
+		{"books", "DELETE FROM books WHERE user_id = ?"},
+		{"tags", "DELETE FROM tags WHERE user_id = ?"},
+		{"sessions", "DELETE FROM sessions WHERE user_id = ?"},
+		{"tokens", "DELETE FROM tokens WHERE user_id = ?"},
+		{"access_tokens", "DELETE FROM access_tokens WHERE user_id = ?"},
+		{"recovery_codes", "DELETE FROM recovery_codes WHERE user_id = ?"},
+		{"users", "DELETE FROM users WHERE id = ?"},
+	}
+
+	for _, q := range queries {
+		if err := tx.Exec(q.query, user.ID).Error; err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "deleting %s", q.table)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.Wrap(err, "committing a transaction")
+	}
+
+	return nil
 }
@@ -0,0 +1,534 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package oidc implements the authorization code flow of OpenID Connect with
+// PKCE, for signing in with an external identity provider.
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/crypt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// clockSkew is the tolerance for the time claims of an ID token
+	clockSkew = time.Minute
+	// keysRefetchInterval is the minimum time between fetches of the signing
+	// keys, so that ID tokens with unknown key ids cannot make the client
+	// fetch the keys on every request
+	keysRefetchInterval = time.Minute
+)
+
+var (
+	// ErrIDTokenInvalid is an error for an ID token that is malformed, is not
+	// signed by the provider, or is not meant for this client
+	ErrIDTokenInvalid = errors.New("id token is invalid")
+)
+
+// Config is the registration of the client with the identity provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// metadata is the subset of the provider metadata used by the client
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenEndpointAuth     []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Provider is a client of an OpenID provider. The provider metadata and the
+// signing keys are fetched when they are first needed.
+type Provider struct {
+	cfg Config
+	hc  *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys map[string]crypto.PublicKey
+	// keysFetchedAt is when the keys were last fetched, or failed to be
+	keysFetchedAt time.Time
+}
+
+// NewProvider returns a new Provider
+func NewProvider(cfg Config, hc *http.Client) *Provider {
+	if hc == nil {
+		hc = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{
+		cfg: cfg,
+		hc:  hc,
+	}
+}
+
+// Claims is the subset of the claims in an ID token used by the client
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+}
+
+// audience is the aud claim, which is either a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*a = audience(l)
+
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flexBool is a boolean claim that some providers encode as a string
+type flexBool bool
+
+func (f *flexBool) UnmarshalJSON(b []byte) error {
+	switch string(b) {
+	case "true", `"true"`:
+		*f = true
+	case "false", `"false"`, "null":
+		*f = false
+	default:
+		return errors.Errorf("invalid boolean %s", string(b))
+	}
+
+	return nil
+}
+
+// RandomString returns a random string suitable for the state and the nonce
+func RandomString() (string, error) {
+	b, err := crypt.RandomBytes(32)
+	if err != nil {
+		return "", errors.Wrap(err, "generating random bytes")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 PKCE code challenge of the given verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) getJSON(u string, dest interface{}) error {
+	res, err := p.hc.Get(u)
+	if err != nil {
+		return errors.Wrap(err, "making http request")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("%s responded with %d", u, res.StatusCode)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(dest); err != nil {
+		return errors.Wrap(err, "decoding response")
+	}
+
+	return nil
+}
+
+// discover returns the provider metadata
+func (p *Provider) discover() (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var m metadata
+	u := strings.TrimRight(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(u, &m); err != nil {
+		return nil, errors.Wrap(err, "fetching provider metadata")
+	}
+
+	if m.Issuer != p.cfg.Issuer {
+		return nil, errors.Errorf("provider issuer %s does not match the configured issuer %s", m.Issuer, p.cfg.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("provider metadata is incomplete")
+	}
+
+	p.meta = &m
+
+	return p.meta, nil
+}
+
+// AuthCodeURL returns the URL of the provider to which the user is sent to sign in
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	m, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing authorization endpoint")
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", "openid email profile")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// usesBasicAuth checks if the client should authenticate to the token endpoint
+// with HTTP basic authentication rather than the request body
+func (m *metadata) usesBasicAuth() bool {
+	if len(m.TokenEndpointAuth) == 0 {
+		return true
+	}
+
+	for _, method := range m.TokenEndpointAuth {
+		if method == "client_secret_basic" {
+			return true
+		}
+	}
+
+	return false
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange exchanges the given authorization code for an ID token
+func (p *Provider) Exchange(code, codeVerifier string) (string, error) {
+	m, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	basicAuth := p.cfg.ClientSecret != "" && m.usesBasicAuth()
+	if !basicAuth {
+		form.Set("client_id", p.cfg.ClientID)
+		if p.cfg.ClientSecret != "" {
+			form.Set("client_secret", p.cfg.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequest("POST", m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "constructing http request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basicAuth {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	res, err := p.hc.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "making http request")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "reading response")
+	}
+
+	var resp tokenResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", errors.Wrapf(err, "decoding token response with status %d", res.StatusCode)
+	}
+	if res.StatusCode != http.StatusOK || resp.Error != "" {
+		return "", errors.Errorf("token endpoint responded with %d: %s %s", res.StatusCode, resp.Error, resp.ErrorDescription)
+	}
+	if resp.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+
+	return resp.IDToken, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// publicKey returns the public key represented by the JWK, or nil if the key
+// type is not supported
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding modulus")
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding x")
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding y")
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// fetchKeys fetches the signing keys of the provider
+func (p *Provider) fetchKeys() error {
+	m, err := p.discover()
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(m.JWKSURI, &set); err != nil {
+		return errors.Wrap(err, "fetching keys")
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return errors.Wrapf(err, "parsing key %s", k.Kid)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	return nil
+}
+
+// getKey returns the signing key with the given id. It refetches the keys if
+// the key is not found, as the provider might have rotated them, unless they
+// have been fetched within keysRefetchInterval.
+func (p *Provider) getKey(kid string, now time.Time) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	if ok {
+		p.mu.Unlock()
+		return key, nil
+	}
+	if !p.keysFetchedAt.IsZero() && now.Before(p.keysFetchedAt.Add(keysRefetchInterval)) {
+		p.mu.Unlock()
+		return nil, errors.Wrapf(ErrIDTokenInvalid, "unknown key %s", kid)
+	}
+	p.keysFetchedAt = now
+	p.mu.Unlock()
+
+	if err := p.fetchKeys(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	key, ok = p.keys[kid]
+	p.mu.Unlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrIDTokenInvalid, "unknown key %s", kid)
+	}
+
+	return key, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, sig []byte) error {
+	sum := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.Wrap(ErrIDTokenInvalid, "key type does not match RS256")
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig); err != nil {
+			return errors.Wrap(ErrIDTokenInvalid, "signature mismatch")
+		}
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return errors.Wrap(ErrIDTokenInvalid, "key type does not match ES256")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, sum[:], r, s) {
+			return errors.Wrap(ErrIDTokenInvalid, "signature mismatch")
+		}
+	default:
+		return errors.Wrapf(ErrIDTokenInvalid, "unsupported algorithm %s", alg)
+	}
+
+	return nil
+}
+
+// Verify verifies the signature and the claims of the given ID token, and
+// returns the claims.
+func (p *Provider) Verify(rawIDToken, nonce string, now time.Time) (*Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "decoding header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "parsing header")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "decoding signature")
+	}
+
+	key, err := p.getKey(header.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "decoding payload")
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "parsing claims")
+	}
+
+	if claims.Issuer != p.cfg.Issuer {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "issuer mismatch")
+	}
+	if !claims.Audience.contains(p.cfg.ClientID) {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "audience mismatch")
+	}
+	if !now.Before(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "token has expired")
+	}
+	if claims.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "token is issued in the future")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.Wrap(ErrIDTokenInvalid, "subject is missing")
+	}
+
+	return &claims, nil
+}
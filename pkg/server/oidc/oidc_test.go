@@ -0,0 +1,251 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+func TestExchangeAndVerify(t *testing.T) {
+	mp := NewMockProvider(t)
+	defer mp.Server.Close()
+
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	p := NewProvider(mp.Config("http://localhost:3000/oidc/callback"), nil)
+
+	authURL, err := p.AuthCodeURL("state1", "nonce1", "verifier-verifier-verifier-verifier-verifier")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting auth code url"))
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "parsing url"))
+	}
+	q := u.Query()
+	assert.Equal(t, q.Get("state"), "state1", "state mismatch")
+	assert.Equal(t, q.Get("code_challenge_method"), "S256", "code_challenge_method mismatch")
+	assert.Equal(t, q.Get("redirect_uri"), "http://localhost:3000/oidc/callback", "redirect_uri mismatch")
+
+	claims := map[string]interface{}{
+		"sub":            "user1",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+	}
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		code := mp.Authorize(t, authURL, claims)
+
+		_, err := p.Exchange(code, "another-verifier-another-verifier-another")
+		assert.NotEqual(t, err, nil, "error mismatch")
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		code := mp.Authorize(t, authURL, claims)
+
+		idToken, err := p.Exchange(code, "verifier-verifier-verifier-verifier-verifier")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "exchanging code"))
+		}
+
+		result, err := p.Verify(idToken, "nonce1", now)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "verifying id token"))
+		}
+		assert.Equal(t, result.Subject, "user1", "subject mismatch")
+		assert.Equal(t, result.Email, "alice@example.com", "email mismatch")
+		assert.Equal(t, bool(result.EmailVerified), true, "email_verified mismatch")
+	})
+}
+
+func TestVerify(t *testing.T) {
+	mp := NewMockProvider(t)
+	defer mp.Server.Close()
+
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	p := NewProvider(mp.Config("http://localhost:3000/oidc/callback"), nil)
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   mp.Issuer(),
+			"aud":   mp.ClientID,
+			"sub":   "user1",
+			"nonce": "nonce1",
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+		}
+	}
+
+	otherProvider := NewMockProvider(t)
+	defer otherProvider.Server.Close()
+
+	testCases := []struct {
+		update   func(map[string]interface{})
+		token    func(claims map[string]interface{}) string
+		expected error
+	}{
+		{
+			update: func(c map[string]interface{}) {},
+		},
+		{
+			update: func(c map[string]interface{}) { c["aud"] = []string{"other", mp.ClientID} },
+		},
+		{
+			update: func(c map[string]interface{}) { c["email_verified"] = "true" },
+		},
+		{
+			update:   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+			expected: ErrIDTokenInvalid,
+		},
+		{
+			update:   func(c map[string]interface{}) { c["aud"] = "other" },
+			expected: ErrIDTokenInvalid,
+		},
+		{
+			update:   func(c map[string]interface{}) { c["nonce"] = "nonce2" },
+			expected: ErrIDTokenInvalid,
+		},
+		{
+			update:   func(c map[string]interface{}) { c["exp"] = now.Add(-2 * time.Minute).Unix() },
+			expected: ErrIDTokenInvalid,
+		},
+		{
+			update:   func(c map[string]interface{}) { c["iat"] = now.Add(time.Hour).Unix() },
+			expected: ErrIDTokenInvalid,
+		},
+		{
+			update:   func(c map[string]interface{}) { delete(c, "sub") },
+			expected: ErrIDTokenInvalid,
+		},
+		{
+			// signed by another key with the same key id
+			update: func(c map[string]interface{}) {},
+			token: func(c map[string]interface{}) string {
+				return otherProvider.SignIDToken(t, c)
+			},
+			expected: ErrIDTokenInvalid,
+		},
+		{
+			// unsigned
+			update: func(c map[string]interface{}) {},
+			token: func(c map[string]interface{}) string {
+				return "eyJhbGciOiJub25lIiwia2lkIjoidGVzdCJ9.e30."
+			},
+			expected: ErrIDTokenInvalid,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			claims := validClaims()
+			tc.update(claims)
+
+			var token string
+			if tc.token != nil {
+				token = tc.token(claims)
+			} else {
+				token = mp.SignIDToken(t, claims)
+			}
+
+			_, err := p.Verify(token, "nonce1", now)
+			assert.Equal(t, errors.Cause(err), tc.expected, "error mismatch")
+		})
+	}
+}
+
+func TestVerifyUnknownKey(t *testing.T) {
+	mp := NewMockProvider(t)
+	defer mp.Server.Close()
+
+	now := time.Date(2019, time.October, 1, 12, 0, 0, 0, time.UTC)
+	p := NewProvider(mp.Config("http://localhost:3000/oidc/callback"), nil)
+
+	claims := map[string]interface{}{
+		"iss":   mp.Issuer(),
+		"aud":   mp.ClientID,
+		"sub":   "user1",
+		"nonce": "nonce1",
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	// The signature is not checked because the key is not found
+	unknownKeyToken := "eyJhbGciOiJSUzI1NiIsImtpZCI6InVua25vd24ifQ.e30.c2ln"
+
+	countRequests := func() int {
+		mp.mu.Lock()
+		defer mp.mu.Unlock()
+
+		return mp.jwksRequests
+	}
+
+	if _, err := p.Verify(mp.SignIDToken(t, claims), "nonce1", now); err != nil {
+		t.Fatal(errors.Wrap(err, "verifying token"))
+	}
+	assert.Equal(t, countRequests(), 1, "request count mismatch")
+
+	testCases := []struct {
+		now              time.Time
+		expectedRequests int
+	}{
+		{
+			now:              now,
+			expectedRequests: 1,
+		},
+		{
+			now:              now.Add(30 * time.Second),
+			expectedRequests: 1,
+		},
+		{
+			now:              now.Add(keysRefetchInterval),
+			expectedRequests: 2,
+		},
+		{
+			now:              now.Add(keysRefetchInterval + 30*time.Second),
+			expectedRequests: 2,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			_, err := p.Verify(unknownKeyToken, "nonce1", tc.now)
+
+			assert.Equal(t, errors.Cause(err), ErrIDTokenInvalid, "error mismatch")
+			assert.Equal(t, countRequests(), tc.expectedRequests, "request count mismatch")
+		})
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	mp := NewMockProvider(t)
+	defer mp.Server.Close()
+
+	cfg := mp.Config("http://localhost:3000/oidc/callback")
+	cfg.Issuer = mp.Issuer() + "/"
+	p := NewProvider(cfg, nil)
+
+	_, err := p.AuthCodeURL("state", "nonce", "verifier")
+	assert.NotEqual(t, err, nil, "error mismatch")
+}
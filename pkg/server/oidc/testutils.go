@@ -0,0 +1,223 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// MockProvider is an OpenID provider for tests. It signs ID tokens with an
+// RSA key and issues them for the authorization codes created by Authorize.
+type MockProvider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockGrant
+	// jwksRequests is the number of requests for the signing keys
+	jwksRequests int
+}
+
+type mockGrant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+// NewMockProvider starts a new MockProvider. The caller needs to close the server.
+func NewMockProvider(t *testing.T) *MockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generating key"))
+	}
+
+	m := &MockProvider{
+		ClientID:     "nad",
+		ClientSecret: "secret",
+		key:          key,
+		codes:        map[string]mockGrant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.handleDiscovery)
+	mux.HandleFunc("/jwks", m.handleJWKS)
+	mux.HandleFunc("/token", m.handleToken)
+	m.Server = httptest.NewServer(mux)
+
+	return m
+}
+
+// Issuer returns the issuer identifier of the provider
+func (m *MockProvider) Issuer() string {
+	return m.Server.URL
+}
+
+// Config returns the client configuration for the provider
+func (m *MockProvider) Config(redirectURL string) Config {
+	return Config{
+		Issuer:       m.Issuer(),
+		ClientID:     m.ClientID,
+		ClientSecret: m.ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// Authorize simulates the user signing in at the given authorization URL and
+// returns the authorization code. The ID token will have the given claims in
+// addition to the standard ones.
+func (m *MockProvider) Authorize(t *testing.T, authURL string, claims map[string]interface{}) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "parsing authorization url"))
+	}
+	q := u.Query()
+
+	c := map[string]interface{}{
+		"iss":   m.Issuer(),
+		"aud":   q.Get("client_id"),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		c[k] = v
+	}
+
+	code, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: q.Get("code_challenge"), claims: c}
+	m.mu.Unlock()
+
+	return code
+}
+
+// SignIDToken returns an ID token with the given claims signed by the provider
+func (m *MockProvider) SignIDToken(t *testing.T, claims map[string]interface{}) string {
+	ret, err := m.sign(claims)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "signing id token"))
+	}
+
+	return ret
+}
+
+func (m *MockProvider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (m *MockProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                 m.Issuer(),
+		"authorization_endpoint": m.Issuer() + "/authorize",
+		"token_endpoint":         m.Issuer() + "/token",
+		"jwks_uri":               m.Issuer() + "/jwks",
+	})
+}
+
+func (m *MockProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.jwksRequests++
+	m.mu.Unlock()
+
+	pub := m.key.PublicKey
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	})
+}
+
+func (m *MockProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != m.ClientID || secret != m.ClientSecret {
+		tokenError("invalid_client")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		tokenError("invalid_request")
+		return
+	}
+
+	m.mu.Lock()
+	grant, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	if !ok || CodeChallenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	idToken, err := m.sign(grant.claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
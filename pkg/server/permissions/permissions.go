@@ -52,6 +52,11 @@ func DeleteNote(userID uint, note models.Note) bool {
 	return isNoteOwner(userID, note)
 }
 
+// ViewNoteRevisions checks if the given user can view the revisions of the given note
+func ViewNoteRevisions(userID uint, note models.Note) bool {
+	return isNoteOwner(userID, note)
+}
+
 // ViewBook checks if the given user can view the given book
 func ViewBook(userID uint, book models.Book) bool {
 	if book.Deleted {
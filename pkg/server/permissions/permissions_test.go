@@ -127,6 +127,36 @@ func TestUpdateNote(t *testing.T) {
 	})
 }
 
+func TestViewNoteRevisions(t *testing.T) {
+	user := models.User{Model: models.Model{ID: 1}}
+	anotherUser := models.User{Model: models.Model{ID: 2}}
+
+	book := models.Book{
+		UserID: user.ID,
+		Name:   "js",
+	}
+	publicNote := models.Note{
+		UserID:   user.ID,
+		BookUUID: book.UUID,
+		Public:   true,
+	}
+
+	t.Run("owner viewing revisions", func(t *testing.T) {
+		result := ViewNoteRevisions(user.ID, publicNote)
+		assert.Equal(t, result, true, "result mismatch")
+	})
+
+	t.Run("non-owner viewing revisions of public note", func(t *testing.T) {
+		result := ViewNoteRevisions(anotherUser.ID, publicNote)
+		assert.Equal(t, result, false, "result mismatch")
+	})
+
+	t.Run("guest viewing revisions of public note", func(t *testing.T) {
+		result := ViewNoteRevisions(0, publicNote)
+		assert.Equal(t, result, false, "result mismatch")
+	})
+}
+
 func TestDeleteNote(t *testing.T) {
 	user := models.User{Model: models.Model{ID: 1}}
 	anotherUser := models.User{Model: models.Model{ID: 2}}
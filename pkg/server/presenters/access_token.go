@@ -0,0 +1,68 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package presenters
+
+import (
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/models"
+)
+
+// AccessToken is a result of PresentAccessToken
+type AccessToken struct {
+	ID         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func formatOptionalTS(ts *time.Time) *time.Time {
+	if ts == nil {
+		return nil
+	}
+
+	ret := FormatTS(*ts)
+	return &ret
+}
+
+// PresentAccessToken presents an access token
+func PresentAccessToken(token models.AccessToken) AccessToken {
+	return AccessToken{
+		ID:         token.ID,
+		CreatedAt:  FormatTS(token.CreatedAt),
+		Name:       token.Name,
+		Scopes:     token.ScopeList(),
+		ExpiresAt:  formatOptionalTS(token.ExpiresAt),
+		LastUsedAt: formatOptionalTS(token.LastUsedAt),
+	}
+}
+
+// PresentAccessTokens presents access tokens
+func PresentAccessTokens(tokens []models.AccessToken) []AccessToken {
+	ret := []AccessToken{}
+
+	for _, token := range tokens {
+		p := PresentAccessToken(token)
+		ret = append(ret, p)
+	}
+
+	return ret
+}
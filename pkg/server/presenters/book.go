@@ -26,21 +26,25 @@ import (
 
 // Book is a result of PresentBooks
 type Book struct {
-	UUID      string    `json:"uuid"`
-	USN       int       `json:"usn"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Name      string    `json:"name"`
+	UUID       string    `json:"uuid"`
+	USN        int       `json:"usn"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Name       string    `json:"name"`
+	ParentUUID string    `json:"parent_uuid"`
+	Encrypted  bool      `json:"encrypted"`
 }
 
 // PresentBook presents a book
 func PresentBook(book models.Book) Book {
 	return Book{
-		UUID:      book.UUID,
-		USN:       book.USN,
-		CreatedAt: FormatTS(book.CreatedAt),
-		UpdatedAt: FormatTS(book.UpdatedAt),
-		Name:      book.Name,
+		UUID:       book.UUID,
+		USN:        book.USN,
+		CreatedAt:  FormatTS(book.CreatedAt),
+		UpdatedAt:  FormatTS(book.UpdatedAt),
+		Name:       book.Name,
+		ParentUUID: book.ParentUUID,
+		Encrypted:  book.Encrypted,
 	}
 }
 
@@ -31,8 +31,11 @@ type Note struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"content"`
 	AddedOn   int64     `json:"added_on"`
+	EditedOn  int64     `json:"edited_on"`
 	Public    bool      `json:"public"`
+	Encrypted bool      `json:"encrypted"`
 	USN       int       `json:"usn"`
+	Tags      []string  `json:"tags"`
 	Book      NoteBook  `json:"book"`
 	User      NoteUser  `json:"user"`
 }
@@ -57,10 +60,13 @@ func PresentNote(note models.Note) Note {
 		UpdatedAt: FormatTS(note.UpdatedAt),
 		Body:      note.Body,
 		AddedOn:   note.AddedOn,
+		EditedOn:  note.EditedOn,
 		Public:    note.Public,
+		Encrypted: note.Encrypted,
 		USN:       note.USN,
+		Tags:      models.TagNames(note.Tags),
 		Book: NoteBook{
-			UUID: note.Book.UUID,
+			UUID: note.BookUUID,
 			Name: note.Book.Name,
 		},
 		User: NoteUser{
@@ -82,3 +88,26 @@ func PresentNotes(notes []models.Note) []Note {
 
 	return ret
 }
+
+// NoteSearchResult is a result of PresentNoteSearchResults
+type NoteSearchResult struct {
+	Note
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+// PresentNoteSearchResults presents full-text search results
+func PresentNoteSearchResults(results []models.NoteSearchResult) []NoteSearchResult {
+	ret := []NoteSearchResult{}
+
+	for _, r := range results {
+		p := NoteSearchResult{
+			Note:     PresentNote(r.Note),
+			Rank:     r.Rank,
+			Headline: r.Headline,
+		}
+		ret = append(ret, p)
+	}
+
+	return ret
+}
@@ -0,0 +1,61 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package presenters
+
+import (
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/models"
+)
+
+// NoteRevision is a result of PresentNoteRevision
+type NoteRevision struct {
+	UUID      string    `json:"uuid"`
+	CreatedAt time.Time `json:"created_at"`
+	BookUUID  string    `json:"book_uuid"`
+	Body      string    `json:"content"`
+	EditedOn  int64     `json:"edited_on"`
+	USN       int       `json:"usn"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+// PresentNoteRevision presents a note revision
+func PresentNoteRevision(nr models.NoteRevision) NoteRevision {
+	return NoteRevision{
+		UUID:      nr.UUID,
+		CreatedAt: FormatTS(nr.CreatedAt),
+		BookUUID:  nr.BookUUID,
+		Body:      nr.Body,
+		EditedOn:  nr.EditedOn,
+		USN:       nr.USN,
+		Encrypted: nr.Encrypted,
+	}
+}
+
+// PresentNoteRevisions presents note revisions
+func PresentNoteRevisions(revisions []models.NoteRevision) []NoteRevision {
+	ret := []NoteRevision{}
+
+	for _, nr := range revisions {
+		p := PresentNoteRevision(nr)
+		ret = append(ret, p)
+	}
+
+	return ret
+}
@@ -0,0 +1,62 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package presenters
+
+import (
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/models"
+)
+
+// Session is a result of PresentSession
+type Session struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+}
+
+// PresentSession presents a session. currentKey is the key of the session
+// making the request.
+func PresentSession(session models.Session, currentKey string) Session {
+	return Session{
+		ID:         session.ID,
+		CreatedAt:  FormatTS(session.CreatedAt),
+		LastUsedAt: FormatTS(session.LastUsedAt),
+		ExpiresAt:  FormatTS(session.ExpiresAt),
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		Current:    session.Key == currentKey,
+	}
+}
+
+// PresentSessions presents sessions
+func PresentSessions(sessions []models.Session, currentKey string) []Session {
+	ret := []Session{}
+
+	for _, session := range sessions {
+		p := PresentSession(session, currentKey)
+		ret = append(ret, p)
+	}
+
+	return ret
+}
@@ -0,0 +1,88 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// bucket is the count of the requests for a key in the current window
+type bucket struct {
+	Key         string `gorm:"primary_key"`
+	WindowStart time.Time
+	Count       int
+	ResetAt     time.Time `gorm:"index"`
+}
+
+// TableName returns the name of the table for the buckets
+func (bucket) TableName() string {
+	return "rate_limits"
+}
+
+// PostgresStore keeps the counts in a Postgres table, so that the limits are
+// shared between multiple replicas of the server.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresStore returns a new PostgresStore. It creates the table for the
+// counts if it does not exist.
+func NewPostgresStore(db *gorm.DB) (*PostgresStore, error) {
+	if err := db.AutoMigrate(&bucket{}).Error; err != nil {
+		return nil, errors.Wrap(err, "creating rate limit table")
+	}
+
+	return &PostgresStore{db: db}, nil
+}
+
+// takeQuery increments the count for a key in a single statement, starting
+// a new count if the window has moved on.
+const takeQuery = `INSERT INTO rate_limits (key, window_start, count, reset_at)
+VALUES (?, ?, 1, ?)
+ON CONFLICT (key) DO UPDATE SET
+	count = CASE WHEN rate_limits.window_start = EXCLUDED.window_start THEN rate_limits.count + 1 ELSE 1 END,
+	window_start = EXCLUDED.window_start,
+	reset_at = EXCLUDED.reset_at
+RETURNING count`
+
+// Take counts a request for the key, and returns whether it is within the limit
+func (s *PostgresStore) Take(key string, limit int, window time.Duration, now time.Time) (Result, error) {
+	start := windowStart(now, window)
+	reset := start.Add(window)
+
+	var count int
+	if err := s.db.Raw(takeQuery, key, start, reset).Row().Scan(&count); err != nil {
+		return Result{}, errors.Wrap(err, "counting request")
+	}
+
+	return newResult(count, limit, reset), nil
+}
+
+// DeleteExpired deletes the counts for the windows that ended before now
+func (s *PostgresStore) DeleteExpired(now time.Time) (int64, error) {
+	db := s.db.Where("reset_at <= ?", now).Delete(&bucket{})
+	if err := db.Error; err != nil {
+		return 0, errors.Wrap(err, "deleting expired rate limits")
+	}
+
+	return db.RowsAffected, nil
+}
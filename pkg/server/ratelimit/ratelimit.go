@@ -0,0 +1,116 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package ratelimit counts the requests made in fixed windows of time, and
+// keeps the counts in a pluggable store.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Result is the result of taking a request from a rate limit
+type Result struct {
+	// Allowed is false if the request exceeds the limit
+	Allowed bool
+	Limit   int
+	// Remaining is the number of requests that can be made until Reset
+	Remaining int
+	Reset     time.Time
+}
+
+// Store counts the requests for each key in the current window
+type Store interface {
+	// Take counts a request for the key, and returns whether it is within the limit
+	Take(key string, limit int, window time.Duration, now time.Time) (Result, error)
+	// DeleteExpired deletes the counts for the windows that ended before now
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+// windowStart returns the start of the fixed window that the given time falls into
+func windowStart(now time.Time, window time.Duration) time.Time {
+	return now.Truncate(window)
+}
+
+func newResult(count, limit int, reset time.Time) Result {
+	remaining := limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return Result{
+		Allowed:   count <= limit,
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     reset,
+	}
+}
+
+type memoryEntry struct {
+	count int
+	start time.Time
+	reset time.Time
+}
+
+// MemoryStore keeps the counts in the memory of the process. The limits are not
+// shared between multiple replicas of the server.
+type MemoryStore struct {
+	mtx     sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+// NewMemoryStore returns a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]*memoryEntry{},
+	}
+}
+
+// Take counts a request for the key, and returns whether it is within the limit
+func (s *MemoryStore) Take(key string, limit int, window time.Duration, now time.Time) (Result, error) {
+	start := windowStart(now, window)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !e.start.Equal(start) {
+		e = &memoryEntry{start: start, reset: start.Add(window)}
+		s.entries[key] = e
+	}
+	e.count++
+
+	return newResult(e.count, limit, e.reset), nil
+}
+
+// DeleteExpired deletes the counts for the windows that ended before now
+func (s *MemoryStore) DeleteExpired(now time.Time) (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var n int64
+	for key, e := range s.entries {
+		if !e.reset.After(now) {
+			delete(s.entries, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
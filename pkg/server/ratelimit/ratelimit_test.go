@@ -0,0 +1,85 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Date(2019, 10, 1, 12, 0, 10, 0, time.UTC)
+	reset := time.Date(2019, 10, 1, 12, 1, 0, 0, time.UTC)
+
+	testCases := []struct {
+		key               string
+		now               time.Time
+		expectedAllowed   bool
+		expectedRemaining int
+		expectedReset     time.Time
+	}{
+		{key: "a", now: now, expectedAllowed: true, expectedRemaining: 1, expectedReset: reset},
+		{key: "a", now: now.Add(time.Second), expectedAllowed: true, expectedRemaining: 0, expectedReset: reset},
+		{key: "a", now: now.Add(2 * time.Second), expectedAllowed: false, expectedRemaining: 0, expectedReset: reset},
+		// other keys are counted separately
+		{key: "b", now: now.Add(3 * time.Second), expectedAllowed: true, expectedRemaining: 1, expectedReset: reset},
+		// the count starts over in the next window
+		{key: "a", now: reset, expectedAllowed: true, expectedRemaining: 1, expectedReset: reset.Add(time.Minute)},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			res, err := s.Take(tc.key, 2, time.Minute, tc.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, res.Allowed, tc.expectedAllowed, "allowed mismatch")
+			assert.Equal(t, res.Limit, 2, "limit mismatch")
+			assert.Equal(t, res.Remaining, tc.expectedRemaining, "remaining mismatch")
+			assert.Equal(t, res.Reset, tc.expectedReset, "reset mismatch")
+		})
+	}
+}
+
+func TestMemoryStoreDeleteExpired(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Date(2019, 10, 1, 12, 0, 10, 0, time.UTC)
+
+	if _, err := s.Take("a", 10, time.Minute, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Take("b", 10, time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.DeleteExpired(now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, n, int64(1), "deleted count mismatch")
+	assert.Equal(t, len(s.entries), 1, "entries count mismatch")
+	_, ok := s.entries["b"]
+	assert.Equal(t, ok, true, "entry b should remain")
+}
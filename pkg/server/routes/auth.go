@@ -25,10 +25,15 @@ func AuthWithSession(r *http.Request, ss models.SessionService, us models.UserSe
 	}
 
 	// check if the session has been expired.
-	if session.ExpiresAt.Before(time.Now()) {
+	now := time.Now()
+	if session.ExpiresAt.Before(now) {
 		return nil, nil
 	}
 
+	if err := ss.Use(session, now); err != nil {
+		return nil, errors.Wrap(err, "extending the session")
+	}
+
 	user, err := us.ByID(session.UserID)
 	if err != nil {
 		return nil, err
@@ -36,3 +41,32 @@ func AuthWithSession(r *http.Request, ss models.SessionService, us models.UserSe
 
 	return user, nil
 }
+
+// AuthWithAccessToken performs user authentication with the given access token key.
+// It records the use of the token, at most once a minute.
+func AuthWithAccessToken(key string, ats models.AccessTokenService, us models.UserService) (*models.User, *models.AccessToken, error) {
+	token, err := ats.ByKey(key)
+	if err == models.ErrNotFound {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if token.IsExpired(now) {
+		return nil, nil, nil
+	}
+
+	user, err := us.ByID(token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute {
+		if err := ats.Touch(token, now); err != nil {
+			return nil, nil, errors.Wrap(err, "recording the use of the access token")
+		}
+	}
+
+	return user, token, nil
+}
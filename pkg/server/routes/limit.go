@@ -19,102 +19,125 @@
 package routes
 
 import (
+	"fmt"
+	"net"
 	"net/http"
-	"strings"
-	"sync"
+	"strconv"
 	"time"
 
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/controllers"
 	"github.com/nadproject/nad/pkg/server/log"
-	"golang.org/x/time/rate"
+	"github.com/nadproject/nad/pkg/server/ratelimit"
 )
 
-type visitor struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
-}
-
-var visitors = make(map[string]*visitor)
-var mtx sync.RWMutex
-
-func init() {
-	go cleanupVisitors()
-}
+// limitGroup is a group of routes that share a rate limit policy
+type limitGroup int
 
-// addVisitor adds a new visitor to the map and returns a limiter for the visitor
-func addVisitor(identifier string) *rate.Limiter {
-	// initialize a token bucket
-	limiter := rate.NewLimiter(rate.Every(1*time.Second), 60)
+const (
+	// limitNone is for the routes that are not rate limited
+	limitNone limitGroup = iota
+	limitDefault
+	limitLogin
+	limitSync
+	limitWrite
+)
 
-	mtx.Lock()
-	visitors[identifier] = &visitor{
-		limiter:  limiter,
-		lastSeen: time.Now()}
-	mtx.Unlock()
+func (g limitGroup) String() string {
+	switch g {
+	case limitDefault:
+		return "default"
+	case limitLogin:
+		return "login"
+	case limitSync:
+		return "sync"
+	case limitWrite:
+		return "write"
+	}
 
-	return limiter
+	return "none"
 }
 
-// getVisitor returns a limiter for a visitor with the given identifier. It
-// adds the visitor to the map if not seen before.
-func getVisitor(identifier string) *rate.Limiter {
-	mtx.RLock()
-	v, exists := visitors[identifier]
+// limiter rate limits the requests by the policy of the group of the route
+type limiter struct {
+	store    ratelimit.Store
+	policies map[limitGroup]config.RateLimitPolicy
+	clock    clock.Clock
+}
 
-	if !exists {
-		mtx.RUnlock()
-		return addVisitor(identifier)
+func newLimiter(c config.RateLimitConfig, store ratelimit.Store, cl clock.Clock) *limiter {
+	return &limiter{
+		store: store,
+		policies: map[limitGroup]config.RateLimitPolicy{
+			limitDefault: c.Default,
+			limitLogin:   c.Login,
+			limitSync:    c.Sync,
+			limitWrite:   c.Write,
+		},
+		clock: cl,
 	}
+}
 
-	v.lastSeen = time.Now()
-	mtx.RUnlock()
+// key returns the key to count the request by. Requests are counted per user
+// if authenticated, and per IP otherwise. Login requests are always counted
+// per IP so that a session cannot be used to get around the limit.
+func (l *limiter) key(r *http.Request, g limitGroup) string {
+	user := context.User(r.Context())
+	if user == nil || g == limitLogin {
+		return fmt.Sprintf("%s:ip:%s", g, controllers.LookupIP(r))
+	}
 
-	return v.limiter
+	return fmt.Sprintf("%s:user:%d", g, user.ID)
 }
 
-// cleanupVisitors deletes visitors that has not been seen in a while from the
-// map of visitors
-func cleanupVisitors() {
-	for {
-		time.Sleep(time.Minute)
-		mtx.Lock()
-
-		for identifier, v := range visitors {
-			if time.Now().Sub(v.lastSeen) > 3*time.Minute {
-				delete(visitors, identifier)
-			}
-		}
-
-		mtx.Unlock()
+// setRateLimitHeaders sets the RateLimit header fields and, if the request is
+// not allowed, Retry-After.
+func setRateLimitHeaders(w http.ResponseWriter, p config.RateLimitPolicy, res ratelimit.Result, now time.Time) {
+	reset := int(res.Reset.Sub(now).Seconds() + 0.5)
+	if reset < 1 {
+		reset = 1
 	}
-}
 
-// lookupIP returns the request's IP
-func lookupIP(r *http.Request) string {
-	realIP := r.Header.Get("X-Real-IP")
-	forwardedFor := r.Header.Get("X-Forwarded-For")
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Limit, int(p.Window.Seconds())))
 
-	if forwardedFor != "" {
-		parts := strings.Split(forwardedFor, ",")
-		return parts[0]
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(reset))
 	}
+}
 
-	if realIP != "" {
-		return realIP
+// limitMw is a middleware to rate limit the handler by the policy of the given group
+func (l *limiter) limitMw(next http.Handler, g limitGroup) http.Handler {
+	p := l.policies[g]
+	if g == limitNone || p.Limit == 0 {
+		return next
 	}
 
-	return r.RemoteAddr
-}
-
-// limitMw is a middleware to rate limit the handler
-func limitMw(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		identifier := lookupIP(r)
-		limiter := getVisitor(identifier)
+		now := l.clock.Now()
+		key := l.key(r, g)
+
+		res, err := l.store.Take(key, p.Limit, p.Window, now)
+		if err != nil {
+			// Let the request through so that the server keeps working if the store is unavailable
+			log.ErrorWrap(err, "taking rate limit")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		setRateLimitHeaders(w, p, res, now)
 
-		if !limiter.Allow() {
+		if !res.Allowed {
 			http.Error(w, "Too many requests", http.StatusTooManyRequests)
 			log.WithFields(log.Fields{
-				"ip": identifier,
+				"ip":     controllers.LookupIP(r),
+				"key":    key,
+				"policy": g.String(),
 			}).Warn("Too many requests")
 			return
 		}
@@ -122,3 +145,13 @@ func limitMw(next http.Handler) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// realIPMw resolves the IP address of the client from the trusted proxies
+func realIPMw(next http.Handler, trustedProxies []*net.IPNet) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := controllers.ResolveIP(r, trustedProxies)
+		ctx := context.WithClientIP(r.Context(), ip)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
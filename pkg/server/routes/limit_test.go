@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/clock"
+	"github.com/nadproject/nad/pkg/server/config"
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/ratelimit"
+)
+
+func TestLimitMw(t *testing.T) {
+	c := config.RateLimitConfig{
+		Default: config.RateLimitPolicy{Limit: 2, Window: time.Minute},
+		Login:   config.RateLimitPolicy{Limit: 1, Window: time.Minute},
+	}
+	cl := clock.NewMock()
+	cl.SetNow(time.Date(2019, 10, 1, 12, 0, 15, 0, time.UTC))
+	l := newLimiter(c, ratelimit.NewMemoryStore(), cl)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	alice := &models.User{Model: models.Model{ID: 1}}
+	bob := &models.User{Model: models.Model{ID: 2}}
+
+	testCases := []struct {
+		group             limitGroup
+		ip                string
+		user              *models.User
+		expectedCode      int
+		expectedRemaining string
+	}{
+		{group: limitDefault, ip: "192.0.2.1", expectedCode: http.StatusOK, expectedRemaining: "1"},
+		{group: limitDefault, ip: "192.0.2.1", expectedCode: http.StatusOK, expectedRemaining: "0"},
+		{group: limitDefault, ip: "192.0.2.1", expectedCode: http.StatusTooManyRequests, expectedRemaining: "0"},
+		// other IP addresses and users are limited separately
+		{group: limitDefault, ip: "192.0.2.2", expectedCode: http.StatusOK, expectedRemaining: "1"},
+		{group: limitDefault, ip: "192.0.2.1", user: alice, expectedCode: http.StatusOK, expectedRemaining: "1"},
+		{group: limitDefault, ip: "192.0.2.1", user: bob, expectedCode: http.StatusOK, expectedRemaining: "1"},
+		// groups are limited separately, and login is limited by IP address
+		{group: limitLogin, ip: "192.0.2.1", user: alice, expectedCode: http.StatusOK, expectedRemaining: "0"},
+		{group: limitLogin, ip: "192.0.2.1", user: bob, expectedCode: http.StatusTooManyRequests, expectedRemaining: "0"},
+		// groups without a policy are not limited
+		{group: limitSync, ip: "192.0.2.1", expectedCode: http.StatusOK, expectedRemaining: ""},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			ctx := context.WithClientIP(req.Context(), tc.ip)
+			if tc.user != nil {
+				ctx = context.WithUser(ctx, tc.user)
+			}
+
+			w := httptest.NewRecorder()
+			l.limitMw(ok, tc.group).ServeHTTP(w, req.WithContext(ctx))
+
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+			assert.Equal(t, w.Header().Get("RateLimit-Remaining"), tc.expectedRemaining, "remaining mismatch")
+
+			if tc.expectedRemaining != "" {
+				assert.Equal(t, w.Header().Get("RateLimit-Reset"), "45", "reset mismatch")
+			}
+			if tc.expectedCode == http.StatusTooManyRequests {
+				assert.Equal(t, w.Header().Get("Retry-After"), "45", "retry-after mismatch")
+			} else {
+				assert.Equal(t, w.Header().Get("Retry-After"), "", "retry-after mismatch")
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/nadproject/nad/pkg/server/controllers"
 	"github.com/nadproject/nad/pkg/server/log"
 )
 
@@ -29,7 +30,7 @@ func loggingMw(inner http.Handler) http.HandlerFunc {
 		inner.ServeHTTP(&lw, r)
 
 		log.WithFields(log.Fields{
-			"remoteAddr": lookupIP(r),
+			"remoteAddr": controllers.LookupIP(r),
 			"uri":        r.RequestURI,
 			"statusCode": lw.statusCode,
 			"method":     r.Method,
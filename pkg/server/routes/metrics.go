@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec(
+		"nad_http_requests_total",
+		"Total number of HTTP requests, by method, route pattern and status code.",
+		"method", "route", "code",
+	)
+	httpRequestDuration = metrics.NewHistogramVec(
+		"nad_http_request_duration_seconds",
+		"Latency of HTTP requests, by method and route pattern.",
+		metrics.DefBuckets,
+		"method", "route",
+	)
+)
+
+// metricsMw is a middleware to record the count and the latency of the
+// requests to the route with the given pattern. The pattern is used instead of
+// the path so that the number of series does not grow with the number of notes.
+func metricsMw(next http.Handler, route string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		lw := logResponseWriter{w, http.StatusOK}
+		next.ServeHTTP(&lw, r)
+
+		httpRequests.Inc(r.Method, route, strconv.Itoa(lw.statusCode))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// metricsAuthMw requires the given bearer token to read the metrics, if the token is set
+func metricsAuthMw(next http.Handler, token string) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			credential := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(credential), []byte(token)) != 1 {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/server/metrics"
+)
+
+func TestMetricsMw(t *testing.T) {
+	h := metricsMw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), "/test/{id}")
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/1", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/2", nil))
+
+	var buf bytes.Buffer
+	if _, err := metrics.DefaultRegistry.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, strings.Contains(buf.String(), `nad_http_requests_total{method="GET",route="/test/{id}",code="418"} 2`), true, "request count mismatch")
+	assert.Equal(t, strings.Contains(buf.String(), `nad_http_request_duration_seconds_count{method="GET",route="/test/{id}"} 2`), true, "duration count mismatch")
+}
+
+func TestMetricsAuthMw(t *testing.T) {
+	testCases := []struct {
+		token         string
+		authorization string
+		expectedCode  int
+	}{
+		{token: "", authorization: "", expectedCode: http.StatusOK},
+		{token: "secret", authorization: "Bearer secret", expectedCode: http.StatusOK},
+		{token: "secret", authorization: "Bearer wrong", expectedCode: http.StatusUnauthorized},
+		{token: "secret", authorization: "", expectedCode: http.StatusUnauthorized},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			h := metricsAuthMw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), tc.token)
+
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, w.Code, tc.expectedCode, "status code mismatch")
+		})
+	}
+}
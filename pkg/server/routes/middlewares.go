@@ -8,29 +8,27 @@ import (
 	"github.com/nadproject/nad/pkg/server/models"
 )
 
-type middleware func(h http.Handler, c config.Config, s *models.Services, rateLimit bool) http.Handler
+type middleware func(h http.Handler, c config.Config, s *models.Services, l *limiter, g limitGroup) http.Handler
 
-func webMw(h http.Handler, c config.Config, s *models.Services, rateLimit bool) http.Handler {
+func webMw(h http.Handler, c config.Config, s *models.Services, l *limiter, g limitGroup) http.Handler {
 	csrfMw := csrf.Protect([]byte(c.CSRFAuthKey), csrf.Secure(c.IsProd()))
 
 	ret := h
+	if c.AppEnv != "TEST" {
+		ret = l.limitMw(ret, g)
+	}
 	ret = userMw(ret, s.Session, s.User)
 	ret = csrfMw(ret)
 
-	if rateLimit && c.AppEnv != "TEST" {
-		ret = limitMw(ret)
-	}
-
 	return ret
 }
 
-func apiMw(h http.Handler, c config.Config, s *models.Services, rateLimit bool) http.Handler {
+func apiMw(h http.Handler, c config.Config, s *models.Services, l *limiter, g limitGroup) http.Handler {
 	ret := h
-	ret = userMw(ret, s.Session, s.User)
-
-	if rateLimit && c.AppEnv != "TEST" {
-		ret = limitMw(ret)
+	if c.AppEnv != "TEST" {
+		ret = l.limitMw(ret, g)
 	}
+	ret = apiUserMw(ret, s.Session, s.User, s.AccessToken)
 
 	return ret
 }
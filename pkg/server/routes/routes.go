@@ -2,12 +2,17 @@ package routes
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/nadproject/nad/pkg/clock"
 	"github.com/nadproject/nad/pkg/server/config"
 	"github.com/nadproject/nad/pkg/server/controllers"
+	"github.com/nadproject/nad/pkg/server/mailer"
+	"github.com/nadproject/nad/pkg/server/metrics"
 	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/oidc"
+	"github.com/nadproject/nad/pkg/server/ratelimit"
 )
 
 // Route represents a single route
@@ -15,12 +20,13 @@ type Route struct {
 	Method    string
 	Pattern   string
 	Handler   http.Handler
-	RateLimit bool
+	RateLimit limitGroup
 }
 
-func registerRoutes(router *mux.Router, mw middleware, c config.Config, s *models.Services, routes []Route) {
+func registerRoutes(router *mux.Router, prefix string, mw middleware, c config.Config, s *models.Services, l *limiter, routes []Route) {
 	for _, route := range routes {
-		wrappedHandler := mw(route.Handler, c, s, route.RateLimit)
+		wrappedHandler := mw(route.Handler, c, s, l, route.RateLimit)
+		wrappedHandler = metricsMw(wrappedHandler, prefix+route.Pattern)
 
 		router.
 			Handle(route.Pattern, wrappedHandler).
@@ -28,54 +34,148 @@ func registerRoutes(router *mux.Router, mw middleware, c config.Config, s *model
 	}
 }
 
-// New creates and returns a new router
-func New(cfg config.Config, s *models.Services, cl clock.Clock) http.Handler {
+// New creates and returns a new router. The requests are rate limited with
+// the counts in the given store.
+func New(cfg config.Config, s *models.Services, store ratelimit.Store, cl clock.Clock) http.Handler {
 	router := mux.NewRouter().StrictSlash(true)
+	l := newLimiter(cfg.RateLimit, store, cl)
 
-	usersC := controllers.NewUsers(cfg, s.User, s.Session)
-	notesC := controllers.NewNotes(cfg, s.Note, s.User, cl, s.DB)
-	booksC := controllers.NewBooks(cfg, s.Book, s.User, s.Note, cl, s.DB)
+	m := mailer.New(cfg, &mailer.SimpleBackendImplementation{}, mailer.NewTemplates(nil))
+
+	usersC := controllers.NewUsers(cfg, s.User, s.Session, s.Token, s.RecoveryCode, s.AccessToken, m, cl, s.DB)
+	notesC := controllers.NewNotes(cfg, s.Note, s.NoteRevision, s.Tag, s.Book, s.User, cl, s.DB)
+	booksC := controllers.NewBooks(cfg, s.Book, s.User, s.Note, s.NoteRevision, cl, s.DB)
 	syncC := controllers.NewSync(s.Note, s.Book, cl)
+	accessTokensC := controllers.NewAccessTokens(cfg, s.AccessToken, cl)
+	sessionsC := controllers.NewSessions(cfg, s.Session)
+	exportsC := controllers.NewExports(s.Note, s.Book, cl)
 	staticC := controllers.NewStatic(cfg)
+	healthC := controllers.NewHealth(s.DB)
 
 	var webRoutes = []Route{
-		{"GET", "/", webRequireUserMw(http.HandlerFunc(notesC.Index), s.User), true},
-		{"GET", "/register", http.HandlerFunc(usersC.New), true},
-		{"POST", "/register", http.HandlerFunc(usersC.Create), true},
-		{"POST", "/logout", http.HandlerFunc(usersC.Logout), true},
-		{"GET", "/login", usersC.LoginView, true},
-		{"POST", "/login", http.HandlerFunc(usersC.Login), true},
+		{"GET", "/", webRequireTwoFactorMw(http.HandlerFunc(notesC.Index), cfg, s.User), limitDefault},
+		{"GET", "/register", http.HandlerFunc(usersC.New), limitDefault},
+		{"POST", "/register", http.HandlerFunc(usersC.Create), limitLogin},
+		{"POST", "/logout", http.HandlerFunc(usersC.Logout), limitDefault},
+		{"GET", "/login", http.HandlerFunc(usersC.LoginPage), limitDefault},
+		{"POST", "/login", http.HandlerFunc(usersC.Login), limitLogin},
+		{"POST", "/login/2fa", http.HandlerFunc(usersC.LoginTwoFactor), limitLogin},
+		{"GET", "/verify-email/{token}", http.HandlerFunc(usersC.VerifyEmail), limitLogin},
+		{"POST", "/verify-email", webRequireUserMw(http.HandlerFunc(usersC.ResendEmailVerification), s.User), limitWrite},
+		{"GET", "/password-reset", usersC.ForgotPwView, limitDefault},
+		{"POST", "/password-reset", http.HandlerFunc(usersC.RequestPwReset), limitLogin},
+		{"GET", "/password-reset/{token}", http.HandlerFunc(usersC.ResetPw), limitDefault},
+		{"POST", "/password-reset/{token}", http.HandlerFunc(usersC.CompletePwReset), limitLogin},
+		{"GET", "/tokens", webRequireTwoFactorMw(http.HandlerFunc(accessTokensC.Index), cfg, s.User), limitDefault},
+		{"POST", "/tokens", webRequireTwoFactorMw(http.HandlerFunc(accessTokensC.Create), cfg, s.User), limitWrite},
+		{"POST", "/tokens/{tokenID}/delete", webRequireTwoFactorMw(http.HandlerFunc(accessTokensC.Delete), cfg, s.User), limitWrite},
+		{"GET", "/sessions", webRequireTwoFactorMw(http.HandlerFunc(sessionsC.Index), cfg, s.User), limitDefault},
+		{"POST", "/sessions/{sessionID}/delete", webRequireTwoFactorMw(http.HandlerFunc(sessionsC.Delete), cfg, s.User), limitWrite},
+		{"GET", "/settings", webRequireUserMw(http.HandlerFunc(usersC.Settings), s.User), limitDefault},
+		{"POST", "/settings/password", webRequireUserMw(http.HandlerFunc(usersC.ChangePassword), s.User), limitLogin},
+		{"POST", "/settings/email", webRequireUserMw(http.HandlerFunc(usersC.ChangeEmail), s.User), limitLogin},
+		{"POST", "/settings/delete", webRequireUserMw(http.HandlerFunc(usersC.DeleteAccount), s.User), limitLogin},
+		{"GET", "/settings/2fa", webRequireUserMw(http.HandlerFunc(usersC.TwoFactor), s.User), limitDefault},
+		{"POST", "/settings/2fa", webRequireUserMw(http.HandlerFunc(usersC.SetupTwoFactor), s.User), limitWrite},
+		{"POST", "/settings/2fa/enable", webRequireUserMw(http.HandlerFunc(usersC.EnableTwoFactor), s.User), limitWrite},
+		{"POST", "/settings/2fa/disable", webRequireUserMw(http.HandlerFunc(usersC.DisableTwoFactor), s.User), limitWrite},
+		{"POST", "/settings/2fa/recovery-codes", webRequireUserMw(http.HandlerFunc(usersC.RegenerateRecoveryCodes), s.User), limitWrite},
+		{"GET", "/export", noWriteTimeoutMw(webRequireVerifiedUserMw(http.HandlerFunc(exportsC.Export), cfg, s.User)), limitDefault},
+		{"GET", "/search", webRequireVerifiedUserMw(http.HandlerFunc(notesC.Search), cfg, s.User), limitDefault},
+		{"GET", "/notes/new", webRequireVerifiedUserMw(http.HandlerFunc(notesC.New), cfg, s.User), limitDefault},
+		{"POST", "/notes", webRequireVerifiedUserMw(http.HandlerFunc(notesC.Create), cfg, s.User), limitWrite},
+		{"GET", "/notes/{noteUUID}", http.HandlerFunc(notesC.Show), limitDefault},
+		{"GET", "/notes/{noteUUID}/edit", webRequireVerifiedUserMw(http.HandlerFunc(notesC.Edit), cfg, s.User), limitDefault},
+		{"POST", "/notes/{noteUUID}", webRequireVerifiedUserMw(http.HandlerFunc(notesC.Update), cfg, s.User), limitWrite},
+		{"POST", "/notes/{noteUUID}/delete", webRequireVerifiedUserMw(http.HandlerFunc(notesC.Delete), cfg, s.User), limitWrite},
+		{"GET", "/books", webRequireVerifiedUserMw(http.HandlerFunc(booksC.Index), cfg, s.User), limitDefault},
+		{"POST", "/books", webRequireVerifiedUserMw(http.HandlerFunc(booksC.Create), cfg, s.User), limitWrite},
+		{"GET", "/books/{bookUUID}", webRequireVerifiedUserMw(http.HandlerFunc(booksC.Show), cfg, s.User), limitDefault},
+		{"POST", "/books/{bookUUID}", webRequireVerifiedUserMw(http.HandlerFunc(booksC.Update), cfg, s.User), limitWrite},
+		{"POST", "/books/{bookUUID}/delete", webRequireVerifiedUserMw(http.HandlerFunc(booksC.Delete), cfg, s.User), limitWrite},
 	}
 	var apiRoutes = []Route{
-		{"POST", "/v1/login", http.HandlerFunc(usersC.V1Login), true},
-		{"POST", "/v1/logout", http.HandlerFunc(usersC.V1Logout), true},
-
-		{"GET", "/v1/notes/{noteUUID}", apiRequireUserMw(http.HandlerFunc(notesC.V1Get), s.User), true},
-		{"POST", "/v1/notes", apiRequireUserMw(http.HandlerFunc(notesC.V1Create), s.User), true},
-		{"PATCH", "/v1/notes/{noteUUID}", apiRequireUserMw(http.HandlerFunc(notesC.V1Update), s.User), true},
-		{"DELETE", "/v1/notes/{noteUUID}", apiRequireUserMw(http.HandlerFunc(notesC.V1Delete), s.User), false},
-
-		{"GET", "/v1/books", apiRequireUserMw(http.HandlerFunc(booksC.V1Index), s.User), true},
-		{"GET", "/v1/books/{bookUUID}", apiRequireUserMw(http.HandlerFunc(booksC.V1Show), s.User), true},
-		{"POST", "/v1/books", apiRequireUserMw(http.HandlerFunc(booksC.V1Create), s.User), true},
-		{"PATCH", "/v1/books/{bookUUID}", apiRequireUserMw(http.HandlerFunc(booksC.V1Update), s.User), true},
-		{"DELETE", "/v1/books/{bookUUID}", apiRequireUserMw(http.HandlerFunc(booksC.V1Delete), s.User), false},
-
-		{"GET", "/v1/sync/state", apiRequireUserMw(http.HandlerFunc(syncC.GetState), s.User), false},
-		{"GET", "/v1/sync/fragment", apiRequireUserMw(http.HandlerFunc(syncC.GetFragment), s.User), false},
+		{"POST", "/v1/login", http.HandlerFunc(usersC.V1Login), limitLogin},
+		{"POST", "/v1/login/2fa", http.HandlerFunc(usersC.V1LoginTwoFactor), limitLogin},
+		{"POST", "/v1/logout", http.HandlerFunc(usersC.V1Logout), limitDefault},
+		{"POST", "/v1/password-reset", http.HandlerFunc(usersC.V1RequestPwReset), limitLogin},
+		{"PATCH", "/v1/password-reset", http.HandlerFunc(usersC.V1CompletePwReset), limitLogin},
+		{"PATCH", "/v1/verify-email", http.HandlerFunc(usersC.V1VerifyEmail), limitLogin},
+		{"POST", "/v1/verification-token", apiRequireUserMw(http.HandlerFunc(usersC.V1ResendEmailVerification), s.User), limitWrite},
+		{"GET", "/v1/encryption", apiRequireVerifiedUserMw(http.HandlerFunc(usersC.V1GetEncryption), cfg, s.User, models.ScopeSync), limitDefault},
+		{"PUT", "/v1/encryption", apiRequireVerifiedUserMw(http.HandlerFunc(usersC.V1SetEncryption), cfg, s.User), limitWrite},
+
+		{"PATCH", "/v1/account/password", apiRequireUserMw(http.HandlerFunc(usersC.V1ChangePassword), s.User), limitLogin},
+		{"PATCH", "/v1/account/email", apiRequireUserMw(http.HandlerFunc(usersC.V1ChangeEmail), s.User), limitLogin},
+		{"DELETE", "/v1/account", apiRequireUserMw(http.HandlerFunc(usersC.V1DeleteAccount), s.User), limitLogin},
+
+		{"GET", "/v1/2fa", apiRequireUserMw(http.HandlerFunc(usersC.V1GetTwoFactor), s.User), limitDefault},
+		{"POST", "/v1/2fa", apiRequireUserMw(http.HandlerFunc(usersC.V1SetupTwoFactor), s.User), limitWrite},
+		{"DELETE", "/v1/2fa", apiRequireUserMw(http.HandlerFunc(usersC.V1DisableTwoFactor), s.User), limitWrite},
+		{"POST", "/v1/2fa/enable", apiRequireUserMw(http.HandlerFunc(usersC.V1EnableTwoFactor), s.User), limitWrite},
+		{"POST", "/v1/2fa/recovery-codes", apiRequireUserMw(http.HandlerFunc(usersC.V1RegenerateRecoveryCodes), s.User), limitWrite},
+
+		{"GET", "/v1/tokens", apiRequireUserMw(http.HandlerFunc(accessTokensC.V1Index), s.User), limitDefault},
+		{"POST", "/v1/tokens", apiRequireUserMw(http.HandlerFunc(accessTokensC.V1Create), s.User), limitWrite},
+		{"DELETE", "/v1/tokens/{tokenID}", apiRequireUserMw(http.HandlerFunc(accessTokensC.V1Delete), s.User), limitWrite},
+
+		{"GET", "/v1/sessions", apiRequireUserMw(http.HandlerFunc(sessionsC.V1Index), s.User), limitDefault},
+		{"DELETE", "/v1/sessions", apiRequireUserMw(http.HandlerFunc(sessionsC.V1DeleteOthers), s.User), limitWrite},
+		{"DELETE", "/v1/sessions/{sessionID}", apiRequireUserMw(http.HandlerFunc(sessionsC.V1Delete), s.User), limitWrite},
+
+		{"GET", "/v1/notes", apiRequireVerifiedUserMw(http.HandlerFunc(notesC.V1Index), cfg, s.User, models.ScopeNotesRead, models.ScopeSync), limitDefault},
+		{"GET", "/v1/notes/{noteUUID}", apiRequireVerifiedUserMw(http.HandlerFunc(notesC.V1Get), cfg, s.User, models.ScopeNotesRead, models.ScopeSync), limitDefault},
+		{"GET", "/v1/notes/{noteUUID}/revisions", apiRequireVerifiedUserMw(http.HandlerFunc(notesC.V1Revisions), cfg, s.User, models.ScopeNotesRead, models.ScopeSync), limitDefault},
+		{"POST", "/v1/notes", apiRequireVerifiedUserMw(http.HandlerFunc(notesC.V1Create), cfg, s.User, models.ScopeNotesWrite, models.ScopeSync), limitWrite},
+		{"PATCH", "/v1/notes/{noteUUID}", apiRequireVerifiedUserMw(http.HandlerFunc(notesC.V1Update), cfg, s.User, models.ScopeNotesWrite, models.ScopeSync), limitWrite},
+		{"DELETE", "/v1/notes/{noteUUID}", apiRequireVerifiedUserMw(http.HandlerFunc(notesC.V1Delete), cfg, s.User, models.ScopeNotesWrite, models.ScopeSync), limitWrite},
+
+		{"GET", "/v1/books", apiRequireVerifiedUserMw(http.HandlerFunc(booksC.V1Index), cfg, s.User, models.ScopeNotesRead, models.ScopeSync), limitDefault},
+		{"GET", "/v1/books/{bookUUID}", apiRequireVerifiedUserMw(http.HandlerFunc(booksC.V1Show), cfg, s.User, models.ScopeNotesRead, models.ScopeSync), limitDefault},
+		{"POST", "/v1/books", apiRequireVerifiedUserMw(http.HandlerFunc(booksC.V1Create), cfg, s.User, models.ScopeNotesWrite, models.ScopeSync), limitWrite},
+		{"PATCH", "/v1/books/{bookUUID}", apiRequireVerifiedUserMw(http.HandlerFunc(booksC.V1Update), cfg, s.User, models.ScopeNotesWrite, models.ScopeSync), limitWrite},
+		{"DELETE", "/v1/books/{bookUUID}", apiRequireVerifiedUserMw(http.HandlerFunc(booksC.V1Delete), cfg, s.User, models.ScopeNotesWrite, models.ScopeSync), limitWrite},
+
+		{"GET", "/v1/export", noWriteTimeoutMw(apiRequireVerifiedUserMw(http.HandlerFunc(exportsC.V1Export), cfg, s.User, models.ScopeNotesRead)), limitDefault},
+
+		{"GET", "/v1/sync/state", apiRequireVerifiedUserMw(http.HandlerFunc(syncC.GetState), cfg, s.User, models.ScopeSync), limitSync},
+		{"GET", "/v1/sync/fragment", apiRequireVerifiedUserMw(http.HandlerFunc(syncC.GetFragment), cfg, s.User, models.ScopeSync), limitSync},
+	}
+
+	if cfg.OIDC.Enabled() {
+		p := oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  strings.TrimRight(cfg.WebURL, "/") + "/oidc/callback",
+		}, nil)
+		oidcC := controllers.NewOIDC(cfg, p, s.User, s.Session, s.Token, cl)
+
+		webRoutes = append(webRoutes,
+			Route{"GET", "/login/oidc", http.HandlerFunc(oidcC.Login), limitLogin},
+			Route{"GET", "/oidc/callback", http.HandlerFunc(oidcC.Callback), limitLogin},
+		)
+		apiRoutes = append(apiRoutes,
+			Route{"POST", "/v1/login/oidc", http.HandlerFunc(oidcC.V1Login), limitLogin},
+		)
 	}
 
+	// health checks and metrics are not rate limited so that probes and scrapes always succeed
+	router.HandleFunc("/healthz", healthC.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", healthC.Readyz).Methods("GET")
+	router.Handle("/metrics", metricsAuthMw(metrics.DefaultRegistry.Handler(), cfg.MetricsToken)).Methods("GET")
+
 	webRouter := router.PathPrefix("/").Subrouter()
 	apiRouter := router.PathPrefix("/api").Subrouter()
-	registerRoutes(webRouter, webMw, cfg, s, webRoutes)
-	registerRoutes(apiRouter, apiMw, cfg, s, apiRoutes)
+	registerRoutes(webRouter, "", webMw, cfg, s, l, webRoutes)
+	registerRoutes(apiRouter, "/api", apiMw, cfg, s, l, apiRoutes)
 
 	// static
 	staticHandler := http.StripPrefix("/static/", http.FileServer(http.Dir(cfg.StaticDir)))
-	router.PathPrefix("/static/").Handler(staticHandler)
+	router.PathPrefix("/static/").Handler(metricsMw(staticHandler, "/static/"))
 
 	// catch-all
-	router.PathPrefix("/").HandlerFunc(staticC.NotFound)
+	router.PathPrefix("/").Handler(metricsMw(http.HandlerFunc(staticC.NotFound), "notfound"))
 
-	return loggingMw(router)
+	return realIPMw(loggingMw(router), cfg.TrustedProxies)
 }
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/log"
+)
+
+// noWriteTimeoutMw exempts the request from the write timeout of the server,
+// for responses that can take longer to send, such as exports. It needs the
+// connection in the request context, and only applies to HTTP/1.x, as the
+// write timeout of HTTP/2 is applied to each stream.
+func noWriteTimeoutMw(inner http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := context.Conn(r.Context()); c != nil && r.ProtoMajor == 1 {
+			if err := c.SetWriteDeadline(time.Time{}); err != nil {
+				log.ErrorWrap(err, "clearing write deadline")
+			}
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/nadproject/nad/pkg/server/context"
+)
+
+func TestNoWriteTimeoutMw(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 1<<20)
+
+	// slow writes the response after the write timeout of the server has passed
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		w.Write(body)
+	})
+
+	testCases := []struct {
+		name        string
+		handler     http.Handler
+		expectedErr bool
+	}{
+		{
+			name:        "with write timeout",
+			handler:     slow,
+			expectedErr: true,
+		},
+		{
+			name:        "without write timeout",
+			handler:     noWriteTimeoutMw(slow),
+			expectedErr: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(tc.handler)
+			srv.Config.WriteTimeout = 50 * time.Millisecond
+			srv.Config.ConnContext = context.WithConn
+			srv.Start()
+			defer srv.Close()
+
+			var b []byte
+			res, err := http.Get(srv.URL)
+			if err == nil {
+				b, err = ioutil.ReadAll(res.Body)
+				res.Body.Close()
+			}
+
+			assert.Equal(t, err != nil, tc.expectedErr, fmt.Sprintf("error mismatch: %v", err))
+			if !tc.expectedErr {
+				assert.Equal(t, len(b), len(body), "body length mismatch")
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package routes
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/nadproject/nad/pkg/server/config"
 	"github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/controllers"
 	"github.com/nadproject/nad/pkg/server/log"
 	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/nadproject/nad/pkg/server/views"
 )
 
 func userMw(inner http.Handler, ss models.SessionService, us models.UserService) http.HandlerFunc {
@@ -23,6 +27,35 @@ func userMw(inner http.Handler, ss models.SessionService, us models.UserService)
 	})
 }
 
+// apiUserMw authenticates the request with either a session or an access token
+func apiUserMw(inner http.Handler, ss models.SessionService, us models.UserService, ats models.AccessTokenService) http.HandlerFunc {
+	sessionMw := userMw(inner, ss, us)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential, err := controllers.GetCredential(r)
+		if err != nil || !strings.HasPrefix(credential, models.AccessTokenPrefix) {
+			sessionMw.ServeHTTP(w, r)
+			return
+		}
+
+		user, token, err := AuthWithAccessToken(credential, ats, us)
+		if err != nil {
+			log.ErrorWrap(err, "authenticating with access token")
+			inner.ServeHTTP(w, r)
+			return
+		}
+		if user == nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		ctx = context.WithUser(ctx, user)
+		ctx = context.WithAccessToken(ctx, token)
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // webRequireUserMw redirects the request to the login page if user is not set
 func webRequireUserMw(inner http.Handler, us models.UserService) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -36,8 +69,48 @@ func webRequireUserMw(inner http.Handler, us models.UserService) http.HandlerFun
 	})
 }
 
-// apiRequireUserMw redirects the request to the login page if user is not set
-func apiRequireUserMw(inner http.Handler, us models.UserService) http.HandlerFunc {
+// webRequireTwoFactorMw redirects the request to the login page if user is not set, or
+// to the two-factor authentication settings if the server requires two-factor
+// authentication and the user has not enabled it
+func webRequireTwoFactorMw(inner http.Handler, c config.Config, us models.UserService) http.HandlerFunc {
+	return webRequireUserMw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.User(r.Context())
+		if c.RequireTwoFactor && !user.TOTPEnabled {
+			alert := views.Alert{
+				Level:   views.AlertLvlWarning,
+				Message: "This server requires two-factor authentication. Please set it up to continue.",
+			}
+			views.RedirectAlert(w, r, "/settings/2fa", http.StatusFound, alert)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	}), us)
+}
+
+// webRequireVerifiedUserMw is webRequireTwoFactorMw that also redirects the request to
+// the home page if the server requires email verification and the user has not verified
+// the email
+func webRequireVerifiedUserMw(inner http.Handler, c config.Config, us models.UserService) http.HandlerFunc {
+	return webRequireTwoFactorMw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.User(r.Context())
+		if c.RequireEmailVerification && !user.EmailVerified {
+			alert := views.Alert{
+				Level:   views.AlertLvlWarning,
+				Message: "Please verify your email address to continue.",
+			}
+			views.RedirectAlert(w, r, "/", http.StatusFound, alert)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	}), c, us)
+}
+
+// apiRequireUserMw responds with forbidden if user is not set. If the request was
+// authenticated with an access token, the token needs to have one of the given scopes.
+// Without any scopes, only the tokens with the admin scope are allowed.
+func apiRequireUserMw(inner http.Handler, us models.UserService, scopes ...string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := context.User(r.Context())
 		if user == nil {
@@ -45,6 +118,30 @@ func apiRequireUserMw(inner http.Handler, us models.UserService) http.HandlerFun
 			return
 		}
 
+		if token := context.AccessToken(r.Context()); token != nil && !token.HasScope(scopes...) {
+			http.Error(w, "The access token does not have the required scope", http.StatusForbidden)
+			return
+		}
+
 		inner.ServeHTTP(w, r)
 	})
 }
+
+// apiRequireVerifiedUserMw responds with forbidden if user is not set, if the
+// server requires a verified email and the email of the user is not verified, or
+// if the server requires two-factor authentication and the user has not enabled it
+func apiRequireVerifiedUserMw(inner http.Handler, c config.Config, us models.UserService, scopes ...string) http.HandlerFunc {
+	return apiRequireUserMw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.User(r.Context())
+		if c.RequireEmailVerification && !user.EmailVerified {
+			http.Error(w, "Email verification is required", http.StatusForbidden)
+			return
+		}
+		if c.RequireTwoFactor && !user.TOTPEnabled {
+			http.Error(w, "Two-factor authentication is required", http.StatusForbidden)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	}), us, scopes...)
+}
@@ -0,0 +1,149 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of NAD.
+ *
+ * NAD is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * NAD is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with NAD.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/config"
+	servercontext "github.com/nadproject/nad/pkg/server/context"
+	"github.com/nadproject/nad/pkg/server/tlscert"
+	"github.com/pkg/errors"
+)
+
+// certReloadInterval is the interval between checking the TLS certificate files for changes
+const certReloadInterval = time.Minute
+
+// listenUnix listens on the Unix socket at the given path. A socket left
+// behind by a previous process is removed first.
+func listenUnix(path string) (net.Listener, error) {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrap(err, "removing stale socket")
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "checking socket")
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "listening on socket")
+	}
+
+	// Allow a reverse proxy running as another user in the same group to connect
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, errors.Wrap(err, "setting socket permission")
+	}
+
+	return ln, nil
+}
+
+// listen listens on the Unix socket if configured, and on the port otherwise
+func listen(cfg config.Config) (net.Listener, error) {
+	if cfg.Server.UnixSocket != "" {
+		return listenUnix(cfg.Server.UnixSocket)
+	}
+
+	return net.Listen("tcp", fmt.Sprintf(":%s", cfg.Port))
+}
+
+// newServer returns a new server for the given handler. The connection of a
+// request is kept in its context, so that the routes for exports can lift
+// the write timeout.
+func newServer(cfg config.Config, h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:      h,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ConnContext:  servercontext.WithConn,
+	}
+}
+
+// serve serves the requests on the listener until SIGINT or SIGTERM is
+// received. It then stops accepting new connections and waits for the
+// requests in flight, such as syncs, to complete.
+func serve(cfg config.Config, srv *http.Server, ln net.Listener) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	if cfg.Server.TLSEnabled() {
+		r, err := tlscert.NewReloader(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		if err != nil {
+			return errors.Wrap(err, "loading TLS certificate")
+		}
+		go r.Watch(certReloadInterval, stop)
+
+		srv.TLSConfig = &tls.Config{
+			GetCertificate: r.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+
+		select {
+		case <-stop:
+			return
+		case sig := <-sigs:
+			log.Printf("received %s, waiting up to %s for requests to complete", sig, cfg.Server.ShutdownTimeout)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("shutting down: %s", err.Error())
+		}
+	}()
+
+	var err error
+	if cfg.Server.TLSEnabled() {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	<-shutdownDone
+
+	return nil
+}
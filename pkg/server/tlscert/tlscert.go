@@ -0,0 +1,130 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package tlscert provides TLS certificates that are reloaded when the files
+// change, so that renewed certificates are served without a restart.
+package tlscert
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/log"
+	"github.com/pkg/errors"
+)
+
+// Reloader holds a certificate loaded from a pair of certificate and key files
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mtx         sync.RWMutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// NewReloader loads the certificate from the given files and returns a Reloader
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "reading %s", path)
+	}
+
+	return info.ModTime(), nil
+}
+
+// reload loads the certificate again if either of the files has been modified
+// since it was last loaded. It returns whether the certificate was reloaded.
+func (r *Reloader) reload() (bool, error) {
+	certModTime, err := modTime(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyModTime, err := modTime(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mtx.RLock()
+	unchanged := r.cert != nil && certModTime.Equal(r.certModTime) && keyModTime.Equal(r.keyModTime)
+	r.mtx.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	// If only one of the files has been replaced so far, the pair does not
+	// match and the previous certificate is kept until the next attempt.
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, errors.Wrap(err, "loading certificate")
+	}
+
+	r.mtx.Lock()
+	r.cert = &cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	r.mtx.Unlock()
+
+	return true, nil
+}
+
+// GetCertificate returns the current certificate. It is used as
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.cert, nil
+}
+
+// Watch checks the files for changes at the given interval and reloads the
+// certificate, until the stop channel is closed.
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				log.ErrorWrap(err, "reloading TLS certificate")
+			} else if reloaded {
+				log.Info("reloaded TLS certificate")
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+// writeCert writes a self-signed certificate for the given common name and its
+// key to the files, with the given modification time.
+func writeCert(t *testing.T, certFile, keyFile, commonName string, mtime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generating key"))
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating certificate"))
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling key"))
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "writing certificate"))
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "writing key"))
+	}
+
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, mtime, mtime); err != nil {
+			t.Fatal(errors.Wrap(err, "setting modification time"))
+		}
+	}
+}
+
+func getCommonName(t *testing.T, r *Reloader) string {
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting certificate"))
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "parsing certificate"))
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nad-tlscert")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	mtime := time.Now().Add(-time.Hour)
+	writeCert(t, certFile, keyFile, "first", mtime)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating reloader"))
+	}
+	assert.Equal(t, getCommonName(t, r), "first", "initial certificate mismatch")
+
+	t.Run("unchanged", func(t *testing.T) {
+		reloaded, err := r.reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, reloaded, false, "reloaded mismatch")
+		assert.Equal(t, getCommonName(t, r), "first", "certificate mismatch")
+	})
+
+	t.Run("mismatched pair", func(t *testing.T) {
+		if err := ioutil.WriteFile(keyFile, []byte("invalid"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := r.reload()
+
+		assert.NotEqual(t, err, nil, "error mismatch")
+		assert.Equal(t, getCommonName(t, r), "first", "certificate mismatch")
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		writeCert(t, certFile, keyFile, "second", mtime.Add(time.Minute))
+
+		reloaded, err := r.reload()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, reloaded, true, "reloaded mismatch")
+		assert.Equal(t, getCommonName(t, r), "second", "certificate mismatch")
+	})
+}
@@ -0,0 +1,156 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package totp implements time-based one-time passwords as specified by
+// RFC 6238, compatible with authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nadproject/nad/pkg/server/crypt"
+	"github.com/pkg/errors"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// Period is the number of seconds for which a code is valid
+	Period = 30
+	// Digits is the number of digits in a code
+	Digits = 6
+	// Skew is the number of periods before and after the current one whose
+	// codes are accepted, to allow for clock drift
+	Skew = 1
+
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret encoded in base32
+func GenerateSecret() (string, error) {
+	b, err := crypt.RandomBytes(secretSize)
+	if err != nil {
+		return "", errors.Wrap(err, "generating random bytes")
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// Step returns the time step that the given time belongs to
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	s = strings.TrimRight(s, "=")
+
+	return encoding.DecodeString(s)
+}
+
+func codeAt(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	var mod uint32 = 1
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
+
+// Code returns the code for the given secret at the given time
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", errors.Wrap(err, "decoding secret")
+	}
+
+	return codeAt(key, Step(t)), nil
+}
+
+// Validate checks the given code against the given secret at the given time.
+// If the code is valid, it returns the time step of the code so that callers
+// can refuse the reuse of the same code.
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	code = strings.Replace(strings.TrimSpace(code), " ", "", -1)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if hmac.Equal([]byte(codeAt(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// ProvisioningURI returns the otpauth URI that authenticator apps read from a
+// QR code to enroll the given secret.
+func ProvisioningURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprintf("%d", Digits))
+	q.Set("period", fmt.Sprintf("%d", Period))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+
+	return u.String()
+}
+
+// QRCode returns a PNG image of a QR code of the given provisioning URI, with
+// the given width and height in pixels.
+func QRCode(uri string, size int) ([]byte, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding QR code")
+	}
+
+	return png, nil
+}
@@ -0,0 +1,137 @@
+/* Copyright (C) 2019 Monomax Software Pty Ltd
+ *
+ * This file is part of nad.
+ *
+ * nad is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * nad is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with nad.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package totp
+
+import (
+	"bytes"
+	"encoding/base32"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadproject/nad/pkg/assert"
+	"github.com/pkg/errors"
+)
+
+// rfcSecret is the secret used by the test vectors in RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	testCases := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1111111111, expected: "050471"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			result, err := Code(rfcSecret, time.Unix(tc.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, result, tc.expected, "code mismatch")
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	testCases := []struct {
+		code         string
+		expectedOK   bool
+		expectedStep int64
+	}{
+		{code: "081804", expectedOK: true, expectedStep: Step(now)},
+		{code: " 081 804 ", expectedOK: true, expectedStep: Step(now)},
+		// the code of the previous period
+		{code: mustCode(t, now.Add(-Period*time.Second)), expectedOK: true, expectedStep: Step(now) - 1},
+		// the code of the next period
+		{code: mustCode(t, now.Add(Period*time.Second)), expectedOK: true, expectedStep: Step(now) + 1},
+		// the code from two periods ago
+		{code: mustCode(t, now.Add(-2*Period*time.Second)), expectedOK: false},
+		{code: "000000", expectedOK: false},
+		{code: "08180", expectedOK: false},
+		{code: "", expectedOK: false},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", idx), func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tc.code, now)
+
+			assert.Equal(t, ok, tc.expectedOK, "ok mismatch")
+			assert.Equal(t, step, tc.expectedStep, "step mismatch")
+		})
+	}
+}
+
+func mustCode(t *testing.T, at time.Time) string {
+	code, err := Code(rfcSecret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(key), secretSize, "key size mismatch")
+}
+
+func TestProvisioningURI(t *testing.T) {
+	result := ProvisioningURI("nad", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	assert.Equal(t, strings.HasPrefix(result, "otpauth://totp/nad:alice@example.com?"), true, "prefix mismatch")
+	assert.Equal(t, strings.Contains(result, "secret=JBSWY3DPEHPK3PXP"), true, "secret mismatch")
+	assert.Equal(t, strings.Contains(result, "issuer=nad"), true, "issuer mismatch")
+}
+
+func TestQRCode(t *testing.T) {
+	uri := ProvisioningURI("nad", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	result, err := QRCode(uri, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(result))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the image"))
+	}
+
+	assert.Equal(t, img.Bounds().Dx(), 256, "width mismatch")
+	assert.Equal(t, img.Bounds().Dy(), 256, "height mismatch")
+}
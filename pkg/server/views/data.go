@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/nadproject/nad/pkg/server/models"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -46,7 +47,7 @@ func getErrMessage(err error) string {
 
 // SetAlert sets alert in the given data for given error.
 func (d *Data) SetAlert(err error) {
-	if pErr, ok := err.(PublicError); ok {
+	if pErr, ok := errors.Cause(err).(PublicError); ok {
 		d.Alert = &Alert{
 			Level:   AlertLvlError,
 			Message: pErr.Public(),
@@ -143,6 +144,12 @@ type ConflictError interface {
 	IsConflictError() bool
 }
 
+// TooManyRequestsError is an error for a request made too frequently
+type TooManyRequestsError interface {
+	error
+	IsTooManyRequestsError() bool
+}
+
 // NotFoundError is an error for bad request
 type NotFoundError interface {
 	error
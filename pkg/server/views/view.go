@@ -13,6 +13,7 @@ import (
 	"github.com/nadproject/nad/pkg/server/buildinfo"
 	"github.com/nadproject/nad/pkg/server/context"
 	"github.com/nadproject/nad/pkg/server/log"
+	"github.com/nadproject/nad/pkg/server/markdown"
 	"github.com/pkg/errors"
 )
 
@@ -63,6 +64,7 @@ func NewView(baseDir string, c Config, files ...string) *View {
 		"headerTemplate": func() string {
 			return c.HeaderTemplate
 		},
+		"markdown": markdown.Render,
 	}).ParseFiles(files...)
 	if err != nil {
 		panic(errors.Wrap(err, "instantiating view."))
@@ -44,10 +44,13 @@ build() {
   moduleName="github.com/nadproject/nad"
   ldflags="-X '$moduleName/pkg/server/build.CSSFiles=$cssFilename' -X '$moduleName/pkg/server/build.JSFiles=nad.js' -X '$moduleName/pkg/server/build.Version=$version' "
 
+  # cgo is required for SQLite, and the fts5 tag for its full-text search
+  CGO_ENABLED=1 \
   GOOS="$platform" \
   GOARCH="$arch" go build \
     -o "$destDir/nad-server" \
     -ldflags "$ldflags" \
+    --tags "fts5" \
     "$basedir"/*.go
 
   popd
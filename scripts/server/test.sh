@@ -10,7 +10,7 @@ pushd "$dir/../../pkg/server"
 
 function run_test {
   # go test ./... -cover -p 1 
-  go test ./controllers -cover -p 1 
+  go test ./controllers -cover -p 1 --tags "fts5"
 }
 
 if [ "${WATCH-false}" == true ]; then